@@ -2,6 +2,7 @@ package main
 
 import (
 	"log"
+	"os"
 
 	"github.com/idoyudha/eshop-cart/config"
 	"github.com/idoyudha/eshop-cart/internal/app"
@@ -13,5 +14,11 @@ func main() {
 		log.Fatal(err)
 	}
 
+	// maintenance commands, e.g. `app migrate-redis-keys`
+	if len(os.Args) > 1 {
+		app.RunCommand(cfg, os.Args[1], os.Args[2:])
+		return
+	}
+
 	app.Run(cfg)
 }
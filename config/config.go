@@ -1,6 +1,10 @@
 package config
 
-import "github.com/ilyakaznacheev/cleanenv"
+import (
+	"time"
+
+	"github.com/ilyakaznacheev/cleanenv"
+)
 
 type (
 	Config struct {
@@ -12,6 +16,17 @@ type (
 		AuthService
 		Kafka
 		OrderService
+		ProductService
+		InventoryService
+		Outbox
+		Reconcile
+		Idempotency
+		GuestCart
+		CartRules
+		Retention
+		AbandonedCart
+		CartSnapshot
+		Checkout
 	}
 
 	App struct {
@@ -21,6 +36,8 @@ type (
 
 	HTTP struct {
 		Port string `env-required:"true" yaml:"port" env:"HTTP_PORT"`
+		// serves /debug/vars, keep it off the public network. Empty disables the admin listener
+		AdminPort string `yaml:"admin_port" env:"HTTP_ADMIN_PORT"`
 	}
 
 	MySQL struct {
@@ -32,9 +49,10 @@ type (
 
 	Redis struct {
 		// RedisURL           string `env-required:"true" env:"REDIS_URL"`
-		RedisMaster        string `env-required:"true" env:"REDIS_MASTER"`
-		RedisSentinelAddrs string `env-required:"true" env:"REDIS_SENTINEL_ADDRS"`
-		RedisPassword      string `env-required:"true" env:"REDIS_PASSWORD"`
+		RedisMaster        string        `env-required:"true" env:"REDIS_MASTER"`
+		RedisSentinelAddrs string        `env-required:"true" env:"REDIS_SENTINEL_ADDRS"`
+		RedisPassword      string        `env-required:"true" env:"REDIS_PASSWORD"`
+		CartTTL            time.Duration `env:"REDIS_CART_TTL" env-default:"168h"`
 	}
 
 	Log struct {
@@ -51,6 +69,96 @@ type (
 
 	OrderService struct {
 		BaseURL string `env-required:"true" env:"ORDER_SERVICE"`
+		// authenticates the lookups of the checkout recovery, they run without a shopper token
+		ServiceToken string `env-required:"true" env:"ORDER_SERVICE_TOKEN"`
+		// bounds each attempt, a retry gets its own timeout
+		Timeout time.Duration `env:"ORDER_SERVICE_TIMEOUT" env-default:"5s"`
+		// retries of an unreachable or overloaded service, the backoff doubles after each of them
+		MaxRetries   int           `env:"ORDER_SERVICE_MAX_RETRIES" env-default:"2"`
+		RetryBackoff time.Duration `env:"ORDER_SERVICE_RETRY_BACKOFF" env-default:"200ms"`
+		// failures in a row that open the circuit, a zero threshold disables it
+		BreakerThreshold int           `env:"ORDER_SERVICE_BREAKER_THRESHOLD" env-default:"5"`
+		BreakerCooldown  time.Duration `env:"ORDER_SERVICE_BREAKER_COOLDOWN" env-default:"30s"`
+	}
+
+	ProductService struct {
+		BaseURL string        `env-required:"true" env:"PRODUCT_SERVICE"`
+		Timeout time.Duration `env:"PRODUCT_SERVICE_TIMEOUT" env-default:"5s"`
+	}
+
+	InventoryService struct {
+		BaseURL string        `env-required:"true" env:"INVENTORY_SERVICE"`
+		Timeout time.Duration `env:"INVENTORY_SERVICE_TIMEOUT" env-default:"5s"`
+		// how long stock stays reserved for a checkout, keep it above CHECKOUT_STUCK_AFTER
+		ReservationTTL time.Duration `env:"INVENTORY_RESERVATION_TTL" env-default:"15m"`
+		// expired reservations of checkouts without order are released every interval
+		SweepInterval  time.Duration `env:"INVENTORY_SWEEP_INTERVAL" env-default:"1m"`
+		SweepBatchSize int           `env:"INVENTORY_SWEEP_BATCH_SIZE" env-default:"100"`
+	}
+
+	Outbox struct {
+		RelayInterval time.Duration `env:"OUTBOX_RELAY_INTERVAL" env-default:"5s"`
+		BatchSize     int           `env:"OUTBOX_BATCH_SIZE" env-default:"100"`
+		Retention     time.Duration `env:"OUTBOX_RETENTION" env-default:"24h"`
+	}
+
+	Reconcile struct {
+		Interval  time.Duration `env:"RECONCILE_INTERVAL" env-default:"1h"`
+		Repair    bool          `env:"RECONCILE_REPAIR" env-default:"false"`
+		BatchSize int           `env:"RECONCILE_BATCH_SIZE" env-default:"500"`
+	}
+
+	Idempotency struct {
+		// how long a completed response is replayed
+		TTL time.Duration `env:"IDEMPOTENCY_TTL" env-default:"24h"`
+		// how long a key stays reserved by a request that never completes
+		LockTimeout time.Duration `env:"IDEMPOTENCY_LOCK_TIMEOUT" env-default:"1m"`
+	}
+
+	GuestCart struct {
+		TokenSecret string        `env-required:"true" env:"GUEST_CART_TOKEN_SECRET"`
+		TTL         time.Duration `env:"GUEST_CART_TTL" env-default:"72h"`
+		// sum, max or guest, see entity.CartMergeRuleSum
+		MergeRule string `env:"GUEST_CART_MERGE_RULE" env-default:"sum"`
+		// guest carts a client ip may open per window on each instance, a zero limit disables it
+		CreateLimit  int           `env:"GUEST_CART_CREATE_LIMIT" env-default:"10"`
+		CreateWindow time.Duration `env:"GUEST_CART_CREATE_WINDOW" env-default:"1m"`
+	}
+
+	// business rules of a cart, a zero maximum is not enforced
+	CartRules struct {
+		MinQuantity   int64 `env:"CART_MIN_QUANTITY" env-default:"1"`
+		MaxQuantity   int64 `env:"CART_MAX_QUANTITY" env-default:"99"`
+		MaxLines      int   `env:"CART_MAX_LINES" env-default:"50"`
+		MaxNoteLength int   `env:"CART_MAX_NOTE_LENGTH" env-default:"255"`
+	}
+
+	Retention struct {
+		// soft deleted cart lines older than this are purged, keep it longer than any restore window
+		Period    time.Duration `env:"RETENTION_PERIOD" env-default:"720h"`
+		Interval  time.Duration `env:"RETENTION_INTERVAL" env-default:"1h"`
+		BatchSize int           `env:"RETENTION_BATCH_SIZE" env-default:"500"`
+		// copy purged lines to cart_items_archive instead of only deleting them
+		Archive bool `env:"RETENTION_ARCHIVE" env-default:"false"`
+	}
+
+	AbandonedCart struct {
+		// a cart is abandoned when its newest line is older than this
+		Threshold time.Duration `env:"ABANDONED_CART_THRESHOLD" env-default:"24h"`
+		Interval  time.Duration `env:"ABANDONED_CART_INTERVAL" env-default:"15m"`
+		BatchSize int           `env:"ABANDONED_CART_BATCH_SIZE" env-default:"100"`
+	}
+
+	CartSnapshot struct {
+		// how long a shared cart snapshot can be read and imported
+		TTL time.Duration `env:"CART_SNAPSHOT_TTL" env-default:"168h"`
+	}
+
+	Checkout struct {
+		// a checkout unchanged for this long is resumed by the recovery, keep it above the order request time with all its retries
+		StuckAfter       time.Duration `env:"CHECKOUT_STUCK_AFTER" env-default:"10m"`
+		RecoveryInterval time.Duration `env:"CHECKOUT_RECOVERY_INTERVAL" env-default:"1m"`
+		BatchSize        int           `env:"CHECKOUT_RECOVERY_BATCH_SIZE" env-default:"100"`
 	}
 )
 
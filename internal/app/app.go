@@ -1,6 +1,7 @@
 package app
 
 import (
+	"context"
 	"os"
 	"os/signal"
 	"syscall"
@@ -9,8 +10,10 @@ import (
 	"github.com/idoyudha/eshop-cart/config"
 	v1Http "github.com/idoyudha/eshop-cart/internal/controller/http/v1"
 	kafkaEvent "github.com/idoyudha/eshop-cart/internal/controller/kafka"
+	"github.com/idoyudha/eshop-cart/internal/entity"
 	"github.com/idoyudha/eshop-cart/internal/usecase"
 	"github.com/idoyudha/eshop-cart/internal/usecase/repo"
+	"github.com/idoyudha/eshop-cart/internal/usecase/webapi"
 	"github.com/idoyudha/eshop-cart/pkg/httpserver"
 	"github.com/idoyudha/eshop-cart/pkg/kafka"
 	"github.com/idoyudha/eshop-cart/pkg/logger"
@@ -21,12 +24,27 @@ import (
 func Run(cfg *config.Config) {
 	l := logger.New(cfg.Log.Level)
 
+	if !entity.IsCartMergeRule(cfg.GuestCart.MergeRule) {
+		l.Fatal("app - Run - unknown guest cart merge rule: %s", cfg.GuestCart.MergeRule)
+	}
+
+	// a snapshot without expiry would never leave redis
+	if cfg.CartSnapshot.TTL <= 0 {
+		l.Fatal("app - Run - cart snapshot ttl must be positive: %s", cfg.CartSnapshot.TTL)
+	}
+
 	kafkaConsumer, err := kafka.NewKafkaConsumer(cfg.Kafka)
 	if err != nil {
 		l.Fatal("app - Run - kafka.NewKafkaConsumer: ", err)
 	}
 	defer kafkaConsumer.Close()
 
+	kafkaProducer, err := kafka.NewKafkaProducer(cfg.Kafka)
+	if err != nil {
+		l.Fatal("app - Run - kafka.NewKafkaProducer: ", err)
+	}
+	defer kafkaProducer.Close()
+
 	mySQL, err := mysql.NewMySQL(cfg.MySQL)
 	if err != nil {
 		l.Fatal("app - Run - mysql.NewMySQL: ", err)
@@ -37,17 +55,75 @@ func Run(cfg *config.Config) {
 		l.Fatal("app - Run - redis.NewRedis: ", err)
 	}
 
+	cartRedisRepo := repo.NewCartRedisRepo(redisClient, cfg.Redis.CartTTL)
+	cartMySQLRepo := repo.NewCartMySQLRepo(mySQL)
+	outboxMySQLRepo := repo.NewOutboxMySQLRepo(mySQL)
+	idempotencyRedisRepo := repo.NewIdempotencyRedisRepo(redisClient)
+	abandonedCartMySQLRepo := repo.NewAbandonedCartMySQLRepo(mySQL)
+	cartEventKafkaRepo := repo.NewCartEventKafkaRepo(kafkaProducer)
+	cartEventMySQLRepo := repo.NewCartEventMySQLRepo(mySQL)
+	cartSnapshotRedisRepo := repo.NewCartSnapshotRedisRepo(redisClient)
+	checkoutMySQLRepo := repo.NewCheckoutMySQLRepo(mySQL)
+
+	outboxRelay := usecase.NewOutboxRelayUseCase(
+		outboxMySQLRepo,
+		cartMySQLRepo,
+		cartRedisRepo,
+		cartEventKafkaRepo,
+		cfg.Outbox,
+		l,
+	)
+
 	cartUseCase := usecase.NewCartUseCase(
-		repo.NewCartRedisRepo(redisClient),
-		repo.NewCartMySQLRepo(mySQL),
-		cfg.OrderService,
+		cartRedisRepo,
+		cartMySQLRepo,
+		outboxMySQLRepo,
+		cartEventMySQLRepo,
+		checkoutMySQLRepo,
+		outboxRelay,
+		webapi.NewOrderWebAPI(cfg.OrderService),
+		webapi.NewProductWebAPI(cfg.ProductService),
+		webapi.NewInventoryWebAPI(cfg.InventoryService),
+		cfg.GuestCart,
+		cfg.CartRules,
 	)
 
+	cartSnapshotUseCase := usecase.NewCartSnapshotUseCase(cartSnapshotRedisRepo, cartUseCase, cfg.CartSnapshot)
+	idempotencyUseCase := usecase.NewIdempotencyUseCase(idempotencyRedisRepo, cfg.Idempotency)
+
+	// Background workers
+	workerCtx, cancelWorkers := context.WithCancel(context.Background())
+	defer cancelWorkers()
+
+	go outboxRelay.Run(workerCtx)
+	go usecase.NewReconcileUseCase(cartMySQLRepo, cartRedisRepo, cfg.Reconcile, l).Run(workerCtx)
+	go usecase.NewRetentionUseCase(cartMySQLRepo, cfg.Retention, l).Run(workerCtx)
+	go usecase.NewAbandonedCartUseCase(
+		abandonedCartMySQLRepo,
+		cartMySQLRepo,
+		outboxMySQLRepo,
+		outboxRelay,
+		cfg.AbandonedCart,
+		l,
+	).Run(workerCtx)
+	go usecase.NewCheckoutRecoveryUseCase(checkoutMySQLRepo, cartUseCase, cfg.Checkout, l).Run(workerCtx)
+	go usecase.NewReservationSweeperUseCase(checkoutMySQLRepo, cartUseCase, cfg.InventoryService, l).Run(workerCtx)
+
 	// HTTP Server
 	handler := gin.Default()
-	v1Http.NewRouter(handler, cartUseCase, l, cfg.AuthService)
+	v1Http.NewRouter(handler, cartUseCase, cartSnapshotUseCase, idempotencyUseCase, l, cfg.AuthService, cfg.GuestCart)
 	httpServer := httpserver.New(handler, httpserver.Port(cfg.HTTP.Port))
 
+	// Admin HTTP Server
+	var adminServer *httpserver.Server
+	var adminNotify <-chan error
+	if cfg.HTTP.AdminPort != "" {
+		adminHandler := gin.New()
+		v1Http.NewAdminRouter(adminHandler)
+		adminServer = httpserver.New(adminHandler, httpserver.Port(cfg.HTTP.AdminPort))
+		adminNotify = adminServer.Notify()
+	}
+
 	// Kafka Consumer
 	kafkaErrChan := make(chan error, 1)
 	go func() {
@@ -64,6 +140,8 @@ func Run(cfg *config.Config) {
 		l.Info("app - Run - signal: %s", s.String())
 	case err = <-httpServer.Notify():
 		l.Error("app - Run - httpServer.Notify: ", err)
+	case err = <-adminNotify:
+		l.Error("app - Run - adminServer.Notify: ", err)
 	}
 
 	// Shutdown
@@ -71,4 +149,10 @@ func Run(cfg *config.Config) {
 	if err != nil {
 		l.Info("app - Run - httpServer.Shutdown: %s", err)
 	}
+
+	if adminServer != nil {
+		if err = adminServer.Shutdown(); err != nil {
+			l.Info("app - Run - adminServer.Shutdown: %s", err)
+		}
+	}
 }
@@ -0,0 +1,73 @@
+package app
+
+import (
+	"context"
+	"flag"
+
+	"github.com/idoyudha/eshop-cart/config"
+	"github.com/idoyudha/eshop-cart/internal/usecase"
+	"github.com/idoyudha/eshop-cart/internal/usecase/repo"
+	"github.com/idoyudha/eshop-cart/pkg/logger"
+	"github.com/idoyudha/eshop-cart/pkg/mysql"
+	"github.com/idoyudha/eshop-cart/pkg/redis"
+)
+
+const (
+	CommandMigrateRedisKeys    = "migrate-redis-keys"
+	CommandRebuildProductIndex = "rebuild-product-index"
+	CommandReconcile           = "reconcile"
+	CommandPurgeDeleted        = "purge-deleted"
+)
+
+// RunCommand executes a one-shot maintenance command instead of serving traffic.
+func RunCommand(cfg *config.Config, name string, args []string) {
+	l := logger.New(cfg.Log.Level)
+
+	mySQL, err := mysql.NewMySQL(cfg.MySQL)
+	if err != nil {
+		l.Fatal("app - RunCommand - mysql.NewMySQL: ", err)
+	}
+
+	redisClient, err := redis.NewRedis(cfg.Redis)
+	if err != nil {
+		l.Fatal("app - RunCommand - redis.NewRedis: ", err)
+	}
+
+	cartRedisRepo := repo.NewCartRedisRepo(redisClient, cfg.Redis.CartTTL)
+	cartMySQLRepo := repo.NewCartMySQLRepo(mySQL)
+
+	maintenanceUseCase := usecase.NewMaintenanceUseCase(
+		cartRedisRepo,
+		cartMySQLRepo,
+		l,
+	)
+
+	ctx := context.Background()
+
+	switch name {
+	case CommandMigrateRedisKeys:
+		err = maintenanceUseCase.MigrateRedisCartKeys(ctx)
+	case CommandRebuildProductIndex:
+		err = maintenanceUseCase.RebuildProductIndex(ctx)
+	case CommandReconcile:
+		flags := flag.NewFlagSet(CommandReconcile, flag.ExitOnError)
+		repair := flags.Bool("repair", false, "rewrite drifted carts in redis from mysql")
+		_ = flags.Parse(args)
+
+		reconcileUseCase := usecase.NewReconcileUseCase(cartMySQLRepo, cartRedisRepo, cfg.Reconcile, l)
+		_, err = reconcileUseCase.Reconcile(ctx, *repair)
+	case CommandPurgeDeleted:
+		flags := flag.NewFlagSet(CommandPurgeDeleted, flag.ExitOnError)
+		archive := flags.Bool("archive", cfg.Retention.Archive, "copy purged lines to cart_items_archive")
+		_ = flags.Parse(args)
+
+		retentionUseCase := usecase.NewRetentionUseCase(cartMySQLRepo, cfg.Retention, l)
+		_, err = retentionUseCase.Purge(ctx, *archive)
+	default:
+		l.Fatal("app - RunCommand - unknown command: %s", name)
+	}
+
+	if err != nil {
+		l.Fatal("app - RunCommand - %s: %s", name, err)
+	}
+}
@@ -0,0 +1,77 @@
+package v1
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/idoyudha/eshop-cart/internal/entity"
+	"github.com/idoyudha/eshop-cart/internal/usecase"
+)
+
+const (
+	batchModeAllOrNothing = "all_or_nothing"
+	batchModeBestEffort   = "best_effort"
+
+	batchItemStatusAdded  = "added"
+	batchItemStatusFailed = "failed"
+)
+
+type createCartsRequest struct {
+	Mode  string              `json:"mode" binding:"omitempty,oneof=all_or_nothing best_effort"`
+	Items []createCartRequest `json:"items" binding:"required,min=1,max=50,dive"`
+}
+
+type createCartsItemResponse struct {
+	Index  int                 `json:"index"`
+	Status string              `json:"status"`
+	Item   *createCartResponse `json:"item,omitempty"`
+	Error  *errorMessage       `json:"error,omitempty"`
+}
+
+// add several items at once. all_or_nothing, the default, adds every item or none and answers 422 naming the failed items,
+// best_effort adds the valid items and reports the status of each one with 207 when some failed, or 422 when all failed
+func (r *cartRoutes) createCarts(ctx *gin.Context) {
+	var req createCartsRequest
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		r.l.Error(err, "http - v1 - cartRoutes - createCarts")
+		ctx.JSON(http.StatusBadRequest, newBadRequestError(err.Error()))
+		return
+	}
+
+	userID, exist := ctx.Get(UserIDKey)
+	if !exist {
+		r.l.Error("not exist", "http - v1 - cartRoutes - createCarts")
+		ctx.JSON(http.StatusInternalServerError, newInternalServerError("user id not exist"))
+		return
+	}
+
+	items := make([]*entity.CartItem, len(req.Items))
+	for i, itemReq := range req.Items {
+		itemEntity := createCartRequestToCartItemEntity(userID.(uuid.UUID), itemReq)
+		items[i] = &itemEntity
+	}
+
+	results, err := r.uc.CreateCarts(ctx.Request.Context(), userID.(uuid.UUID), selectedCartID(ctx), items, req.Mode != batchModeBestEffort)
+	if err != nil {
+		r.l.Error(err, "http - v1 - cartRoutes - createCarts")
+		writeUseCaseError(ctx, err)
+		return
+	}
+
+	writeBatchResults(ctx, results)
+}
+
+// writeBatchResults answers 201 when every item was added and 207 when some failed,
+// a batch where none was added fails in the usecase and is answered 422 by writeUseCaseError
+func writeBatchResults(ctx *gin.Context, results []usecase.CartBatchResult) {
+	response := cartBatchResultsToCreateCartsItemResponse(results)
+	for _, result := range results {
+		if result.Err != nil {
+			ctx.JSON(http.StatusMultiStatus, newPartialCreateSuccess(response))
+			return
+		}
+	}
+
+	ctx.JSON(http.StatusCreated, newCreateSuccess(response))
+}
@@ -0,0 +1,81 @@
+package v1
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"github.com/idoyudha/eshop-cart/internal/entity"
+	"github.com/idoyudha/eshop-cart/internal/usecase"
+	"github.com/idoyudha/eshop-cart/pkg/logger"
+)
+
+func TestCreateCartsRequest(t *testing.T) {
+	const mug = `{"product_id":"4f0c2ab2-9d34-4c6a-9d5e-0c1b7a9e6f11","product_name":"mug","product_price_amount":1999,"currency":"USD","product_quantity":1}`
+	const plate = `{"product_id":"7a3f6a8e-1d2b-4b8e-a1c4-5e9f0d2c3b44","product_name":"plate","product_price_amount":999,"currency":"EUR","product_quantity":2}`
+
+	tests := []struct {
+		name       string
+		body       string
+		wantAtomic bool
+		wantStatus int
+		wantItems  int
+	}{
+		{name: "all or nothing by default", body: `{"items":[` + mug + `]}`, wantAtomic: true, wantStatus: http.StatusCreated, wantItems: 1},
+		{name: "all or nothing with a failed item", body: `{"mode":"all_or_nothing","items":[` + mug + `,` + plate + `]}`, wantAtomic: true, wantStatus: http.StatusUnprocessableEntity, wantItems: 2},
+		{name: "best effort with a failed item", body: `{"mode":"best_effort","items":[` + mug + `,` + plate + `]}`, wantStatus: http.StatusMultiStatus, wantItems: 2},
+		{name: "best effort where every item failed", body: `{"mode":"best_effort","items":[` + plate + `]}`, wantStatus: http.StatusUnprocessableEntity, wantItems: 1},
+		{name: "unknown mode", body: `{"mode":"some","items":[` + mug + `]}`, wantStatus: http.StatusBadRequest},
+		{name: "no items", body: `{"items":[]}`, wantStatus: http.StatusBadRequest},
+		{name: "invalid item", body: `{"items":[{"product_name":"mug"}]}`, wantStatus: http.StatusBadRequest},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var gotItems int
+			var gotAtomic bool
+			// the usecase fails every item in another currency than USD
+			uc := &fakeCartUseCase{
+				createCarts: func(items []*entity.CartItem, atomic bool) ([]usecase.CartBatchResult, error) {
+					gotItems, gotAtomic = len(items), atomic
+					results := make([]usecase.CartBatchResult, len(items))
+					added := 0
+					for i, item := range items {
+						if item.Currency != "USD" {
+							results[i].Err = usecase.ErrCurrencyMismatch
+							continue
+						}
+						results[i].Item = *item
+						added++
+					}
+					if added == 0 || (atomic && added < len(items)) {
+						return nil, &usecase.ValidationError{Violations: []usecase.FieldViolation{{Field: "items", Message: "currency mismatch"}}}
+					}
+					return results, nil
+				},
+			}
+
+			routes := &cartRoutes{uc: uc, l: logger.New("error")}
+			recorder := serveHandler(t, routes.createCarts, http.MethodPost, nil, nil, tt.body)
+			if recorder.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d: %s", recorder.Code, tt.wantStatus, recorder.Body)
+			}
+			if gotItems != tt.wantItems || gotAtomic != tt.wantAtomic {
+				t.Errorf("CreateCarts(%d items, atomic %v), want %d items, atomic %v", gotItems, gotAtomic, tt.wantItems, tt.wantAtomic)
+			}
+			if recorder.Code != http.StatusMultiStatus {
+				return
+			}
+
+			var body struct {
+				Data []createCartsItemResponse `json:"data"`
+			}
+			if err := json.Unmarshal(recorder.Body.Bytes(), &body); err != nil {
+				t.Fatalf("body = %v", err)
+			}
+			if len(body.Data) != 2 || body.Data[0].Status != batchItemStatusAdded || body.Data[1].Status != batchItemStatusFailed || body.Data[1].Index != 1 {
+				t.Errorf("items = %+v, want the first added and the second failed", body.Data)
+			}
+		})
+	}
+}
@@ -1,6 +1,7 @@
 package v1
 
 import (
+	"errors"
 	"net/http"
 
 	"github.com/gin-gonic/gin"
@@ -14,38 +15,73 @@ type cartRoutes struct {
 	l  logger.Interface
 }
 
-func newCartRoutes(handler *gin.RouterGroup, uc usecase.Cart, l logger.Interface, authMid gin.HandlerFunc) {
+func newCartRoutes(handler *gin.RouterGroup, uc usecase.Cart, l logger.Interface, authMid gin.HandlerFunc, idempotencyMid gin.HandlerFunc, guestRateMid gin.HandlerFunc) {
 	r := &cartRoutes{uc: uc, l: l}
+	ownerMid := cartOwnerMiddleware(authMid, uc)
 
-	h := handler.Group("/carts").Use(authMid)
+	g := handler.Group("/carts")
 	{
-		h.POST("", r.createCart)
+		// anyone can open a guest cart, limit how fast a single client can fill mysql
+		g.POST("/guest", guestRateMid, r.createGuestCart)
+	}
+
+	// named carts belong to signed in users only
+	n := handler.Group("/carts/named").Use(authMid)
+	{
+		n.GET("", r.listCarts)
+		n.POST("", r.createNamedCart)
+		n.PATCH("/:cartID", r.renameCart)
+		n.DELETE("/:cartID", r.deleteNamedCart)
+		n.PUT("/:cartID/default", r.setDefaultCart)
+	}
+
+	// signed in users and guests with a cart token
+	h := handler.Group("/carts").Use(ownerMid)
+	{
+		h.POST("/merge", r.mergeGuestCart)
+		h.POST("", idempotencyMid, r.createCart)
+		h.POST("/batch", idempotencyMid, r.createCarts)
 		h.GET("/user", r.getCartByUserID)
+		h.GET("/saved", r.getSavedItems)
+		h.GET("/history", r.getHistory)
+		h.GET("/removed", r.getRemovedItems)
+		h.POST("/:id/move", r.moveCartItem)
+		h.POST("/:id/restore", r.restoreCartItem)
 		h.PATCH("/:id", r.updateCart)
 		h.DELETE("/:id", r.deleteCart)
 		h.PATCH("/deletes", r.deleteCarts)
-		h.POST("/checkout", r.checkOutCarts)
+		h.POST("/checkout", idempotencyMid, r.checkOutCarts)
 	}
 }
 
 type createCartRequest struct {
-	ProductID       uuid.UUID `json:"product_id" binding:"required"`
-	ProductName     string    `json:"product_name" binding:"required"`
-	ProductImageURL string    `json:"product_image_url" inding:"required"`
-	ProductPrice    float64   `json:"product_price" binding:"required"`
-	ProductQuantity int64     `json:"product_quantity" binding:"required"`
-	Note            string    `json:"note"`
+	ProductID          uuid.UUID         `json:"product_id" binding:"required"`
+	VariantID          uuid.UUID         `json:"variant_id"`
+	ProductName        string            `json:"product_name" binding:"required"`
+	ProductImageURL    string            `json:"product_image_url" inding:"required"`
+	ProductPrice       float64           `json:"product_price"` // deprecated: decimal price, use product_price_amount
+	ProductPriceAmount int64             `json:"product_price_amount" binding:"required_without=ProductPrice"`
+	Currency           string            `json:"currency" binding:"omitempty,iso4217"`
+	ProductQuantity    int64             `json:"product_quantity" binding:"required"`
+	Note               string            `json:"note"`
+	Options            map[string]string `json:"options" binding:"omitempty,max=20,dive,keys,max=64,endkeys,max=255"`
 }
 
 type createCartResponse struct {
-	ID              uuid.UUID `json:"id"`
-	UserID          uuid.UUID `json:"user_id"`
-	ProductID       uuid.UUID `json:"product_id"`
-	ProductName     string    `json:"product_name"`
-	ProductImageURL string    `json:"product_image_url"`
-	ProductPrice    float64   `json:"product_price"`
-	ProductQuantity int64     `json:"product_quantity"`
-	Note            string    `json:"note"`
+	ID                 uuid.UUID         `json:"id"`
+	CartID             uuid.UUID         `json:"cart_id"`
+	UserID             uuid.UUID         `json:"user_id"`
+	ProductID          uuid.UUID         `json:"product_id"`
+	VariantID          uuid.UUID         `json:"variant_id"`
+	ProductName        string            `json:"product_name"`
+	ProductImageURL    string            `json:"product_image_url"`
+	ProductPrice       float64           `json:"product_price"` // deprecated: use product_price_amount
+	ProductPriceAmount int64             `json:"product_price_amount"`
+	Currency           string            `json:"currency"`
+	ProductQuantity    int64             `json:"product_quantity"`
+	Note               string            `json:"note"`
+	Options            map[string]string `json:"options,omitempty"`
+	Version            int64             `json:"version"`
 }
 
 func (r *cartRoutes) createCart(ctx *gin.Context) {
@@ -63,29 +99,50 @@ func (r *cartRoutes) createCart(ctx *gin.Context) {
 		return
 	}
 
-	cartEntity := createCartRequestToCartEntity(userID.(uuid.UUID), req)
+	itemEntity := createCartRequestToCartItemEntity(userID.(uuid.UUID), req)
+	itemEntity.CartID = selectedCartID(ctx)
 
-	cart, err := r.uc.CreateCart(ctx.Request.Context(), &cartEntity)
+	item, err := r.uc.CreateCart(ctx.Request.Context(), &itemEntity)
 	if err != nil {
 		r.l.Error(err, "http - v1 - cartRoutes - createCart")
-		ctx.JSON(http.StatusInternalServerError, newInternalServerError(err.Error()))
+		writeUseCaseError(ctx, err)
 		return
 	}
 
-	cartResponse := cartEntityToCreateCartResponse(cart)
+	cartResponse := cartItemEntityToCreateCartResponse(item)
+
+	ctx.Header(ETagHeader, cartItemETag(item.Version))
 
 	ctx.JSON(http.StatusCreated, newCreateSuccess(cartResponse))
 }
 
 type getCartResponse struct {
-	ID              uuid.UUID `json:"id"`
-	UserID          uuid.UUID `json:"user_id"`
-	ProductID       uuid.UUID `json:"product_id"`
-	ProductName     string    `json:"product_name"`
-	ProductImageURL string    `json:"product_image_url"`
-	ProductPrice    float64   `json:"product_price"`
-	ProductQuantity int64     `json:"product_quantity"`
-	Note            string    `json:"note"`
+	ID             uuid.UUID             `json:"id"`
+	UserID         uuid.UUID             `json:"user_id"`
+	Name           string                `json:"name"`
+	Default        bool                  `json:"default"`
+	Currency       string                `json:"currency"`
+	Status         string                `json:"status"`
+	Subtotal       float64               `json:"subtotal"` // deprecated: use subtotal_amount
+	SubtotalAmount int64                 `json:"subtotal_amount"`
+	ItemCount      int64                 `json:"item_count"`
+	Items          []getCartItemResponse `json:"items"`
+}
+
+type getCartItemResponse struct {
+	ID                 uuid.UUID         `json:"id"`
+	CartID             uuid.UUID         `json:"cart_id"`
+	ProductID          uuid.UUID         `json:"product_id"`
+	VariantID          uuid.UUID         `json:"variant_id"`
+	ProductName        string            `json:"product_name"`
+	ProductImageURL    string            `json:"product_image_url"`
+	ProductPrice       float64           `json:"product_price"` // deprecated: use product_price_amount
+	ProductPriceAmount int64             `json:"product_price_amount"`
+	Currency           string            `json:"currency"`
+	ProductQuantity    int64             `json:"product_quantity"`
+	Note               string            `json:"note"`
+	Options            map[string]string `json:"options,omitempty"`
+	Version            int64             `json:"version"`
 }
 
 // get cart by user id
@@ -97,32 +154,38 @@ func (r *cartRoutes) getCartByUserID(ctx *gin.Context) {
 		return
 	}
 
-	carts, err := r.uc.GetUserCart(ctx.Request.Context(), userID.(uuid.UUID))
+	cart, err := r.uc.GetUserCart(ctx.Request.Context(), userID.(uuid.UUID), selectedCartID(ctx))
 	if err != nil {
 		r.l.Error(err, "http - v1 - cartRoutes - getCart")
-		ctx.JSON(http.StatusInternalServerError, newInternalServerError(err.Error()))
+		writeUseCaseError(ctx, err)
 		return
 	}
 
-	cartsResponse := cartEntitiesToGetCartResponse(carts)
+	cartResponse := cartEntityToGetCartResponse(cart)
 
-	ctx.JSON(http.StatusOK, newGetSuccess(cartsResponse))
+	ctx.JSON(http.StatusOK, newGetSuccess(cartResponse))
 }
 
 type updateCartRequest struct {
-	ProductQuantity int64  `json:"product_quantity" binding:"required"`
+	ProductQuantity *int64 `json:"product_quantity" binding:"required"` // 0 removes the line
 	Note            string `json:"note"`
 }
 
 type updateCartResponse struct {
-	ID              uuid.UUID `json:"id"`
-	UserID          uuid.UUID `json:"user_id"`
-	ProductID       uuid.UUID `json:"product_id"`
-	ProductName     string    `json:"product_name"`
-	ProductImageURL string    `json:"product_image_url"`
-	ProductPrice    float64   `json:"product_price"`
-	ProductQuantity int64     `json:"product_quantity"`
-	Note            string    `json:"note"`
+	ID                 uuid.UUID         `json:"id"`
+	CartID             uuid.UUID         `json:"cart_id"`
+	UserID             uuid.UUID         `json:"user_id"`
+	ProductID          uuid.UUID         `json:"product_id"`
+	VariantID          uuid.UUID         `json:"variant_id"`
+	ProductName        string            `json:"product_name"`
+	ProductImageURL    string            `json:"product_image_url"`
+	ProductPrice       float64           `json:"product_price"` // deprecated: use product_price_amount
+	ProductPriceAmount int64             `json:"product_price_amount"`
+	Currency           string            `json:"currency"`
+	ProductQuantity    int64             `json:"product_quantity"`
+	Note               string            `json:"note"`
+	Options            map[string]string `json:"options,omitempty"`
+	Version            int64             `json:"version"`
 }
 
 func (r *cartRoutes) updateCart(ctx *gin.Context) {
@@ -140,6 +203,13 @@ func (r *cartRoutes) updateCart(ctx *gin.Context) {
 		return
 	}
 
+	version, err := parseIfMatch(ctx.GetHeader(IfMatchHeader))
+	if err != nil {
+		r.l.Error(err, "http - v1 - cartRoutes - updateCart")
+		ctx.JSON(http.StatusBadRequest, newBadRequestError(err.Error()))
+		return
+	}
+
 	userID, exist := ctx.Get(UserIDKey)
 	if !exist {
 		r.l.Error("not exist", "http - v1 - cartRoutes - createCart")
@@ -147,16 +217,23 @@ func (r *cartRoutes) updateCart(ctx *gin.Context) {
 		return
 	}
 
-	cart := updateCartRequestToCartEntity(cartID, userID.(uuid.UUID), req)
+	item := updateCartRequestToCartItemEntity(cartID, userID.(uuid.UUID), version, req)
 
-	err = r.uc.UpdateQtyAndNoteCart(ctx.Request.Context(), &cart)
+	err = r.uc.UpdateQtyAndNoteCart(ctx.Request.Context(), &item)
 	if err != nil {
 		r.l.Error(err, "http - v1 - cartRoutes - updateCart")
-		ctx.JSON(http.StatusInternalServerError, newInternalServerError(err.Error()))
+		writeUseCaseError(ctx, err)
 		return
 	}
 
-	cartResponse := cartEntityToUpdateCartResponse(cart)
+	if !item.DeletedAt.IsZero() {
+		ctx.JSON(http.StatusOK, newDeleteSuccess())
+		return
+	}
+
+	cartResponse := cartItemEntityToUpdateCartResponse(item)
+
+	ctx.Header(ETagHeader, cartItemETag(item.Version))
 
 	ctx.JSON(http.StatusOK, newUpdateSuccess(cartResponse))
 }
@@ -169,6 +246,13 @@ func (r *cartRoutes) deleteCart(ctx *gin.Context) {
 		return
 	}
 
+	version, err := parseIfMatch(ctx.GetHeader(IfMatchHeader))
+	if err != nil {
+		r.l.Error(err, "http - v1 - cartRoutes - deleteCart")
+		ctx.JSON(http.StatusBadRequest, newBadRequestError(err.Error()))
+		return
+	}
+
 	userID, exist := ctx.Get(UserIDKey)
 	if !exist {
 		r.l.Error("not exist", "http - v1 - cartRoutes - createCart")
@@ -176,10 +260,10 @@ func (r *cartRoutes) deleteCart(ctx *gin.Context) {
 		return
 	}
 
-	err = r.uc.DeleteCart(ctx.Request.Context(), userID.(uuid.UUID), cartID)
+	err = r.uc.DeleteCart(ctx.Request.Context(), userID.(uuid.UUID), cartID, version)
 	if err != nil {
 		r.l.Error(err, "http - v1 - cartRoutes - deleteCart")
-		ctx.JSON(http.StatusInternalServerError, newInternalServerError(err.Error()))
+		writeUseCaseError(ctx, err)
 		return
 	}
 
@@ -235,6 +319,11 @@ func (r *cartRoutes) checkOutCarts(ctx *gin.Context) {
 		return
 	}
 
+	if ctx.GetBool(GuestKey) {
+		ctx.JSON(http.StatusUnauthorized, newUnauthorizedError("sign in to check out the cart"))
+		return
+	}
+
 	userID, exist := ctx.Get(UserIDKey)
 	if !exist {
 		r.l.Error("not exist", "http - v1 - cartRoutes - createCart")
@@ -254,13 +343,19 @@ func (r *cartRoutes) checkOutCarts(ctx *gin.Context) {
 	err := r.uc.CheckOutCarts(
 		ctx.Request.Context(),
 		userID.(uuid.UUID),
+		selectedCartID(ctx),
 		req.CartIDs,
 		&address,
 		token.(string),
 	)
+	if errors.Is(err, usecase.ErrCheckoutPending) {
+		r.l.Warn("http - v1 - cartRoutes - checkOutCarts - %s", err)
+		ctx.JSON(http.StatusAccepted, newCheckoutAccepted(usecase.ErrCheckoutPending.Error()))
+		return
+	}
 	if err != nil {
 		r.l.Error(err, "http - v1 - cartRoutes - checkOutCarts")
-		ctx.JSON(http.StatusInternalServerError, newInternalServerError(err.Error()))
+		writeUseCaseError(ctx, err)
 		return
 	}
 
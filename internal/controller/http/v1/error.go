@@ -1,7 +1,13 @@
 package v1
 
 import (
+	"errors"
 	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/idoyudha/eshop-cart/internal/entity"
+	"github.com/idoyudha/eshop-cart/internal/usecase"
 )
 
 type restError struct {
@@ -10,8 +16,28 @@ type restError struct {
 }
 
 type errorMessage struct {
+	Message string       `json:"message"`
+	Causes  error        `json:"causes"`
+	Fields  []fieldError `json:"fields,omitempty"`
+	// set when checkout found lines whose catalog price or availability changed
+	PriceChanges []priceChangeResponse `json:"price_changes,omitempty"`
+}
+
+type fieldError struct {
+	Field   string `json:"field"`
 	Message string `json:"message"`
-	Causes  error  `json:"causes"`
+}
+
+type priceChangeResponse struct {
+	ItemID              uuid.UUID `json:"item_id"`
+	ProductID           uuid.UUID `json:"product_id"`
+	ProductName         string    `json:"product_name"`
+	PreviousPriceAmount int64     `json:"previous_price_amount"`
+	PreviousCurrency    string    `json:"previous_currency"`
+	PriceAmount         int64     `json:"price_amount"`
+	Currency            string    `json:"currency"`
+	Available           bool      `json:"available"`
+	Reason              string    `json:"reason"`
 }
 
 func newBadRequestError(message string) *restError {
@@ -49,3 +75,149 @@ func newUnauthorizedError(message string) *restError {
 		},
 	}
 }
+
+func newPreconditionFailedError(message string) *restError {
+	return &restError{
+		Code: http.StatusPreconditionFailed,
+		Error: errorMessage{
+			Message: message,
+		},
+	}
+}
+
+func newConflictError(message string) *restError {
+	return &restError{
+		Code: http.StatusConflict,
+		Error: errorMessage{
+			Message: message,
+		},
+	}
+}
+
+func newUnprocessableEntityError(message string) *restError {
+	return &restError{
+		Code: http.StatusUnprocessableEntity,
+		Error: errorMessage{
+			Message: message,
+		},
+	}
+}
+
+func newServiceUnavailableError(message string) *restError {
+	return &restError{
+		Code: http.StatusServiceUnavailable,
+		Error: errorMessage{
+			Message: message,
+		},
+	}
+}
+
+func newTooManyRequestsError(message string) *restError {
+	return &restError{
+		Code: http.StatusTooManyRequests,
+		Error: errorMessage{
+			Message: message,
+		},
+	}
+}
+
+func newValidationError(message string, violations []usecase.FieldViolation) *restError {
+	return &restError{
+		Code: http.StatusUnprocessableEntity,
+		Error: errorMessage{
+			Message: message,
+			Fields:  fieldViolationsToFieldErrors(violations),
+		},
+	}
+}
+
+func newPriceChangedError(message string, changes []entity.CartPriceChange) *restError {
+	return &restError{
+		Code: http.StatusConflict,
+		Error: errorMessage{
+			Message:      message,
+			PriceChanges: priceChangesToPriceChangeResponses(changes),
+		},
+	}
+}
+
+func priceChangesToPriceChangeResponses(changes []entity.CartPriceChange) []priceChangeResponse {
+	responses := make([]priceChangeResponse, len(changes))
+	for i, change := range changes {
+		responses[i] = priceChangeResponse{
+			ItemID:              change.ItemID,
+			ProductID:           change.ProductID,
+			ProductName:         change.ProductName,
+			PreviousPriceAmount: change.PreviousPrice,
+			PreviousCurrency:    change.PreviousCurrency,
+			PriceAmount:         change.Price,
+			Currency:            change.Currency,
+			Available:           change.Available,
+			Reason:              change.Reason,
+		}
+	}
+	return responses
+}
+
+func fieldViolationsToFieldErrors(violations []usecase.FieldViolation) []fieldError {
+	fields := make([]fieldError, len(violations))
+	for i, violation := range violations {
+		fields[i] = fieldError{
+			Field:   violation.Field,
+			Message: violation.Message,
+		}
+	}
+	return fields
+}
+
+// writeUseCaseError responds with the http status matching the typed errors of the usecase
+func writeUseCaseError(ctx *gin.Context, err error) {
+	var versionConflict *usecase.VersionConflictError
+	var validation *usecase.ValidationError
+	var orderRejected *usecase.OrderRejectedError
+	var priceChanged *usecase.PriceChangedError
+
+	switch {
+	case errors.As(err, &validation):
+		ctx.JSON(http.StatusUnprocessableEntity, newValidationError(err.Error(), validation.Violations))
+	case errors.As(err, &versionConflict):
+		ctx.Header(ETagHeader, cartItemETag(versionConflict.Current))
+		ctx.JSON(http.StatusPreconditionFailed, newPreconditionFailedError(err.Error()))
+	case errors.As(err, &priceChanged):
+		ctx.JSON(http.StatusConflict, newPriceChangedError(err.Error(), priceChanged.Changes))
+	case errors.As(err, &orderRejected) && orderRejected.Conflict:
+		ctx.JSON(http.StatusConflict, newConflictError(err.Error()))
+	case errors.As(err, &orderRejected):
+		ctx.JSON(http.StatusUnprocessableEntity, newUnprocessableEntityError(err.Error()))
+	case errors.Is(err, usecase.ErrInsufficientStock):
+		ctx.JSON(http.StatusConflict, newConflictError(err.Error()))
+	case errors.Is(err, entity.ErrOrderServiceUnavailable), errors.Is(err, entity.ErrProductCatalogUnavailable), errors.Is(err, entity.ErrInventoryServiceUnavailable):
+		ctx.JSON(http.StatusServiceUnavailable, newServiceUnavailableError(err.Error()))
+	case errors.Is(err, usecase.ErrCartItemNotFound):
+		ctx.JSON(http.StatusNotFound, newNotFoundError(err.Error()))
+	case errors.Is(err, usecase.ErrInvalidCartToken):
+		ctx.JSON(http.StatusUnauthorized, newUnauthorizedError(err.Error()))
+	case errors.Is(err, usecase.ErrGuestCartNotFound), errors.Is(err, usecase.ErrCartSnapshotNotFound), errors.Is(err, usecase.ErrCartNotFound):
+		ctx.JSON(http.StatusNotFound, newNotFoundError(err.Error()))
+	case errors.Is(err, usecase.ErrCartEmpty):
+		ctx.JSON(http.StatusUnprocessableEntity, newUnprocessableEntityError(err.Error()))
+	case errors.Is(err, usecase.ErrCurrencyMismatch):
+		ctx.JSON(http.StatusBadRequest, newBadRequestError(err.Error()))
+	case errors.Is(err, usecase.ErrCartNameTaken), errors.Is(err, usecase.ErrDefaultCartDelete):
+		ctx.JSON(http.StatusConflict, newConflictError(err.Error()))
+	case errors.Is(err, usecase.ErrCheckoutInProgress):
+		// the lines are free again once the running checkout ends
+		markTransientResponse(ctx)
+		ctx.JSON(http.StatusConflict, newConflictError(err.Error()))
+	case errors.Is(err, entity.ErrAlreadyExists):
+		// lost a race to a concurrent request twice in a row, the client can retry
+		markTransientResponse(ctx)
+		ctx.JSON(http.StatusConflict, newConflictError(err.Error()))
+	case errors.Is(err, usecase.ErrIdempotencyKeyInProgress):
+		ctx.JSON(http.StatusConflict, newConflictError(err.Error()))
+	case errors.Is(err, usecase.ErrIdempotencyKeyReused):
+		ctx.JSON(http.StatusUnprocessableEntity, newUnprocessableEntityError(err.Error()))
+	default:
+		ctx.JSON(http.StatusInternalServerError, newInternalServerError(err.Error()))
+	}
+}
@@ -0,0 +1,34 @@
+package v1
+
+import (
+	"errors"
+	"strconv"
+	"strings"
+)
+
+const (
+	ETagHeader    = "ETag"
+	IfMatchHeader = "If-Match"
+)
+
+// cartItemETag is the strong entity tag of a cart line, its quoted version
+func cartItemETag(version int64) string {
+	return strconv.Quote(strconv.FormatInt(version, 10))
+}
+
+// parseIfMatch returns the cart line version expected by an If-Match header,
+// zero when the header is absent or "*" so the change is applied unconditionally
+func parseIfMatch(header string) (int64, error) {
+	header = strings.TrimSpace(header)
+	if header == "" || header == "*" {
+		return 0, nil
+	}
+
+	tag := strings.Trim(strings.TrimPrefix(header, "W/"), `"`)
+	version, err := strconv.ParseInt(tag, 10, 64)
+	if err != nil || version <= 0 {
+		return 0, errors.New("invalid If-Match header, expected the ETag of the cart item")
+	}
+
+	return version, nil
+}
@@ -0,0 +1,126 @@
+package v1
+
+import (
+	"errors"
+	"net/http"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/idoyudha/eshop-cart/internal/entity"
+	"github.com/idoyudha/eshop-cart/internal/usecase"
+	"github.com/idoyudha/eshop-cart/pkg/logger"
+)
+
+func TestParseIfMatch(t *testing.T) {
+	tests := []struct {
+		header  string
+		want    int64
+		wantErr bool
+	}{
+		{header: "", want: 0},
+		{header: "*", want: 0},
+		{header: `"3"`, want: 3},
+		{header: ` "3" `, want: 3},
+		{header: `W/"3"`, want: 3},
+		{header: cartItemETag(42), want: 42},
+		{header: `"0"`, wantErr: true},
+		{header: `"-1"`, wantErr: true},
+		{header: `"abc"`, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		got, err := parseIfMatch(tt.header)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("parseIfMatch(%q) error = %v, want error %v", tt.header, err, tt.wantErr)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("parseIfMatch(%q) = %d, want %d", tt.header, got, tt.want)
+		}
+	}
+}
+
+func TestUpdateCartIfMatch(t *testing.T) {
+	itemID := uuid.New()
+	conflict := &usecase.VersionConflictError{ItemID: itemID, Expected: 2, Current: 5}
+
+	tests := []struct {
+		name        string
+		ifMatch     string
+		body        string
+		ucErr       error
+		wantStatus  int
+		wantVersion int64
+		wantETag    string
+	}{
+		{name: "matching version", ifMatch: `"2"`, body: `{"product_quantity":3}`, wantStatus: http.StatusOK, wantVersion: 2, wantETag: `"3"`},
+		{name: "unconditional", body: `{"product_quantity":3}`, wantStatus: http.StatusOK, wantETag: `"3"`},
+		{name: "stale version", ifMatch: `"2"`, body: `{"product_quantity":3}`, ucErr: conflict, wantStatus: http.StatusPreconditionFailed, wantVersion: 2, wantETag: `"5"`},
+		{name: "wrapped stale version", ifMatch: `"2"`, body: `{"product_quantity":3}`, ucErr: errors.Join(errors.New("tx"), conflict), wantStatus: http.StatusPreconditionFailed, wantVersion: 2, wantETag: `"5"`},
+		{name: "malformed header", ifMatch: "v2", body: `{"product_quantity":3}`, wantStatus: http.StatusBadRequest},
+		{name: "removed line has no tag", ifMatch: `"2"`, body: `{"product_quantity":0}`, wantStatus: http.StatusOK, wantVersion: 2},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var called bool
+			uc := &fakeCartUseCase{
+				updateItem: func(item *entity.CartItem) error {
+					called = true
+					if item.Version != tt.wantVersion || item.ID != itemID {
+						t.Errorf("UpdateQtyAndNoteCart got item %s at version %d, want %s at %d", item.ID, item.Version, itemID, tt.wantVersion)
+					}
+					if tt.ucErr != nil {
+						return tt.ucErr
+					}
+					if item.ProductQuantity == 0 {
+						item.DeletedAt = item.UpdatedAt
+						return nil
+					}
+					item.Version = 3
+					return nil
+				},
+			}
+
+			routes := &cartRoutes{uc: uc, l: logger.New("error")}
+			header := http.Header{}
+			if tt.ifMatch != "" {
+				header.Set(IfMatchHeader, tt.ifMatch)
+			}
+			recorder := serveHandler(t, routes.updateCart, http.MethodPatch, gin.Params{{Key: "id", Value: itemID.String()}}, header, tt.body)
+			if recorder.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d: %s", recorder.Code, tt.wantStatus, recorder.Body)
+			}
+			if called != (tt.wantStatus != http.StatusBadRequest) {
+				t.Errorf("usecase called = %v with status %d", called, recorder.Code)
+			}
+			if got := recorder.Header().Get(ETagHeader); got != tt.wantETag {
+				t.Errorf("ETag = %q, want %q", got, tt.wantETag)
+			}
+		})
+	}
+}
+
+func TestDeleteCartIfMatch(t *testing.T) {
+	itemID := uuid.New()
+
+	var gotVersion int64
+	uc := &fakeCartUseCase{
+		deleteItem: func(_ uuid.UUID, _ uuid.UUID, version int64) error {
+			gotVersion = version
+			return &usecase.VersionConflictError{ItemID: itemID, Expected: version, Current: 4}
+		},
+	}
+
+	routes := &cartRoutes{uc: uc, l: logger.New("error")}
+	header := http.Header{IfMatchHeader: []string{`W/"1"`}}
+	recorder := serveHandler(t, routes.deleteCart, http.MethodDelete, gin.Params{{Key: "id", Value: itemID.String()}}, header, "")
+
+	if gotVersion != 1 {
+		t.Errorf("DeleteCart got version %d, want 1", gotVersion)
+	}
+	if recorder.Code != http.StatusPreconditionFailed || recorder.Header().Get(ETagHeader) != `"4"` {
+		t.Errorf("got %d with ETag %q, want 412 with the current tag", recorder.Code, recorder.Header().Get(ETagHeader))
+	}
+}
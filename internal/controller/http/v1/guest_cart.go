@@ -0,0 +1,68 @@
+package v1
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+type createGuestCartResponse struct {
+	CartToken string          `json:"cart_token"`
+	ExpiresAt time.Time       `json:"expires_at"`
+	Cart      getCartResponse `json:"cart"`
+}
+
+// createGuestCart opens a cart for an anonymous shopper, the returned token is sent back in the X-Cart-Token header
+func (r *cartRoutes) createGuestCart(ctx *gin.Context) {
+	cartToken, cart, err := r.uc.CreateGuestCart(ctx.Request.Context())
+	if err != nil {
+		r.l.Error(err, "http - v1 - cartRoutes - createGuestCart")
+		ctx.JSON(http.StatusInternalServerError, newInternalServerError(err.Error()))
+		return
+	}
+
+	ctx.JSON(http.StatusCreated, newCreateSuccess(createGuestCartResponse{
+		CartToken: cartToken,
+		ExpiresAt: cart.ExpiresAt,
+		Cart:      cartEntityToGetCartResponse(cart),
+	}))
+}
+
+// mergeGuestCart folds the guest cart of the X-Cart-Token header into the cart of the signed in user
+func (r *cartRoutes) mergeGuestCart(ctx *gin.Context) {
+	if ctx.GetBool(GuestKey) {
+		ctx.JSON(http.StatusUnauthorized, newUnauthorizedError("sign in to merge the guest cart"))
+		return
+	}
+
+	cartToken := ctx.GetHeader(CartTokenHeader)
+	if cartToken == "" {
+		ctx.JSON(http.StatusBadRequest, newBadRequestError(CartTokenHeader+" header is required"))
+		return
+	}
+
+	guestID, err := r.uc.ParseGuestCartToken(cartToken)
+	if err != nil {
+		r.l.Error(err, "http - v1 - cartRoutes - mergeGuestCart")
+		writeUseCaseError(ctx, err)
+		return
+	}
+
+	userID, exist := ctx.Get(UserIDKey)
+	if !exist {
+		r.l.Error("not exist", "http - v1 - cartRoutes - mergeGuestCart")
+		ctx.JSON(http.StatusInternalServerError, newInternalServerError("user id not exist"))
+		return
+	}
+
+	cart, err := r.uc.MergeGuestCart(ctx.Request.Context(), userID.(uuid.UUID), selectedCartID(ctx), guestID)
+	if err != nil {
+		r.l.Error(err, "http - v1 - cartRoutes - mergeGuestCart")
+		writeUseCaseError(ctx, err)
+		return
+	}
+
+	ctx.JSON(http.StatusOK, newUpdateSuccess(cartEntityToGetCartResponse(cart)))
+}
@@ -0,0 +1,91 @@
+package v1
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+const defaultHistoryLimit = 20
+
+type getHistoryRequest struct {
+	Cursor string `form:"cursor" binding:"omitempty,uuid"`
+	Limit  int    `form:"limit" binding:"omitempty,min=1,max=100"`
+}
+
+type cartEventSnapshotResponse struct {
+	ProductID          uuid.UUID         `json:"product_id"`
+	VariantID          uuid.UUID         `json:"variant_id"`
+	ProductName        string            `json:"product_name"`
+	ProductPriceAmount int64             `json:"product_price_amount"`
+	Currency           string            `json:"currency"`
+	ProductQuantity    int64             `json:"product_quantity"`
+	Note               string            `json:"note"`
+	Options            map[string]string `json:"options,omitempty"`
+	List               string            `json:"list"`
+	Version            int64             `json:"version"`
+}
+
+type cartEventResponse struct {
+	ID        uuid.UUID                  `json:"id"`
+	CartID    uuid.UUID                  `json:"cart_id"`
+	ItemID    uuid.UUID                  `json:"item_id"`
+	EventType string                     `json:"event_type"`
+	Actor     string                     `json:"actor"`
+	Source    string                     `json:"source"`
+	Before    *cartEventSnapshotResponse `json:"before"`
+	After     *cartEventSnapshotResponse `json:"after"`
+	CreatedAt time.Time                  `json:"created_at"`
+}
+
+type getHistoryResponse struct {
+	Events     []cartEventResponse `json:"events"`
+	NextCursor *uuid.UUID          `json:"next_cursor"`
+}
+
+// get the changes made to the cart, newest first. next_cursor is null on the last page
+func (r *cartRoutes) getHistory(ctx *gin.Context) {
+	var req getHistoryRequest
+	if err := ctx.ShouldBindQuery(&req); err != nil {
+		r.l.Error(err, "http - v1 - cartRoutes - getHistory")
+		ctx.JSON(http.StatusBadRequest, newBadRequestError(err.Error()))
+		return
+	}
+	if req.Limit == 0 {
+		req.Limit = defaultHistoryLimit
+	}
+
+	userID, exist := ctx.Get(UserIDKey)
+	if !exist {
+		r.l.Error("not exist", "http - v1 - cartRoutes - getHistory")
+		ctx.JSON(http.StatusInternalServerError, newInternalServerError("user id not exist"))
+		return
+	}
+
+	var cursor uuid.UUID
+	if req.Cursor != "" {
+		parsed, err := uuid.Parse(req.Cursor)
+		if err != nil {
+			r.l.Error(err, "http - v1 - cartRoutes - getHistory")
+			ctx.JSON(http.StatusBadRequest, newBadRequestError("invalid cursor"))
+			return
+		}
+		cursor = parsed
+	}
+
+	events, err := r.uc.GetHistory(ctx.Request.Context(), userID.(uuid.UUID), cursor, req.Limit)
+	if err != nil {
+		r.l.Error(err, "http - v1 - cartRoutes - getHistory")
+		ctx.JSON(http.StatusInternalServerError, newInternalServerError(err.Error()))
+		return
+	}
+
+	response := getHistoryResponse{Events: cartEventEntitiesToCartEventResponse(events)}
+	if len(events) == req.Limit {
+		response.NextCursor = &events[len(events)-1].ID
+	}
+
+	ctx.JSON(http.StatusOK, newGetSuccess(response))
+}
@@ -0,0 +1,91 @@
+package v1
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/idoyudha/eshop-cart/internal/entity"
+	"github.com/idoyudha/eshop-cart/pkg/logger"
+)
+
+func TestGetHistory(t *testing.T) {
+	cursor := uuid.New()
+	page := func(n int) []*entity.CartEvent {
+		events := make([]*entity.CartEvent, n)
+		for i := range events {
+			events[i] = &entity.CartEvent{ID: uuid.New(), EventType: entity.CartEventItemUpdated}
+		}
+		return events
+	}
+
+	tests := []struct {
+		name       string
+		query      string
+		events     []*entity.CartEvent
+		err        error
+		wantStatus int
+		wantCursor uuid.UUID
+		wantLimit  int
+		wantNext   bool
+	}{
+		{name: "first page with the default limit", query: "", events: page(3), wantStatus: http.StatusOK, wantLimit: defaultHistoryLimit},
+		{name: "full page has a next cursor", query: "?limit=2&cursor=" + cursor.String(), events: page(2), wantStatus: http.StatusOK, wantCursor: cursor, wantLimit: 2, wantNext: true},
+		{name: "limit over the maximum", query: "?limit=101", wantStatus: http.StatusBadRequest},
+		{name: "invalid cursor", query: "?cursor=latest", wantStatus: http.StatusBadRequest},
+		{name: "mysql down", events: nil, err: errors.New("connection refused"), wantStatus: http.StatusInternalServerError, wantLimit: defaultHistoryLimit},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var gotCursor uuid.UUID
+			var gotLimit int
+			uc := &fakeCartUseCase{
+				getHistory: func(cursor uuid.UUID, limit int) ([]*entity.CartEvent, error) {
+					gotCursor, gotLimit = cursor, limit
+					return tt.events, tt.err
+				},
+			}
+			routes := &cartRoutes{uc: uc, l: logger.New("error")}
+
+			gin.SetMode(gin.TestMode)
+			engine := gin.New()
+			engine.GET("/v1/carts/history", func(ctx *gin.Context) {
+				ctx.Set(UserIDKey, uuid.New())
+				routes.getHistory(ctx)
+			})
+			recorder := httptest.NewRecorder()
+			engine.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/v1/carts/history"+tt.query, nil))
+
+			if recorder.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d: %s", recorder.Code, tt.wantStatus, recorder.Body)
+			}
+			if gotCursor != tt.wantCursor || gotLimit != tt.wantLimit {
+				t.Errorf("GetHistory(cursor %s, limit %d), want cursor %s limit %d", gotCursor, gotLimit, tt.wantCursor, tt.wantLimit)
+			}
+			if tt.wantStatus != http.StatusOK {
+				return
+			}
+
+			var body struct {
+				Data getHistoryResponse `json:"data"`
+			}
+			if err := json.Unmarshal(recorder.Body.Bytes(), &body); err != nil {
+				t.Fatalf("body = %v", err)
+			}
+			if len(body.Data.Events) != len(tt.events) {
+				t.Errorf("%d events, want %d", len(body.Data.Events), len(tt.events))
+			}
+			switch {
+			case tt.wantNext && (body.Data.NextCursor == nil || *body.Data.NextCursor != tt.events[len(tt.events)-1].ID):
+				t.Errorf("next_cursor = %v, want the last event", body.Data.NextCursor)
+			case !tt.wantNext && body.Data.NextCursor != nil:
+				t.Errorf("next_cursor = %v on the last page", body.Data.NextCursor)
+			}
+		})
+	}
+}
@@ -0,0 +1,156 @@
+package v1
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/idoyudha/eshop-cart/internal/entity"
+	"github.com/idoyudha/eshop-cart/internal/usecase"
+	"github.com/idoyudha/eshop-cart/pkg/logger"
+)
+
+const (
+	IdempotencyKeyHeader     = "Idempotency-Key"
+	IdempotentReplayedHeader = "Idempotent-Replayed"
+	maxIdempotencyKeyLength  = 255
+	// set by handlers whose response only tells the client to retry later
+	idempotencyTransientKey = "idempotencyTransient"
+)
+
+// response headers stored with the body and sent again on replay
+var idempotentResponseHeaders = []string{"Content-Type", ETagHeader}
+
+// idempotencyResponseWriter keeps a copy of the body written by the handler
+type idempotencyResponseWriter struct {
+	gin.ResponseWriter
+	body bytes.Buffer
+}
+
+func (w *idempotencyResponseWriter) Write(data []byte) (int, error) {
+	w.body.Write(data)
+	return w.ResponseWriter.Write(data)
+}
+
+func (w *idempotencyResponseWriter) WriteString(s string) (int, error) {
+	w.body.WriteString(s)
+	return w.ResponseWriter.WriteString(s)
+}
+
+// idempotencyMiddleware makes a route safe to retry when the client sends an Idempotency-Key header:
+// the response of the first request is stored and replayed to retries with the same payload,
+// a different payload under the same key is rejected. Register it after the auth or cart owner middleware,
+// keys are scoped per user or guest. Requests without the header are handled as usual
+func idempotencyMiddleware(uc usecase.Idempotency, l logger.Interface) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		idempotencyKey := ctx.GetHeader(IdempotencyKeyHeader)
+		if idempotencyKey == "" {
+			ctx.Next()
+			return
+		}
+
+		if len(idempotencyKey) > maxIdempotencyKeyLength {
+			ctx.JSON(http.StatusBadRequest, newBadRequestError(fmt.Sprintf("%s must be at most %d characters", IdempotencyKeyHeader, maxIdempotencyKeyLength)))
+			ctx.Abort()
+			return
+		}
+
+		body, err := io.ReadAll(ctx.Request.Body)
+		if err != nil {
+			l.Error(err, "http - v1 - idempotencyMiddleware - ReadAll")
+			ctx.JSON(http.StatusBadRequest, newBadRequestError(err.Error()))
+			ctx.Abort()
+			return
+		}
+		ctx.Request.Body = io.NopCloser(bytes.NewReader(body))
+
+		// without an owner every client would share the same keys and replay each other's responses
+		userID, exist := ctx.Get(UserIDKey)
+		if !exist {
+			l.Error("not exist", "http - v1 - idempotencyMiddleware")
+			ctx.JSON(http.StatusInternalServerError, newInternalServerError("user id not exist"))
+			ctx.Abort()
+			return
+		}
+		scope := fmt.Sprint(userID)
+		if ctx.GetBool(GuestKey) {
+			scope = "guest:" + scope
+		}
+		key := fmt.Sprintf("%s:%s", scope, idempotencyKey)
+
+		requestHash := hashIdempotentRequest(ctx.Request, body)
+
+		record, err := uc.Begin(ctx.Request.Context(), key, requestHash)
+		if err != nil {
+			l.Error(err, "http - v1 - idempotencyMiddleware - Begin")
+			writeUseCaseError(ctx, err)
+			ctx.Abort()
+			return
+		}
+
+		if record != nil {
+			for name, value := range record.ResponseHeader {
+				ctx.Header(name, value)
+			}
+			ctx.Header(IdempotentReplayedHeader, "true")
+			ctx.Data(record.ResponseStatus, record.ResponseHeader["Content-Type"], record.ResponseBody)
+			ctx.Abort()
+			return
+		}
+
+		writer := &idempotencyResponseWriter{ResponseWriter: ctx.Writer}
+		ctx.Writer = writer
+
+		ctx.Next()
+
+		// the key must be settled even if the client went away while the handler ran
+		settleCtx := context.WithoutCancel(ctx.Request.Context())
+
+		// server errors and responses asking to retry later, like an accepted checkout still pending,
+		// are not stored so the retry is handled again and gets the final outcome
+		if writer.Status() >= http.StatusInternalServerError || writer.Status() == http.StatusAccepted || ctx.GetBool(idempotencyTransientKey) {
+			if err := uc.Release(settleCtx, key); err != nil {
+				l.Error(err, "http - v1 - idempotencyMiddleware - Release")
+			}
+			return
+		}
+
+		completed := entity.NewIdempotencyRecord(key, requestHash)
+		completed.ResponseStatus = writer.Status()
+		completed.ResponseHeader = make(map[string]string, len(idempotentResponseHeaders))
+		for _, name := range idempotentResponseHeaders {
+			if value := writer.Header().Get(name); value != "" {
+				completed.ResponseHeader[name] = value
+			}
+		}
+		completed.ResponseBody = writer.body.Bytes()
+
+		if err := uc.Complete(settleCtx, completed); err != nil {
+			l.Error(err, "http - v1 - idempotencyMiddleware - Complete")
+		}
+	}
+}
+
+// markTransientResponse keeps the idempotency key of the request free, its response only asks the client to retry later
+func markTransientResponse(ctx *gin.Context) {
+	ctx.Set(idempotencyTransientKey, true)
+}
+
+// hashIdempotentRequest identifies the payload of a request, the same key on another route is a different payload.
+// the full RequestURI is hashed on purpose: the ?cart_id= selector is part of the payload, so replaying a key
+// against another named cart is rejected instead of answering with the response of the first cart
+func hashIdempotentRequest(req *http.Request, body []byte) string {
+	hash := sha256.New()
+	hash.Write([]byte(req.Method))
+	hash.Write([]byte{'\n'})
+	hash.Write([]byte(req.URL.RequestURI()))
+	hash.Write([]byte{'\n'})
+	hash.Write(body)
+
+	return hex.EncodeToString(hash.Sum(nil))
+}
@@ -0,0 +1,171 @@
+package v1
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/idoyudha/eshop-cart/internal/entity"
+	"github.com/idoyudha/eshop-cart/internal/usecase"
+	"github.com/idoyudha/eshop-cart/pkg/logger"
+)
+
+func TestHashIdempotentRequest(t *testing.T) {
+	base := hashIdempotentRequest(httptest.NewRequest("POST", "/v1/carts", nil), []byte(`{"product_quantity":1}`))
+
+	tests := []struct {
+		name   string
+		method string
+		target string
+		body   string
+		same   bool
+	}{
+		{name: "same request", method: "POST", target: "/v1/carts", body: `{"product_quantity":1}`, same: true},
+		{name: "other body", method: "POST", target: "/v1/carts", body: `{"product_quantity":2}`},
+		{name: "other method", method: "PUT", target: "/v1/carts", body: `{"product_quantity":1}`},
+		{name: "other path", method: "POST", target: "/v1/carts/batch", body: `{"product_quantity":1}`},
+		{name: "other cart selector", method: "POST", target: "/v1/carts?cart_id=0192e4a0-0000-7000-8000-000000000001", body: `{"product_quantity":1}`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := hashIdempotentRequest(httptest.NewRequest(tt.method, tt.target, nil), []byte(tt.body))
+			if (got == base) != tt.same {
+				t.Errorf("hash equal to the base request = %v, want %v", got == base, tt.same)
+			}
+		})
+	}
+}
+
+// fakeIdempotencyUseCase replays replay for every key and records how the key was settled
+type fakeIdempotencyUseCase struct {
+	replay    *entity.IdempotencyRecord
+	beginErr  error
+	begun     string
+	completed *entity.IdempotencyRecord
+	released  string
+}
+
+func (f *fakeIdempotencyUseCase) Begin(_ context.Context, key string, _ string) (*entity.IdempotencyRecord, error) {
+	f.begun = key
+	return f.replay, f.beginErr
+}
+
+func (f *fakeIdempotencyUseCase) Complete(_ context.Context, record *entity.IdempotencyRecord) error {
+	f.completed = record
+	return nil
+}
+
+func (f *fakeIdempotencyUseCase) Release(_ context.Context, key string) error {
+	f.released = key
+	return nil
+}
+
+func TestIdempotencyMiddleware(t *testing.T) {
+	userID := uuid.New()
+
+	tests := []struct {
+		name string
+		key  string
+		// owner set by the auth middleware, nil when the route has none
+		owner    any
+		guest    bool
+		replay   *entity.IdempotencyRecord
+		beginErr error
+		// status the handler answers, with a transient mark
+		handlerStatus int
+		transient     bool
+
+		wantStatus    int
+		wantHandled   bool
+		wantScope     string
+		wantCompleted bool
+		wantReleased  bool
+	}{
+		{name: "no key", owner: userID, handlerStatus: http.StatusCreated, wantStatus: http.StatusCreated, wantHandled: true},
+		{name: "key too long", key: strings.Repeat("k", maxIdempotencyKeyLength+1), owner: userID, wantStatus: http.StatusBadRequest},
+		{name: "no owner", key: "k1", wantStatus: http.StatusInternalServerError},
+		{
+			name: "first request is stored", key: "k1", owner: userID, handlerStatus: http.StatusCreated,
+			wantStatus: http.StatusCreated, wantHandled: true, wantScope: userID.String() + ":k1", wantCompleted: true,
+		},
+		{
+			name: "guest keys are scoped apart from users", key: "k1", owner: userID, guest: true, handlerStatus: http.StatusCreated,
+			wantStatus: http.StatusCreated, wantHandled: true, wantScope: "guest:" + userID.String() + ":k1", wantCompleted: true,
+		},
+		{
+			name: "client errors are stored", key: "k1", owner: userID, handlerStatus: http.StatusUnprocessableEntity,
+			wantStatus: http.StatusUnprocessableEntity, wantHandled: true, wantScope: userID.String() + ":k1", wantCompleted: true,
+		},
+		{
+			name: "pending checkout is released", key: "k1", owner: userID, handlerStatus: http.StatusAccepted,
+			wantStatus: http.StatusAccepted, wantHandled: true, wantScope: userID.String() + ":k1", wantReleased: true,
+		},
+		{
+			name: "transient conflict is released", key: "k1", owner: userID, handlerStatus: http.StatusConflict, transient: true,
+			wantStatus: http.StatusConflict, wantHandled: true, wantScope: userID.String() + ":k1", wantReleased: true,
+		},
+		{
+			name: "server error is released", key: "k1", owner: userID, handlerStatus: http.StatusInternalServerError,
+			wantStatus: http.StatusInternalServerError, wantHandled: true, wantScope: userID.String() + ":k1", wantReleased: true,
+		},
+		{
+			name: "completed key is replayed", key: "k1", owner: userID,
+			replay:     &entity.IdempotencyRecord{ResponseStatus: http.StatusCreated, ResponseHeader: map[string]string{"Content-Type": "application/json"}, ResponseBody: []byte(`{}`)},
+			wantStatus: http.StatusCreated, wantScope: userID.String() + ":k1",
+		},
+		{name: "key reused with another payload", key: "k1", owner: userID, beginErr: usecase.ErrIdempotencyKeyReused, wantStatus: http.StatusUnprocessableEntity, wantScope: userID.String() + ":k1"},
+		{name: "key still running", key: "k1", owner: userID, beginErr: usecase.ErrIdempotencyKeyInProgress, wantStatus: http.StatusConflict, wantScope: userID.String() + ":k1"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			gin.SetMode(gin.TestMode)
+			uc := &fakeIdempotencyUseCase{replay: tt.replay, beginErr: tt.beginErr}
+
+			handled := false
+			engine := gin.New()
+			engine.POST("/v1/carts", func(ctx *gin.Context) {
+				if tt.owner != nil {
+					ctx.Set(UserIDKey, tt.owner)
+				}
+				if tt.guest {
+					ctx.Set(GuestKey, true)
+				}
+			}, idempotencyMiddleware(uc, logger.New("error")), func(ctx *gin.Context) {
+				handled = true
+				if tt.transient {
+					markTransientResponse(ctx)
+				}
+				ctx.JSON(tt.handlerStatus, gin.H{})
+			})
+
+			req := httptest.NewRequest(http.MethodPost, "/v1/carts", strings.NewReader(`{"product_quantity":1}`))
+			if tt.key != "" {
+				req.Header.Set(IdempotencyKeyHeader, tt.key)
+			}
+			recorder := httptest.NewRecorder()
+			engine.ServeHTTP(recorder, req)
+
+			if recorder.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d: %s", recorder.Code, tt.wantStatus, recorder.Body)
+			}
+			if handled != tt.wantHandled {
+				t.Errorf("handled = %v, want %v", handled, tt.wantHandled)
+			}
+			if uc.begun != tt.wantScope {
+				t.Errorf("key = %q, want %q", uc.begun, tt.wantScope)
+			}
+			if (uc.completed != nil) != tt.wantCompleted || (uc.released != "") != tt.wantReleased {
+				t.Errorf("completed = %v, released = %v, want %v, %v", uc.completed != nil, uc.released != "", tt.wantCompleted, tt.wantReleased)
+			}
+			if tt.replay != nil && recorder.Header().Get(IdempotentReplayedHeader) != "true" {
+				t.Error("replayed response without the replay header")
+			}
+		})
+	}
+}
@@ -1,76 +1,161 @@
 package v1
 
 import (
+	"errors"
 	"time"
 
 	"github.com/google/uuid"
 	"github.com/idoyudha/eshop-cart/internal/entity"
+	"github.com/idoyudha/eshop-cart/internal/usecase"
 )
 
-func createCartRequestToCartEntity(userID uuid.UUID, req createCartRequest) entity.Cart {
-	return entity.Cart{
+func createCartRequestToCartItemEntity(userID uuid.UUID, req createCartRequest) entity.CartItem {
+	currency := req.Currency
+	if currency == "" {
+		currency = entity.DefaultCartCurrency
+	}
+
+	// v1 clients still send the decimal product_price
+	price := req.ProductPriceAmount
+	if price == 0 {
+		price = entity.ToMinorUnits(req.ProductPrice, currency)
+	}
+
+	return entity.CartItem{
 		UserID:          userID,
 		ProductID:       req.ProductID,
+		VariantID:       req.VariantID,
 		ProductName:     req.ProductName,
 		ProductImageURL: req.ProductImageURL,
-		ProductPrice:    req.ProductPrice,
+		ProductPrice:    price,
+		Currency:        currency,
 		ProductQuantity: req.ProductQuantity,
 		Note:            req.Note,
+		Options:         req.Options,
 		CreatedAt:       time.Now(),
 		UpdatedAt:       time.Now(),
 	}
 }
 
-func cartEntityToCreateCartResponse(cart entity.Cart) createCartResponse {
+func cartItemEntityToCreateCartResponse(item entity.CartItem) createCartResponse {
 	return createCartResponse{
-		ID:              cart.ID,
-		UserID:          cart.UserID,
-		ProductID:       cart.ProductID,
-		ProductName:     cart.ProductName,
-		ProductImageURL: cart.ProductImageURL,
-		ProductPrice:    cart.ProductPrice,
-		ProductQuantity: cart.ProductQuantity,
-		Note:            cart.Note,
-	}
-}
-
-func cartEntitiesToGetCartResponse(cart []*entity.Cart) []getCartResponse {
-	var res []getCartResponse
-	for _, c := range cart {
-		res = append(res, getCartResponse{
-			ID:              c.ID,
-			UserID:          c.UserID,
-			ProductID:       c.ProductID,
-			ProductName:     c.ProductName,
-			ProductImageURL: c.ProductImageURL,
-			ProductPrice:    c.ProductPrice,
-			ProductQuantity: c.ProductQuantity,
-			Note:            c.Note,
+		ID:                 item.ID,
+		CartID:             item.CartID,
+		UserID:             item.UserID,
+		ProductID:          item.ProductID,
+		VariantID:          item.VariantID,
+		ProductName:        item.ProductName,
+		ProductImageURL:    item.ProductImageURL,
+		ProductPrice:       entity.FromMinorUnits(item.ProductPrice, item.Currency),
+		ProductPriceAmount: item.ProductPrice,
+		Currency:           item.Currency,
+		ProductQuantity:    item.ProductQuantity,
+		Note:               item.Note,
+		Options:            item.Options,
+		Version:            item.Version,
+	}
+}
+
+func cartEntityToGetCartResponse(cart *entity.Cart) getCartResponse {
+	items := make([]getCartItemResponse, 0, len(cart.Items))
+	for _, item := range cart.Items {
+		items = append(items, getCartItemResponse{
+			ID:                 item.ID,
+			CartID:             item.CartID,
+			ProductID:          item.ProductID,
+			VariantID:          item.VariantID,
+			ProductName:        item.ProductName,
+			ProductImageURL:    item.ProductImageURL,
+			ProductPrice:       entity.FromMinorUnits(item.ProductPrice, item.Currency),
+			ProductPriceAmount: item.ProductPrice,
+			Currency:           item.Currency,
+			ProductQuantity:    item.ProductQuantity,
+			Note:               item.Note,
+			Options:            item.Options,
+			Version:            item.Version,
 		})
 	}
-	return res
+
+	return getCartResponse{
+		ID:             cart.ID,
+		UserID:         cart.UserID,
+		Name:           cart.Name,
+		Default:        cart.Default,
+		Currency:       cart.Currency,
+		Status:         cart.Status,
+		Subtotal:       entity.FromMinorUnits(cart.Subtotal(), cart.Currency),
+		SubtotalAmount: cart.Subtotal(),
+		ItemCount:      cart.ItemCount(),
+		Items:          items,
+	}
 }
 
-func updateCartRequestToCartEntity(cartID uuid.UUID, userID uuid.UUID, req updateCartRequest) entity.Cart {
-	return entity.Cart{
-		ID:              cartID,
+func updateCartRequestToCartItemEntity(itemID uuid.UUID, userID uuid.UUID, version int64, req updateCartRequest) entity.CartItem {
+	return entity.CartItem{
+		ID:              itemID,
 		UserID:          userID,
-		ProductQuantity: req.ProductQuantity,
+		ProductQuantity: *req.ProductQuantity,
 		Note:            req.Note,
+		Version:         version,
 		UpdatedAt:       time.Now(),
 	}
 }
 
-func cartEntityToUpdateCartResponse(cart entity.Cart) updateCartResponse {
+func cartItemEntityToUpdateCartResponse(item entity.CartItem) updateCartResponse {
 	return updateCartResponse{
-		ID:              cart.ID,
-		UserID:          cart.UserID,
-		ProductID:       cart.ProductID,
-		ProductName:     cart.ProductName,
-		ProductImageURL: cart.ProductImageURL,
-		ProductPrice:    cart.ProductPrice,
-		ProductQuantity: cart.ProductQuantity,
-		Note:            cart.Note,
+		ID:                 item.ID,
+		CartID:             item.CartID,
+		UserID:             item.UserID,
+		ProductID:          item.ProductID,
+		VariantID:          item.VariantID,
+		ProductName:        item.ProductName,
+		ProductImageURL:    item.ProductImageURL,
+		ProductPrice:       entity.FromMinorUnits(item.ProductPrice, item.Currency),
+		ProductPriceAmount: item.ProductPrice,
+		Currency:           item.Currency,
+		ProductQuantity:    item.ProductQuantity,
+		Note:               item.Note,
+		Options:            item.Options,
+		Version:            item.Version,
+	}
+}
+
+func cartItemEntitiesToSavedCartItemResponse(items []*entity.CartItem) []savedCartItemResponse {
+	response := make([]savedCartItemResponse, 0, len(items))
+	for _, item := range items {
+		response = append(response, savedCartItemResponse{
+			ID:                 item.ID,
+			CartID:             item.CartID,
+			ProductID:          item.ProductID,
+			VariantID:          item.VariantID,
+			ProductName:        item.ProductName,
+			ProductImageURL:    item.ProductImageURL,
+			ProductPriceAmount: item.ProductPrice,
+			Currency:           item.Currency,
+			ProductQuantity:    item.ProductQuantity,
+			Note:               item.Note,
+			Options:            item.Options,
+			Version:            item.Version,
+		})
+	}
+	return response
+}
+
+func cartItemEntityToMoveCartItemResponse(item entity.CartItem) moveCartItemResponse {
+	return moveCartItemResponse{
+		ID:                 item.ID,
+		CartID:             item.CartID,
+		ProductID:          item.ProductID,
+		VariantID:          item.VariantID,
+		ProductName:        item.ProductName,
+		ProductImageURL:    item.ProductImageURL,
+		ProductPriceAmount: item.ProductPrice,
+		Currency:           item.Currency,
+		ProductQuantity:    item.ProductQuantity,
+		Note:               item.Note,
+		Options:            item.Options,
+		List:               item.List,
+		Version:            item.Version,
 	}
 }
 
@@ -82,3 +167,146 @@ func checkoutAddressRequestToCheckoutAddressEntity(req checkoutAddressRequest) e
 		ZipCode: req.ZipCode,
 	}
 }
+
+func cartEventEntitiesToCartEventResponse(events []*entity.CartEvent) []cartEventResponse {
+	response := make([]cartEventResponse, 0, len(events))
+	for _, event := range events {
+		response = append(response, cartEventResponse{
+			ID:        event.ID,
+			CartID:    event.CartID,
+			ItemID:    event.ItemID,
+			EventType: event.EventType,
+			Actor:     event.Actor,
+			Source:    event.Source,
+			Before:    cartItemSnapshotToCartEventSnapshotResponse(event.Before),
+			After:     cartItemSnapshotToCartEventSnapshotResponse(event.After),
+			CreatedAt: event.CreatedAt,
+		})
+	}
+	return response
+}
+
+func cartItemSnapshotToCartEventSnapshotResponse(snapshot *entity.CartItemSnapshot) *cartEventSnapshotResponse {
+	if snapshot == nil {
+		return nil
+	}
+	return &cartEventSnapshotResponse{
+		ProductID:          snapshot.ProductID,
+		VariantID:          snapshot.VariantID,
+		ProductName:        snapshot.ProductName,
+		ProductPriceAmount: snapshot.ProductPrice,
+		Currency:           snapshot.Currency,
+		ProductQuantity:    snapshot.ProductQuantity,
+		Note:               snapshot.Note,
+		Options:            snapshot.Options,
+		List:               snapshot.List,
+		Version:            snapshot.Version,
+	}
+}
+
+func cartItemEntitiesToRemovedCartItemResponse(items []*entity.CartItem) []removedCartItemResponse {
+	response := make([]removedCartItemResponse, 0, len(items))
+	for _, item := range items {
+		response = append(response, removedCartItemResponse{
+			ID:                 item.ID,
+			CartID:             item.CartID,
+			ProductID:          item.ProductID,
+			VariantID:          item.VariantID,
+			ProductName:        item.ProductName,
+			ProductImageURL:    item.ProductImageURL,
+			ProductPriceAmount: item.ProductPrice,
+			Currency:           item.Currency,
+			ProductQuantity:    item.ProductQuantity,
+			Note:               item.Note,
+			Options:            item.Options,
+			List:               item.List,
+			DeletedAt:          item.DeletedAt,
+		})
+	}
+	return response
+}
+
+func cartItemEntityToRestoreCartItemResponse(item entity.CartItem) restoreCartItemResponse {
+	return restoreCartItemResponse{
+		ID:                 item.ID,
+		CartID:             item.CartID,
+		ProductID:          item.ProductID,
+		VariantID:          item.VariantID,
+		ProductName:        item.ProductName,
+		ProductImageURL:    item.ProductImageURL,
+		ProductPriceAmount: item.ProductPrice,
+		Currency:           item.Currency,
+		ProductQuantity:    item.ProductQuantity,
+		Note:               item.Note,
+		Options:            item.Options,
+		List:               item.List,
+		Version:            item.Version,
+	}
+}
+
+func cartBatchResultsToCreateCartsItemResponse(results []usecase.CartBatchResult) []createCartsItemResponse {
+	response := make([]createCartsItemResponse, len(results))
+	for i, result := range results {
+		response[i].Index = i
+		if result.Err == nil {
+			item := cartItemEntityToCreateCartResponse(result.Item)
+			response[i].Status = batchItemStatusAdded
+			response[i].Item = &item
+			continue
+		}
+
+		response[i].Status = batchItemStatusFailed
+		response[i].Error = &errorMessage{Message: result.Err.Error()}
+		var validation *usecase.ValidationError
+		if errors.As(result.Err, &validation) {
+			response[i].Error.Fields = fieldViolationsToFieldErrors(validation.Violations)
+		}
+	}
+	return response
+}
+
+func cartSnapshotEntityToCartSnapshotResponse(snapshot *entity.CartSnapshot) cartSnapshotResponse {
+	items := make([]cartSnapshotItemResponse, len(snapshot.Items))
+	for i, item := range snapshot.Items {
+		items[i] = cartSnapshotItemResponse{
+			ProductID:          item.ProductID,
+			VariantID:          item.VariantID,
+			ProductName:        item.ProductName,
+			ProductImageURL:    item.ProductImageURL,
+			ProductPriceAmount: item.ProductPrice,
+			Currency:           item.Currency,
+			ProductQuantity:    item.ProductQuantity,
+			Note:               item.Note,
+			Options:            item.Options,
+		}
+	}
+
+	return cartSnapshotResponse{
+		ID:             snapshot.ID,
+		Currency:       snapshot.Currency,
+		SubtotalAmount: snapshot.Subtotal(),
+		Items:          items,
+		ExpiresAt:      snapshot.ExpiresAt,
+		CreatedAt:      snapshot.CreatedAt,
+	}
+}
+
+func cartEntityToNamedCartResponse(cart *entity.Cart) namedCartResponse {
+	return namedCartResponse{
+		ID:        cart.ID,
+		Name:      cart.Name,
+		Default:   cart.Default,
+		Currency:  cart.Currency,
+		Status:    cart.Status,
+		CreatedAt: cart.CreatedAt,
+		UpdatedAt: cart.UpdatedAt,
+	}
+}
+
+func cartEntitiesToNamedCartResponse(carts []*entity.Cart) []namedCartResponse {
+	response := make([]namedCartResponse, 0, len(carts))
+	for _, cart := range carts {
+		response = append(response, cartEntityToNamedCartResponse(cart))
+	}
+	return response
+}
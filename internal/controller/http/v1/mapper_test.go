@@ -0,0 +1,46 @@
+package v1
+
+import (
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/idoyudha/eshop-cart/internal/entity"
+)
+
+func TestCreateCartRequestPrice(t *testing.T) {
+	tests := []struct {
+		name         string
+		req          createCartRequest
+		wantPrice    int64
+		wantCurrency string
+	}{
+		{name: "minor units", req: createCartRequest{ProductPriceAmount: 1999, Currency: "USD"}, wantPrice: 1999, wantCurrency: "USD"},
+		{name: "minor units win over the decimal price", req: createCartRequest{ProductPriceAmount: 1999, ProductPrice: 5, Currency: "USD"}, wantPrice: 1999, wantCurrency: "USD"},
+		{name: "decimal price of a v1 client", req: createCartRequest{ProductPrice: 19.99, Currency: "EUR"}, wantPrice: 1999, wantCurrency: "EUR"},
+		{name: "decimal price without minor unit", req: createCartRequest{ProductPrice: 1500, Currency: "JPY"}, wantPrice: 1500, wantCurrency: "JPY"},
+		{name: "no currency", req: createCartRequest{ProductPrice: 19.99}, wantPrice: 1999, wantCurrency: entity.DefaultCartCurrency},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			item := createCartRequestToCartItemEntity(uuid.New(), tt.req)
+			if item.ProductPrice != tt.wantPrice || item.Currency != tt.wantCurrency {
+				t.Errorf("item price = %d %s, want %d %s", item.ProductPrice, item.Currency, tt.wantPrice, tt.wantCurrency)
+			}
+		})
+	}
+}
+
+func TestCartResponsePrices(t *testing.T) {
+	cart := &entity.Cart{Currency: "KWD", Items: []*entity.CartItem{
+		{ProductPrice: 1234, Currency: "KWD", ProductQuantity: 2},
+	}}
+
+	response := cartEntityToGetCartResponse(cart)
+	if response.SubtotalAmount != 2468 || response.Subtotal != 2.468 {
+		t.Errorf("subtotal = %d (%v), want 2468 (2.468)", response.SubtotalAmount, response.Subtotal)
+	}
+	if item := response.Items[0]; item.ProductPriceAmount != 1234 || item.ProductPrice != 1.234 {
+		t.Errorf("item price = %d (%v), want 1234 (1.234)", item.ProductPriceAmount, item.ProductPrice)
+	}
+}
@@ -10,11 +10,19 @@ import (
 	"github.com/gin-gonic/gin"
 	"github.com/google/uuid"
 	"github.com/idoyudha/eshop-cart/config"
+	"github.com/idoyudha/eshop-cart/internal/entity"
+	"github.com/idoyudha/eshop-cart/internal/usecase"
 )
 
 const (
 	UserIDKey = "userID"
 	TokenKey  = "token"
+	GuestKey  = "guest"
+	CartIDKey = "cartID"
+
+	CartTokenHeader = "X-Cart-Token"
+	// query parameter selecting one of the named carts of the user
+	CartSelectorParam = "cart_id"
 )
 
 type authSuccessResponse struct {
@@ -70,6 +78,69 @@ func cognitoMiddleware(auth config.AuthService) gin.HandlerFunc {
 		}
 
 		ctx.Set(UserIDKey, authSuccessResponse.Data.UserID)
+		ctx.Request = ctx.Request.WithContext(usecase.ContextWithActor(ctx.Request.Context(), entity.CartActor{
+			ID:     authSuccessResponse.Data.UserID.String(),
+			Source: entity.CartEventSourceHTTP,
+		}))
+		ctx.Next()
+	}
+}
+
+// cartOwnerMiddleware authenticates the user like cognitoMiddleware when an Authorization header is sent,
+// otherwise the shopper is the guest of the signed cart token in the X-Cart-Token header
+func cartOwnerMiddleware(authMid gin.HandlerFunc, uc usecase.Cart) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		if ctx.GetHeader("Authorization") != "" {
+			authMid(ctx)
+			return
+		}
+
+		cartToken := ctx.GetHeader(CartTokenHeader)
+		if cartToken == "" {
+			ctx.JSON(http.StatusUnauthorized, newUnauthorizedError("unauthorized"))
+			ctx.Abort()
+			return
+		}
+
+		guestID, err := uc.ParseGuestCartToken(cartToken)
+		if err != nil {
+			ctx.JSON(http.StatusUnauthorized, newUnauthorizedError(err.Error()))
+			ctx.Abort()
+			return
+		}
+
+		ctx.Set(UserIDKey, guestID)
+		ctx.Set(GuestKey, true)
+		ctx.Request = ctx.Request.WithContext(usecase.ContextWithActor(ctx.Request.Context(), entity.CartActor{
+			ID:     "guest:" + guestID.String(),
+			Source: entity.CartEventSourceHTTP,
+		}))
+		ctx.Next()
+	}
+}
+
+// cartSelectorMiddleware reads the optional cart selector, handlers use the default cart when it is missing
+func cartSelectorMiddleware() gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		cartID := uuid.Nil
+		if selector := ctx.Query(CartSelectorParam); selector != "" {
+			parsed, err := uuid.Parse(selector)
+			if err != nil {
+				ctx.JSON(http.StatusBadRequest, newBadRequestError(CartSelectorParam+" must be a cart id"))
+				ctx.Abort()
+				return
+			}
+			cartID = parsed
+		}
+
+		ctx.Set(CartIDKey, cartID)
 		ctx.Next()
 	}
 }
+
+// selectedCartID is the cart chosen with the cart selector, uuid.Nil for the default cart
+func selectedCartID(ctx *gin.Context) uuid.UUID {
+	cartID, _ := ctx.Get(CartIDKey)
+	selected, _ := cartID.(uuid.UUID)
+	return selected
+}
@@ -0,0 +1,175 @@
+package v1
+
+import (
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/idoyudha/eshop-cart/internal/entity"
+)
+
+type namedCartResponse struct {
+	ID        uuid.UUID `json:"id"`
+	Name      string    `json:"name"`
+	Default   bool      `json:"default"`
+	Currency  string    `json:"currency"`
+	Status    string    `json:"status"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// list the carts of the user without their lines
+func (r *cartRoutes) listCarts(ctx *gin.Context) {
+	userID, exist := ctx.Get(UserIDKey)
+	if !exist {
+		r.l.Error("not exist", "http - v1 - cartRoutes - listCarts")
+		ctx.JSON(http.StatusInternalServerError, newInternalServerError("user id not exist"))
+		return
+	}
+
+	carts, err := r.uc.ListCarts(ctx.Request.Context(), userID.(uuid.UUID))
+	if err != nil {
+		r.l.Error(err, "http - v1 - cartRoutes - listCarts")
+		ctx.JSON(http.StatusInternalServerError, newInternalServerError(err.Error()))
+		return
+	}
+
+	ctx.JSON(http.StatusOK, newGetSuccess(cartEntitiesToNamedCartResponse(carts)))
+}
+
+type createNamedCartRequest struct {
+	Name     string `json:"name" binding:"required,max=64"`
+	Currency string `json:"currency" binding:"omitempty,iso4217"`
+}
+
+// create an empty named cart, the first cart of the user becomes the default cart
+func (r *cartRoutes) createNamedCart(ctx *gin.Context) {
+	var req createNamedCartRequest
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		r.l.Error(err, "http - v1 - cartRoutes - createNamedCart")
+		ctx.JSON(http.StatusBadRequest, newBadRequestError(err.Error()))
+		return
+	}
+
+	name := strings.TrimSpace(req.Name)
+	if name == "" {
+		ctx.JSON(http.StatusBadRequest, newBadRequestError("name is required"))
+		return
+	}
+
+	currency := req.Currency
+	if currency == "" {
+		currency = entity.DefaultCartCurrency
+	}
+
+	userID, exist := ctx.Get(UserIDKey)
+	if !exist {
+		r.l.Error("not exist", "http - v1 - cartRoutes - createNamedCart")
+		ctx.JSON(http.StatusInternalServerError, newInternalServerError("user id not exist"))
+		return
+	}
+
+	cart, err := r.uc.CreateNamedCart(ctx.Request.Context(), userID.(uuid.UUID), name, currency)
+	if err != nil {
+		r.l.Error(err, "http - v1 - cartRoutes - createNamedCart")
+		writeUseCaseError(ctx, err)
+		return
+	}
+
+	ctx.JSON(http.StatusCreated, newCreateSuccess(cartEntityToNamedCartResponse(cart)))
+}
+
+type renameCartRequest struct {
+	Name string `json:"name" binding:"required,max=64"`
+}
+
+func (r *cartRoutes) renameCart(ctx *gin.Context) {
+	cartID, err := uuid.Parse(ctx.Param("cartID"))
+	if err != nil {
+		r.l.Error(err, "http - v1 - cartRoutes - renameCart")
+		ctx.JSON(http.StatusBadRequest, newBadRequestError(err.Error()))
+		return
+	}
+
+	var req renameCartRequest
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		r.l.Error(err, "http - v1 - cartRoutes - renameCart")
+		ctx.JSON(http.StatusBadRequest, newBadRequestError(err.Error()))
+		return
+	}
+
+	name := strings.TrimSpace(req.Name)
+	if name == "" {
+		ctx.JSON(http.StatusBadRequest, newBadRequestError("name is required"))
+		return
+	}
+
+	userID, exist := ctx.Get(UserIDKey)
+	if !exist {
+		r.l.Error("not exist", "http - v1 - cartRoutes - renameCart")
+		ctx.JSON(http.StatusInternalServerError, newInternalServerError("user id not exist"))
+		return
+	}
+
+	cart, err := r.uc.RenameCart(ctx.Request.Context(), userID.(uuid.UUID), cartID, name)
+	if err != nil {
+		r.l.Error(err, "http - v1 - cartRoutes - renameCart")
+		writeUseCaseError(ctx, err)
+		return
+	}
+
+	ctx.JSON(http.StatusOK, newUpdateSuccess(cartEntityToNamedCartResponse(cart)))
+}
+
+// delete a named cart and its lines, the default cart cannot be deleted
+func (r *cartRoutes) deleteNamedCart(ctx *gin.Context) {
+	cartID, err := uuid.Parse(ctx.Param("cartID"))
+	if err != nil {
+		r.l.Error(err, "http - v1 - cartRoutes - deleteNamedCart")
+		ctx.JSON(http.StatusBadRequest, newBadRequestError(err.Error()))
+		return
+	}
+
+	userID, exist := ctx.Get(UserIDKey)
+	if !exist {
+		r.l.Error("not exist", "http - v1 - cartRoutes - deleteNamedCart")
+		ctx.JSON(http.StatusInternalServerError, newInternalServerError("user id not exist"))
+		return
+	}
+
+	if err := r.uc.DeleteNamedCart(ctx.Request.Context(), userID.(uuid.UUID), cartID); err != nil {
+		r.l.Error(err, "http - v1 - cartRoutes - deleteNamedCart")
+		writeUseCaseError(ctx, err)
+		return
+	}
+
+	ctx.JSON(http.StatusOK, newDeleteSuccess())
+}
+
+// make a cart the default one, used by every endpoint called without a cart selector
+func (r *cartRoutes) setDefaultCart(ctx *gin.Context) {
+	cartID, err := uuid.Parse(ctx.Param("cartID"))
+	if err != nil {
+		r.l.Error(err, "http - v1 - cartRoutes - setDefaultCart")
+		ctx.JSON(http.StatusBadRequest, newBadRequestError(err.Error()))
+		return
+	}
+
+	userID, exist := ctx.Get(UserIDKey)
+	if !exist {
+		r.l.Error("not exist", "http - v1 - cartRoutes - setDefaultCart")
+		ctx.JSON(http.StatusInternalServerError, newInternalServerError("user id not exist"))
+		return
+	}
+
+	cart, err := r.uc.SetDefaultCart(ctx.Request.Context(), userID.(uuid.UUID), cartID)
+	if err != nil {
+		r.l.Error(err, "http - v1 - cartRoutes - setDefaultCart")
+		writeUseCaseError(ctx, err)
+		return
+	}
+
+	ctx.JSON(http.StatusOK, newUpdateSuccess(cartEntityToNamedCartResponse(cart)))
+}
@@ -0,0 +1,66 @@
+package v1
+
+import (
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// fixedWindowLimiter counts the requests of each client in the current window, every counter is dropped when
+// the window ends so memory stays bounded by the clients of one window
+type fixedWindowLimiter struct {
+	mu          sync.Mutex
+	limit       int
+	window      time.Duration
+	windowStart time.Time
+	counts      map[string]int
+}
+
+// allow reports whether the client may make another request, otherwise how long until the next window
+func (l *fixedWindowLimiter) allow(client string, now time.Time) (bool, time.Duration) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if now.Sub(l.windowStart) >= l.window {
+		l.windowStart = now
+		l.counts = make(map[string]int)
+	}
+
+	if l.counts[client] >= l.limit {
+		return false, l.windowStart.Add(l.window).Sub(now)
+	}
+	l.counts[client]++
+
+	return true, 0
+}
+
+// rateLimitMiddleware allows each client ip limit requests per window on this instance, a zero limit or window disables it
+func rateLimitMiddleware(limit int, window time.Duration) gin.HandlerFunc {
+	if limit <= 0 || window <= 0 {
+		return func(ctx *gin.Context) {
+			ctx.Next()
+		}
+	}
+
+	limiter := &fixedWindowLimiter{
+		limit:  limit,
+		window: window,
+		counts: make(map[string]int),
+	}
+
+	return func(ctx *gin.Context) {
+		allowed, retryAfter := limiter.allow(ctx.ClientIP(), time.Now())
+		if !allowed {
+			seconds := int((retryAfter + time.Second - 1) / time.Second)
+			ctx.Header("Retry-After", strconv.Itoa(seconds))
+			ctx.JSON(http.StatusTooManyRequests, newTooManyRequestsError("too many requests, retry later"))
+			ctx.Abort()
+			return
+		}
+
+		ctx.Next()
+	}
+}
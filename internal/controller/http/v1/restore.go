@@ -0,0 +1,104 @@
+package v1
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+const defaultRemovedDays = 7
+
+type getRemovedItemsRequest struct {
+	Days int `form:"days" binding:"omitempty,min=1,max=30"`
+}
+
+type removedCartItemResponse struct {
+	ID                 uuid.UUID         `json:"id"`
+	CartID             uuid.UUID         `json:"cart_id"`
+	ProductID          uuid.UUID         `json:"product_id"`
+	VariantID          uuid.UUID         `json:"variant_id"`
+	ProductName        string            `json:"product_name"`
+	ProductImageURL    string            `json:"product_image_url"`
+	ProductPriceAmount int64             `json:"product_price_amount"`
+	Currency           string            `json:"currency"`
+	ProductQuantity    int64             `json:"product_quantity"`
+	Note               string            `json:"note"`
+	Options            map[string]string `json:"options,omitempty"`
+	List               string            `json:"list"`
+	DeletedAt          time.Time         `json:"deleted_at"`
+}
+
+// get the lines removed in the last days, 7 by default
+func (r *cartRoutes) getRemovedItems(ctx *gin.Context) {
+	var req getRemovedItemsRequest
+	if err := ctx.ShouldBindQuery(&req); err != nil {
+		r.l.Error(err, "http - v1 - cartRoutes - getRemovedItems")
+		ctx.JSON(http.StatusBadRequest, newBadRequestError(err.Error()))
+		return
+	}
+	if req.Days == 0 {
+		req.Days = defaultRemovedDays
+	}
+
+	userID, exist := ctx.Get(UserIDKey)
+	if !exist {
+		r.l.Error("not exist", "http - v1 - cartRoutes - getRemovedItems")
+		ctx.JSON(http.StatusInternalServerError, newInternalServerError("user id not exist"))
+		return
+	}
+
+	items, err := r.uc.GetRemovedItems(ctx.Request.Context(), userID.(uuid.UUID), time.Duration(req.Days)*24*time.Hour)
+	if err != nil {
+		r.l.Error(err, "http - v1 - cartRoutes - getRemovedItems")
+		ctx.JSON(http.StatusInternalServerError, newInternalServerError(err.Error()))
+		return
+	}
+
+	ctx.JSON(http.StatusOK, newGetSuccess(cartItemEntitiesToRemovedCartItemResponse(items)))
+}
+
+type restoreCartItemResponse struct {
+	ID                 uuid.UUID         `json:"id"`
+	CartID             uuid.UUID         `json:"cart_id"`
+	ProductID          uuid.UUID         `json:"product_id"`
+	VariantID          uuid.UUID         `json:"variant_id"`
+	ProductName        string            `json:"product_name"`
+	ProductImageURL    string            `json:"product_image_url"`
+	ProductPriceAmount int64             `json:"product_price_amount"`
+	Currency           string            `json:"currency"`
+	ProductQuantity    int64             `json:"product_quantity"`
+	Note               string            `json:"note"`
+	Options            map[string]string `json:"options,omitempty"`
+	List               string            `json:"list"`
+	Version            int64             `json:"version"`
+}
+
+// restore a removed line, the returned line is the one it was merged into when the product was added again
+func (r *cartRoutes) restoreCartItem(ctx *gin.Context) {
+	itemID, err := uuid.Parse(ctx.Param("id"))
+	if err != nil {
+		r.l.Error(err, "http - v1 - cartRoutes - restoreCartItem")
+		ctx.JSON(http.StatusBadRequest, newBadRequestError(err.Error()))
+		return
+	}
+
+	userID, exist := ctx.Get(UserIDKey)
+	if !exist {
+		r.l.Error("not exist", "http - v1 - cartRoutes - restoreCartItem")
+		ctx.JSON(http.StatusInternalServerError, newInternalServerError("user id not exist"))
+		return
+	}
+
+	item, err := r.uc.RestoreCartItem(ctx.Request.Context(), userID.(uuid.UUID), itemID)
+	if err != nil {
+		r.l.Error(err, "http - v1 - cartRoutes - restoreCartItem")
+		writeUseCaseError(ctx, err)
+		return
+	}
+
+	ctx.Header(ETagHeader, cartItemETag(item.Version))
+
+	ctx.JSON(http.StatusOK, newUpdateSuccess(cartItemEntityToRestoreCartItemResponse(item)))
+}
@@ -1,6 +1,7 @@
 package v1
 
 import (
+	"expvar"
 	"net/http"
 
 	"github.com/gin-contrib/cors"
@@ -13,16 +14,19 @@ import (
 func NewRouter(
 	handler *gin.Engine,
 	ucc usecase.Cart,
+	ucs usecase.CartSnapshot,
+	uci usecase.Idempotency,
 	l logger.Interface,
 	auth config.AuthService,
+	guestCart config.GuestCart,
 ) {
 	// handler.Use(gin.Logger())
 	// handler.Use(gin.Recovery())
 	handler.Use(cors.New(cors.Config{
 		AllowOrigins:     []string{"http://localhost:3000"},
 		AllowMethods:     []string{"GET", "POST", "PUT", "PATCH", "DELETE", "OPTIONS"},
-		AllowHeaders:     []string{"Origin", "Content-Type", "Accept", "Authorization"},
-		ExposeHeaders:    []string{"Content-Length"},
+		AllowHeaders:     []string{"Origin", "Content-Type", "Accept", "Authorization", "If-Match", "Idempotency-Key", "X-Cart-Token"},
+		ExposeHeaders:    []string{"Content-Length", "ETag", "Idempotent-Replayed"},
 		AllowCredentials: true,
 		MaxAge:           12 * 3600,
 	}))
@@ -31,9 +35,16 @@ func NewRouter(
 		c.Status(http.StatusOK)
 	})
 	authMid := cognitoMiddleware(auth)
+	idempotencyMid := idempotencyMiddleware(uci, l)
 
-	h := handler.Group("/v1")
+	h := handler.Group("/v1", cartSelectorMiddleware())
 	{
-		newCartRoutes(h, ucc, l, authMid)
+		newCartRoutes(h, ucc, l, authMid, idempotencyMid, rateLimitMiddleware(guestCart.CreateLimit, guestCart.CreateWindow))
+		newCartSnapshotRoutes(h, ucs, ucc, l, authMid, idempotencyMid)
 	}
 }
+
+// NewAdminRouter serves the operational endpoints, it must not be exposed with the public router
+func NewAdminRouter(handler *gin.Engine) {
+	handler.GET("/debug/vars", gin.WrapH(expvar.Handler()))
+}
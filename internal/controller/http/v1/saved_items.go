@@ -0,0 +1,117 @@
+package v1
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/idoyudha/eshop-cart/internal/entity"
+)
+
+type savedCartItemResponse struct {
+	ID                 uuid.UUID         `json:"id"`
+	CartID             uuid.UUID         `json:"cart_id"`
+	ProductID          uuid.UUID         `json:"product_id"`
+	VariantID          uuid.UUID         `json:"variant_id"`
+	ProductName        string            `json:"product_name"`
+	ProductImageURL    string            `json:"product_image_url"`
+	ProductPriceAmount int64             `json:"product_price_amount"`
+	Currency           string            `json:"currency"`
+	ProductQuantity    int64             `json:"product_quantity"`
+	Note               string            `json:"note"`
+	Options            map[string]string `json:"options,omitempty"`
+	Version            int64             `json:"version"`
+}
+
+// get the lines saved for later
+func (r *cartRoutes) getSavedItems(ctx *gin.Context) {
+	userID, exist := ctx.Get(UserIDKey)
+	if !exist {
+		r.l.Error("not exist", "http - v1 - cartRoutes - getSavedItems")
+		ctx.JSON(http.StatusInternalServerError, newInternalServerError("user id not exist"))
+		return
+	}
+
+	items, err := r.uc.GetSavedItems(ctx.Request.Context(), userID.(uuid.UUID), selectedCartID(ctx))
+	if err != nil {
+		r.l.Error(err, "http - v1 - cartRoutes - getSavedItems")
+		writeUseCaseError(ctx, err)
+		return
+	}
+
+	ctx.JSON(http.StatusOK, newGetSuccess(cartItemEntitiesToSavedCartItemResponse(items)))
+}
+
+// exactly one of list, to move between the cart and the saved for later list, or cart_id, to move to another named cart
+type moveCartItemRequest struct {
+	List   string     `json:"list" binding:"required_without=CartID,excluded_with=CartID,omitempty,oneof=cart saved"`
+	CartID *uuid.UUID `json:"cart_id"`
+}
+
+type moveCartItemResponse struct {
+	ID                 uuid.UUID         `json:"id"`
+	CartID             uuid.UUID         `json:"cart_id"`
+	ProductID          uuid.UUID         `json:"product_id"`
+	VariantID          uuid.UUID         `json:"variant_id"`
+	ProductName        string            `json:"product_name"`
+	ProductImageURL    string            `json:"product_image_url"`
+	ProductPriceAmount int64             `json:"product_price_amount"`
+	Currency           string            `json:"currency"`
+	ProductQuantity    int64             `json:"product_quantity"`
+	Note               string            `json:"note"`
+	Options            map[string]string `json:"options,omitempty"`
+	List               string            `json:"list"`
+	Version            int64             `json:"version"`
+}
+
+// move a line between the active cart and the saved for later list, or to another named cart
+func (r *cartRoutes) moveCartItem(ctx *gin.Context) {
+	itemID, err := uuid.Parse(ctx.Param("id"))
+	if err != nil {
+		r.l.Error(err, "http - v1 - cartRoutes - moveCartItem")
+		ctx.JSON(http.StatusBadRequest, newBadRequestError(err.Error()))
+		return
+	}
+
+	var req moveCartItemRequest
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		r.l.Error(err, "http - v1 - cartRoutes - moveCartItem")
+		ctx.JSON(http.StatusBadRequest, newBadRequestError(err.Error()))
+		return
+	}
+
+	if req.CartID != nil && *req.CartID == uuid.Nil {
+		ctx.JSON(http.StatusBadRequest, newBadRequestError("cart_id must be a cart id"))
+		return
+	}
+
+	version, err := parseIfMatch(ctx.GetHeader(IfMatchHeader))
+	if err != nil {
+		r.l.Error(err, "http - v1 - cartRoutes - moveCartItem")
+		ctx.JSON(http.StatusBadRequest, newBadRequestError(err.Error()))
+		return
+	}
+
+	userID, exist := ctx.Get(UserIDKey)
+	if !exist {
+		r.l.Error("not exist", "http - v1 - cartRoutes - moveCartItem")
+		ctx.JSON(http.StatusInternalServerError, newInternalServerError("user id not exist"))
+		return
+	}
+
+	var item entity.CartItem
+	if req.CartID != nil {
+		item, err = r.uc.MoveItemToCart(ctx.Request.Context(), userID.(uuid.UUID), itemID, version, *req.CartID)
+	} else {
+		item, err = r.uc.MoveCartItem(ctx.Request.Context(), userID.(uuid.UUID), itemID, version, req.List)
+	}
+	if err != nil {
+		r.l.Error(err, "http - v1 - cartRoutes - moveCartItem")
+		writeUseCaseError(ctx, err)
+		return
+	}
+
+	ctx.Header(ETagHeader, cartItemETag(item.Version))
+
+	ctx.JSON(http.StatusOK, newUpdateSuccess(cartItemEntityToMoveCartItemResponse(item)))
+}
@@ -0,0 +1,56 @@
+package v1
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/idoyudha/eshop-cart/internal/entity"
+	"github.com/idoyudha/eshop-cart/pkg/logger"
+)
+
+func TestMoveCartItemRequest(t *testing.T) {
+	targetID := uuid.New()
+
+	tests := []struct {
+		name       string
+		body       string
+		wantStatus int
+		wantCart   uuid.UUID
+		wantList   string
+	}{
+		{name: "to another cart", body: `{"cart_id":"` + targetID.String() + `"}`, wantStatus: http.StatusOK, wantCart: targetID},
+		{name: "to the saved list", body: `{"list":"saved"}`, wantStatus: http.StatusOK, wantList: entity.CartItemListSaved},
+		{name: "nil cart id", body: `{"cart_id":"00000000-0000-0000-0000-000000000000"}`, wantStatus: http.StatusBadRequest},
+		{name: "both list and cart id", body: `{"list":"saved","cart_id":"` + targetID.String() + `"}`, wantStatus: http.StatusBadRequest},
+		{name: "neither", body: `{}`, wantStatus: http.StatusBadRequest},
+		{name: "unknown list", body: `{"list":"wishlist"}`, wantStatus: http.StatusBadRequest},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var gotCart uuid.UUID
+			var gotList string
+			uc := &fakeCartUseCase{
+				moveItemToCart: func(_ uuid.UUID, _ uuid.UUID, _ int64, cartID uuid.UUID) (entity.CartItem, error) {
+					gotCart = cartID
+					return entity.CartItem{CartID: cartID, Version: 2}, nil
+				},
+				moveCartItem: func(_ uuid.UUID, _ uuid.UUID, _ int64, list string) (entity.CartItem, error) {
+					gotList = list
+					return entity.CartItem{List: list, Version: 2}, nil
+				},
+			}
+
+			routes := &cartRoutes{uc: uc, l: logger.New("error")}
+			recorder := serveHandler(t, routes.moveCartItem, http.MethodPost, gin.Params{{Key: "id", Value: uuid.NewString()}}, nil, tt.body)
+			if recorder.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d: %s", recorder.Code, tt.wantStatus, recorder.Body)
+			}
+			if gotCart != tt.wantCart || gotList != tt.wantList {
+				t.Errorf("moved to cart %s list %q, want cart %s list %q", gotCart, gotList, tt.wantCart, tt.wantList)
+			}
+		})
+	}
+}
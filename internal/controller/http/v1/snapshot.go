@@ -0,0 +1,100 @@
+package v1
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/idoyudha/eshop-cart/internal/usecase"
+	"github.com/idoyudha/eshop-cart/pkg/logger"
+)
+
+type cartSnapshotRoutes struct {
+	uc usecase.CartSnapshot
+	l  logger.Interface
+}
+
+func newCartSnapshotRoutes(handler *gin.RouterGroup, uc usecase.CartSnapshot, ucc usecase.Cart, l logger.Interface, authMid gin.HandlerFunc, idempotencyMid gin.HandlerFunc) {
+	r := &cartSnapshotRoutes{uc: uc, l: l}
+
+	g := handler.Group("/carts/snapshots")
+	{
+		// anyone with the id can read a snapshot, importing needs a signed in user
+		g.GET("/:snapshotID", r.getSnapshot)
+		g.POST("", cartOwnerMiddleware(authMid, ucc), r.createSnapshot)
+		g.POST("/:snapshotID/import", authMid, idempotencyMid, r.importSnapshot)
+	}
+}
+
+type cartSnapshotResponse struct {
+	ID             string                     `json:"id"`
+	Currency       string                     `json:"currency"`
+	SubtotalAmount int64                      `json:"subtotal_amount"`
+	Items          []cartSnapshotItemResponse `json:"items"`
+	ExpiresAt      time.Time                  `json:"expires_at"`
+	CreatedAt      time.Time                  `json:"created_at"`
+}
+
+type cartSnapshotItemResponse struct {
+	ProductID          uuid.UUID         `json:"product_id"`
+	VariantID          uuid.UUID         `json:"variant_id"`
+	ProductName        string            `json:"product_name"`
+	ProductImageURL    string            `json:"product_image_url"`
+	ProductPriceAmount int64             `json:"product_price_amount"`
+	Currency           string            `json:"currency"`
+	ProductQuantity    int64             `json:"product_quantity"`
+	Note               string            `json:"note"`
+	Options            map[string]string `json:"options,omitempty"`
+}
+
+// freeze the current cart into a snapshot that can be shared by its id
+func (r *cartSnapshotRoutes) createSnapshot(ctx *gin.Context) {
+	userID, exist := ctx.Get(UserIDKey)
+	if !exist {
+		r.l.Error("not exist", "http - v1 - cartSnapshotRoutes - createSnapshot")
+		ctx.JSON(http.StatusInternalServerError, newInternalServerError("user id not exist"))
+		return
+	}
+
+	snapshot, err := r.uc.CreateSnapshot(ctx.Request.Context(), userID.(uuid.UUID), selectedCartID(ctx))
+	if err != nil {
+		r.l.Error(err, "http - v1 - cartSnapshotRoutes - createSnapshot")
+		writeUseCaseError(ctx, err)
+		return
+	}
+
+	ctx.JSON(http.StatusCreated, newCreateSuccess(cartSnapshotEntityToCartSnapshotResponse(snapshot)))
+}
+
+// get a shared snapshot, no authentication
+func (r *cartSnapshotRoutes) getSnapshot(ctx *gin.Context) {
+	snapshot, err := r.uc.GetSnapshot(ctx.Request.Context(), ctx.Param("snapshotID"))
+	if err != nil {
+		r.l.Error(err, "http - v1 - cartSnapshotRoutes - getSnapshot")
+		writeUseCaseError(ctx, err)
+		return
+	}
+
+	ctx.JSON(http.StatusOK, newGetSuccess(cartSnapshotEntityToCartSnapshotResponse(snapshot)))
+}
+
+// add the lines of a snapshot to the cart of the signed in user, each line reports whether it was added.
+// like a best effort batch it answers 201, 207 when some lines failed or 422 when none was added
+func (r *cartSnapshotRoutes) importSnapshot(ctx *gin.Context) {
+	userID, exist := ctx.Get(UserIDKey)
+	if !exist {
+		r.l.Error("not exist", "http - v1 - cartSnapshotRoutes - importSnapshot")
+		ctx.JSON(http.StatusInternalServerError, newInternalServerError("user id not exist"))
+		return
+	}
+
+	results, err := r.uc.ImportSnapshot(ctx.Request.Context(), userID.(uuid.UUID), selectedCartID(ctx), ctx.Param("snapshotID"))
+	if err != nil {
+		r.l.Error(err, "http - v1 - cartSnapshotRoutes - importSnapshot")
+		writeUseCaseError(ctx, err)
+		return
+	}
+
+	writeBatchResults(ctx, results)
+}
@@ -0,0 +1,79 @@
+package v1
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/idoyudha/eshop-cart/internal/entity"
+	"github.com/idoyudha/eshop-cart/internal/usecase"
+	"github.com/idoyudha/eshop-cart/pkg/logger"
+)
+
+type fakeCartSnapshotUseCase struct {
+	usecase.CartSnapshot
+	results []usecase.CartBatchResult
+	err     error
+}
+
+func (f *fakeCartSnapshotUseCase) ImportSnapshot(context.Context, uuid.UUID, uuid.UUID, string) ([]usecase.CartBatchResult, error) {
+	return f.results, f.err
+}
+
+func TestImportSnapshot(t *testing.T) {
+	added := usecase.CartBatchResult{Item: entity.CartItem{ID: uuid.New(), ProductQuantity: 1, Currency: "USD"}}
+	failed := usecase.CartBatchResult{Err: usecase.ErrCurrencyMismatch}
+
+	tests := []struct {
+		name       string
+		results    []usecase.CartBatchResult
+		err        error
+		wantStatus int
+		// statuses of the lines in the response, nil for an error response
+		wantLines []string
+	}{
+		{name: "every line imported", results: []usecase.CartBatchResult{added, added}, wantStatus: http.StatusCreated, wantLines: []string{batchItemStatusAdded, batchItemStatusAdded}},
+		{name: "some lines imported", results: []usecase.CartBatchResult{added, failed}, wantStatus: http.StatusMultiStatus, wantLines: []string{batchItemStatusAdded, batchItemStatusFailed}},
+		{
+			name:       "no line imported",
+			err:        &usecase.ValidationError{Violations: []usecase.FieldViolation{{Field: "items[0]", Message: "currency mismatch"}}},
+			wantStatus: http.StatusUnprocessableEntity,
+		},
+		{name: "expired snapshot", err: usecase.ErrCartSnapshotNotFound, wantStatus: http.StatusNotFound},
+		{name: "mysql down", err: errors.New("connection refused"), wantStatus: http.StatusInternalServerError},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			routes := &cartSnapshotRoutes{uc: &fakeCartSnapshotUseCase{results: tt.results, err: tt.err}, l: logger.New("error")}
+			recorder := serveHandler(t, routes.importSnapshot, http.MethodPost, gin.Params{{Key: "snapshotID", Value: "shared"}}, nil, "")
+
+			if recorder.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d: %s", recorder.Code, tt.wantStatus, recorder.Body)
+			}
+			if tt.wantLines == nil {
+				return
+			}
+
+			var body struct {
+				Code int                       `json:"code"`
+				Data []createCartsItemResponse `json:"data"`
+			}
+			if err := json.Unmarshal(recorder.Body.Bytes(), &body); err != nil {
+				t.Fatalf("decode response: %v", err)
+			}
+			if body.Code != tt.wantStatus || len(body.Data) != len(tt.wantLines) {
+				t.Fatalf("response code %d with %d lines, want %d with %d", body.Code, len(body.Data), tt.wantStatus, len(tt.wantLines))
+			}
+			for i, line := range body.Data {
+				if line.Status != tt.wantLines[i] {
+					t.Errorf("line %d status = %q, want %q", i, line.Status, tt.wantLines[i])
+				}
+			}
+		})
+	}
+}
@@ -16,6 +16,15 @@ func newCreateSuccess(data any) restSuccess {
 	}
 }
 
+// newPartialCreateSuccess answers a batch where only some of the items were created
+func newPartialCreateSuccess(data any) restSuccess {
+	return restSuccess{
+		Code:    http.StatusMultiStatus,
+		Data:    data,
+		Message: "partial create",
+	}
+}
+
 func newGetSuccess(data any) restSuccess {
 	return restSuccess{
 		Code:    http.StatusOK,
@@ -39,6 +48,14 @@ func newDeleteSuccess() restSuccess {
 	}
 }
 
+// newCheckoutAccepted answers a checkout whose order may be placed, it completes in the background
+func newCheckoutAccepted(message string) restSuccess {
+	return restSuccess{
+		Code:    http.StatusAccepted,
+		Message: message,
+	}
+}
+
 func newCheckoutSuccess() restSuccess {
 	return restSuccess{
 		Code:    http.StatusOK,
@@ -0,0 +1,68 @@
+package v1
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/idoyudha/eshop-cart/internal/entity"
+	"github.com/idoyudha/eshop-cart/internal/usecase"
+)
+
+// fakeCartUseCase answers the calls a handler test sets up, any other call panics on the nil usecase.Cart
+type fakeCartUseCase struct {
+	usecase.Cart
+	moveItemToCart func(userID uuid.UUID, itemID uuid.UUID, version int64, cartID uuid.UUID) (entity.CartItem, error)
+	moveCartItem   func(userID uuid.UUID, itemID uuid.UUID, version int64, list string) (entity.CartItem, error)
+	updateItem     func(item *entity.CartItem) error
+	deleteItem     func(userID uuid.UUID, itemID uuid.UUID, version int64) error
+	getHistory     func(cursor uuid.UUID, limit int) ([]*entity.CartEvent, error)
+	createCarts    func(items []*entity.CartItem, atomic bool) ([]usecase.CartBatchResult, error)
+}
+
+func (f *fakeCartUseCase) MoveItemToCart(_ context.Context, userID uuid.UUID, itemID uuid.UUID, version int64, cartID uuid.UUID) (entity.CartItem, error) {
+	return f.moveItemToCart(userID, itemID, version, cartID)
+}
+
+func (f *fakeCartUseCase) MoveCartItem(_ context.Context, userID uuid.UUID, itemID uuid.UUID, version int64, list string) (entity.CartItem, error) {
+	return f.moveCartItem(userID, itemID, version, list)
+}
+
+func (f *fakeCartUseCase) UpdateQtyAndNoteCart(_ context.Context, item *entity.CartItem) error {
+	return f.updateItem(item)
+}
+
+func (f *fakeCartUseCase) DeleteCart(_ context.Context, userID uuid.UUID, itemID uuid.UUID, version int64) error {
+	return f.deleteItem(userID, itemID, version)
+}
+
+func (f *fakeCartUseCase) GetHistory(_ context.Context, _ uuid.UUID, cursor uuid.UUID, limit int) ([]*entity.CartEvent, error) {
+	return f.getHistory(cursor, limit)
+}
+
+func (f *fakeCartUseCase) CreateCarts(_ context.Context, _ uuid.UUID, _ uuid.UUID, items []*entity.CartItem, atomic bool) ([]usecase.CartBatchResult, error) {
+	return f.createCarts(items, atomic)
+}
+
+// serveHandler runs handler for one request of a signed in user with the given path parameters and headers
+func serveHandler(t *testing.T, handler gin.HandlerFunc, method string, params gin.Params, header http.Header, body string) *httptest.ResponseRecorder {
+	t.Helper()
+	gin.SetMode(gin.TestMode)
+
+	recorder := httptest.NewRecorder()
+	ctx, _ := gin.CreateTestContext(recorder)
+	ctx.Request = httptest.NewRequest(method, "/v1/carts", strings.NewReader(body))
+	for key, values := range header {
+		ctx.Request.Header[key] = values
+	}
+	ctx.Request.Header.Set("Content-Type", "application/json")
+	ctx.Params = params
+	ctx.Set(UserIDKey, uuid.New())
+
+	handler(ctx)
+	return recorder
+}
@@ -76,9 +76,11 @@ func KafkaNewRouter(
 }
 
 type KafkaProductUpdatedMessage struct {
-	ProductID    uuid.UUID `json:"product_id"`
-	ProductName  string    `json:"product_name"`
-	ProductPrice float64   `json:"product_price"`
+	ProductID          uuid.UUID `json:"product_id"`
+	ProductName        string    `json:"product_name"`
+	ProductPrice       float64   `json:"product_price"` // deprecated: decimal price, use product_price_amount
+	ProductPriceAmount int64     `json:"product_price_amount"`
+	Currency           string    `json:"currency"`
 }
 
 func (r *kafkaConsumerRoutes) handleProductUpdated(msg *kafka.Message) error {
@@ -89,13 +91,30 @@ func (r *kafkaConsumerRoutes) handleProductUpdated(msg *kafka.Message) error {
 		return err
 	}
 
-	cart := &entity.Cart{
+	// producers not migrated yet still publish the decimal product_price without a currency,
+	// until they are migrated those prices are in the default currency of the carts
+	currency := message.Currency
+	if currency == "" {
+		currency = entity.DefaultCartCurrency
+	}
+	price := message.ProductPriceAmount
+	if price == 0 {
+		price = entity.ToMinorUnits(message.ProductPrice, currency)
+	}
+
+	item := &entity.CartItem{
 		ProductID:    message.ProductID,
 		ProductName:  message.ProductName,
-		ProductPrice: message.ProductPrice,
+		ProductPrice: price,
+		Currency:     currency,
+		UpdatedAt:    time.Now(),
 	}
 
-	if err := r.ucp.UpdateProductNameAndPriceCart(context.Background(), cart); err != nil {
+	ctx := usecase.ContextWithActor(context.Background(), entity.CartActor{
+		ID:     kafkaConSrv.ProductUpdateTopic,
+		Source: entity.CartEventSourceKafka,
+	})
+	if err := r.ucp.UpdateProductNameAndPriceCart(ctx, item); err != nil {
 		r.l.Error(err, "http - v1 - kafkaConsumerRoutes - handleProductUpdated")
 		return err
 	}
@@ -0,0 +1,95 @@
+package v1
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/confluentinc/confluent-kafka-go/kafka"
+	"github.com/google/uuid"
+	"github.com/idoyudha/eshop-cart/internal/entity"
+	"github.com/idoyudha/eshop-cart/internal/usecase"
+	"github.com/idoyudha/eshop-cart/pkg/logger"
+)
+
+type fakeCartUseCase struct {
+	usecase.Cart
+	updated *entity.CartItem
+	err     error
+}
+
+func (f *fakeCartUseCase) UpdateProductNameAndPriceCart(_ context.Context, item *entity.CartItem) error {
+	f.updated = item
+	return f.err
+}
+
+func TestHandleProductUpdated(t *testing.T) {
+	productID := uuid.New()
+
+	tests := []struct {
+		name         string
+		value        string
+		wantErr      bool
+		wantPrice    int64
+		wantCurrency string
+	}{
+		{
+			name:         "amount and currency",
+			value:        `{"product_id":"` + productID.String() + `","product_name":"mug","product_price_amount":1500,"currency":"JPY"}`,
+			wantPrice:    1500,
+			wantCurrency: "JPY",
+		},
+		{
+			name:         "decimal price with a currency",
+			value:        `{"product_id":"` + productID.String() + `","product_name":"mug","product_price":12.5,"currency":"EUR"}`,
+			wantPrice:    1250,
+			wantCurrency: "EUR",
+		},
+		{
+			name:         "legacy message without a currency",
+			value:        `{"product_id":"` + productID.String() + `","product_name":"mug","product_price":19.99}`,
+			wantPrice:    1999,
+			wantCurrency: entity.DefaultCartCurrency,
+		},
+		{
+			name:    "malformed message",
+			value:   `{"product_id":`,
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			uc := &fakeCartUseCase{}
+			routes := &kafkaConsumerRoutes{ucp: uc, l: logger.New("error")}
+
+			err := routes.handleProductUpdated(&kafka.Message{Value: []byte(tt.value)})
+			if tt.wantErr {
+				if err == nil || uc.updated != nil {
+					t.Fatalf("handleProductUpdated() = %v and updated %v, want an error and no update", err, uc.updated)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("handleProductUpdated() = %v", err)
+			}
+
+			if uc.updated.ProductID != productID || uc.updated.ProductName != "mug" {
+				t.Errorf("updated product %s %q, want %s %q", uc.updated.ProductID, uc.updated.ProductName, productID, "mug")
+			}
+			if uc.updated.ProductPrice != tt.wantPrice || uc.updated.Currency != tt.wantCurrency {
+				t.Errorf("updated price = %d %s, want %d %s", uc.updated.ProductPrice, uc.updated.Currency, tt.wantPrice, tt.wantCurrency)
+			}
+		})
+	}
+}
+
+func TestHandleProductUpdatedUseCaseError(t *testing.T) {
+	uc := &fakeCartUseCase{err: errors.New("mysql down")}
+	routes := &kafkaConsumerRoutes{ucp: uc, l: logger.New("error")}
+
+	value := `{"product_id":"` + uuid.NewString() + `","product_name":"mug","product_price_amount":100,"currency":"USD"}`
+	if err := routes.handleProductUpdated(&kafka.Message{Value: []byte(value)}); !errors.Is(err, uc.err) {
+		t.Fatalf("handleProductUpdated() = %v, want %v", err, uc.err)
+	}
+}
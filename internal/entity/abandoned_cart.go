@@ -0,0 +1,64 @@
+package entity
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// AbandonedCart is a user cart whose newest line has not changed since LastActivityAt
+type AbandonedCart struct {
+	CartID         uuid.UUID
+	UserID         uuid.UUID
+	LastActivityAt time.Time
+}
+
+// CartAbandonedPayload is the value of the cart-abandoned event
+type CartAbandonedPayload struct {
+	CartID         uuid.UUID                  `json:"cart_id"`
+	UserID         uuid.UUID                  `json:"user_id"`
+	Currency       string                     `json:"currency"`
+	TotalAmount    int64                      `json:"total_amount"`
+	ItemCount      int64                      `json:"item_count"`
+	Items          []CartAbandonedItemPayload `json:"items"`
+	LastActivityAt time.Time                  `json:"last_activity_at"`
+	DetectedAt     time.Time                  `json:"detected_at"`
+}
+
+type CartAbandonedItemPayload struct {
+	ItemID          uuid.UUID         `json:"item_id"`
+	ProductID       uuid.UUID         `json:"product_id"`
+	VariantID       uuid.UUID         `json:"variant_id"`
+	ProductName     string            `json:"product_name"`
+	ProductImageURL string            `json:"product_image_url"`
+	PriceAmount     int64             `json:"price_amount"`
+	Quantity        int64             `json:"quantity"`
+	Options         map[string]string `json:"options,omitempty"`
+}
+
+func NewCartAbandonedPayload(cart *Cart, lastActivityAt time.Time, detectedAt time.Time) CartAbandonedPayload {
+	items := make([]CartAbandonedItemPayload, 0, len(cart.Items))
+	for _, item := range cart.Items {
+		items = append(items, CartAbandonedItemPayload{
+			ItemID:          item.ID,
+			ProductID:       item.ProductID,
+			VariantID:       item.VariantID,
+			ProductName:     item.ProductName,
+			ProductImageURL: item.ProductImageURL,
+			PriceAmount:     item.ProductPrice,
+			Quantity:        item.ProductQuantity,
+			Options:         item.Options,
+		})
+	}
+
+	return CartAbandonedPayload{
+		CartID:         cart.ID,
+		UserID:         cart.UserID,
+		Currency:       cart.Currency,
+		TotalAmount:    cart.Subtotal(),
+		ItemCount:      cart.ItemCount(),
+		Items:          items,
+		LastActivityAt: lastActivityAt,
+		DetectedAt:     detectedAt,
+	}
+}
@@ -1,31 +1,189 @@
 package entity
 
 import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
 	"time"
 
 	"github.com/google/uuid"
 )
 
+const (
+	CartStatusActive = "active"
+
+	// lines of the active cart, the only ones cached and checked out
+	CartItemListCart = "cart"
+	// lines saved for later, kept with the cart but left out of totals and checkout
+	CartItemListSaved = "saved"
+	// lines held by a running checkout, hidden from the cart until it completes or fails
+	CartItemListCheckout = "checkout"
+
+	// why a line was soft deleted
+	CartItemDeletedRemoved    = "removed"      // removed by the shopper, can be restored
+	CartItemDeletedCheckedOut = "checked_out"  // ordered
+	CartItemDeletedMerged     = "merged"       // folded into another line
+	CartItemDeletedCart       = "cart_deleted" // its named cart was deleted
+
+	DefaultCartCurrency = "USD"
+	// name of the first cart of a user
+	DefaultCartName = "default"
+
+	// rules to fold a guest line into the line of the same product in the user cart
+	CartMergeRuleSum   = "sum"   // add the quantities
+	CartMergeRuleMax   = "max"   // keep the larger quantity
+	CartMergeRuleGuest = "guest" // the guest line replaces quantity and note
+)
+
+// ErrAlreadyExists is returned by repositories when a concurrent writer inserted the same cart or line first
+var ErrAlreadyExists = errors.New("already exists")
+
+func IsCartMergeRule(rule string) bool {
+	switch rule {
+	case CartMergeRuleSum, CartMergeRuleMax, CartMergeRuleGuest:
+		return true
+	}
+	return false
+}
+
+// Cart is the cart header of a user together with its lines.
+// a user can have several named carts, Default marks the one used when no cart is selected.
+// a guest cart is owned by the id of its cart token instead of a user and is dropped at ExpiresAt
 type Cart struct {
+	ID        uuid.UUID
+	UserID    uuid.UUID
+	Name      string
+	Default   bool
+	Currency  string
+	Status    string
+	Guest     bool
+	Items     []*CartItem
+	ExpiresAt time.Time
+	CreatedAt time.Time
+	UpdatedAt time.Time
+	// CacheVersion counts the changes to the carts of the user when the cart was read, only set by GetByUserID
+	CacheVersion int64
+}
+
+func NewCart(userID uuid.UUID, currency string) (*Cart, error) {
+	cartID, err := uuid.NewV7()
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	return &Cart{
+		ID:        cartID,
+		UserID:    userID,
+		Name:      DefaultCartName,
+		Default:   true,
+		Currency:  currency,
+		Status:    CartStatusActive,
+		CreatedAt: now,
+		UpdatedAt: now,
+	}, nil
+}
+
+// NewNamedCart creates another cart of the user, it is not the default cart
+func NewNamedCart(userID uuid.UUID, name string, currency string) (*Cart, error) {
+	cart, err := NewCart(userID, currency)
+	if err != nil {
+		return nil, err
+	}
+
+	cart.Name = name
+	cart.Default = false
+	return cart, nil
+}
+
+func NewGuestCart(expiresAt time.Time) (*Cart, error) {
+	guestID, err := uuid.NewV7()
+	if err != nil {
+		return nil, err
+	}
+
+	cart, err := NewCart(guestID, DefaultCartCurrency)
+	if err != nil {
+		return nil, err
+	}
+
+	cart.Guest = true
+	cart.ExpiresAt = expiresAt
+	return cart, nil
+}
+
+// Subtotal is the sum of price times quantity of every line, in minor units of the cart currency
+func (c *Cart) Subtotal() int64 {
+	var subtotal int64
+	for _, item := range c.Items {
+		subtotal += item.ProductPrice * item.ProductQuantity
+	}
+	return subtotal
+}
+
+// ItemCount is the total quantity of products in the cart
+func (c *Cart) ItemCount() int64 {
+	var count int64
+	for _, item := range c.Items {
+		count += item.ProductQuantity
+	}
+	return count
+}
+
+// CartItem is a single product line of a cart
+type CartItem struct {
 	ID              uuid.UUID
+	CartID          uuid.UUID
 	UserID          uuid.UUID
 	ProductID       uuid.UUID
+	VariantID       uuid.UUID // uuid.Nil for products without variants
 	ProductName     string
 	ProductImageURL string
-	ProductPrice    float64
+	ProductPrice    int64 // in minor units of Currency
+	Currency        string
 	ProductQuantity int64
 	Note            string
+	Options         map[string]string // free form choices such as size, colour or engraving text
+	List            string            // CartItemListCart, CartItemListSaved or CartItemListCheckout
+	Version         int64             // incremented on every change made by the user, used for optimistic locking
 	CreatedAt       time.Time
 	UpdatedAt       time.Time
 	DeletedAt       time.Time
 }
 
-func (c *Cart) GenerateCartID() error {
-	cartID, err := uuid.NewV7()
+func (c *CartItem) GenerateCartItemID() error {
+	itemID, err := uuid.NewV7()
 	if err != nil {
 		return err
 	}
 
-	c.ID = cartID
+	c.ID = itemID
 	return nil
 }
+
+// OptionsHash is a stable hash of Options, empty when there are none
+func (c *CartItem) OptionsHash() string {
+	if len(c.Options) == 0 {
+		return ""
+	}
+
+	// map keys are marshalled in sorted order, equal options always give the same hash
+	options, _ := json.Marshal(c.Options)
+	hash := sha256.Sum256(options)
+	return hex.EncodeToString(hash[:])
+}
+
+// LineKey identifies the line within its cart and list: the product id,
+// followed by variant id and options hash for products bought with a variant or options
+func (c *CartItem) LineKey() string {
+	if c.VariantID == uuid.Nil && len(c.Options) == 0 {
+		return c.ProductID.String()
+	}
+	return fmt.Sprintf("%s:%s:%s", c.ProductID, c.VariantID, c.OptionsHash())
+}
+
+func IsCartItemList(list string) bool {
+	return list == CartItemListCart || list == CartItemListSaved
+}
@@ -0,0 +1,103 @@
+package entity
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+const (
+	CartEventItemCreated     = "item_created"
+	CartEventItemIncremented = "item_incremented"
+	CartEventItemUpdated     = "item_updated"
+	CartEventItemRepriced    = "item_repriced"
+	CartEventItemMoved       = "item_moved"
+	CartEventItemMerged      = "item_merged"
+	CartEventItemDeleted     = "item_deleted"
+	CartEventItemRestored    = "item_restored"
+	CartEventItemCheckedOut  = "item_checked_out"
+
+	CartEventSourceHTTP  = "http"
+	CartEventSourceKafka = "kafka"
+	// background jobs and maintenance commands
+	CartEventSourceSystem = "system"
+)
+
+// CartEvent is one change to a cart line in the append only history,
+// Before is nil for a new line and After is nil for a removed one
+type CartEvent struct {
+	ID        uuid.UUID
+	CartID    uuid.UUID
+	UserID    uuid.UUID
+	ItemID    uuid.UUID
+	EventType string
+	Actor     string
+	Source    string
+	Before    *CartItemSnapshot
+	After     *CartItemSnapshot
+	CreatedAt time.Time
+}
+
+// CartItemSnapshot is the state of a cart line stored with a CartEvent
+type CartItemSnapshot struct {
+	ProductID       uuid.UUID         `json:"product_id"`
+	VariantID       uuid.UUID         `json:"variant_id"`
+	ProductName     string            `json:"product_name"`
+	ProductPrice    int64             `json:"product_price"`
+	Currency        string            `json:"currency"`
+	ProductQuantity int64             `json:"product_quantity"`
+	Note            string            `json:"note"`
+	Options         map[string]string `json:"options,omitempty"`
+	List            string            `json:"list"`
+	Version         int64             `json:"version"`
+}
+
+func NewCartItemSnapshot(item *CartItem) *CartItemSnapshot {
+	if item == nil {
+		return nil
+	}
+
+	return &CartItemSnapshot{
+		ProductID:       item.ProductID,
+		VariantID:       item.VariantID,
+		ProductName:     item.ProductName,
+		ProductPrice:    item.ProductPrice,
+		Currency:        item.Currency,
+		ProductQuantity: item.ProductQuantity,
+		Note:            item.Note,
+		Options:         item.Options,
+		List:            item.List,
+		Version:         item.Version,
+	}
+}
+
+// CartActor is who made a change and through which entry point
+type CartActor struct {
+	ID     string
+	Source string
+}
+
+func NewCartEvent(eventType string, actor CartActor, before *CartItem, after *CartItem) (*CartEvent, error) {
+	eventID, err := uuid.NewV7()
+	if err != nil {
+		return nil, err
+	}
+
+	line := after
+	if line == nil {
+		line = before
+	}
+
+	return &CartEvent{
+		ID:        eventID,
+		CartID:    line.CartID,
+		UserID:    line.UserID,
+		ItemID:    line.ID,
+		EventType: eventType,
+		Actor:     actor.ID,
+		Source:    actor.Source,
+		Before:    NewCartItemSnapshot(before),
+		After:     NewCartItemSnapshot(after),
+		CreatedAt: time.Now(),
+	}, nil
+}
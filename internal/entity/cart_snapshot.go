@@ -0,0 +1,98 @@
+package entity
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// 256 random bits, the id is the only thing protecting a shared snapshot
+const cartSnapshotIDSize = 32
+
+// CartSnapshot is a read only copy of a cart that can be shared by its id until ExpiresAt
+type CartSnapshot struct {
+	ID        string             `json:"id"`
+	UserID    uuid.UUID          `json:"user_id"`
+	Currency  string             `json:"currency"`
+	Items     []CartSnapshotItem `json:"items"`
+	ExpiresAt time.Time          `json:"expires_at"`
+	CreatedAt time.Time          `json:"created_at"`
+}
+
+type CartSnapshotItem struct {
+	ProductID       uuid.UUID         `json:"product_id"`
+	VariantID       uuid.UUID         `json:"variant_id"`
+	ProductName     string            `json:"product_name"`
+	ProductImageURL string            `json:"product_image_url"`
+	ProductPrice    int64             `json:"product_price"`
+	Currency        string            `json:"currency"`
+	ProductQuantity int64             `json:"product_quantity"`
+	Note            string            `json:"note"`
+	Options         map[string]string `json:"options,omitempty"`
+}
+
+func NewCartSnapshot(cart *Cart, ttl time.Duration) (*CartSnapshot, error) {
+	id := make([]byte, cartSnapshotIDSize)
+	if _, err := rand.Read(id); err != nil {
+		return nil, err
+	}
+
+	items := make([]CartSnapshotItem, len(cart.Items))
+	for i, item := range cart.Items {
+		items[i] = CartSnapshotItem{
+			ProductID:       item.ProductID,
+			VariantID:       item.VariantID,
+			ProductName:     item.ProductName,
+			ProductImageURL: item.ProductImageURL,
+			ProductPrice:    item.ProductPrice,
+			Currency:        item.Currency,
+			ProductQuantity: item.ProductQuantity,
+			Note:            item.Note,
+			Options:         item.Options,
+		}
+	}
+
+	now := time.Now()
+	return &CartSnapshot{
+		ID:        base64.RawURLEncoding.EncodeToString(id),
+		UserID:    cart.UserID,
+		Currency:  cart.Currency,
+		Items:     items,
+		ExpiresAt: now.Add(ttl),
+		CreatedAt: now,
+	}, nil
+}
+
+// Subtotal is the total price of the lines in minor units
+func (s *CartSnapshot) Subtotal() int64 {
+	var subtotal int64
+	for _, item := range s.Items {
+		subtotal += item.ProductPrice * item.ProductQuantity
+	}
+	return subtotal
+}
+
+// CartItems returns the lines as new items of the user, ready to be added to a cart
+func (s *CartSnapshot) CartItems(userID uuid.UUID) []*CartItem {
+	now := time.Now()
+	items := make([]*CartItem, len(s.Items))
+	for i, item := range s.Items {
+		items[i] = &CartItem{
+			UserID:          userID,
+			ProductID:       item.ProductID,
+			VariantID:       item.VariantID,
+			ProductName:     item.ProductName,
+			ProductImageURL: item.ProductImageURL,
+			ProductPrice:    item.ProductPrice,
+			Currency:        item.Currency,
+			ProductQuantity: item.ProductQuantity,
+			Note:            item.Note,
+			Options:         item.Options,
+			CreatedAt:       now,
+			UpdatedAt:       now,
+		}
+	}
+	return items
+}
@@ -0,0 +1,50 @@
+package entity
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/google/uuid"
+)
+
+func TestCartItemLineKey(t *testing.T) {
+	productID := uuid.New()
+	variantID := uuid.New()
+
+	plain := &CartItem{ProductID: productID}
+	if got := plain.LineKey(); got != productID.String() {
+		t.Errorf("LineKey() of a plain product = %q, want the product id", got)
+	}
+	if plain.OptionsHash() != "" {
+		t.Errorf("OptionsHash() without options = %q, want empty", plain.OptionsHash())
+	}
+
+	// options built in a different order are the same line
+	red := &CartItem{ProductID: productID, Options: map[string]string{"color": "red", "size": "m"}}
+	sameRed := &CartItem{ProductID: productID, Options: map[string]string{}}
+	sameRed.Options["size"] = "m"
+	sameRed.Options["color"] = "red"
+	if red.LineKey() != sameRed.LineKey() {
+		t.Errorf("equal options give %q and %q", red.LineKey(), sameRed.LineKey())
+	}
+
+	keys := map[string]string{
+		"plain":   plain.LineKey(),
+		"red":     red.LineKey(),
+		"blue":    (&CartItem{ProductID: productID, Options: map[string]string{"color": "blue", "size": "m"}}).LineKey(),
+		"variant": (&CartItem{ProductID: productID, VariantID: variantID}).LineKey(),
+		"both":    (&CartItem{ProductID: productID, VariantID: variantID, Options: red.Options}).LineKey(),
+	}
+	seen := make(map[string]string, len(keys))
+	for name, key := range keys {
+		if other, ok := seen[key]; ok {
+			t.Errorf("%s and %s share the line key %q", name, other, key)
+		}
+		seen[key] = name
+
+		// the product id always leads the key, the product index of the cache relies on it
+		if !strings.HasPrefix(key, productID.String()) {
+			t.Errorf("line key %q of %s does not start with the product id", key, name)
+		}
+	}
+}
@@ -0,0 +1,80 @@
+package entity
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+const (
+	// a checkout goes pending, order_created, cart_cleared then completed, or ends failed
+	CheckoutStatePending      = "pending"       // lines held, the order is not confirmed yet
+	CheckoutStateOrderCreated = "order_created" // the order service accepted the order
+	CheckoutStateCartCleared  = "cart_cleared"  // the ordered lines were removed from the cart
+	CheckoutStateCompleted    = "completed"
+	CheckoutStateFailed       = "failed" // no order, the held lines went back to the cart
+)
+
+// Checkout is one attempt to order lines of a cart, its state is stored
+// so an attempt interrupted by a restart can be resumed
+type Checkout struct {
+	ID        uuid.UUID
+	UserID    uuid.UUID
+	CartID    uuid.UUID
+	ItemIDs   uuid.UUIDs
+	Address   CheckoutAddress
+	State     string
+	OrderID   uuid.UUID
+	LastError string
+	// stock reserved for the lines, ReservationState is empty until it is reserved
+	ReservationID        string
+	ReservationState     string
+	ReservationExpiresAt time.Time
+	CreatedAt            time.Time
+	UpdatedAt            time.Time
+}
+
+func NewCheckout(userID uuid.UUID, cartID uuid.UUID, itemIDs uuid.UUIDs, address CheckoutAddress) (*Checkout, error) {
+	checkoutID, err := uuid.NewV7()
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	return &Checkout{
+		ID:        checkoutID,
+		UserID:    userID,
+		CartID:    cartID,
+		ItemIDs:   itemIDs,
+		Address:   address,
+		State:     CheckoutStatePending,
+		CreatedAt: now,
+		UpdatedAt: now,
+	}, nil
+}
+
+// Advance moves the checkout to state and returns the state it was in
+func (c *Checkout) Advance(state string) string {
+	from := c.State
+	c.State = state
+	c.UpdatedAt = time.Now()
+	return from
+}
+
+// Fail moves the checkout to failed keeping cause, it returns the state it was in
+func (c *Checkout) Fail(cause error) string {
+	c.LastError = cause.Error()
+	return c.Advance(CheckoutStateFailed)
+}
+
+// Reserve records the stock reserved for the checkout
+func (c *Checkout) Reserve(reservation *InventoryReservation) {
+	c.ReservationID = reservation.ID
+	c.ReservationState = ReservationStateReserved
+	c.ReservationExpiresAt = reservation.ExpiresAt
+}
+
+// IsReserved is true while the reserved stock is neither confirmed nor released
+func (c *Checkout) IsReserved() bool {
+	return c.ReservationState == ReservationStateReserved
+}
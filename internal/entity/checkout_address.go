@@ -1,8 +1,8 @@
 package entity
 
 type CheckoutAddress struct {
-	Street  string
-	City    string
-	State   string
-	ZipCode string
+	Street  string `json:"street"`
+	City    string `json:"city"`
+	State   string `json:"state"`
+	ZipCode string `json:"zipcode"`
 }
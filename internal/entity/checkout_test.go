@@ -0,0 +1,90 @@
+package entity
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/google/uuid"
+)
+
+func TestCheckoutTransitions(t *testing.T) {
+	tests := []struct {
+		name      string
+		from      string
+		step      func(*Checkout) string
+		wantState string
+		wantError string
+	}{
+		{
+			name:      "order created",
+			from:      CheckoutStatePending,
+			step:      func(c *Checkout) string { return c.Advance(CheckoutStateOrderCreated) },
+			wantState: CheckoutStateOrderCreated,
+		},
+		{
+			name:      "cart cleared",
+			from:      CheckoutStateOrderCreated,
+			step:      func(c *Checkout) string { return c.Advance(CheckoutStateCartCleared) },
+			wantState: CheckoutStateCartCleared,
+		},
+		{
+			name:      "completed",
+			from:      CheckoutStateCartCleared,
+			step:      func(c *Checkout) string { return c.Advance(CheckoutStateCompleted) },
+			wantState: CheckoutStateCompleted,
+		},
+		{
+			name:      "failed keeps the cause",
+			from:      CheckoutStatePending,
+			step:      func(c *Checkout) string { return c.Fail(errors.New("order rejected")) },
+			wantState: CheckoutStateFailed,
+			wantError: "order rejected",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			checkout, err := NewCheckout(uuid.New(), uuid.New(), uuid.UUIDs{uuid.New()}, CheckoutAddress{})
+			if err != nil {
+				t.Fatalf("NewCheckout: %v", err)
+			}
+			checkout.State = tt.from
+			updatedAt := checkout.UpdatedAt
+
+			if from := tt.step(checkout); from != tt.from {
+				t.Errorf("returned state = %q, want %q", from, tt.from)
+			}
+			if checkout.State != tt.wantState {
+				t.Errorf("state = %q, want %q", checkout.State, tt.wantState)
+			}
+			if checkout.LastError != tt.wantError {
+				t.Errorf("last error = %q, want %q", checkout.LastError, tt.wantError)
+			}
+			if checkout.UpdatedAt.Before(updatedAt) {
+				t.Errorf("updated at went back from %v to %v", updatedAt, checkout.UpdatedAt)
+			}
+		})
+	}
+}
+
+func TestCheckoutIsReserved(t *testing.T) {
+	tests := []struct {
+		state string
+		want  bool
+	}{
+		{state: "", want: false},
+		{state: ReservationStateReserved, want: true},
+		{state: ReservationStateConfirmed, want: false},
+		{state: ReservationStateReleased, want: false},
+		{state: ReservationStateLost, want: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.state, func(t *testing.T) {
+			checkout := &Checkout{ReservationState: tt.state}
+			if got := checkout.IsReserved(); got != tt.want {
+				t.Errorf("IsReserved() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,30 @@
+package entity
+
+import "time"
+
+const (
+	// the first request under the key is still being handled
+	IdempotencyStatusProcessing = "processing"
+	// the response of the first request is stored and replayed to retries
+	IdempotencyStatusCompleted = "completed"
+)
+
+// IdempotencyRecord is the first request seen under an Idempotency-Key and, once completed, its response
+type IdempotencyRecord struct {
+	Key            string            `json:"key"`
+	RequestHash    string            `json:"request_hash"`
+	Status         string            `json:"status"`
+	ResponseStatus int               `json:"response_status,omitempty"`
+	ResponseHeader map[string]string `json:"response_header,omitempty"`
+	ResponseBody   []byte            `json:"response_body,omitempty"`
+	CreatedAt      time.Time         `json:"created_at"`
+}
+
+func NewIdempotencyRecord(key string, requestHash string) *IdempotencyRecord {
+	return &IdempotencyRecord{
+		Key:         key,
+		RequestHash: requestHash,
+		Status:      IdempotencyStatusProcessing,
+		CreatedAt:   time.Now(),
+	}
+}
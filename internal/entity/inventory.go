@@ -0,0 +1,40 @@
+package entity
+
+import (
+	"errors"
+	"fmt"
+	"time"
+)
+
+const (
+	ReservationStateReserved  = "reserved"  // stock held, the order is not placed yet
+	ReservationStateConfirmed = "confirmed" // the order took the stock
+	ReservationStateReleased  = "released"  // the stock is available again
+	ReservationStateLost      = "lost"      // gone from the inventory service before it was confirmed
+)
+
+// ErrInventoryServiceUnavailable is returned when the inventory service cannot be reached or keeps failing
+var ErrInventoryServiceUnavailable = errors.New("inventory service is unavailable")
+
+// InventoryReservationRequest asks the inventory service to hold the stock of cart lines,
+// a request retried with the same Key holds the stock once
+type InventoryReservationRequest struct {
+	Key   string
+	Items []*CartItem
+}
+
+// InventoryReservation is stock held for a checkout until it is confirmed or released, or expires
+type InventoryReservation struct {
+	ID        string
+	ExpiresAt time.Time
+}
+
+// InventoryServiceError is an error response of the inventory service, Message is the reason it gave
+type InventoryServiceError struct {
+	StatusCode int
+	Message    string
+}
+
+func (e *InventoryServiceError) Error() string {
+	return fmt.Sprintf("inventory service responded %d: %s", e.StatusCode, e.Message)
+}
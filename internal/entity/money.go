@@ -0,0 +1,35 @@
+package entity
+
+import (
+	"math"
+	"strings"
+)
+
+// number of decimals of the minor unit, currencies not listed here use cents
+var currencyExponents = map[string]int{
+	"JPY": 0,
+	"KRW": 0,
+	"VND": 0,
+	"BHD": 3,
+	"KWD": 3,
+	"OMR": 3,
+	"JOD": 3,
+	"TND": 3,
+}
+
+func currencyExponent(currency string) int {
+	if exponent, ok := currencyExponents[strings.ToUpper(currency)]; ok {
+		return exponent
+	}
+	return 2
+}
+
+// ToMinorUnits converts a decimal amount, e.g. 19.99 USD, to its integer minor units, e.g. 1999
+func ToMinorUnits(amount float64, currency string) int64 {
+	return int64(math.Round(amount * math.Pow10(currencyExponent(currency))))
+}
+
+// FromMinorUnits converts integer minor units back to a decimal amount, only for display
+func FromMinorUnits(amount int64, currency string) float64 {
+	return float64(amount) / math.Pow10(currencyExponent(currency))
+}
@@ -0,0 +1,47 @@
+package entity
+
+import "testing"
+
+func TestToMinorUnits(t *testing.T) {
+	tests := []struct {
+		amount   float64
+		currency string
+		want     int64
+	}{
+		{amount: 19.99, currency: "USD", want: 1999},
+		// 0.07 * 100 is 7.000000000000001 in floating point
+		{amount: 0.07, currency: "EUR", want: 7},
+		{amount: 1500, currency: "JPY", want: 1500},
+		{amount: 1500, currency: "jpy", want: 1500},
+		{amount: 1.234, currency: "KWD", want: 1234},
+		{amount: 2.5, currency: "XYZ", want: 250},
+		{amount: 0, currency: "USD", want: 0},
+	}
+
+	for _, tt := range tests {
+		got := ToMinorUnits(tt.amount, tt.currency)
+		if got != tt.want {
+			t.Errorf("ToMinorUnits(%v, %q) = %d, want %d", tt.amount, tt.currency, got, tt.want)
+		}
+		if back := ToMinorUnits(FromMinorUnits(got, tt.currency), tt.currency); back != got {
+			t.Errorf("minor units %d %s do not survive a round trip, got %d", got, tt.currency, back)
+		}
+	}
+}
+
+func TestCartSubtotal(t *testing.T) {
+	cart := &Cart{Currency: "USD", Items: []*CartItem{
+		{ProductPrice: 1999, ProductQuantity: 3},
+		{ProductPrice: 1, ProductQuantity: 1},
+	}}
+
+	if got := cart.Subtotal(); got != 5998 {
+		t.Errorf("Subtotal() = %d, want 5998", got)
+	}
+	if got := cart.ItemCount(); got != 4 {
+		t.Errorf("ItemCount() = %d, want 4", got)
+	}
+	if got := (&Cart{}).Subtotal(); got != 0 {
+		t.Errorf("Subtotal() of an empty cart = %d, want 0", got)
+	}
+}
@@ -0,0 +1,33 @@
+package entity
+
+import (
+	"errors"
+	"fmt"
+)
+
+var (
+	// ErrOrderServiceUnavailable is returned when no order request could have reached the order service:
+	// its circuit is open or it kept answering it is overloaded. the order was certainly not placed
+	ErrOrderServiceUnavailable = errors.New("order service is unavailable")
+	// ErrOrderOutcomeUnknown is returned when an order request may have reached the order service
+	// but no answer was read, the order may or may not be placed
+	ErrOrderOutcomeUnknown = errors.New("order outcome is unknown")
+)
+
+// OrderRequest asks the order service to place an order for cart lines,
+// a request retried with the same IdempotencyKey places the order once
+type OrderRequest struct {
+	IdempotencyKey string
+	Items          []*CartItem
+	Address        CheckoutAddress
+}
+
+// OrderServiceError is an error response of the order service, Message is the reason it gave
+type OrderServiceError struct {
+	StatusCode int
+	Message    string
+}
+
+func (e *OrderServiceError) Error() string {
+	return fmt.Sprintf("order service responded %d: %s", e.StatusCode, e.Message)
+}
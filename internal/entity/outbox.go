@@ -0,0 +1,83 @@
+package entity
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+const (
+	// the cached cart of the user in AggregateID must be rebuilt from mysql
+	OutboxEventCartChanged = "cart.changed"
+	// name and price of the product in AggregateID changed, payload is a ProductChangedPayload
+	OutboxEventProductChanged = "product.changed"
+	// the cart of the user in AggregateID was abandoned, payload is a CartAbandonedPayload to publish
+	OutboxEventCartAbandoned = "cart.abandoned"
+)
+
+// OutboxLease is how long a claimed event is left to the process holding it. a new event starts claimed
+// by the request that wrote it, so the relay does not apply it concurrently with that request
+const OutboxLease = 30 * time.Second
+
+// OutboxEvent is a pending change to apply to redis or publish to kafka, written in the same transaction as the mysql change
+type OutboxEvent struct {
+	ID            uuid.UUID
+	AggregateID   uuid.UUID
+	EventType     string
+	Payload       []byte
+	Attempts      int
+	LastError     string
+	CreatedAt     time.Time
+	NextAttemptAt time.Time
+	ProcessedAt   time.Time
+}
+
+type ProductChangedPayload struct {
+	ProductName  string `json:"product_name"`
+	ProductPrice int64  `json:"product_price"`
+	Currency     string `json:"currency"`
+}
+
+func newOutboxEvent(eventType string, aggregateID uuid.UUID, payload []byte) (*OutboxEvent, error) {
+	eventID, err := uuid.NewV7()
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	return &OutboxEvent{
+		ID:            eventID,
+		AggregateID:   aggregateID,
+		EventType:     eventType,
+		Payload:       payload,
+		CreatedAt:     now,
+		NextAttemptAt: now.Add(OutboxLease),
+	}, nil
+}
+
+func NewCartChangedEvent(userID uuid.UUID) (*OutboxEvent, error) {
+	return newOutboxEvent(OutboxEventCartChanged, userID, []byte("{}"))
+}
+
+func NewProductChangedEvent(item *CartItem) (*OutboxEvent, error) {
+	payload, err := json.Marshal(ProductChangedPayload{
+		ProductName:  item.ProductName,
+		ProductPrice: item.ProductPrice,
+		Currency:     item.Currency,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return newOutboxEvent(OutboxEventProductChanged, item.ProductID, payload)
+}
+
+func NewCartAbandonedEvent(payload CartAbandonedPayload) (*OutboxEvent, error) {
+	value, err := json.Marshal(payload)
+	if err != nil {
+		return nil, err
+	}
+
+	return newOutboxEvent(OutboxEventCartAbandoned, payload.UserID, value)
+}
@@ -0,0 +1,81 @@
+package entity
+
+import (
+	"errors"
+
+	"github.com/google/uuid"
+)
+
+// ErrProductCatalogUnavailable is returned when the product catalog cannot be reached or keeps failing
+var ErrProductCatalogUnavailable = errors.New("product catalog is unavailable")
+
+// CatalogProduct is the authoritative name, price and availability of a product
+type CatalogProduct struct {
+	ID          uuid.UUID
+	Name        string
+	PriceAmount int64 // in minor units of Currency
+	Currency    string
+	Available   bool
+}
+
+// why a cart line no longer matches the catalog
+const (
+	CartPriceChangePrice       = "price_changed"    // same currency, another price
+	CartPriceChangeUnavailable = "unavailable"      // gone from the catalog or out of stock
+	CartPriceChangeCurrency    = "currency_changed" // priced in another currency, the line cannot be ordered as is
+)
+
+// CartPriceChange is a cart line whose price or availability in the catalog differs from the cart,
+// Price and Currency are the catalog ones, unchanged for a product that is no longer available
+type CartPriceChange struct {
+	ItemID           uuid.UUID
+	ProductID        uuid.UUID
+	ProductName      string
+	PreviousPrice    int64
+	PreviousCurrency string
+	Price            int64
+	Currency         string
+	Available        bool
+	Reason           string
+}
+
+// NewCartPriceChange compares the line with its product, found is false when the catalog does not know it.
+// it returns false when nothing changed. the catalog prices the product, not its variants,
+// so only the availability of a variant line is checked
+func NewCartPriceChange(item *CartItem, product CatalogProduct, found bool) (CartPriceChange, bool) {
+	change := CartPriceChange{
+		ItemID:           item.ID,
+		ProductID:        item.ProductID,
+		ProductName:      item.ProductName,
+		PreviousPrice:    item.ProductPrice,
+		PreviousCurrency: item.Currency,
+		Price:            item.ProductPrice,
+		Currency:         item.Currency,
+	}
+
+	if !found || !product.Available {
+		change.Reason = CartPriceChangeUnavailable
+		return change, true
+	}
+
+	if item.VariantID != uuid.Nil {
+		return change, false
+	}
+
+	change.ProductName = product.Name
+	change.Price = product.PriceAmount
+	change.Currency = product.Currency
+
+	if product.Currency != item.Currency {
+		change.Reason = CartPriceChangeCurrency
+		return change, true
+	}
+
+	change.Available = true
+	if product.PriceAmount == item.ProductPrice {
+		return change, false
+	}
+
+	change.Reason = CartPriceChangePrice
+	return change, true
+}
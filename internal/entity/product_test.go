@@ -0,0 +1,116 @@
+package entity
+
+import (
+	"testing"
+
+	"github.com/google/uuid"
+)
+
+func TestNewCartPriceChange(t *testing.T) {
+	productID := uuid.New()
+	line := func(variantID uuid.UUID) *CartItem {
+		return &CartItem{ID: uuid.New(), ProductID: productID, VariantID: variantID, ProductName: "mug", ProductPrice: 1000, Currency: "USD"}
+	}
+
+	tests := []struct {
+		name          string
+		item          *CartItem
+		product       CatalogProduct
+		found         bool
+		wantChanged   bool
+		wantReason    string
+		wantAvailable bool
+		wantPrice     int64
+		wantCurrency  string
+	}{
+		{
+			name:    "unchanged",
+			item:    line(uuid.Nil),
+			product: CatalogProduct{ID: productID, Name: "mug", PriceAmount: 1000, Currency: "USD", Available: true},
+			found:   true,
+		},
+		{
+			name:          "price changed",
+			item:          line(uuid.Nil),
+			product:       CatalogProduct{ID: productID, Name: "big mug", PriceAmount: 1200, Currency: "USD", Available: true},
+			found:         true,
+			wantChanged:   true,
+			wantReason:    CartPriceChangePrice,
+			wantAvailable: true,
+			wantPrice:     1200,
+			wantCurrency:  "USD",
+		},
+		{
+			name:         "currency changed",
+			item:         line(uuid.Nil),
+			product:      CatalogProduct{ID: productID, Name: "mug", PriceAmount: 900, Currency: "EUR", Available: true},
+			found:        true,
+			wantChanged:  true,
+			wantReason:   CartPriceChangeCurrency,
+			wantPrice:    900,
+			wantCurrency: "EUR",
+		},
+		{
+			name:         "out of stock",
+			item:         line(uuid.Nil),
+			product:      CatalogProduct{ID: productID, Name: "mug", PriceAmount: 1000, Currency: "USD"},
+			found:        true,
+			wantChanged:  true,
+			wantReason:   CartPriceChangeUnavailable,
+			wantPrice:    1000,
+			wantCurrency: "USD",
+		},
+		{
+			name:         "gone from the catalog",
+			item:         line(uuid.Nil),
+			wantChanged:  true,
+			wantReason:   CartPriceChangeUnavailable,
+			wantPrice:    1000,
+			wantCurrency: "USD",
+		},
+		{
+			name:    "variant price is not compared",
+			item:    line(uuid.New()),
+			product: CatalogProduct{ID: productID, Name: "mug", PriceAmount: 1500, Currency: "EUR", Available: true},
+			found:   true,
+		},
+		{
+			name:         "unavailable variant",
+			item:         line(uuid.New()),
+			product:      CatalogProduct{ID: productID, Name: "mug", PriceAmount: 1500, Currency: "USD"},
+			found:        true,
+			wantChanged:  true,
+			wantReason:   CartPriceChangeUnavailable,
+			wantPrice:    1000,
+			wantCurrency: "USD",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			change, changed := NewCartPriceChange(tt.item, tt.product, tt.found)
+			if changed != tt.wantChanged {
+				t.Fatalf("changed = %v, want %v", changed, tt.wantChanged)
+			}
+			if !changed {
+				return
+			}
+
+			if change.Reason != tt.wantReason {
+				t.Errorf("reason = %q, want %q", change.Reason, tt.wantReason)
+			}
+			if change.Available != tt.wantAvailable {
+				t.Errorf("available = %v, want %v", change.Available, tt.wantAvailable)
+			}
+			if change.Price != tt.wantPrice || change.Currency != tt.wantCurrency {
+				t.Errorf("price = %d %s, want %d %s", change.Price, change.Currency, tt.wantPrice, tt.wantCurrency)
+			}
+			if change.PreviousPrice != tt.item.ProductPrice || change.PreviousCurrency != tt.item.Currency {
+				t.Errorf("previous price = %d %s, want %d %s", change.PreviousPrice, change.PreviousCurrency, tt.item.ProductPrice, tt.item.Currency)
+			}
+			if change.ItemID != tt.item.ID {
+				t.Errorf("item id = %s, want %s", change.ItemID, tt.item.ID)
+			}
+		})
+	}
+}
@@ -0,0 +1,38 @@
+package entity
+
+import "github.com/google/uuid"
+
+const (
+	DriftMissingLine      = "missing_line"
+	DriftExtraLine        = "extra_line"
+	DriftQuantityMismatch = "quantity_mismatch"
+	DriftPriceMismatch    = "price_mismatch"
+	DriftNoteMismatch     = "note_mismatch"
+)
+
+// CartDrift is one difference between the cart in mysql and its copy in redis
+type CartDrift struct {
+	UserID    uuid.UUID
+	ItemID    uuid.UUID
+	ProductID uuid.UUID
+	Kind      string
+	MySQL     string
+	Redis     string
+}
+
+// ReconcileReport summarizes one reconciliation run
+type ReconcileReport struct {
+	UsersChecked  int
+	CartsDrifted  int
+	CartsRepaired int
+	Drifts        []CartDrift
+}
+
+// CountByKind returns how many drifts of each kind were found
+func (r ReconcileReport) CountByKind() map[string]int {
+	counts := make(map[string]int)
+	for _, drift := range r.Drifts {
+		counts[drift.Kind]++
+	}
+	return counts
+}
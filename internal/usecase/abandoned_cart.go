@@ -0,0 +1,136 @@
+package usecase
+
+import (
+	"context"
+	"expvar"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/idoyudha/eshop-cart/config"
+	"github.com/idoyudha/eshop-cart/internal/entity"
+	"github.com/idoyudha/eshop-cart/pkg/logger"
+)
+
+// counters of every detection run of this process, exposed on /debug/vars
+var abandonedCartMetrics = expvar.NewMap("cart_abandoned")
+
+// AbandonedCartUseCase finds carts left idle and publishes a cart-abandoned event once per inactivity,
+// the event goes through the outbox together with the notification record
+type AbandonedCartUseCase struct {
+	repoAbandoned AbandonedCartMySQLRepo
+	repoMySQL     CartMySQLRepo
+	repoOutbox    OutboxMySQLRepo
+	relay         OutboxRelay
+	cfg           config.AbandonedCart
+	l             logger.Interface
+}
+
+func NewAbandonedCartUseCase(
+	repoAbandoned AbandonedCartMySQLRepo,
+	repoMySQL CartMySQLRepo,
+	repoOutbox OutboxMySQLRepo,
+	relay OutboxRelay,
+	cfg config.AbandonedCart,
+	l logger.Interface,
+) *AbandonedCartUseCase {
+	return &AbandonedCartUseCase{
+		repoAbandoned,
+		repoMySQL,
+		repoOutbox,
+		relay,
+		cfg,
+		l,
+	}
+}
+
+// Run detects abandoned carts every cfg.Interval until ctx is done, a zero interval disables it
+func (u *AbandonedCartUseCase) Run(ctx context.Context) {
+	if u.cfg.Interval <= 0 {
+		return
+	}
+
+	ticker := time.NewTicker(u.cfg.Interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if _, err := u.Detect(ctx); err != nil {
+				u.l.Error(err, "usecase - AbandonedCartUseCase - Run - Detect")
+			}
+		}
+	}
+}
+
+// Detect notifies every cart idle for longer than cfg.Threshold and returns how many were notified
+func (u *AbandonedCartUseCase) Detect(ctx context.Context) (int, error) {
+	abandonedCartMetrics.Add("runs", 1)
+	idleBefore := time.Now().Add(-u.cfg.Threshold)
+
+	var notified int
+	afterCartID := uuid.Nil
+	for {
+		carts, err := u.repoAbandoned.GetAbandoned(ctx, idleBefore, afterCartID, u.cfg.BatchSize)
+		if err != nil {
+			return notified, fmt.Errorf("failed to get abandoned carts: %w", err)
+		}
+
+		for _, abandoned := range carts {
+			sent, err := u.notify(ctx, abandoned)
+			if err != nil {
+				return notified, err
+			}
+			if sent {
+				notified++
+			}
+		}
+
+		if len(carts) == 0 || len(carts) < u.cfg.BatchSize {
+			break
+		}
+		afterCartID = carts[len(carts)-1].CartID
+	}
+
+	abandonedCartMetrics.Add("carts_notified", int64(notified))
+	u.l.Info("notified %d abandoned carts idle since %s", notified, idleBefore.Format(time.RFC3339))
+
+	return notified, nil
+}
+
+func (u *AbandonedCartUseCase) notify(ctx context.Context, abandoned entity.AbandonedCart) (bool, error) {
+	cart, err := u.repoMySQL.GetByCartID(ctx, abandoned.UserID, abandoned.CartID)
+	if err != nil {
+		return false, fmt.Errorf("failed to get cart of user %s: %w", abandoned.UserID, err)
+	}
+	if cart == nil || len(cart.Items) == 0 {
+		return false, nil
+	}
+
+	now := time.Now()
+	event, err := entity.NewCartAbandonedEvent(entity.NewCartAbandonedPayload(cart, abandoned.LastActivityAt, now))
+	if err != nil {
+		return false, err
+	}
+
+	var claimed bool
+	err = u.repoMySQL.WithTx(ctx, func(txCtx context.Context) error {
+		var errMark error
+		claimed, errMark = u.repoAbandoned.MarkNotified(txCtx, abandoned, now)
+		if errMark != nil || !claimed {
+			return errMark
+		}
+		return u.repoOutbox.Insert(txCtx, event)
+	})
+	if err != nil {
+		return false, fmt.Errorf("failed to record abandoned cart %s: %w", abandoned.CartID, err)
+	}
+
+	if claimed {
+		u.relay.Dispatch(ctx, event)
+	}
+
+	return claimed, nil
+}
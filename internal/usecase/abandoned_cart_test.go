@@ -0,0 +1,143 @@
+package usecase
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/idoyudha/eshop-cart/config"
+	"github.com/idoyudha/eshop-cart/internal/entity"
+	"github.com/idoyudha/eshop-cart/pkg/logger"
+)
+
+// abandonedRepo returns the idle carts in cart id order, a cart is notified once
+type abandonedRepo struct {
+	AbandonedCartMySQLRepo
+	idle     []entity.AbandonedCart
+	notified map[uuid.UUID]bool
+	pages    int
+	err      error
+}
+
+func (f *abandonedRepo) GetAbandoned(_ context.Context, _ time.Time, after uuid.UUID, limit int) ([]entity.AbandonedCart, error) {
+	if f.err != nil {
+		return nil, f.err
+	}
+	f.pages++
+
+	page := make([]entity.AbandonedCart, 0, limit)
+	for _, abandoned := range f.idle {
+		if bytes.Compare(abandoned.CartID[:], after[:]) > 0 && len(page) < limit {
+			page = append(page, abandoned)
+		}
+	}
+	return page, nil
+}
+
+func (f *abandonedRepo) MarkNotified(_ context.Context, abandoned entity.AbandonedCart, _ time.Time) (bool, error) {
+	if f.notified[abandoned.CartID] {
+		return false, nil
+	}
+	f.notified[abandoned.CartID] = true
+	return true, nil
+}
+
+type abandonedFixture struct {
+	repo   *abandonedRepo
+	carts  *fakeCartRepo
+	outbox *fakeOutboxRepo
+	relay  *fakeRelay
+	uc     *AbandonedCartUseCase
+}
+
+// newAbandonedFixture has idle carts holding lines and idle carts left empty
+func newAbandonedFixture(withLines int, empty int) *abandonedFixture {
+	f := &abandonedFixture{
+		repo:   &abandonedRepo{notified: make(map[uuid.UUID]bool)},
+		carts:  newFakeCartRepo(nil),
+		outbox: &fakeOutboxRepo{},
+		relay:  &fakeRelay{},
+	}
+	for i := 0; i < withLines+empty; i++ {
+		cart := &entity.Cart{ID: uuid.New(), UserID: uuid.New(), Currency: "USD"}
+		f.carts.carts[cart.ID] = cart
+		if i < withLines {
+			f.carts.add(&entity.CartItem{CartID: cart.ID, UserID: cart.UserID, ProductQuantity: 2, ProductPrice: 500, Currency: "USD", List: entity.CartItemListCart})
+		}
+		f.repo.idle = append(f.repo.idle, entity.AbandonedCart{CartID: cart.ID, UserID: cart.UserID, LastActivityAt: time.Now().Add(-48 * time.Hour)})
+	}
+	sort.Slice(f.repo.idle, func(i, j int) bool {
+		return bytes.Compare(f.repo.idle[i].CartID[:], f.repo.idle[j].CartID[:]) < 0
+	})
+
+	cfg := config.AbandonedCart{Threshold: 24 * time.Hour, BatchSize: 2}
+	f.uc = NewAbandonedCartUseCase(f.repo, f.carts, f.outbox, f.relay, cfg, logger.New("error"))
+	return f
+}
+
+func TestDetectAbandonedCarts(t *testing.T) {
+	f := newAbandonedFixture(3, 2)
+
+	notified, err := f.uc.Detect(context.Background())
+	if err != nil {
+		t.Fatalf("Detect() = %v", err)
+	}
+	if notified != 3 {
+		t.Errorf("Detect() = %d, want the 3 carts holding lines", notified)
+	}
+	// five carts in pages of two, the last page is short
+	if f.repo.pages != 3 {
+		t.Errorf("read %d pages, want 3", f.repo.pages)
+	}
+	if len(f.outbox.types) != 3 || len(f.relay.dispatched) != 3 {
+		t.Errorf("recorded %d and dispatched %d events, want 3", len(f.outbox.types), len(f.relay.dispatched))
+	}
+
+	for _, event := range f.relay.dispatched {
+		var payload entity.CartAbandonedPayload
+		if err := json.Unmarshal(event.Payload, &payload); err != nil {
+			t.Fatalf("payload = %v", err)
+		}
+		if event.EventType != entity.OutboxEventCartAbandoned || payload.TotalAmount != 1000 || payload.ItemCount != 2 || len(payload.Items) != 1 {
+			t.Errorf("event %s = %+v, want one line worth 1000", event.EventType, payload)
+		}
+		if !f.repo.notified[payload.CartID] {
+			t.Errorf("cart %s published without being marked notified", payload.CartID)
+		}
+	}
+
+	// a cart stays idle but is notified once per inactivity
+	again, err := f.uc.Detect(context.Background())
+	if err != nil || again != 0 || len(f.relay.dispatched) != 3 {
+		t.Errorf("second Detect() = %d, %v with %d dispatched, want nothing new", again, err, len(f.relay.dispatched))
+	}
+}
+
+func TestDetectAbandonedCartsErrors(t *testing.T) {
+	errDB := errors.New("db down")
+
+	t.Run("idle carts unreadable", func(t *testing.T) {
+		f := newAbandonedFixture(1, 0)
+		f.repo.err = errDB
+		if _, err := f.uc.Detect(context.Background()); !errors.Is(err, errDB) {
+			t.Errorf("Detect() = %v, want %v", err, errDB)
+		}
+	})
+
+	t.Run("outbox insert fails", func(t *testing.T) {
+		f := newAbandonedFixture(2, 0)
+		f.outbox.err = errDB
+		notified, err := f.uc.Detect(context.Background())
+		if !errors.Is(err, errDB) || notified != 0 {
+			t.Errorf("Detect() = %d, %v, want 0 and %v", notified, err, errDB)
+		}
+		if len(f.relay.dispatched) != 0 {
+			t.Errorf("dispatched %d events that were not recorded", len(f.relay.dispatched))
+		}
+	})
+}
@@ -0,0 +1,22 @@
+package usecase
+
+import (
+	"context"
+
+	"github.com/idoyudha/eshop-cart/internal/entity"
+)
+
+type actorKey struct{}
+
+// ContextWithActor attaches who is changing the cart, recorded in the cart history
+func ContextWithActor(ctx context.Context, actor entity.CartActor) context.Context {
+	return context.WithValue(ctx, actorKey{}, actor)
+}
+
+// actorFromContext defaults to the system when no entry point attached an actor
+func actorFromContext(ctx context.Context) entity.CartActor {
+	if actor, ok := ctx.Value(actorKey{}).(entity.CartActor); ok {
+		return actor
+	}
+	return entity.CartActor{Source: entity.CartEventSourceSystem}
+}
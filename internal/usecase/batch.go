@@ -0,0 +1,130 @@
+package usecase
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+
+	"github.com/google/uuid"
+	"github.com/idoyudha/eshop-cart/internal/entity"
+)
+
+// CartBatchResult is the outcome of one item of CreateCarts, Err is set when the item was not added
+type CartBatchResult struct {
+	Item entity.CartItem
+	Err  error
+}
+
+// CreateCarts adds several items to the selected cart of the user in one mysql transaction, redis is refreshed once for the whole batch.
+// with atomic every item is added or none is, and a ValidationError naming the failed items by index is returned.
+// otherwise the valid items are added and the rest report their error in the result of the same index,
+// the ValidationError is only returned when no item at all could be added
+func (u *CartUseCase) CreateCarts(ctx context.Context, userID uuid.UUID, cartID uuid.UUID, items []*entity.CartItem, atomic bool) ([]CartBatchResult, error) {
+	results := make([]CartBatchResult, len(items))
+	valid := 0
+	for i, item := range items {
+		item.UserID = userID
+		if results[i].Err = u.validateLine(item.ProductQuantity, item.Note); results[i].Err != nil {
+			continue
+		}
+		if err := item.GenerateCartItemID(); err != nil {
+			return nil, err
+		}
+		valid++
+	}
+
+	// nothing can be added, best effort fails like all or nothing
+	if (atomic && valid < len(items)) || valid == 0 {
+		return nil, batchValidationError(results)
+	}
+
+	event, err := entity.NewCartChangedEvent(userID)
+	if err != nil {
+		return nil, err
+	}
+
+	// a retry starts again from the validated items, the failed attempt may have changed them
+	validated := slices.Clone(results)
+	originals := make([]entity.CartItem, len(items))
+	for i, item := range items {
+		originals[i] = *item
+	}
+
+	err = retryDuplicate(func() error {
+		copy(results, validated)
+		for i, item := range items {
+			*item = originals[i]
+		}
+
+		return u.mutate(ctx, event, func(txCtx context.Context) error {
+			var cart *entity.Cart
+			for i, item := range items {
+				if results[i].Err != nil {
+					continue
+				}
+
+				if cart == nil {
+					var errCart error
+					if cart, errCart = u.getOrCreateCart(txCtx, userID, cartID, item.Currency); errCart != nil {
+						return errCart
+					}
+				}
+
+				if item.Currency != cart.Currency {
+					results[i].Err = ErrCurrencyMismatch
+					continue
+				}
+				item.CartID = cart.ID
+
+				errAdd := u.addCartItem(txCtx, cart, item)
+				var validation *ValidationError
+				if errors.As(errAdd, &validation) {
+					results[i].Err = errAdd
+					continue
+				}
+				if errAdd != nil {
+					return errAdd
+				}
+				results[i].Item = *item
+			}
+
+			if atomic {
+				// rolls back the items added so far
+				return batchValidationError(results)
+			}
+			return nil
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	for _, result := range results {
+		if result.Err == nil {
+			return results, nil
+		}
+	}
+
+	return nil, batchValidationError(results)
+}
+
+// batchValidationError reports the failed items of a batch with their index, nil when every item succeeded
+func batchValidationError(results []CartBatchResult) error {
+	violations := make([]FieldViolation, 0)
+	for i, result := range results {
+		if result.Err == nil {
+			continue
+		}
+
+		var validation *ValidationError
+		if !errors.As(result.Err, &validation) {
+			violations = append(violations, FieldViolation{Field: fmt.Sprintf("items[%d]", i), Message: result.Err.Error()})
+			continue
+		}
+		for _, violation := range validation.Violations {
+			violations = append(violations, FieldViolation{Field: fmt.Sprintf("items[%d].%s", i, violation.Field), Message: violation.Message})
+		}
+	}
+	return newValidationError(violations)
+}
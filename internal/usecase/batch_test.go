@@ -0,0 +1,130 @@
+package usecase
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/idoyudha/eshop-cart/config"
+	"github.com/idoyudha/eshop-cart/internal/entity"
+)
+
+func TestCreateCarts(t *testing.T) {
+	mug := uuid.New()
+	item := func(productID uuid.UUID, quantity int64, currency string) *entity.CartItem {
+		return &entity.CartItem{ProductID: productID, ProductQuantity: quantity, Currency: currency}
+	}
+
+	tests := []struct {
+		name        string
+		atomic      bool
+		items       []*entity.CartItem
+		insertRaces int
+		// fields of the ValidationError, nil when the batch succeeds
+		wantFields []string
+		// failed items of a best effort batch
+		wantFailed []bool
+		wantLines  int
+	}{
+		{
+			name:       "all added",
+			atomic:     true,
+			items:      []*entity.CartItem{item(mug, 1, "USD"), item(uuid.New(), 2, "USD")},
+			wantFailed: []bool{false, false},
+			wantLines:  2,
+		},
+		{
+			name:       "same product twice adds to one line",
+			items:      []*entity.CartItem{item(mug, 1, "USD"), item(mug, 2, "USD")},
+			wantFailed: []bool{false, false},
+			wantLines:  1,
+		},
+		{
+			name:       "atomic batch with an invalid quantity adds nothing",
+			atomic:     true,
+			items:      []*entity.CartItem{item(mug, 1, "USD"), item(uuid.New(), 0, "USD")},
+			wantFields: []string{"items[1].product_quantity"},
+		},
+		{
+			name:       "best effort skips the invalid quantity",
+			items:      []*entity.CartItem{item(mug, 1, "USD"), item(uuid.New(), 0, "USD")},
+			wantFailed: []bool{false, true},
+			wantLines:  1,
+		},
+		{
+			name:       "best effort skips another currency",
+			items:      []*entity.CartItem{item(mug, 1, "USD"), item(uuid.New(), 1, "EUR")},
+			wantFailed: []bool{false, true},
+			wantLines:  1,
+		},
+		{
+			name:       "best effort where nothing can be added",
+			items:      []*entity.CartItem{item(mug, 0, "USD"), item(uuid.New(), 11, "USD")},
+			wantFields: []string{"items[0].product_quantity", "items[1].product_quantity"},
+		},
+		{
+			name:       "insert race is retried from the validated items",
+			items:      []*entity.CartItem{item(mug, 1, "USD"), item(uuid.New(), 0, "USD")},
+			wantFailed: []bool{false, true},
+			wantLines:  1,
+			// the first insert of the first attempt loses
+			insertRaces: 1,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			userID := uuid.New()
+			repo := newFakeCartRepo(nil)
+			repo.insertRaces = tt.insertRaces
+			uc := &CartUseCase{
+				repoMySQL:  repo,
+				repoOutbox: &fakeOutboxRepo{},
+				repoEvents: &fakeEventRepo{},
+				relay:      &fakeRelay{},
+				rules:      config.CartRules{MinQuantity: 1, MaxQuantity: 10, MaxLines: 5},
+			}
+
+			results, err := uc.CreateCarts(context.Background(), userID, uuid.Nil, tt.items, tt.atomic)
+			if tt.wantFields != nil {
+				var validation *ValidationError
+				if !errors.As(err, &validation) {
+					t.Fatalf("CreateCarts() = %v, want a validation error", err)
+				}
+				if len(validation.Violations) != len(tt.wantFields) {
+					t.Fatalf("violations = %v, want %v", validation.Violations, tt.wantFields)
+				}
+				for i, violation := range validation.Violations {
+					if violation.Field != tt.wantFields[i] {
+						t.Errorf("violation %d on %q, want %q", i, violation.Field, tt.wantFields[i])
+					}
+				}
+				if len(repo.items) != 0 {
+					t.Errorf("a failed batch stored %d lines", len(repo.items))
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("CreateCarts() = %v", err)
+			}
+
+			if len(results) != len(tt.wantFailed) {
+				t.Fatalf("%d results, want one per item", len(results))
+			}
+			for i, result := range results {
+				if failed := result.Err != nil; failed != tt.wantFailed[i] {
+					t.Errorf("item %d failed = %v (%v), want %v", i, failed, result.Err, tt.wantFailed[i])
+				}
+				if result.Err == nil && (result.Item.CartID == uuid.Nil || result.Item.UserID != userID) {
+					t.Errorf("item %d added to cart %s of user %s", i, result.Item.CartID, result.Item.UserID)
+				}
+			}
+
+			cart, _ := repo.GetByUserID(context.Background(), userID)
+			if cart == nil || len(cart.Items) != tt.wantLines {
+				t.Errorf("cart = %v, want %d lines", cart, tt.wantLines)
+			}
+		})
+	}
+}
@@ -1,274 +1,488 @@
 package usecase
 
 import (
-	"bytes"
 	"context"
-	"encoding/json"
-	"fmt"
-	"io"
-	"net/http"
+	"errors"
 
 	"github.com/google/uuid"
 	"github.com/idoyudha/eshop-cart/config"
 	"github.com/idoyudha/eshop-cart/internal/entity"
-	"github.com/idoyudha/eshop-cart/internal/utils"
 )
 
 type CartUseCase struct {
 	repoRedis    CartRedisRepo
 	repoMySQL    CartMySQLRepo
-	orderService config.OrderService
+	repoOutbox   OutboxMySQLRepo
+	repoEvents   CartEventMySQLRepo
+	repoCheckout CheckoutMySQLRepo
+	relay        OutboxRelay
+	orderClient  OrderClient
+	catalog      ProductCatalog
+	inventory    InventoryClient
+	guestCart    config.GuestCart
+	rules        config.CartRules
 }
 
 func NewCartUseCase(
 	repoRedis CartRedisRepo,
 	repoMySQL CartMySQLRepo,
-	orderService config.OrderService,
+	repoOutbox OutboxMySQLRepo,
+	repoEvents CartEventMySQLRepo,
+	repoCheckout CheckoutMySQLRepo,
+	relay OutboxRelay,
+	orderClient OrderClient,
+	catalog ProductCatalog,
+	inventory InventoryClient,
+	guestCart config.GuestCart,
+	rules config.CartRules,
 ) *CartUseCase {
 	return &CartUseCase{
 		repoRedis,
 		repoMySQL,
-		orderService,
+		repoOutbox,
+		repoEvents,
+		repoCheckout,
+		relay,
+		orderClient,
+		catalog,
+		inventory,
+		guestCart,
+		rules,
 	}
 }
 
-func (u *CartUseCase) CreateCart(ctx context.Context, cart *entity.Cart) (entity.Cart, error) {
-	err := cart.GenerateCartID()
-	if err != nil {
-		return entity.Cart{}, err
-	}
+// mutate runs fn and records event in the same mysql transaction,
+// then applies the event to redis right away. if redis fails the relay retries it later.
+func (u *CartUseCase) mutate(ctx context.Context, event *entity.OutboxEvent, fn func(context.Context) error) error {
+	return u.mutateMany(ctx, []*entity.OutboxEvent{event}, fn)
+}
 
-	exist, errExist := u.repoRedis.IsProductExistInUserCart(ctx, cart.UserID.String(), cart.ProductID.String())
-	if errExist != nil {
-		return entity.Cart{}, errExist
+// mutateMany is mutate for a change that touches more than one cart
+func (u *CartUseCase) mutateMany(ctx context.Context, events []*entity.OutboxEvent, fn func(context.Context) error) error {
+	errTx := u.repoMySQL.WithTx(ctx, func(txCtx context.Context) error {
+		if err := fn(txCtx); err != nil {
+			return err
+		}
+		for _, event := range events {
+			if err := u.repoOutbox.Insert(txCtx, event); err != nil {
+				return err
+			}
+			if event.EventType != entity.OutboxEventCartChanged {
+				continue
+			}
+			if err := u.repoMySQL.IncrementCacheVersion(txCtx, event.AggregateID); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if errTx != nil {
+		return errTx
 	}
 
-	var errInsertOrUpdateRedis error
+	u.relay.Dispatch(ctx, events...)
 
-	if !exist {
-		if errInsert := u.repoMySQL.Insert(ctx, cart); errInsert != nil {
-			return entity.Cart{}, errInsert
-		}
+	return nil
+}
 
-		errInsertOrUpdateRedis = u.repoRedis.Save(ctx, cart)
-	} else {
-		if errUpdateProductQty := u.repoMySQL.UpdateProductQty(ctx, cart); errUpdateProductQty != nil {
-			return entity.Cart{}, errUpdateProductQty
-		}
+// retryDuplicate runs fn once more when it lost a race to insert the same cart or line. the retry runs in a new
+// transaction that sees the row committed by the other writer and updates it instead, fn must be safe to run again
+func retryDuplicate(fn func() error) error {
+	err := fn()
+	if errors.Is(err, entity.ErrAlreadyExists) {
+		return fn()
+	}
+	return err
+}
+
+func (u *CartUseCase) CreateCart(ctx context.Context, item *entity.CartItem) (entity.CartItem, error) {
+	if err := u.validateLine(item.ProductQuantity, item.Note); err != nil {
+		return entity.CartItem{}, err
+	}
 
-		errInsertOrUpdateRedis = u.repoRedis.UpdateProductQtyCart(ctx, cart)
+	err := item.GenerateCartItemID()
+	if err != nil {
+		return entity.CartItem{}, err
+	}
+
+	event, err := entity.NewCartChangedEvent(item.UserID)
+	if err != nil {
+		return entity.CartItem{}, err
 	}
 
-	// delete cart from mysql if insert or update to redis failed
-	if errInsertOrUpdateRedis != nil {
-		_, _ = u.repoMySQL.DeleteOne(ctx, cart.ID)
-		return entity.Cart{}, errInsertOrUpdateRedis
+	var added entity.CartItem
+	err = retryDuplicate(func() error {
+		added = *item
+		return u.mutate(ctx, event, func(txCtx context.Context) error {
+			cart, errCart := u.getOrCreateCart(txCtx, added.UserID, added.CartID, added.Currency)
+			if errCart != nil {
+				return errCart
+			}
+			if cart.Currency != added.Currency {
+				return ErrCurrencyMismatch
+			}
+			added.CartID = cart.ID
+
+			return u.addCartItem(txCtx, cart, &added)
+		})
+	})
+	if err != nil {
+		return entity.CartItem{}, err
 	}
 
-	return *cart, nil
+	return added, nil
 }
 
-func (u *CartUseCase) GetUserCart(ctx context.Context, userID uuid.UUID) ([]*entity.Cart, error) {
-	// get cart from redis
-	carts, errGet := u.repoRedis.GetUserCart(ctx, userID.String())
-	if errGet != nil {
-		return nil, errGet
+// addCartItem adds the line to cart, or its quantity to the line of the same product, variant and options.
+// cart.Items must hold the active lines and gets the new line appended
+func (u *CartUseCase) addCartItem(ctx context.Context, cart *entity.Cart, item *entity.CartItem) error {
+	existing, errExist := u.repoMySQL.GetItemByLine(ctx, cart.ID, item, entity.CartItemListCart)
+	if errExist != nil {
+		return errExist
 	}
 
-	// if cart found, return it
-	if len(carts) > 0 {
-		return carts, nil
+	if existing == nil {
+		if errCount := u.validateLineCount(len(cart.Items) + 1); errCount != nil {
+			return errCount
+		}
+		item.List = entity.CartItemListCart
+		item.Version = 1
+		if errInsert := u.repoMySQL.Insert(ctx, item); errInsert != nil {
+			return errInsert
+		}
+		cart.Items = append(cart.Items, item)
+		return u.recordEvent(ctx, entity.CartEventItemCreated, nil, item)
 	}
 
-	// if cart not found, get cart from mysql
-	carts, errGet = u.repoMySQL.GetByUserID(ctx, userID)
+	// same product, variant and options already in the cart, add the quantity to its line
+	if errQuantity := newValidationError(u.checkQuantity(existing.ProductQuantity + item.ProductQuantity)); errQuantity != nil {
+		return errQuantity
+	}
+	item.ID = existing.ID
+	if errUpdate := u.repoMySQL.UpdateProductQty(ctx, item); errUpdate != nil {
+		return errUpdate
+	}
+	item.ProductQuantity += existing.ProductQuantity
+	item.List = existing.List
+	item.Version = existing.Version + 1
+	item.CreatedAt = existing.CreatedAt
+
+	return u.recordEvent(ctx, entity.CartEventItemIncremented, existing, item)
+}
+
+// getOrCreateCart returns the selected cart of the user with its lines, the default cart when cartID is uuid.Nil.
+// the default cart is created on the first item, an empty cart takes over the currency of the item being added.
+func (u *CartUseCase) getOrCreateCart(ctx context.Context, userID uuid.UUID, cartID uuid.UUID, currency string) (*entity.Cart, error) {
+	var cart *entity.Cart
+	var errGet error
+	if cartID != uuid.Nil {
+		cart, errGet = u.repoMySQL.GetByCartID(ctx, userID, cartID)
+		if errGet == nil && cart == nil {
+			errGet = ErrCartNotFound
+		}
+	} else {
+		cart, errGet = u.repoMySQL.GetByUserID(ctx, userID)
+	}
 	if errGet != nil {
 		return nil, errGet
 	}
 
-	// save cart to redis
-	for _, cart := range carts {
-		if errSave := u.repoRedis.Save(ctx, cart); errSave != nil {
-			return nil, errSave
+	if cart != nil {
+		if len(cart.Items) == 0 && cart.Currency != currency {
+			if errUpdate := u.repoMySQL.UpdateCartCurrency(ctx, cart.ID, currency); errUpdate != nil {
+				return nil, errUpdate
+			}
+			cart.Currency = currency
 		}
+		return cart, nil
 	}
 
-	return carts, nil
-}
+	cart, errNew := entity.NewCart(userID, currency)
+	if errNew != nil {
+		return nil, errNew
+	}
 
-func (u *CartUseCase) UpdateQtyAndNoteCart(ctx context.Context, cart *entity.Cart) error {
-	productID, errUpdate := u.repoMySQL.UpdateQtyAndNote(ctx, cart)
-	if errUpdate != nil {
-		return errUpdate
+	// a concurrent request that created the cart first fails this insert with entity.ErrAlreadyExists,
+	// the caller retries in a new transaction that sees that cart
+	if errInsert := u.repoMySQL.InsertCart(ctx, cart); errInsert != nil {
+		return nil, errInsert
 	}
 
-	cart.ProductID = *productID
-	if errSave := u.repoRedis.UpdateQtyAndNote(ctx, cart); errSave != nil {
-		return errSave
+	if errDefault := u.repoMySQL.SetDefaultCart(ctx, userID, cart.ID); errDefault != nil {
+		return nil, errDefault
 	}
 
-	return nil
+	return cart, nil
 }
 
-func (u *CartUseCase) UpdateProductNameAndPriceCart(ctx context.Context, cart *entity.Cart) error {
-	if errUpdate := u.repoMySQL.UpdateNameAndPrice(ctx, cart); errUpdate != nil {
-		return errUpdate
+// selectCart returns the header of the selected cart of the user, the default cart when cartID is uuid.Nil.
+// nil when the user has no cart yet, ErrCartNotFound when the selected cart does not exist
+func (u *CartUseCase) selectCart(ctx context.Context, userID uuid.UUID, cartID uuid.UUID) (*entity.Cart, error) {
+	if cartID == uuid.Nil {
+		return u.repoMySQL.GetCartByUserID(ctx, userID)
 	}
 
-	if errSave := u.repoRedis.UpdateNameAndPrice(ctx, cart); errSave != nil {
-		return errSave
+	cart, err := u.repoMySQL.GetCartByID(ctx, userID, cartID)
+	if err != nil {
+		return nil, err
+	}
+	if cart == nil {
+		return nil, ErrCartNotFound
 	}
 
-	return nil
+	return cart, nil
 }
 
-func (u *CartUseCase) DeleteCart(ctx context.Context, userID uuid.UUID, cartID uuid.UUID) error {
-	productID, errDelete := u.repoMySQL.DeleteOne(ctx, cartID)
-	if errDelete != nil {
-		return errDelete
+// GetUserCart returns the selected cart of the user, the default cart when cartID is uuid.Nil.
+// only the default cart is cached in redis, other named carts are read from mysql
+func (u *CartUseCase) GetUserCart(ctx context.Context, userID uuid.UUID, cartID uuid.UUID) (*entity.Cart, error) {
+	if cartID != uuid.Nil {
+		cart, errGet := u.repoMySQL.GetByCartID(ctx, userID, cartID)
+		if errGet != nil {
+			return nil, errGet
+		}
+		if cart == nil {
+			return nil, ErrCartNotFound
+		}
+		return cart, nil
 	}
 
-	if errDelete := u.repoRedis.DeleteCart(ctx, userID.String(), productID.String()); errDelete != nil {
-		return errDelete
+	// get cart from redis
+	cart, errGet := u.repoRedis.GetUserCart(ctx, userID.String())
+	if errGet != nil {
+		return nil, errGet
 	}
 
-	return nil
-}
+	// if cart found, return it
+	if cart != nil {
+		return cart, nil
+	}
 
-func (u *CartUseCase) DeleteCarts(ctx context.Context, userID uuid.UUID, cartIDs uuid.UUIDs) error {
-	if errDelete := u.repoMySQL.DeleteMany(ctx, cartIDs); errDelete != nil {
-		return errDelete
+	// if cart not found, get cart from mysql
+	cart, errGet = u.repoMySQL.GetByUserID(ctx, userID)
+	if errGet != nil {
+		return nil, errGet
 	}
 
-	var redisCartIDs []string
-	for _, cartID := range cartIDs {
-		redisCartIDs = append(redisCartIDs, cartID.String())
+	// user without any item yet, nothing to cache
+	if cart == nil {
+		return emptyCart(userID), nil
 	}
-	if errDelete := u.repoRedis.DeleteCarts(ctx, userID.String()); errDelete != nil {
-		return errDelete
+
+	// save cart to redis
+	if errSave := u.repoRedis.SaveCart(ctx, cart); errSave != nil {
+		return nil, errSave
 	}
 
-	return nil
+	return cart, nil
 }
 
-type createOrderRequest struct {
-	Items   []createItemsOrderRequest `json:"items"`
-	Address createAddressOrderRequest `json:"address"`
+// emptyCart is returned for users that never added an item, it is not stored
+func emptyCart(userID uuid.UUID) *entity.Cart {
+	return &entity.Cart{
+		UserID:   userID,
+		Name:     entity.DefaultCartName,
+		Default:  true,
+		Currency: entity.DefaultCartCurrency,
+		Status:   entity.CartStatusActive,
+		Items:    make([]*entity.CartItem, 0),
+	}
 }
 
-type createItemsOrderRequest struct {
-	ProductID uuid.UUID `json:"product_id"`
-	Quantity  int64     `json:"quantity"`
-	Price     float64   `json:"price"`
-}
+// UpdateQtyAndNoteCart updates the line in place and fills it with its new state,
+// a quantity of zero removes the line and sets item.DeletedAt.
+// a non zero item.Version must match the current version of the line.
+func (u *CartUseCase) UpdateQtyAndNoteCart(ctx context.Context, item *entity.CartItem) error {
+	if item.ProductQuantity != 0 {
+		if err := u.validateLine(item.ProductQuantity, item.Note); err != nil {
+			return err
+		}
+	}
 
-type createAddressOrderRequest struct {
-	Street  string `json:"street"`
-	City    string `json:"city"`
-	State   string `json:"state"`
-	ZipCode string `json:"zipcode"`
-	Note    string `json:"note"`
-}
+	event, err := entity.NewCartChangedEvent(item.UserID)
+	if err != nil {
+		return err
+	}
 
-type restSuccessCreateOrder struct {
-	Code    int           `json:"code"`
-	Data    orderResponse `json:"data"`
-	Message string        `json:"message"`
-}
+	return u.mutate(ctx, event, func(txCtx context.Context) error {
+		current, errCurrent := u.lockCartItem(txCtx, item.UserID, item.ID, item.Version)
+		if errCurrent != nil {
+			return errCurrent
+		}
 
-type orderResponse struct {
-	Status     string               `json:"status"`
-	TotalPrice float64              `json:"total_price"`
-	Items      []itemsOrderResponse `json:"items"`
-	Address    addressOrderResponse `json:"address"`
-}
+		before := *current
+		if item.ProductQuantity == 0 {
+			if errDelete := u.repoMySQL.DeleteOne(txCtx, item.ID, entity.CartItemDeletedRemoved); errDelete != nil {
+				return errDelete
+			}
+			current.ProductQuantity = 0
+			current.DeletedAt = item.UpdatedAt
+			*item = *current
+			return u.recordEvent(txCtx, entity.CartEventItemDeleted, &before, nil)
+		}
 
-type itemsOrderResponse struct {
-	OrderID   uuid.UUID `json:"order_id"`
-	ProductID uuid.UUID `json:"product_id"`
-	Price     float64   `json:"price"`
-	Quantity  int64     `json:"quantity"`
-	Note      string    `json:"note"`
-}
+		if errUpdate := u.repoMySQL.UpdateQtyAndNote(txCtx, item); errUpdate != nil {
+			return errUpdate
+		}
 
-type addressOrderResponse struct {
-	OrderID uuid.UUID `json:"order_id"`
-	Street  string    `json:"street"`
-	City    string    `json:"city"`
-	State   string    `json:"state"`
-	ZipCode string    `json:"zipcode"`
-	Note    string    `json:"note"`
+		current.ProductQuantity = item.ProductQuantity
+		current.Note = item.Note
+		current.UpdatedAt = item.UpdatedAt
+		current.Version++
+		*item = *current
+
+		return u.recordEvent(txCtx, entity.CartEventItemUpdated, &before, current)
+	})
 }
 
-func cartToCreateOrderRequest(carts []*entity.Cart, cartIDs uuid.UUIDs, address *entity.CheckoutAddress) createOrderRequest {
-	var items []createItemsOrderRequest
-	for _, cart := range carts {
-		if utils.IDInSliceUUID(cart.ID, cartIDs) {
-			items = append(items, createItemsOrderRequest{
-				ProductID: cart.ProductID,
-				Quantity:  cart.ProductQuantity,
-				Price:     cart.ProductPrice,
-			})
-		}
+// lockCartItem returns the active line of the user locked for the running transaction,
+// checking it is still at expectedVersion unless that is zero
+func (u *CartUseCase) lockCartItem(ctx context.Context, userID uuid.UUID, itemID uuid.UUID, expectedVersion int64) (*entity.CartItem, error) {
+	current, err := u.repoMySQL.GetItemByID(ctx, userID, itemID)
+	if err != nil {
+		return nil, err
 	}
-	return createOrderRequest{
-		Items: items,
-		Address: createAddressOrderRequest{
-			Street:  address.Street,
-			City:    address.City,
-			State:   address.State,
-			ZipCode: address.ZipCode,
-		},
+
+	if current == nil {
+		return nil, ErrCartItemNotFound
 	}
+
+	if current.List == entity.CartItemListCheckout {
+		return nil, ErrCheckoutInProgress
+	}
+
+	if expectedVersion != 0 && expectedVersion != current.Version {
+		return nil, &VersionConflictError{
+			ItemID:   itemID,
+			Expected: expectedVersion,
+			Current:  current.Version,
+		}
+	}
+
+	return current, nil
 }
 
-func (u *CartUseCase) CheckOutCarts(ctx context.Context, userID uuid.UUID, cartIDs uuid.UUIDs, address *entity.CheckoutAddress, token string) error {
-	// 1. get cart from redis
-	carts, err := u.GetUserCart(ctx, userID)
+// UpdateProductNameAndPriceCart applies a catalog update to every line of the product, only lines that
+// actually change are written and recorded, a price in another currency than the line is ignored
+func (u *CartUseCase) UpdateProductNameAndPriceCart(ctx context.Context, item *entity.CartItem) error {
+	lines, err := u.repoMySQL.GetItemsByProductID(ctx, item.ProductID)
 	if err != nil {
-		return fmt.Errorf("failed to get cart: %w", err)
+		return err
 	}
 
-	// 2. request create order
-	createOrderURL := fmt.Sprintf("%s/v1/orders", u.orderService.BaseURL)
-	createOrderReq := cartToCreateOrderRequest(carts, cartIDs, address)
+	changed := make([]*entity.CartItem, 0, len(lines))
+	afters := make([]*entity.CartItem, 0, len(lines))
+	for _, line := range lines {
+		after := *line
+		after.ProductName = item.ProductName
+		if line.Currency == item.Currency {
+			after.ProductPrice = item.ProductPrice
+		}
+		if after.ProductName == line.ProductName && after.ProductPrice == line.ProductPrice {
+			continue
+		}
+		after.UpdatedAt = item.UpdatedAt
+		changed = append(changed, line)
+		afters = append(afters, &after)
+	}
 
-	requestBody, err := json.Marshal(createOrderReq)
-	if err != nil {
-		return fmt.Errorf("failed to marshal request body: %w", err)
+	if len(changed) == 0 {
+		return nil
 	}
 
-	req, err := http.NewRequestWithContext(ctx, http.MethodPost, createOrderURL, bytes.NewBuffer(requestBody))
+	event, err := entity.NewProductChangedEvent(item)
 	if err != nil {
-		return fmt.Errorf("failed to create request: %w", err)
+		return err
 	}
-	req.Header.Set("Content-Type", "application/json")
-	req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", token))
 
-	client := &http.Client{}
-	resp, err := client.Do(req)
-	if err != nil {
-		return fmt.Errorf("failed to send request: %w", err)
+	ids := make(uuid.UUIDs, len(changed))
+	for i, line := range changed {
+		ids[i] = line.ID
 	}
-	defer resp.Body.Close()
 
-	body, err := io.ReadAll(resp.Body)
+	return u.mutate(ctx, event, func(txCtx context.Context) error {
+		if errUpdate := u.repoMySQL.UpdateNameAndPrice(txCtx, item, ids); errUpdate != nil {
+			return errUpdate
+		}
+
+		for i, line := range changed {
+			if errEvent := u.recordEvent(txCtx, entity.CartEventItemRepriced, line, afters[i]); errEvent != nil {
+				return errEvent
+			}
+		}
+
+		return nil
+	})
+}
+
+// DeleteCart soft deletes the line, a non zero version must match the current version of the line
+func (u *CartUseCase) DeleteCart(ctx context.Context, userID uuid.UUID, itemID uuid.UUID, version int64) error {
+	event, err := entity.NewCartChangedEvent(userID)
 	if err != nil {
-		return fmt.Errorf("failed to read response body: %w", err)
+		return err
 	}
 
-	var successCreateOrder restSuccessCreateOrder
-	if err := json.Unmarshal(body, &successCreateOrder); err != nil {
-		return fmt.Errorf("failed to unmarshal response body: %w", err)
+	return u.mutate(ctx, event, func(txCtx context.Context) error {
+		current, errCurrent := u.lockCartItem(txCtx, userID, itemID, version)
+		if errCurrent != nil {
+			return errCurrent
+		}
+
+		if errDelete := u.repoMySQL.DeleteOne(txCtx, itemID, entity.CartItemDeletedRemoved); errDelete != nil {
+			return errDelete
+		}
+
+		return u.recordEvent(txCtx, entity.CartEventItemDeleted, current, nil)
+	})
+}
+
+// DeleteCarts soft deletes the lines of itemIDs owned by the user, other ids are ignored
+func (u *CartUseCase) DeleteCarts(ctx context.Context, userID uuid.UUID, itemIDs uuid.UUIDs) error {
+	return u.deleteItems(ctx, userID, itemIDs, entity.CartItemDeletedRemoved, entity.CartEventItemDeleted)
+}
+
+// deleteItems soft deletes the lines of itemIDs owned by the user for reason and records eventType for each of them
+func (u *CartUseCase) deleteItems(ctx context.Context, userID uuid.UUID, itemIDs uuid.UUIDs, reason string, eventType string) error {
+	event, err := entity.NewCartChangedEvent(userID)
+	if err != nil {
+		return err
 	}
 
-	if resp.StatusCode != http.StatusCreated {
-		return fmt.Errorf("failed to create order: %w", err)
+	return u.mutate(ctx, event, func(txCtx context.Context) error {
+		items, errItems := u.repoMySQL.GetItemsByIDs(txCtx, userID, itemIDs)
+		if errItems != nil {
+			return errItems
+		}
+		if len(items) == 0 {
+			return nil
+		}
+
+		// lines held by a running checkout are left to it
+		deleted := make([]*entity.CartItem, 0, len(items))
+		for _, item := range items {
+			if item.List != entity.CartItemListCheckout {
+				deleted = append(deleted, item)
+			}
+		}
+
+		return u.deleteLines(txCtx, userID, deleted, reason, eventType)
+	})
+}
+
+// deleteLines soft deletes the locked lines of the user for reason and records eventType for each of them
+func (u *CartUseCase) deleteLines(ctx context.Context, userID uuid.UUID, items []*entity.CartItem, reason string, eventType string) error {
+	itemIDs := make(uuid.UUIDs, len(items))
+	for i, item := range items {
+		itemIDs[i] = item.ID
+	}
+	if errDelete := u.repoMySQL.DeleteMany(ctx, userID, itemIDs, reason); errDelete != nil {
+		return errDelete
 	}
 
-	// 3. delete cart from mysql and redis
-	if errDelete := u.DeleteCarts(ctx, userID, cartIDs); errDelete != nil {
-		return fmt.Errorf("failed to delete cart: %w", errDelete)
+	for _, item := range items {
+		if errEvent := u.recordEvent(ctx, eventType, item, nil); errEvent != nil {
+			return errEvent
+		}
 	}
 
 	return nil
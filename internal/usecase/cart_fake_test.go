@@ -0,0 +1,350 @@
+package usecase
+
+import (
+	"bytes"
+	"context"
+
+	"github.com/google/uuid"
+	"github.com/idoyudha/eshop-cart/internal/entity"
+)
+
+// the fakes embed the interfaces they stand in for, a call a test does not expect panics
+
+// fakeCartRepo is an in memory CartMySQLRepo holding the carts of one user, cart is the default one
+type fakeCartRepo struct {
+	CartMySQLRepo
+	cart    *entity.Cart
+	carts   map[uuid.UUID]*entity.Cart
+	items   map[uuid.UUID]*entity.CartItem
+	deleted map[uuid.UUID]string
+	// cart changes counted by IncrementCacheVersion
+	versions int64
+	// Insert loses the race to a concurrent insert this many times
+	insertRaces int
+}
+
+func newFakeCartRepo(cart *entity.Cart, items ...*entity.CartItem) *fakeCartRepo {
+	f := &fakeCartRepo{
+		cart:    cart,
+		carts:   make(map[uuid.UUID]*entity.Cart),
+		items:   make(map[uuid.UUID]*entity.CartItem),
+		deleted: make(map[uuid.UUID]string),
+	}
+	if cart != nil {
+		f.carts[cart.ID] = cart
+	}
+	for _, item := range items {
+		f.items[item.ID] = item
+	}
+	return f
+}
+
+func (f *fakeCartRepo) WithTx(ctx context.Context, fn func(context.Context) error) error {
+	return fn(ctx)
+}
+
+func (f *fakeCartRepo) InsertCart(_ context.Context, cart *entity.Cart) error {
+	f.carts[cart.ID] = cart
+	return nil
+}
+
+func (f *fakeCartRepo) SetDefaultCart(_ context.Context, _ uuid.UUID, cartID uuid.UUID) error {
+	f.cart = f.carts[cartID]
+	return nil
+}
+
+func (f *fakeCartRepo) UpdateCartCurrency(_ context.Context, cartID uuid.UUID, currency string) error {
+	f.carts[cartID].Currency = currency
+	return nil
+}
+
+func (f *fakeCartRepo) GetCartByUserID(_ context.Context, userID uuid.UUID) (*entity.Cart, error) {
+	return f.defaultCart(userID), nil
+}
+
+func (f *fakeCartRepo) GetCartByID(_ context.Context, userID uuid.UUID, cartID uuid.UUID) (*entity.Cart, error) {
+	cart, ok := f.carts[cartID]
+	if !ok || cart.UserID != userID {
+		return nil, nil
+	}
+	return cart, nil
+}
+
+func (f *fakeCartRepo) IncrementCacheVersion(context.Context, uuid.UUID) error {
+	f.versions++
+	return nil
+}
+
+func (f *fakeCartRepo) GetByUserID(ctx context.Context, userID uuid.UUID) (*entity.Cart, error) {
+	header := f.defaultCart(userID)
+	if header == nil {
+		return nil, nil
+	}
+	cart, err := f.GetByCartID(ctx, userID, header.ID)
+	if cart != nil {
+		cart.CacheVersion = f.versions
+	}
+	return cart, err
+}
+
+func (f *fakeCartRepo) GetByCartID(_ context.Context, _ uuid.UUID, cartID uuid.UUID) (*entity.Cart, error) {
+	cart, ok := f.carts[cartID]
+	if !ok {
+		return nil, nil
+	}
+
+	copied := *cart
+	copied.Items = f.list(cartID, entity.CartItemListCart)
+	return &copied, nil
+}
+
+func (f *fakeCartRepo) GetItemsForUpdate(_ context.Context, cartID uuid.UUID) ([]*entity.CartItem, error) {
+	return f.list(cartID, entity.CartItemListCart), nil
+}
+
+func (f *fakeCartRepo) GetItemsByProductID(_ context.Context, productID uuid.UUID) ([]*entity.CartItem, error) {
+	items := make([]*entity.CartItem, 0)
+	for id, item := range f.items {
+		if item.ProductID == productID && f.deleted[id] == "" {
+			copied := *item
+			items = append(items, &copied)
+		}
+	}
+	return items, nil
+}
+
+func (f *fakeCartRepo) GetItemByID(_ context.Context, _ uuid.UUID, itemID uuid.UUID) (*entity.CartItem, error) {
+	item, ok := f.items[itemID]
+	if !ok || f.deleted[itemID] != "" {
+		return nil, nil
+	}
+	copied := *item
+	return &copied, nil
+}
+
+func (f *fakeCartRepo) GetItemsByIDs(_ context.Context, _ uuid.UUID, itemIDs uuid.UUIDs) ([]*entity.CartItem, error) {
+	items := make([]*entity.CartItem, 0, len(itemIDs))
+	for _, itemID := range itemIDs {
+		if item, ok := f.items[itemID]; ok && f.deleted[itemID] == "" {
+			copied := *item
+			items = append(items, &copied)
+		}
+	}
+	return items, nil
+}
+
+func (f *fakeCartRepo) GetItemsByList(_ context.Context, cartID uuid.UUID, list string) ([]*entity.CartItem, error) {
+	return f.list(cartID, list), nil
+}
+
+func (f *fakeCartRepo) GetItemByLine(_ context.Context, cartID uuid.UUID, line *entity.CartItem, list string) (*entity.CartItem, error) {
+	for _, item := range f.list(cartID, list) {
+		if item.LineKey() == line.LineKey() {
+			return item, nil
+		}
+	}
+	return nil, nil
+}
+
+func (f *fakeCartRepo) Insert(_ context.Context, item *entity.CartItem) error {
+	if f.insertRaces > 0 {
+		f.insertRaces--
+		return entity.ErrAlreadyExists
+	}
+	copied := *item
+	f.items[item.ID] = &copied
+	return nil
+}
+
+func (f *fakeCartRepo) GetRemovedItemByID(_ context.Context, userID uuid.UUID, itemID uuid.UUID) (*entity.CartItem, error) {
+	item, ok := f.items[itemID]
+	if !ok || item.UserID != userID || f.deleted[itemID] != entity.CartItemDeletedRemoved {
+		return nil, nil
+	}
+	copied := *item
+	return &copied, nil
+}
+
+func (f *fakeCartRepo) RestoreItem(_ context.Context, item *entity.CartItem) error {
+	delete(f.deleted, item.ID)
+	f.items[item.ID].Version++
+	return nil
+}
+
+func (f *fakeCartRepo) MoveItem(_ context.Context, item *entity.CartItem) error {
+	f.items[item.ID].List = item.List
+	f.items[item.ID].Version++
+	return nil
+}
+
+func (f *fakeCartRepo) MoveItemToCart(_ context.Context, item *entity.CartItem) error {
+	f.items[item.ID].CartID = item.CartID
+	f.items[item.ID].Version++
+	return nil
+}
+
+func (f *fakeCartRepo) MoveItemsList(_ context.Context, _ uuid.UUID, itemIDs uuid.UUIDs, from string, to string) error {
+	for _, itemID := range itemIDs {
+		if item := f.items[itemID]; item != nil && item.List == from {
+			item.List = to
+		}
+	}
+	return nil
+}
+
+func (f *fakeCartRepo) UpdateQtyAndNote(_ context.Context, item *entity.CartItem) error {
+	line := f.items[item.ID]
+	line.ProductQuantity = item.ProductQuantity
+	line.Note = item.Note
+	line.Version++
+	return nil
+}
+
+func (f *fakeCartRepo) UpdateProductQty(_ context.Context, item *entity.CartItem) error {
+	line := f.items[item.ID]
+	line.ProductQuantity += item.ProductQuantity
+	line.Version++
+	return nil
+}
+
+func (f *fakeCartRepo) UpdateNameAndPrice(_ context.Context, item *entity.CartItem, itemIDs uuid.UUIDs) error {
+	for _, itemID := range itemIDs {
+		line := f.items[itemID]
+		line.ProductName = item.ProductName
+		if line.Currency == item.Currency {
+			line.ProductPrice = item.ProductPrice
+		}
+	}
+	return nil
+}
+
+func (f *fakeCartRepo) DeleteOne(_ context.Context, itemID uuid.UUID, reason string) error {
+	f.deleted[itemID] = reason
+	return nil
+}
+
+func (f *fakeCartRepo) DeleteMany(_ context.Context, _ uuid.UUID, itemIDs uuid.UUIDs, reason string) error {
+	for _, itemID := range itemIDs {
+		f.deleted[itemID] = reason
+	}
+	return nil
+}
+
+// defaultCart returns the default cart stored for userID, such as the guest cart of a merge, and cart when there is none
+func (f *fakeCartRepo) defaultCart(userID uuid.UUID) *entity.Cart {
+	for _, cart := range f.carts {
+		if cart.Default && cart.UserID == userID && cart != f.cart {
+			return cart
+		}
+	}
+	return f.cart
+}
+
+// add stores a copy of the line under a new id
+func (f *fakeCartRepo) add(item *entity.CartItem) uuid.UUID {
+	copied := *item
+	copied.ID = uuid.New()
+	f.items[copied.ID] = &copied
+	return copied.ID
+}
+
+// list returns copies of the active lines of the cart list
+func (f *fakeCartRepo) list(cartID uuid.UUID, list string) []*entity.CartItem {
+	items := make([]*entity.CartItem, 0)
+	for id, item := range f.items {
+		if item.CartID == cartID && item.List == list && f.deleted[id] == "" {
+			copied := *item
+			items = append(items, &copied)
+		}
+	}
+	return items
+}
+
+// fakeCartRedisRepo is the cache of the users, err fails every call
+type fakeCartRedisRepo struct {
+	CartRedisRepo
+	err      error
+	carts    map[string]*entity.Cart
+	replaced map[string]*entity.Cart
+	products []*entity.CartItem
+}
+
+func newFakeCartRedisRepo() *fakeCartRedisRepo {
+	return &fakeCartRedisRepo{carts: make(map[string]*entity.Cart), replaced: make(map[string]*entity.Cart)}
+}
+
+func (f *fakeCartRedisRepo) GetUserCart(_ context.Context, userID string) (*entity.Cart, error) {
+	return f.carts[userID], f.err
+}
+
+func (f *fakeCartRedisRepo) SaveCart(_ context.Context, cart *entity.Cart) error {
+	if f.err != nil {
+		return f.err
+	}
+	f.carts[cart.UserID.String()] = cart
+	return nil
+}
+
+func (f *fakeCartRedisRepo) ReplaceCart(_ context.Context, userID string, cart *entity.Cart) error {
+	if f.err != nil {
+		return f.err
+	}
+	f.replaced[userID] = cart
+	f.carts[userID] = cart
+	return nil
+}
+
+func (f *fakeCartRedisRepo) UpdateNameAndPrice(_ context.Context, item *entity.CartItem) error {
+	if f.err != nil {
+		return f.err
+	}
+	f.products = append(f.products, item)
+	return nil
+}
+
+type fakeOutboxRepo struct {
+	OutboxMySQLRepo
+	err   error
+	types []string
+}
+
+func (f *fakeOutboxRepo) Insert(_ context.Context, event *entity.OutboxEvent) error {
+	if f.err != nil {
+		return f.err
+	}
+	f.types = append(f.types, event.EventType)
+	return nil
+}
+
+type fakeRelay struct {
+	OutboxRelay
+	dispatched []*entity.OutboxEvent
+}
+
+func (f *fakeRelay) Dispatch(_ context.Context, events ...*entity.OutboxEvent) {
+	f.dispatched = append(f.dispatched, events...)
+}
+
+type fakeEventRepo struct {
+	CartEventMySQLRepo
+	types  []string
+	events []*entity.CartEvent
+}
+
+func (f *fakeEventRepo) Insert(_ context.Context, event *entity.CartEvent) error {
+	f.types = append(f.types, event.EventType)
+	f.events = append(f.events, event)
+	return nil
+}
+
+// GetByUserID pages the events newest first, event ids are time ordered
+func (f *fakeEventRepo) GetByUserID(_ context.Context, userID uuid.UUID, before uuid.UUID, limit int) ([]*entity.CartEvent, error) {
+	events := make([]*entity.CartEvent, 0, limit)
+	for i := len(f.events) - 1; i >= 0 && len(events) < limit; i-- {
+		event := f.events[i]
+		if event.UserID == userID && bytes.Compare(event.ID[:], before[:]) < 0 {
+			events = append(events, event)
+		}
+	}
+	return events, nil
+}
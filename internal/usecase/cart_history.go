@@ -0,0 +1,29 @@
+package usecase
+
+import (
+	"context"
+
+	"github.com/google/uuid"
+	"github.com/idoyudha/eshop-cart/internal/entity"
+)
+
+// recordEvent appends the change of a line to the cart history, called inside the mutating transaction
+// so a change and its history are committed together. before is nil for a new line, after for a removed one
+func (u *CartUseCase) recordEvent(ctx context.Context, eventType string, before *entity.CartItem, after *entity.CartItem) error {
+	event, err := entity.NewCartEvent(eventType, actorFromContext(ctx), before, after)
+	if err != nil {
+		return err
+	}
+
+	return u.repoEvents.Insert(ctx, event)
+}
+
+// GetHistory returns up to limit changes to the cart of the user, newest first,
+// starting after the event id cursor or from the newest event when it is uuid.Nil
+func (u *CartUseCase) GetHistory(ctx context.Context, userID uuid.UUID, cursor uuid.UUID, limit int) ([]*entity.CartEvent, error) {
+	if cursor == uuid.Nil {
+		cursor = uuid.Max
+	}
+
+	return u.repoEvents.GetByUserID(ctx, userID, cursor, limit)
+}
@@ -0,0 +1,88 @@
+package usecase
+
+import (
+	"context"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/idoyudha/eshop-cart/config"
+	"github.com/idoyudha/eshop-cart/internal/entity"
+)
+
+func TestCartHistory(t *testing.T) {
+	userID := uuid.New()
+	cart := &entity.Cart{ID: uuid.New(), UserID: userID, Default: true, Currency: "USD"}
+	repo := newFakeCartRepo(cart)
+	events := &fakeEventRepo{}
+	uc := &CartUseCase{
+		repoMySQL:  repo,
+		repoOutbox: &fakeOutboxRepo{},
+		repoEvents: events,
+		relay:      &fakeRelay{},
+		rules:      config.CartRules{MinQuantity: 1, MaxQuantity: 10},
+	}
+
+	ctx := ContextWithActor(context.Background(), entity.CartActor{ID: userID.String(), Source: entity.CartEventSourceHTTP})
+	item := entity.CartItem{UserID: userID, ProductID: uuid.New(), ProductQuantity: 1, Currency: "USD"}
+	added, err := uc.CreateCart(ctx, &item)
+	if err != nil {
+		t.Fatalf("CreateCart() = %v", err)
+	}
+	update := entity.CartItem{ID: added.ID, UserID: userID, ProductQuantity: 4}
+	if err := uc.UpdateQtyAndNoteCart(ctx, &update); err != nil {
+		t.Fatalf("UpdateQtyAndNoteCart() = %v", err)
+	}
+	// changes made without an entry point are the system's
+	if err := uc.DeleteCart(context.Background(), userID, added.ID, 0); err != nil {
+		t.Fatalf("DeleteCart() = %v", err)
+	}
+
+	history, err := uc.GetHistory(context.Background(), userID, uuid.Nil, 10)
+	if err != nil {
+		t.Fatalf("GetHistory() = %v", err)
+	}
+
+	want := []struct {
+		eventType  string
+		source     string
+		before     int64
+		after      int64
+		hasBefore  bool
+		hasAfter   bool
+		withUserID bool
+	}{
+		{eventType: entity.CartEventItemDeleted, source: entity.CartEventSourceSystem, before: 4, hasBefore: true},
+		{eventType: entity.CartEventItemUpdated, source: entity.CartEventSourceHTTP, before: 1, after: 4, hasBefore: true, hasAfter: true, withUserID: true},
+		{eventType: entity.CartEventItemCreated, source: entity.CartEventSourceHTTP, after: 1, hasAfter: true, withUserID: true},
+	}
+	if len(history) != len(want) {
+		t.Fatalf("GetHistory() = %d events, want %d", len(history), len(want))
+	}
+	for i, event := range history {
+		w := want[i]
+		if event.EventType != w.eventType || event.Source != w.source || event.ItemID != added.ID || event.CartID != cart.ID {
+			t.Errorf("event %d = %s from %s of item %s, want %s from %s", i, event.EventType, event.Source, event.ItemID, w.eventType, w.source)
+		}
+		if (event.Actor == userID.String()) != w.withUserID {
+			t.Errorf("event %d actor = %q", i, event.Actor)
+		}
+		if (event.Before != nil) != w.hasBefore || (event.After != nil) != w.hasAfter {
+			t.Fatalf("event %d before %v after %v, want before %v after %v", i, event.Before, event.After, w.hasBefore, w.hasAfter)
+		}
+		if w.hasBefore && event.Before.ProductQuantity != w.before {
+			t.Errorf("event %d before quantity %d, want %d", i, event.Before.ProductQuantity, w.before)
+		}
+		if w.hasAfter && event.After.ProductQuantity != w.after {
+			t.Errorf("event %d after quantity %d, want %d", i, event.After.ProductQuantity, w.after)
+		}
+	}
+
+	// the cursor continues after the last event of a page
+	page, err := uc.GetHistory(context.Background(), userID, history[0].ID, 1)
+	if err != nil || len(page) != 1 || page[0].ID != history[1].ID {
+		t.Errorf("GetHistory() after %s = %v, %v, want the update", history[0].ID, page, err)
+	}
+	if others, _ := uc.GetHistory(context.Background(), uuid.New(), uuid.Nil, 10); len(others) != 0 {
+		t.Errorf("another user sees %d events", len(others))
+	}
+}
@@ -0,0 +1,71 @@
+package usecase
+
+import (
+	"context"
+
+	"github.com/google/uuid"
+	"github.com/idoyudha/eshop-cart/config"
+	"github.com/idoyudha/eshop-cart/internal/entity"
+)
+
+type CartSnapshotUseCase struct {
+	repo CartSnapshotRedisRepo
+	cart Cart
+	cfg  config.CartSnapshot
+}
+
+func NewCartSnapshotUseCase(repo CartSnapshotRedisRepo, cart Cart, cfg config.CartSnapshot) *CartSnapshotUseCase {
+	return &CartSnapshotUseCase{
+		repo,
+		cart,
+		cfg,
+	}
+}
+
+// CreateSnapshot freezes the selected cart of the user into a snapshot that can be shared until it expires
+func (u *CartSnapshotUseCase) CreateSnapshot(ctx context.Context, userID uuid.UUID, cartID uuid.UUID) (*entity.CartSnapshot, error) {
+	cart, err := u.cart.GetUserCart(ctx, userID, cartID)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(cart.Items) == 0 {
+		return nil, ErrCartEmpty
+	}
+
+	snapshot, err := entity.NewCartSnapshot(cart, u.cfg.TTL)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := u.repo.Save(ctx, snapshot); err != nil {
+		return nil, err
+	}
+
+	return snapshot, nil
+}
+
+// GetSnapshot returns ErrCartSnapshotNotFound once the snapshot expired
+func (u *CartSnapshotUseCase) GetSnapshot(ctx context.Context, id string) (*entity.CartSnapshot, error) {
+	snapshot, err := u.repo.Get(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	if snapshot == nil {
+		return nil, ErrCartSnapshotNotFound
+	}
+
+	return snapshot, nil
+}
+
+// ImportSnapshot adds the lines of the snapshot to the selected cart of the user like adding them one by one,
+// lines that break the cart rules are skipped and reported in their result
+func (u *CartSnapshotUseCase) ImportSnapshot(ctx context.Context, userID uuid.UUID, cartID uuid.UUID, id string) ([]CartBatchResult, error) {
+	snapshot, err := u.GetSnapshot(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	return u.cart.CreateCarts(ctx, userID, cartID, snapshot.CartItems(userID), false)
+}
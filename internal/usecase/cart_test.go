@@ -0,0 +1,460 @@
+package usecase
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/idoyudha/eshop-cart/config"
+	"github.com/idoyudha/eshop-cart/internal/entity"
+)
+
+func TestUpdateProductNameAndPriceCart(t *testing.T) {
+	productID := uuid.New()
+	cart := &entity.Cart{ID: uuid.New(), UserID: uuid.New(), Default: true, Currency: "USD"}
+
+	tests := []struct {
+		name   string
+		update entity.CartItem
+		// the product lines before the update, priced 1000 and named mug
+		currencies []string
+		wantPrices map[string]int64
+		wantName   string
+		wantEvents int
+	}{
+		{
+			name:       "lines in the price currency are repriced, others renamed",
+			update:     entity.CartItem{ProductName: "big mug", ProductPrice: 1200, Currency: "USD"},
+			currencies: []string{"USD", "EUR"},
+			wantPrices: map[string]int64{"USD": 1200, "EUR": 1000},
+			wantName:   "big mug",
+			wantEvents: 2,
+		},
+		{
+			name:       "price in a currency no line uses only renames",
+			update:     entity.CartItem{ProductName: "big mug", ProductPrice: 1200, Currency: "JPY"},
+			currencies: []string{"USD"},
+			wantPrices: map[string]int64{"USD": 1000},
+			wantName:   "big mug",
+			wantEvents: 1,
+		},
+		{
+			name:       "unchanged lines record nothing",
+			update:     entity.CartItem{ProductName: "mug", ProductPrice: 1000, Currency: "USD"},
+			currencies: []string{"USD"},
+			wantPrices: map[string]int64{"USD": 1000},
+			wantName:   "mug",
+		},
+		{
+			name:   "product in no cart",
+			update: entity.CartItem{ProductName: "big mug", ProductPrice: 1200, Currency: "USD"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			repo := newFakeCartRepo(cart)
+			for _, currency := range tt.currencies {
+				repo.add(&entity.CartItem{CartID: cart.ID, ProductID: productID, ProductName: "mug", ProductPrice: 1000, Currency: currency, List: entity.CartItemListCart})
+			}
+			// another product is never touched
+			repo.add(&entity.CartItem{CartID: cart.ID, ProductID: uuid.New(), ProductName: "plate", ProductPrice: 1000, Currency: "USD", List: entity.CartItemListCart})
+
+			outbox := &fakeOutboxRepo{}
+			events := &fakeEventRepo{}
+			uc := &CartUseCase{repoMySQL: repo, repoOutbox: outbox, repoEvents: events, relay: &fakeRelay{}}
+
+			update := tt.update
+			update.ProductID = productID
+			if err := uc.UpdateProductNameAndPriceCart(context.Background(), &update); err != nil {
+				t.Fatalf("UpdateProductNameAndPriceCart() = %v", err)
+			}
+
+			for _, item := range repo.items {
+				if item.ProductID != productID {
+					if item.ProductName != "plate" || item.ProductPrice != 1000 {
+						t.Errorf("another product changed to %q at %d", item.ProductName, item.ProductPrice)
+					}
+					continue
+				}
+				if item.ProductName != tt.wantName || item.ProductPrice != tt.wantPrices[item.Currency] {
+					t.Errorf("%s line = %q at %d, want %q at %d", item.Currency, item.ProductName, item.ProductPrice, tt.wantName, tt.wantPrices[item.Currency])
+				}
+			}
+
+			if len(events.types) != tt.wantEvents {
+				t.Errorf("recorded %d events, want %d", len(events.types), tt.wantEvents)
+			}
+			// redis is only refreshed for a change
+			wantOutbox := 0
+			if tt.wantEvents > 0 {
+				wantOutbox = 1
+			}
+			if len(outbox.types) != wantOutbox {
+				t.Errorf("outbox events = %v, want %d", outbox.types, wantOutbox)
+			}
+		})
+	}
+}
+
+func TestCreateCart(t *testing.T) {
+	userID := uuid.New()
+	mug := uuid.New()
+
+	tests := []struct {
+		name string
+		// the default cart of the user, nil when the user has none yet
+		cart        *entity.Cart
+		lines       []*entity.CartItem
+		item        entity.CartItem
+		insertRaces int
+		wantErr     func(error) bool
+		// the line the item ended in and the currency of the cart afterwards
+		wantQuantity int64
+		wantVersion  int64
+		wantCurrency string
+		wantLines    int
+	}{
+		{
+			name:         "first item creates the default cart",
+			item:         entity.CartItem{ProductID: mug, ProductQuantity: 2, Currency: "EUR"},
+			wantQuantity: 2, wantVersion: 1, wantCurrency: "EUR", wantLines: 1,
+		},
+		{
+			name:         "same product adds to its line",
+			cart:         &entity.Cart{Currency: "USD"},
+			lines:        []*entity.CartItem{{ProductID: mug, ProductQuantity: 3, Currency: "USD", Version: 4}},
+			item:         entity.CartItem{ProductID: mug, ProductQuantity: 2, Currency: "USD"},
+			wantQuantity: 5, wantVersion: 5, wantCurrency: "USD", wantLines: 1,
+		},
+		{
+			name:         "same product with other options is a new line",
+			cart:         &entity.Cart{Currency: "USD"},
+			lines:        []*entity.CartItem{{ProductID: mug, ProductQuantity: 3, Currency: "USD", Options: map[string]string{"color": "red"}, Version: 4}},
+			item:         entity.CartItem{ProductID: mug, ProductQuantity: 2, Currency: "USD", Options: map[string]string{"color": "blue"}},
+			wantQuantity: 2, wantVersion: 1, wantCurrency: "USD", wantLines: 2,
+		},
+		{
+			name:         "same product and options adds to its line",
+			cart:         &entity.Cart{Currency: "USD"},
+			lines:        []*entity.CartItem{{ProductID: mug, ProductQuantity: 3, Currency: "USD", Options: map[string]string{"color": "red"}, Version: 4}},
+			item:         entity.CartItem{ProductID: mug, ProductQuantity: 2, Currency: "USD", Options: map[string]string{"color": "red"}},
+			wantQuantity: 5, wantVersion: 5, wantCurrency: "USD", wantLines: 1,
+		},
+		{
+			name:         "empty cart takes the currency of the item",
+			cart:         &entity.Cart{Currency: "USD"},
+			item:         entity.CartItem{ProductID: mug, ProductQuantity: 1, Currency: "JPY"},
+			wantQuantity: 1, wantVersion: 1, wantCurrency: "JPY", wantLines: 1,
+		},
+		{
+			name:         "insert race is retried",
+			insertRaces:  1,
+			item:         entity.CartItem{ProductID: mug, ProductQuantity: 1, Currency: "USD"},
+			wantQuantity: 1, wantVersion: 1, wantCurrency: "USD", wantLines: 1,
+		},
+		{
+			name:        "insert race lost twice",
+			insertRaces: 2,
+			item:        entity.CartItem{ProductID: mug, ProductQuantity: 1, Currency: "USD"},
+			wantErr:     func(err error) bool { return errors.Is(err, entity.ErrAlreadyExists) },
+		},
+		{
+			name:    "cart in another currency",
+			cart:    &entity.Cart{Currency: "USD"},
+			lines:   []*entity.CartItem{{ProductID: uuid.New(), ProductQuantity: 1, Currency: "USD"}},
+			item:    entity.CartItem{ProductID: mug, ProductQuantity: 1, Currency: "EUR"},
+			wantErr: func(err error) bool { return errors.Is(err, ErrCurrencyMismatch) },
+		},
+		{
+			name:    "new line over the line limit",
+			cart:    &entity.Cart{Currency: "USD"},
+			lines:   []*entity.CartItem{{ProductID: uuid.New(), ProductQuantity: 1, Currency: "USD"}, {ProductID: uuid.New(), ProductQuantity: 1, Currency: "USD"}},
+			item:    entity.CartItem{ProductID: mug, ProductQuantity: 1, Currency: "USD"},
+			wantErr: isValidationError,
+		},
+		{
+			name:    "added quantity over the maximum",
+			cart:    &entity.Cart{Currency: "USD"},
+			lines:   []*entity.CartItem{{ProductID: mug, ProductQuantity: 9, Currency: "USD"}},
+			item:    entity.CartItem{ProductID: mug, ProductQuantity: 2, Currency: "USD"},
+			wantErr: isValidationError,
+		},
+		{
+			name:    "quantity below the minimum",
+			item:    entity.CartItem{ProductID: mug, ProductQuantity: -1, Currency: "USD"},
+			wantErr: isValidationError,
+		},
+		{
+			name:    "unknown named cart",
+			item:    entity.CartItem{ProductID: mug, ProductQuantity: 1, Currency: "USD", CartID: uuid.New()},
+			wantErr: func(err error) bool { return errors.Is(err, ErrCartNotFound) },
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.cart != nil {
+				tt.cart.ID = uuid.New()
+				tt.cart.UserID = userID
+				tt.cart.Default = true
+			}
+			repo := newFakeCartRepo(tt.cart)
+			for _, line := range tt.lines {
+				line.CartID = tt.cart.ID
+				line.UserID = userID
+				line.List = entity.CartItemListCart
+				repo.add(line)
+			}
+			repo.insertRaces = tt.insertRaces
+
+			uc := &CartUseCase{
+				repoMySQL:  repo,
+				repoOutbox: &fakeOutboxRepo{},
+				repoEvents: &fakeEventRepo{},
+				relay:      &fakeRelay{},
+				rules:      config.CartRules{MinQuantity: 1, MaxQuantity: 10, MaxLines: 2},
+			}
+
+			item := tt.item
+			item.UserID = userID
+			added, err := uc.CreateCart(context.Background(), &item)
+			if tt.wantErr != nil {
+				if !tt.wantErr(err) {
+					t.Fatalf("CreateCart() = %v, want a matching error", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("CreateCart() = %v", err)
+			}
+
+			if added.ProductQuantity != tt.wantQuantity || added.Version != tt.wantVersion {
+				t.Errorf("added line quantity %d version %d, want %d version %d", added.ProductQuantity, added.Version, tt.wantQuantity, tt.wantVersion)
+			}
+			cart, _ := repo.GetByUserID(context.Background(), userID)
+			if cart == nil || cart.ID != added.CartID {
+				t.Fatalf("line added to cart %s, want the default cart %v", added.CartID, cart)
+			}
+			if cart.Currency != tt.wantCurrency || len(cart.Items) != tt.wantLines {
+				t.Errorf("cart in %s with %d lines, want %s with %d", cart.Currency, len(cart.Items), tt.wantCurrency, tt.wantLines)
+			}
+		})
+	}
+}
+
+func TestGetUserCart(t *testing.T) {
+	userID := uuid.New()
+	stored := &entity.Cart{ID: uuid.New(), UserID: userID, Default: true, Currency: "USD", Items: make([]*entity.CartItem, 0)}
+	named := &entity.Cart{ID: uuid.New(), UserID: userID, Name: "warehouse", Currency: "USD"}
+	errRedisDown := errors.New("redis down")
+
+	tests := []struct {
+		name     string
+		cached   *entity.Cart
+		mysql    *entity.Cart
+		cartID   uuid.UUID
+		redisErr error
+		wantErr  error
+		wantID   uuid.UUID
+		// whether the cart read from mysql is written to redis
+		wantSaved bool
+	}{
+		{name: "cached", cached: stored, mysql: stored, wantID: stored.ID},
+		{name: "cache miss", mysql: stored, wantID: stored.ID, wantSaved: true},
+		{name: "user without a cart", wantID: uuid.Nil},
+		{name: "named cart bypasses the cache", cached: stored, mysql: stored, cartID: named.ID, wantID: named.ID},
+		{name: "unknown named cart", mysql: stored, cartID: uuid.New(), wantErr: ErrCartNotFound},
+		{name: "redis down", mysql: stored, redisErr: errRedisDown, wantErr: errRedisDown},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			repo := newFakeCartRepo(tt.mysql)
+			repo.carts[named.ID] = named
+			redis := newFakeCartRedisRepo()
+			redis.err = tt.redisErr
+			if tt.cached != nil {
+				redis.carts[userID.String()] = tt.cached
+			}
+			uc := &CartUseCase{repoMySQL: repo, repoRedis: redis}
+
+			cart, err := uc.GetUserCart(context.Background(), userID, tt.cartID)
+			if tt.wantErr != nil {
+				if !errors.Is(err, tt.wantErr) {
+					t.Fatalf("GetUserCart() = %v, want %v", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("GetUserCart() = %v", err)
+			}
+
+			if cart.ID != tt.wantID || cart.Items == nil {
+				t.Errorf("GetUserCart() = cart %s with items %v, want cart %s", cart.ID, cart.Items, tt.wantID)
+			}
+			if saved := tt.cached == nil && redis.carts[userID.String()] != nil; saved != tt.wantSaved {
+				t.Errorf("saved to redis = %v, want %v", saved, tt.wantSaved)
+			}
+		})
+	}
+}
+
+func TestUpdateQtyAndNoteCart(t *testing.T) {
+	userID := uuid.New()
+
+	tests := []struct {
+		name    string
+		list    string
+		missing bool
+		update  entity.CartItem
+		wantErr func(error) bool
+		// the stored line afterwards, wantRemoved when it was soft deleted
+		wantQuantity int64
+		wantVersion  int64
+		wantRemoved  bool
+		wantEvent    string
+	}{
+		{
+			name:         "unconditional update",
+			update:       entity.CartItem{ProductQuantity: 4, Note: "gift"},
+			wantQuantity: 4, wantVersion: 3, wantEvent: entity.CartEventItemUpdated,
+		},
+		{
+			name:         "matching version",
+			update:       entity.CartItem{ProductQuantity: 4, Version: 2},
+			wantQuantity: 4, wantVersion: 3, wantEvent: entity.CartEventItemUpdated,
+		},
+		{
+			name:         "zero quantity removes the line",
+			update:       entity.CartItem{ProductQuantity: 0, Version: 2},
+			wantQuantity: 1, wantVersion: 2, wantRemoved: true, wantEvent: entity.CartEventItemDeleted,
+		},
+		{
+			name:   "stale version",
+			update: entity.CartItem{ProductQuantity: 4, Version: 1},
+			wantErr: func(err error) bool {
+				var conflict *VersionConflictError
+				return errors.As(err, &conflict) && conflict.Expected == 1 && conflict.Current == 2
+			},
+			wantQuantity: 1, wantVersion: 2,
+		},
+		{
+			name:         "stale version cannot remove the line",
+			update:       entity.CartItem{ProductQuantity: 0, Version: 1},
+			wantErr:      func(err error) bool { var conflict *VersionConflictError; return errors.As(err, &conflict) },
+			wantQuantity: 1, wantVersion: 2,
+		},
+		{
+			name:         "quantity over the limit",
+			update:       entity.CartItem{ProductQuantity: 11},
+			wantErr:      isValidationError,
+			wantQuantity: 1, wantVersion: 2,
+		},
+		{
+			name:         "line in checkout",
+			list:         entity.CartItemListCheckout,
+			update:       entity.CartItem{ProductQuantity: 4},
+			wantErr:      func(err error) bool { return errors.Is(err, ErrCheckoutInProgress) },
+			wantQuantity: 1, wantVersion: 2,
+		},
+		{
+			name:    "unknown line",
+			missing: true,
+			update:  entity.CartItem{ProductQuantity: 4},
+			wantErr: func(err error) bool { return errors.Is(err, ErrCartItemNotFound) },
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cart := &entity.Cart{ID: uuid.New(), UserID: userID, Default: true, Currency: "USD"}
+			repo := newFakeCartRepo(cart)
+			list := entity.CartItemListCart
+			if tt.list != "" {
+				list = tt.list
+			}
+			lineID := repo.add(&entity.CartItem{CartID: cart.ID, UserID: userID, ProductID: uuid.New(), ProductQuantity: 1, Currency: "USD", List: list, Version: 2})
+			events := &fakeEventRepo{}
+			uc := &CartUseCase{
+				repoMySQL:  repo,
+				repoOutbox: &fakeOutboxRepo{},
+				repoEvents: events,
+				relay:      &fakeRelay{},
+				rules:      config.CartRules{MinQuantity: 1, MaxQuantity: 10, MaxLines: 2},
+			}
+
+			update := tt.update
+			update.UserID = userID
+			update.ID = lineID
+			update.UpdatedAt = time.Now()
+			if tt.missing {
+				update.ID = uuid.New()
+			}
+			err := uc.UpdateQtyAndNoteCart(context.Background(), &update)
+			if tt.wantErr != nil {
+				if !tt.wantErr(err) {
+					t.Fatalf("UpdateQtyAndNoteCart() = %v, want a matching error", err)
+				}
+				if len(events.types) != 0 {
+					t.Errorf("recorded %v for a failed update", events.types)
+				}
+			} else if err != nil {
+				t.Fatalf("UpdateQtyAndNoteCart() = %v", err)
+			}
+			if tt.missing {
+				return
+			}
+
+			line := repo.items[lineID]
+			if line.ProductQuantity != tt.wantQuantity || line.Version != tt.wantVersion {
+				t.Errorf("line at quantity %d version %d, want %d version %d", line.ProductQuantity, line.Version, tt.wantQuantity, tt.wantVersion)
+			}
+			if removed := repo.deleted[lineID] != ""; removed != tt.wantRemoved {
+				t.Errorf("line removed = %v, want %v", removed, tt.wantRemoved)
+			}
+			if tt.wantErr != nil {
+				return
+			}
+			if update.DeletedAt.IsZero() == tt.wantRemoved {
+				t.Errorf("returned line deleted at %v, want removed %v", update.DeletedAt, tt.wantRemoved)
+			}
+			if !tt.wantRemoved && (update.Version != tt.wantVersion || update.ProductID != line.ProductID) {
+				t.Errorf("returned line %+v, want the stored line at version %d", update, tt.wantVersion)
+			}
+			if len(events.types) != 1 || events.types[0] != tt.wantEvent {
+				t.Errorf("recorded %v, want %s", events.types, tt.wantEvent)
+			}
+		})
+	}
+}
+
+func TestDeleteCartVersion(t *testing.T) {
+	userID := uuid.New()
+	cart := &entity.Cart{ID: uuid.New(), UserID: userID, Default: true, Currency: "USD"}
+	repo := newFakeCartRepo(cart)
+	lineID := repo.add(&entity.CartItem{CartID: cart.ID, UserID: userID, ProductQuantity: 1, List: entity.CartItemListCart, Version: 3})
+	uc := &CartUseCase{repoMySQL: repo, repoOutbox: &fakeOutboxRepo{}, repoEvents: &fakeEventRepo{}, relay: &fakeRelay{}}
+
+	var conflict *VersionConflictError
+	if err := uc.DeleteCart(context.Background(), userID, lineID, 2); !errors.As(err, &conflict) || conflict.Current != 3 {
+		t.Fatalf("DeleteCart() at a stale version = %v, want a conflict at version 3", err)
+	}
+	if repo.deleted[lineID] != "" {
+		t.Fatal("a stale delete removed the line")
+	}
+
+	if err := uc.DeleteCart(context.Background(), userID, lineID, 3); err != nil {
+		t.Fatalf("DeleteCart() = %v", err)
+	}
+	if repo.deleted[lineID] != entity.CartItemDeletedRemoved {
+		t.Errorf("line deleted as %q, want %q", repo.deleted[lineID], entity.CartItemDeletedRemoved)
+	}
+}
+
+func isValidationError(err error) bool {
+	var validation *ValidationError
+	return errors.As(err, &validation)
+}
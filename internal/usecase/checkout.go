@@ -0,0 +1,558 @@
+package usecase
+
+import (
+	"context"
+	"errors"
+	"expvar"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/idoyudha/eshop-cart/internal/entity"
+	"github.com/idoyudha/eshop-cart/internal/utils"
+)
+
+// counters of every checkout of this process, exposed on /debug/vars
+var checkoutMetrics = expvar.NewMap("cart_checkout")
+
+const (
+	// attempts and first backoff of recording a created order on its checkout
+	_checkoutRecordAttempts = 3
+	_checkoutRecordBackoff  = 100 * time.Millisecond
+)
+
+var (
+	// errCheckoutTaken is returned by a checkout step when another process moved the checkout first
+	errCheckoutTaken = errors.New("checkout was moved by another process")
+	// errCheckoutInterrupted is recorded on a pending checkout the order service has no order for
+	errCheckoutInterrupted = errors.New("checkout interrupted before the order was created")
+)
+
+// CheckOutCarts orders the lines of itemIDs as a saga recorded in checkouts: the lines are held
+// out of the cart, checked against the catalog, their stock is reserved, the order is created,
+// then the stock is confirmed and the lines are removed. if a step before the order fails
+// the stock is released and the held lines go back to the cart, once the order exists
+// a failing step is left to the recovery worker and the checkout still succeeds.
+// the steps after holding the lines run to the end even if the caller goes away
+func (u *CartUseCase) CheckOutCarts(ctx context.Context, userID uuid.UUID, cartID uuid.UUID, itemIDs uuid.UUIDs, address *entity.CheckoutAddress, token string) error {
+	if len(itemIDs) == 0 {
+		return newValidationError([]FieldViolation{{Field: "cart_ids", Message: "must list at least one cart item"}})
+	}
+
+	// 1. get the selected cart
+	cart, err := u.selectCart(ctx, userID, cartID)
+	if err != nil {
+		return fmt.Errorf("failed to get cart: %w", err)
+	}
+	if cart == nil {
+		return checkoutItemsError(uuid.Nil, itemIDs, nil)
+	}
+
+	checkout, err := entity.NewCheckout(userID, cart.ID, itemIDs, *address)
+	if err != nil {
+		return err
+	}
+
+	// 2. record the attempt and hold its lines so they cannot change while the order is created
+	items, errHold := u.holdCheckout(ctx, checkout)
+	if errHold != nil {
+		return fmt.Errorf("failed to start checkout: %w", errHold)
+	}
+	checkoutMetrics.Add("started", 1)
+
+	// a checkout left half way holds the lines until the recovery gets to it, finish it instead
+	ctx = context.WithoutCancel(ctx)
+
+	// 3. check the held lines against the catalog, the shopper confirms any change before ordering
+	changes, errPrice := u.priceChanges(ctx, items)
+	if errPrice == nil && len(changes) > 0 {
+		errPrice = &PriceChangedError{Changes: changes}
+	}
+	if errPrice != nil {
+		// reprice the held lines first so they go back to the cart with the catalog price
+		errReprice := u.repriceItems(ctx, checkout, items, changes)
+		errAbort := u.abortCheckout(ctx, checkout, errPrice)
+		if errReprice != nil {
+			return fmt.Errorf("%w, failed to update the cart prices: %v", errAbort, errReprice)
+		}
+		return errAbort
+	}
+
+	// 4. reserve the stock, the reservation expires on its own if the checkout never ends
+	if errReserve := u.reserveStock(ctx, checkout, items); errReserve != nil {
+		return u.abortCheckout(ctx, checkout, errReserve)
+	}
+
+	// 5. request create order
+	orderID, errOrder := u.createOrder(ctx, checkout, items, token)
+	if errors.Is(errOrder, entity.ErrOrderOutcomeUnknown) {
+		// the order may be placed, the checkout stays pending with its stock reserved
+		// until the recovery finds out from the order service
+		checkoutMetrics.Add("outcome_unknown", 1)
+		return fmt.Errorf("%w: %v", ErrCheckoutPending, errOrder)
+	}
+	if errOrder != nil {
+		return u.abortCheckout(ctx, checkout, errOrder)
+	}
+
+	// the order is placed, from here on the checkout never fails
+	if errRecord := u.recordOrder(ctx, checkout, orderID); errRecord != nil {
+		// still pending, the recovery finds the order by its idempotency key and finishes the checkout
+		checkoutMetrics.Add("deferred", 1)
+		return nil
+	}
+
+	// 6. confirm the stock and delete the ordered lines, from here on the order is placed whatever happens to the cart
+	if errResume := u.resumeCheckout(ctx, checkout); errResume != nil && !errors.Is(errResume, errCheckoutTaken) {
+		checkoutMetrics.Add("deferred", 1)
+	}
+
+	return nil
+}
+
+// recordOrder moves the checkout to order_created with the id of its order. the transition is retried
+// a few times since a placed order must not be left behind a checkout that says pending
+func (u *CartUseCase) recordOrder(ctx context.Context, checkout *entity.Checkout, orderID uuid.UUID) error {
+	checkout.OrderID = orderID
+	from := checkout.Advance(entity.CheckoutStateOrderCreated)
+
+	var err error
+	backoff := _checkoutRecordBackoff
+	for attempt := 0; attempt < _checkoutRecordAttempts; attempt++ {
+		if attempt > 0 {
+			time.Sleep(backoff)
+			backoff *= 2
+		}
+
+		var claimed bool
+		claimed, err = u.repoCheckout.Transition(ctx, checkout, from)
+		if err == nil && !claimed {
+			// another process moved it, retrying cannot help
+			err = errCheckoutTaken
+			break
+		}
+		if err == nil {
+			return nil
+		}
+	}
+
+	checkout.State = from
+	return err
+}
+
+// resolvePendingCheckout settles a checkout interrupted before its order was recorded. the order service is asked
+// for the order placed with the checkout id as idempotency key: when it exists the checkout resumes, when it
+// certainly does not the checkout is failed. if the order service cannot tell the checkout stays pending
+func (u *CartUseCase) resolvePendingCheckout(ctx context.Context, checkout *entity.Checkout) error {
+	orderID, found, err := u.orderClient.FindOrder(ctx, checkout.ID.String())
+	if err != nil {
+		return fmt.Errorf("failed to find the order of checkout %s: %w", checkout.ID, err)
+	}
+
+	if !found {
+		return u.failCheckout(ctx, checkout, errCheckoutInterrupted)
+	}
+
+	if err := u.recordOrder(ctx, checkout, orderID); err != nil {
+		return err
+	}
+
+	return u.resumeCheckout(ctx, checkout)
+}
+
+// holdCheckout records the pending checkout and moves its lines out of the cart in one transaction,
+// it returns the held lines. every item of the checkout must be an active line of its cart
+func (u *CartUseCase) holdCheckout(ctx context.Context, checkout *entity.Checkout) ([]*entity.CartItem, error) {
+	event, err := entity.NewCartChangedEvent(checkout.UserID)
+	if err != nil {
+		return nil, err
+	}
+
+	var held []*entity.CartItem
+	err = u.mutate(ctx, event, func(txCtx context.Context) error {
+		items, errItems := u.repoMySQL.GetItemsByIDs(txCtx, checkout.UserID, checkout.ItemIDs)
+		if errItems != nil {
+			return errItems
+		}
+
+		for _, item := range items {
+			if item.List == entity.CartItemListCheckout {
+				return ErrCheckoutInProgress
+			}
+		}
+		if errItems := checkoutItemsError(checkout.CartID, checkout.ItemIDs, items); errItems != nil {
+			return errItems
+		}
+
+		// in the order of the request, an id listed twice is held once
+		held = make([]*entity.CartItem, 0, len(items))
+		heldIDs := make(uuid.UUIDs, 0, len(items))
+		for _, itemID := range checkout.ItemIDs {
+			for _, item := range items {
+				if item.ID == itemID && !utils.IDInSliceUUID(itemID, heldIDs) {
+					held = append(held, item)
+					heldIDs = append(heldIDs, itemID)
+				}
+			}
+		}
+		checkout.ItemIDs = heldIDs
+
+		if errInsert := u.repoCheckout.Insert(txCtx, checkout); errInsert != nil {
+			return errInsert
+		}
+
+		return u.repoMySQL.MoveItemsList(txCtx, checkout.UserID, heldIDs, entity.CartItemListCart, entity.CartItemListCheckout)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return held, nil
+}
+
+// checkoutItemsError lists the ids of itemIDs that are not among the active lines of cartID in items,
+// nil when there is none. lines saved for later or of another cart or user are never ordered
+func checkoutItemsError(cartID uuid.UUID, itemIDs uuid.UUIDs, items []*entity.CartItem) error {
+	violations := make([]FieldViolation, 0)
+	for i, itemID := range itemIDs {
+		var active bool
+		for _, item := range items {
+			if item.ID == itemID && item.CartID == cartID && item.List == entity.CartItemListCart {
+				active = true
+				break
+			}
+		}
+		if !active {
+			violations = append(violations, FieldViolation{
+				Field:   fmt.Sprintf("cart_ids[%d]", i),
+				Message: fmt.Sprintf("%s is not an active item of the cart", itemID),
+			})
+		}
+	}
+	return newValidationError(violations)
+}
+
+// abortCheckout fails the checkout because of cause and returns cause with the checkout id
+func (u *CartUseCase) abortCheckout(ctx context.Context, checkout *entity.Checkout, cause error) error {
+	if errRelease := u.failCheckout(ctx, checkout, cause); errRelease != nil {
+		return fmt.Errorf("checkout %s: %w, failed to release its lines: %v", checkout.ID, cause, errRelease)
+	}
+	return fmt.Errorf("checkout %s: %w", checkout.ID, cause)
+}
+
+// priceChanges compares the lines with the catalog and returns the ones whose price or availability changed
+func (u *CartUseCase) priceChanges(ctx context.Context, items []*entity.CartItem) ([]entity.CartPriceChange, error) {
+	productIDs := make(uuid.UUIDs, 0, len(items))
+	for _, item := range items {
+		if !utils.IDInSliceUUID(item.ProductID, productIDs) {
+			productIDs = append(productIDs, item.ProductID)
+		}
+	}
+
+	products, err := u.catalog.GetProducts(ctx, productIDs)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get products: %w", err)
+	}
+
+	changes := make([]entity.CartPriceChange, 0)
+	for _, item := range items {
+		product, found := products[item.ProductID]
+		if change, changed := entity.NewCartPriceChange(item, product, found); changed {
+			changes = append(changes, change)
+		}
+	}
+
+	return changes, nil
+}
+
+// repriceItems applies the catalog price of the repriced changes to the held lines of the checkout,
+// other carts holding the product get it from the product-updated message
+func (u *CartUseCase) repriceItems(ctx context.Context, checkout *entity.Checkout, items []*entity.CartItem, changes []entity.CartPriceChange) error {
+	held := make(map[uuid.UUID]*entity.CartItem, len(items))
+	for _, item := range items {
+		held[item.ID] = item
+	}
+
+	repriced := make([]entity.CartPriceChange, 0, len(changes))
+	for _, change := range changes {
+		if change.Reason == entity.CartPriceChangePrice && held[change.ItemID] != nil {
+			repriced = append(repriced, change)
+		}
+	}
+	if len(repriced) == 0 {
+		return nil
+	}
+
+	event, err := entity.NewCartChangedEvent(checkout.UserID)
+	if err != nil {
+		return err
+	}
+
+	return u.mutate(ctx, event, func(txCtx context.Context) error {
+		for _, change := range repriced {
+			line := held[change.ItemID]
+			after := *line
+			after.ProductName = change.ProductName
+			after.ProductPrice = change.Price
+			after.UpdatedAt = time.Now()
+
+			if errUpdate := u.repoMySQL.UpdateNameAndPrice(txCtx, &after, uuid.UUIDs{line.ID}); errUpdate != nil {
+				return errUpdate
+			}
+			if errEvent := u.recordEvent(txCtx, entity.CartEventItemRepriced, line, &after); errEvent != nil {
+				return errEvent
+			}
+		}
+
+		return nil
+	})
+}
+
+// failCheckout is the compensation of a checkout without order, its held lines go back to the cart
+// and its reserved stock is released
+func (u *CartUseCase) failCheckout(ctx context.Context, checkout *entity.Checkout, cause error) error {
+	event, err := entity.NewCartChangedEvent(checkout.UserID)
+	if err != nil {
+		return err
+	}
+
+	from := checkout.Fail(cause)
+	err = u.mutate(ctx, event, func(txCtx context.Context) error {
+		claimed, errTransition := u.repoCheckout.Transition(txCtx, checkout, from)
+		if errTransition != nil {
+			return errTransition
+		}
+		if !claimed {
+			return errCheckoutTaken
+		}
+
+		return u.returnHeldLines(txCtx, checkout)
+	})
+	if err != nil {
+		// the transaction rolled back, the checkout is still where it was
+		checkout.State = from
+		return err
+	}
+	checkoutMetrics.Add("failed", 1)
+
+	// a reservation that cannot be released now is released by the sweeper once it expires
+	if errRelease := u.releaseStock(ctx, checkout); errRelease != nil {
+		checkoutMetrics.Add("release_deferred", 1)
+	}
+
+	return nil
+}
+
+// returnHeldLines gives the lines held by the checkout back to its cart, a line of the same product,
+// variant and options added to the cart in the meantime takes over the held quantity
+func (u *CartUseCase) returnHeldLines(ctx context.Context, checkout *entity.Checkout) error {
+	held, err := u.repoMySQL.GetItemsByIDs(ctx, checkout.UserID, checkout.ItemIDs)
+	if err != nil {
+		return err
+	}
+
+	now := time.Now()
+	moving := make(uuid.UUIDs, 0, len(held))
+	for _, line := range held {
+		if line.List != entity.CartItemListCheckout {
+			continue
+		}
+
+		existing, errExist := u.repoMySQL.GetItemByLine(ctx, checkout.CartID, line, entity.CartItemListCart)
+		if errExist != nil {
+			return errExist
+		}
+		if existing == nil {
+			moving = append(moving, line.ID)
+			continue
+		}
+
+		before := *existing
+		existing.ProductQuantity += line.ProductQuantity
+		if u.rules.MaxQuantity > 0 {
+			existing.ProductQuantity = min(existing.ProductQuantity, u.rules.MaxQuantity)
+		}
+		existing.UpdatedAt = now
+		if errUpdate := u.repoMySQL.UpdateQtyAndNote(ctx, existing); errUpdate != nil {
+			return errUpdate
+		}
+		existing.Version++
+
+		if errDelete := u.repoMySQL.DeleteOne(ctx, line.ID, entity.CartItemDeletedMerged); errDelete != nil {
+			return errDelete
+		}
+		if errEvent := u.recordEvent(ctx, entity.CartEventItemMerged, &before, existing); errEvent != nil {
+			return errEvent
+		}
+	}
+
+	return u.repoMySQL.MoveItemsList(ctx, checkout.UserID, moving, entity.CartItemListCheckout, entity.CartItemListCart)
+}
+
+// resumeCheckout runs the steps left after the order was created,
+// the checkout completes once its stock is confirmed and its lines deleted
+func (u *CartUseCase) resumeCheckout(ctx context.Context, checkout *entity.Checkout) error {
+	// the order is placed, a failing confirmation never holds back clearing the cart
+	errConfirm := u.confirmStock(ctx, checkout)
+
+	if checkout.State == entity.CheckoutStateOrderCreated {
+		if err := u.clearCheckoutCart(ctx, checkout); err != nil {
+			return err
+		}
+	}
+
+	if errConfirm != nil {
+		return errConfirm
+	}
+
+	if checkout.State == entity.CheckoutStateCartCleared {
+		from := checkout.Advance(entity.CheckoutStateCompleted)
+		claimed, err := u.repoCheckout.Transition(ctx, checkout, from)
+		if err == nil && !claimed {
+			err = errCheckoutTaken
+		}
+		if err != nil {
+			checkout.State = from
+			return err
+		}
+		checkoutMetrics.Add("completed", 1)
+	}
+
+	return nil
+}
+
+// clearCheckoutCart soft deletes the held lines of a checkout whose order was created
+func (u *CartUseCase) clearCheckoutCart(ctx context.Context, checkout *entity.Checkout) error {
+	event, err := entity.NewCartChangedEvent(checkout.UserID)
+	if err != nil {
+		return err
+	}
+
+	from := checkout.Advance(entity.CheckoutStateCartCleared)
+	err = u.mutate(ctx, event, func(txCtx context.Context) error {
+		claimed, errTransition := u.repoCheckout.Transition(txCtx, checkout, from)
+		if errTransition != nil {
+			return errTransition
+		}
+		if !claimed {
+			return errCheckoutTaken
+		}
+
+		items, errItems := u.repoMySQL.GetItemsByIDs(txCtx, checkout.UserID, checkout.ItemIDs)
+		if errItems != nil {
+			return errItems
+		}
+
+		ordered := make([]*entity.CartItem, 0, len(items))
+		for _, item := range items {
+			if item.List == entity.CartItemListCheckout {
+				ordered = append(ordered, item)
+			}
+		}
+
+		return u.deleteLines(txCtx, checkout.UserID, ordered, entity.CartItemDeletedCheckedOut, entity.CartEventItemCheckedOut)
+	})
+	if err != nil {
+		// the transaction rolled back, the checkout is still where it was
+		checkout.State = from
+		return err
+	}
+
+	return nil
+}
+
+// reserveStock reserves the stock of the held lines and records the reservation on the checkout
+func (u *CartUseCase) reserveStock(ctx context.Context, checkout *entity.Checkout, items []*entity.CartItem) error {
+	reservation, err := u.inventory.Reserve(ctx, entity.InventoryReservationRequest{
+		Key:   checkout.ID.String(),
+		Items: items,
+	})
+	if err != nil {
+		return inventoryClientError(err)
+	}
+
+	checkout.Reserve(reservation)
+	return u.repoCheckout.UpdateReservation(ctx, checkout)
+}
+
+// confirmStock confirms the reservation of a checkout whose order was created
+func (u *CartUseCase) confirmStock(ctx context.Context, checkout *entity.Checkout) error {
+	if !checkout.IsReserved() {
+		return nil
+	}
+
+	err := u.inventory.Confirm(ctx, checkout.ReservationID, checkout.ID.String()+":confirm")
+	var rejected *entity.InventoryServiceError
+	switch {
+	case errors.As(err, &rejected) && (rejected.StatusCode == http.StatusNotFound || rejected.StatusCode == http.StatusGone):
+		// no retry can confirm it, the order is placed without its stock being taken and needs a look
+		checkoutMetrics.Add("reservation_lost", 1)
+		checkout.ReservationState = entity.ReservationStateLost
+		checkout.LastError = fmt.Sprintf("reservation %s lost before it was confirmed: %s", checkout.ReservationID, rejected.Message)
+	case err != nil:
+		return fmt.Errorf("failed to confirm reservation %s: %w", checkout.ReservationID, err)
+	default:
+		checkout.ReservationState = entity.ReservationStateConfirmed
+	}
+
+	return u.repoCheckout.UpdateReservation(ctx, checkout)
+}
+
+// releaseStock releases the reservation of a checkout without order
+func (u *CartUseCase) releaseStock(ctx context.Context, checkout *entity.Checkout) error {
+	if !checkout.IsReserved() {
+		return nil
+	}
+
+	if err := u.inventory.Release(ctx, checkout.ReservationID); err != nil {
+		return fmt.Errorf("failed to release reservation %s: %w", checkout.ReservationID, err)
+	}
+
+	checkout.ReservationState = entity.ReservationStateReleased
+	return u.repoCheckout.UpdateReservation(ctx, checkout)
+}
+
+// inventoryClientError turns the errors of the inventory client into the typed errors of the usecase
+func inventoryClientError(err error) error {
+	var rejected *entity.InventoryServiceError
+	switch {
+	case errors.Is(err, entity.ErrInventoryServiceUnavailable):
+		return err
+	case errors.As(err, &rejected) && (rejected.StatusCode == http.StatusConflict || rejected.StatusCode == http.StatusUnprocessableEntity):
+		return fmt.Errorf("%w: %s", ErrInsufficientStock, rejected.Message)
+	default:
+		return fmt.Errorf("failed to reserve stock: %w", err)
+	}
+}
+
+// createOrder requests the order of the held lines and returns its id
+func (u *CartUseCase) createOrder(ctx context.Context, checkout *entity.Checkout, items []*entity.CartItem, token string) (uuid.UUID, error) {
+	order := entity.OrderRequest{
+		IdempotencyKey: checkout.ID.String(),
+		Items:          items,
+		Address:        checkout.Address,
+	}
+
+	orderID, err := u.orderClient.CreateOrder(ctx, token, order)
+	if err != nil {
+		return uuid.Nil, orderClientError(err)
+	}
+
+	return orderID, nil
+}
+
+// orderClientError turns the errors of the order client into the typed errors of the usecase
+func orderClientError(err error) error {
+	var rejected *entity.OrderServiceError
+	switch {
+	case errors.Is(err, entity.ErrOrderServiceUnavailable), errors.Is(err, entity.ErrOrderOutcomeUnknown):
+		return err
+	case errors.As(err, &rejected) && rejected.StatusCode == http.StatusConflict:
+		return &OrderRejectedError{Conflict: true, Message: rejected.Message}
+	case errors.As(err, &rejected) && rejected.StatusCode < http.StatusInternalServerError:
+		return &OrderRejectedError{Message: rejected.Message}
+	default:
+		return fmt.Errorf("failed to create order: %w", err)
+	}
+}
@@ -0,0 +1,94 @@
+package usecase
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/idoyudha/eshop-cart/config"
+	"github.com/idoyudha/eshop-cart/internal/entity"
+	"github.com/idoyudha/eshop-cart/pkg/logger"
+)
+
+// CheckoutRecoveryUseCase resumes checkouts left unfinished, e.g. by a restart in the middle of one
+type CheckoutRecoveryUseCase struct {
+	repoCheckout CheckoutMySQLRepo
+	cart         *CartUseCase
+	cfg          config.Checkout
+	l            logger.Interface
+}
+
+func NewCheckoutRecoveryUseCase(
+	repoCheckout CheckoutMySQLRepo,
+	cart *CartUseCase,
+	cfg config.Checkout,
+	l logger.Interface,
+) *CheckoutRecoveryUseCase {
+	return &CheckoutRecoveryUseCase{
+		repoCheckout,
+		cart,
+		cfg,
+		l,
+	}
+}
+
+// Run recovers stuck checkouts every cfg.RecoveryInterval until ctx is done, a zero interval disables it
+func (u *CheckoutRecoveryUseCase) Run(ctx context.Context) {
+	if u.cfg.RecoveryInterval <= 0 {
+		return
+	}
+
+	ticker := time.NewTicker(u.cfg.RecoveryInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if _, err := u.Recover(ctx); err != nil {
+				u.l.Error(err, "usecase - CheckoutRecoveryUseCase - Run - Recover")
+			}
+		}
+	}
+}
+
+// Recover moves one batch of checkouts unchanged for longer than cfg.StuckAfter to a final state
+// and returns how many it finished. a pending checkout is looked up on the order service by its idempotency key,
+// it is only failed and its lines given back when the order does not exist. a checkout with an order
+// gets its remaining steps run. cfg.StuckAfter must exceed the longest a checkout request can take,
+// retries of the order service included, or an order still being placed could be missed
+func (u *CheckoutRecoveryUseCase) Recover(ctx context.Context) (int, error) {
+	checkoutMetrics.Add("recovery_runs", 1)
+	ctx = ContextWithActor(ctx, entity.CartActor{ID: "checkout-recovery", Source: entity.CartEventSourceSystem})
+
+	states := []string{entity.CheckoutStatePending, entity.CheckoutStateOrderCreated, entity.CheckoutStateCartCleared}
+	stuck, err := u.repoCheckout.GetStuck(ctx, states, time.Now().Add(-u.cfg.StuckAfter), u.cfg.BatchSize)
+	if err != nil {
+		return 0, fmt.Errorf("failed to get stuck checkouts: %w", err)
+	}
+
+	var recovered int
+	for _, checkout := range stuck {
+		var errStep error
+		if checkout.State == entity.CheckoutStatePending {
+			errStep = u.cart.resolvePendingCheckout(ctx, checkout)
+		} else {
+			errStep = u.cart.resumeCheckout(ctx, checkout)
+		}
+
+		switch {
+		case errors.Is(errStep, errCheckoutTaken):
+			continue
+		case errStep != nil:
+			// the next run retries it
+			u.l.Warn("usecase - CheckoutRecoveryUseCase - Recover - checkout %s in state %s: %s", checkout.ID, checkout.State, errStep)
+			continue
+		}
+		recovered++
+	}
+
+	checkoutMetrics.Add("recovered", int64(recovered))
+	return recovered, nil
+}
@@ -0,0 +1,395 @@
+package usecase
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/idoyudha/eshop-cart/config"
+	"github.com/idoyudha/eshop-cart/internal/entity"
+	"github.com/idoyudha/eshop-cart/internal/usecase/webapi"
+)
+
+// fakeCheckoutRepo keeps the stored copy of one checkout
+type fakeCheckoutRepo struct {
+	CheckoutMySQLRepo
+	stored entity.Checkout
+}
+
+func (f *fakeCheckoutRepo) Insert(_ context.Context, checkout *entity.Checkout) error {
+	f.stored = *checkout
+	return nil
+}
+
+func (f *fakeCheckoutRepo) Transition(_ context.Context, checkout *entity.Checkout, from string) (bool, error) {
+	if f.stored.State != from {
+		return false, nil
+	}
+	f.stored.State = checkout.State
+	f.stored.OrderID = checkout.OrderID
+	f.stored.LastError = checkout.LastError
+	return true, nil
+}
+
+func (f *fakeCheckoutRepo) UpdateReservation(_ context.Context, checkout *entity.Checkout) error {
+	f.stored.ReservationID = checkout.ReservationID
+	f.stored.ReservationState = checkout.ReservationState
+	f.stored.ReservationExpiresAt = checkout.ReservationExpiresAt
+	f.stored.LastError = checkout.LastError
+	return nil
+}
+
+type fakeOrderClient struct {
+	OrderClient
+	orderID uuid.UUID
+	err     error
+	found   bool
+	findErr error
+}
+
+func (f *fakeOrderClient) CreateOrder(context.Context, string, entity.OrderRequest) (uuid.UUID, error) {
+	return f.orderID, f.err
+}
+
+func (f *fakeOrderClient) FindOrder(context.Context, string) (uuid.UUID, bool, error) {
+	return f.orderID, f.found, f.findErr
+}
+
+type fakeInventory struct {
+	InventoryClient
+	confirmErr  error
+	confirmKeys []string
+	released    []string
+	// reservations whose release fails with their error
+	releaseErrs map[string]error
+}
+
+func (f *fakeInventory) Reserve(context.Context, entity.InventoryReservationRequest) (*entity.InventoryReservation, error) {
+	return &entity.InventoryReservation{ID: "reservation", ExpiresAt: time.Now().Add(time.Hour)}, nil
+}
+
+func (f *fakeInventory) Confirm(_ context.Context, _ string, idempotencyKey string) error {
+	f.confirmKeys = append(f.confirmKeys, idempotencyKey)
+	return f.confirmErr
+}
+
+func (f *fakeInventory) Release(_ context.Context, reservationID string) error {
+	if err := f.releaseErrs[reservationID]; err != nil {
+		return err
+	}
+	f.released = append(f.released, reservationID)
+	return nil
+}
+
+type checkoutFixture struct {
+	uc        *CartUseCase
+	cart      *fakeCartRepo
+	events    *fakeEventRepo
+	checkouts *fakeCheckoutRepo
+	inventory *fakeInventory
+	userID    uuid.UUID
+	item      *entity.CartItem
+}
+
+// newCheckoutFixture builds a cart holding one line of 2 items at 1000 USD, the catalog sells it as product
+func newCheckoutFixture(product entity.CatalogProduct, orders *fakeOrderClient, inventory *fakeInventory) *checkoutFixture {
+	userID := uuid.New()
+	cart := &entity.Cart{ID: uuid.New(), UserID: userID, Default: true, Currency: "USD"}
+	item := &entity.CartItem{
+		ID:              uuid.New(),
+		CartID:          cart.ID,
+		UserID:          userID,
+		ProductID:       product.ID,
+		ProductName:     "mug",
+		ProductPrice:    1000,
+		Currency:        "USD",
+		ProductQuantity: 2,
+		List:            entity.CartItemListCart,
+	}
+
+	fixture := &checkoutFixture{
+		cart:      newFakeCartRepo(cart, item),
+		events:    &fakeEventRepo{},
+		checkouts: &fakeCheckoutRepo{},
+		inventory: inventory,
+		userID:    userID,
+		item:      item,
+	}
+	fixture.uc = &CartUseCase{
+		repoMySQL:    fixture.cart,
+		repoOutbox:   &fakeOutboxRepo{},
+		repoEvents:   fixture.events,
+		repoCheckout: fixture.checkouts,
+		relay:        &fakeRelay{},
+		orderClient:  orders,
+		catalog:      webapi.NewFakeProductCatalog(product),
+		inventory:    inventory,
+		rules:        config.CartRules{MinQuantity: 1, MaxQuantity: 99},
+	}
+	return fixture
+}
+
+func TestCheckOutCarts(t *testing.T) {
+	productID := uuid.New()
+	orderID := uuid.New()
+	sameProduct := entity.CatalogProduct{ID: productID, Name: "mug", PriceAmount: 1000, Currency: "USD", Available: true}
+
+	tests := []struct {
+		name             string
+		product          entity.CatalogProduct
+		orderErr         error
+		confirmErr       error
+		checkErr         func(error) bool
+		wantState        string
+		wantReservation  string
+		wantList         string
+		wantDeleted      string
+		wantPrice        int64
+		wantConfirmed    bool
+		wantReleased     bool
+		wantChangeReason string
+	}{
+		{
+			name:            "completed",
+			product:         sameProduct,
+			checkErr:        func(err error) bool { return err == nil },
+			wantState:       entity.CheckoutStateCompleted,
+			wantReservation: entity.ReservationStateConfirmed,
+			wantList:        entity.CartItemListCheckout,
+			wantDeleted:     entity.CartItemDeletedCheckedOut,
+			wantPrice:       1000,
+			wantConfirmed:   true,
+		},
+		{
+			name:             "price changed reprices the held line",
+			product:          entity.CatalogProduct{ID: productID, Name: "mug", PriceAmount: 1200, Currency: "USD", Available: true},
+			checkErr:         isPriceChanged,
+			wantState:        entity.CheckoutStateFailed,
+			wantList:         entity.CartItemListCart,
+			wantPrice:        1200,
+			wantChangeReason: entity.CartPriceChangePrice,
+		},
+		{
+			name:             "currency changed keeps the price",
+			product:          entity.CatalogProduct{ID: productID, Name: "mug", PriceAmount: 900, Currency: "EUR", Available: true},
+			checkErr:         isPriceChanged,
+			wantState:        entity.CheckoutStateFailed,
+			wantList:         entity.CartItemListCart,
+			wantPrice:        1000,
+			wantChangeReason: entity.CartPriceChangeCurrency,
+		},
+		{
+			name:             "unavailable product",
+			product:          entity.CatalogProduct{ID: productID, Name: "mug", PriceAmount: 1000, Currency: "USD"},
+			checkErr:         isPriceChanged,
+			wantState:        entity.CheckoutStateFailed,
+			wantList:         entity.CartItemListCart,
+			wantPrice:        1000,
+			wantChangeReason: entity.CartPriceChangeUnavailable,
+		},
+		{
+			name:            "order rejected gives the lines back",
+			product:         sameProduct,
+			orderErr:        &entity.OrderServiceError{StatusCode: http.StatusUnprocessableEntity, Message: "address not served"},
+			checkErr:        func(err error) bool { var rejected *OrderRejectedError; return errors.As(err, &rejected) },
+			wantState:       entity.CheckoutStateFailed,
+			wantReservation: entity.ReservationStateReleased,
+			wantList:        entity.CartItemListCart,
+			wantPrice:       1000,
+			wantReleased:    true,
+		},
+		{
+			name:            "order service unavailable gives the lines back",
+			product:         sameProduct,
+			orderErr:        entity.ErrOrderServiceUnavailable,
+			checkErr:        func(err error) bool { return errors.Is(err, entity.ErrOrderServiceUnavailable) },
+			wantState:       entity.CheckoutStateFailed,
+			wantReservation: entity.ReservationStateReleased,
+			wantList:        entity.CartItemListCart,
+			wantPrice:       1000,
+			wantReleased:    true,
+		},
+		{
+			name:            "unknown order outcome stays pending",
+			product:         sameProduct,
+			orderErr:        entity.ErrOrderOutcomeUnknown,
+			checkErr:        func(err error) bool { return errors.Is(err, ErrCheckoutPending) },
+			wantState:       entity.CheckoutStatePending,
+			wantReservation: entity.ReservationStateReserved,
+			wantList:        entity.CartItemListCheckout,
+			wantPrice:       1000,
+		},
+		{
+			name:            "lost reservation still completes",
+			product:         sameProduct,
+			confirmErr:      &entity.InventoryServiceError{StatusCode: http.StatusGone, Message: "reservation expired"},
+			checkErr:        func(err error) bool { return err == nil },
+			wantState:       entity.CheckoutStateCompleted,
+			wantReservation: entity.ReservationStateLost,
+			wantList:        entity.CartItemListCheckout,
+			wantDeleted:     entity.CartItemDeletedCheckedOut,
+			wantPrice:       1000,
+			wantConfirmed:   true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			inventory := &fakeInventory{confirmErr: tt.confirmErr}
+			fixture := newCheckoutFixture(tt.product, &fakeOrderClient{orderID: orderID, err: tt.orderErr}, inventory)
+
+			err := fixture.uc.CheckOutCarts(context.Background(), fixture.userID, uuid.Nil, uuid.UUIDs{fixture.item.ID}, &entity.CheckoutAddress{}, "token")
+			if !tt.checkErr(err) {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			stored := fixture.checkouts.stored
+			if stored.State != tt.wantState {
+				t.Errorf("checkout state = %q, want %q", stored.State, tt.wantState)
+			}
+			if stored.ReservationState != tt.wantReservation {
+				t.Errorf("reservation state = %q, want %q", stored.ReservationState, tt.wantReservation)
+			}
+			if tt.wantReservation == entity.ReservationStateLost && stored.LastError == "" {
+				t.Error("lost reservation left no last error")
+			}
+
+			line := fixture.cart.items[fixture.item.ID]
+			if line.List != tt.wantList {
+				t.Errorf("line list = %q, want %q", line.List, tt.wantList)
+			}
+			if got := fixture.cart.deleted[fixture.item.ID]; got != tt.wantDeleted {
+				t.Errorf("line deleted as %q, want %q", got, tt.wantDeleted)
+			}
+			if line.ProductPrice != tt.wantPrice {
+				t.Errorf("line price = %d, want %d", line.ProductPrice, tt.wantPrice)
+			}
+
+			if confirmed := len(inventory.confirmKeys) > 0; confirmed != tt.wantConfirmed {
+				t.Errorf("confirmed = %v, want %v", confirmed, tt.wantConfirmed)
+			}
+			if tt.wantConfirmed && inventory.confirmKeys[0] != stored.ID.String()+":confirm" {
+				t.Errorf("confirm idempotency key = %q, want %q", inventory.confirmKeys[0], stored.ID.String()+":confirm")
+			}
+			if released := len(inventory.released) > 0; released != tt.wantReleased {
+				t.Errorf("released = %v, want %v", released, tt.wantReleased)
+			}
+
+			if tt.wantChangeReason != "" {
+				var priceChanged *PriceChangedError
+				errors.As(err, &priceChanged)
+				if len(priceChanged.Changes) != 1 || priceChanged.Changes[0].Reason != tt.wantChangeReason {
+					t.Errorf("price changes = %+v, want one %q", priceChanged.Changes, tt.wantChangeReason)
+				}
+			}
+		})
+	}
+}
+
+func TestResolvePendingCheckout(t *testing.T) {
+	orderID := uuid.New()
+
+	tests := []struct {
+		name      string
+		orders    *fakeOrderClient
+		wantErr   bool
+		wantState string
+		wantOrder uuid.UUID
+		wantList  string
+	}{
+		{
+			name:      "order found completes",
+			orders:    &fakeOrderClient{orderID: orderID, found: true},
+			wantState: entity.CheckoutStateCompleted,
+			wantOrder: orderID,
+			wantList:  entity.CartItemListCheckout,
+		},
+		{
+			name:      "no order fails",
+			orders:    &fakeOrderClient{},
+			wantState: entity.CheckoutStateFailed,
+			wantList:  entity.CartItemListCart,
+		},
+		{
+			name:      "order service down stays pending",
+			orders:    &fakeOrderClient{findErr: entity.ErrOrderServiceUnavailable},
+			wantErr:   true,
+			wantState: entity.CheckoutStatePending,
+			wantList:  entity.CartItemListCheckout,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			product := entity.CatalogProduct{ID: uuid.New(), Name: "mug", PriceAmount: 1000, Currency: "USD", Available: true}
+			fixture := newCheckoutFixture(product, tt.orders, &fakeInventory{})
+
+			checkout, err := entity.NewCheckout(fixture.userID, fixture.cart.cart.ID, uuid.UUIDs{fixture.item.ID}, entity.CheckoutAddress{})
+			if err != nil {
+				t.Fatalf("NewCheckout: %v", err)
+			}
+			if _, err := fixture.uc.holdCheckout(context.Background(), checkout); err != nil {
+				t.Fatalf("holdCheckout: %v", err)
+			}
+
+			err = fixture.uc.resolvePendingCheckout(context.Background(), checkout)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("resolvePendingCheckout() = %v, want error %v", err, tt.wantErr)
+			}
+
+			stored := fixture.checkouts.stored
+			if stored.State != tt.wantState {
+				t.Errorf("checkout state = %q, want %q", stored.State, tt.wantState)
+			}
+			if stored.OrderID != tt.wantOrder {
+				t.Errorf("order id = %s, want %s", stored.OrderID, tt.wantOrder)
+			}
+			if got := fixture.cart.items[fixture.item.ID].List; got != tt.wantList {
+				t.Errorf("line list = %q, want %q", got, tt.wantList)
+			}
+		})
+	}
+}
+
+func isPriceChanged(err error) bool {
+	var priceChanged *PriceChangedError
+	return errors.As(err, &priceChanged)
+}
+
+func TestCheckoutItemsError(t *testing.T) {
+	cartID := uuid.New()
+	active := &entity.CartItem{ID: uuid.New(), CartID: cartID, List: entity.CartItemListCart}
+	saved := &entity.CartItem{ID: uuid.New(), CartID: cartID, List: entity.CartItemListSaved}
+	otherCart := &entity.CartItem{ID: uuid.New(), CartID: uuid.New(), List: entity.CartItemListCart}
+	unknown := uuid.New()
+	items := []*entity.CartItem{active, saved, otherCart}
+
+	tests := []struct {
+		name    string
+		itemIDs uuid.UUIDs
+		fields  []string
+	}{
+		{name: "active line", itemIDs: uuid.UUIDs{active.ID}},
+		{name: "active line twice", itemIDs: uuid.UUIDs{active.ID, active.ID}},
+		{name: "saved line", itemIDs: uuid.UUIDs{active.ID, saved.ID}, fields: []string{"cart_ids[1]"}},
+		{name: "line of another cart", itemIDs: uuid.UUIDs{otherCart.ID}, fields: []string{"cart_ids[0]"}},
+		{name: "unknown line", itemIDs: uuid.UUIDs{unknown, active.ID}, fields: []string{"cart_ids[0]"}},
+		{name: "every line wrong", itemIDs: uuid.UUIDs{saved.ID, otherCart.ID, unknown}, fields: []string{"cart_ids[0]", "cart_ids[1]", "cart_ids[2]"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := checkoutItemsError(cartID, tt.itemIDs, items)
+			if (err == nil) != (len(tt.fields) == 0) {
+				t.Fatalf("checkoutItemsError() = %v, want fields %v", err, tt.fields)
+			}
+			if got := violationFields(err); strings.Join(got, ",") != strings.Join(tt.fields, ",") {
+				t.Errorf("fields = %v, want %v", got, tt.fields)
+			}
+		})
+	}
+}
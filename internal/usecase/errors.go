@@ -0,0 +1,92 @@
+package usecase
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/google/uuid"
+	"github.com/idoyudha/eshop-cart/internal/entity"
+)
+
+var (
+	ErrCurrencyMismatch = errors.New("item currency does not match the cart currency")
+	ErrCartItemNotFound = errors.New("cart item not found")
+	ErrCartEmpty        = errors.New("cart is empty")
+
+	ErrCheckoutInProgress = errors.New("cart item is being checked out")
+	ErrCheckoutPending    = errors.New("the order may have been placed, the checkout completes once the order service confirms it")
+
+	ErrInsufficientStock = errors.New("not enough stock for the cart items")
+
+	ErrCartNotFound      = errors.New("cart not found")
+	ErrCartNameTaken     = errors.New("a cart with this name already exists")
+	ErrDefaultCartDelete = errors.New("the default cart cannot be deleted, choose another default cart first")
+
+	ErrCartSnapshotNotFound = errors.New("cart snapshot not found or expired")
+
+	ErrInvalidCartToken  = errors.New("invalid or expired cart token")
+	ErrGuestCartNotFound = errors.New("guest cart not found")
+
+	ErrIdempotencyKeyReused     = errors.New("idempotency key was already used with a different request")
+	ErrIdempotencyKeyInProgress = errors.New("a request with the same idempotency key is still in progress")
+)
+
+// VersionConflictError is returned when a cart item changed since the version the client last read
+type VersionConflictError struct {
+	ItemID   uuid.UUID
+	Expected int64
+	Current  int64
+}
+
+func (e *VersionConflictError) Error() string {
+	return fmt.Sprintf("cart item %s is at version %d, expected %d", e.ItemID, e.Current, e.Expected)
+}
+
+// OrderRejectedError is returned when the order service refuses the order, Message is the reason it gave.
+// Conflict is set when the order conflicts with one it already has
+type OrderRejectedError struct {
+	Conflict bool
+	Message  string
+}
+
+func (e *OrderRejectedError) Error() string {
+	return "order rejected: " + e.Message
+}
+
+// PriceChangedError is returned when checkout finds lines whose price or availability changed in the catalog.
+// the cart already has the new prices, the shopper reviews them and checks out again
+type PriceChangedError struct {
+	Changes []entity.CartPriceChange
+}
+
+func (e *PriceChangedError) Error() string {
+	return fmt.Sprintf("%d cart items changed price or availability, review the cart and check out again", len(e.Changes))
+}
+
+// FieldViolation is one broken business rule, Field is the json name of the offending request field
+type FieldViolation struct {
+	Field   string
+	Message string
+}
+
+// ValidationError is returned when a change breaks the cart business rules
+type ValidationError struct {
+	Violations []FieldViolation
+}
+
+func (e *ValidationError) Error() string {
+	messages := make([]string, len(e.Violations))
+	for i, violation := range e.Violations {
+		messages[i] = fmt.Sprintf("%s %s", violation.Field, violation.Message)
+	}
+	return "invalid cart change: " + strings.Join(messages, ", ")
+}
+
+// newValidationError returns nil without violations
+func newValidationError(violations []FieldViolation) error {
+	if len(violations) == 0 {
+		return nil
+	}
+	return &ValidationError{Violations: violations}
+}
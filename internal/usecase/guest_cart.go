@@ -0,0 +1,259 @@
+package usecase
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/idoyudha/eshop-cart/internal/entity"
+)
+
+// a guest cart token is base64url(guest id || expiry unix seconds) "." base64url(hmac-sha256 of that payload),
+// opaque to the client and only verifiable with the secret of the service
+const guestCartTokenPayloadSize = 16 + 8
+
+func signGuestCartToken(secret []byte, guestID uuid.UUID, expiresAt time.Time) string {
+	payload := make([]byte, guestCartTokenPayloadSize)
+	copy(payload, guestID[:])
+	binary.BigEndian.PutUint64(payload[16:], uint64(expiresAt.Unix()))
+
+	mac := hmac.New(sha256.New, secret)
+	mac.Write(payload)
+
+	return base64.RawURLEncoding.EncodeToString(payload) + "." + base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+func parseGuestCartToken(secret []byte, token string, now time.Time) (uuid.UUID, error) {
+	encodedPayload, encodedSignature, found := strings.Cut(token, ".")
+	if !found {
+		return uuid.Nil, ErrInvalidCartToken
+	}
+
+	payload, err := base64.RawURLEncoding.DecodeString(encodedPayload)
+	if err != nil || len(payload) != guestCartTokenPayloadSize {
+		return uuid.Nil, ErrInvalidCartToken
+	}
+
+	signature, err := base64.RawURLEncoding.DecodeString(encodedSignature)
+	if err != nil {
+		return uuid.Nil, ErrInvalidCartToken
+	}
+
+	mac := hmac.New(sha256.New, secret)
+	mac.Write(payload)
+	if !hmac.Equal(signature, mac.Sum(nil)) {
+		return uuid.Nil, ErrInvalidCartToken
+	}
+
+	expiresAt := time.Unix(int64(binary.BigEndian.Uint64(payload[16:])), 0)
+	if !now.Before(expiresAt) {
+		return uuid.Nil, ErrInvalidCartToken
+	}
+
+	guestID, err := uuid.FromBytes(bytes.Clone(payload[:16]))
+	if err != nil {
+		return uuid.Nil, ErrInvalidCartToken
+	}
+
+	return guestID, nil
+}
+
+// CreateGuestCart opens an empty cart for an anonymous shopper and returns it with the token that identifies it
+func (u *CartUseCase) CreateGuestCart(ctx context.Context) (string, *entity.Cart, error) {
+	cart, err := entity.NewGuestCart(time.Now().Add(u.guestCart.TTL))
+	if err != nil {
+		return "", nil, err
+	}
+
+	err = u.repoMySQL.WithTx(ctx, func(txCtx context.Context) error {
+		if errInsert := u.repoMySQL.InsertCart(txCtx, cart); errInsert != nil {
+			return errInsert
+		}
+		return u.repoMySQL.SetDefaultCart(txCtx, cart.UserID, cart.ID)
+	})
+	if err != nil {
+		return "", nil, err
+	}
+	cart.Items = make([]*entity.CartItem, 0)
+
+	return signGuestCartToken([]byte(u.guestCart.TokenSecret), cart.UserID, cart.ExpiresAt), cart, nil
+}
+
+// ParseGuestCartToken returns the owner id of the guest cart, ErrInvalidCartToken if the token is forged or expired
+func (u *CartUseCase) ParseGuestCartToken(token string) (uuid.UUID, error) {
+	return parseGuestCartToken([]byte(u.guestCart.TokenSecret), token, time.Now())
+}
+
+// MergeGuestCart folds the lines of the guest cart into the selected cart of the user after sign in,
+// following the configured merge rule for products in both carts, and empties the guest cart.
+// lines saved for later are merged the same way into the saved list of the user, they do not count against MaxLines
+func (u *CartUseCase) MergeGuestCart(ctx context.Context, userID uuid.UUID, cartID uuid.UUID, guestID uuid.UUID) (*entity.Cart, error) {
+	userEvent, err := entity.NewCartChangedEvent(userID)
+	if err != nil {
+		return nil, err
+	}
+
+	guestEvent, err := entity.NewCartChangedEvent(guestID)
+	if err != nil {
+		return nil, err
+	}
+
+	err = retryDuplicate(func() error {
+		return u.mutateMany(ctx, []*entity.OutboxEvent{userEvent, guestEvent}, func(txCtx context.Context) error {
+			guestCart, errGuest := u.repoMySQL.GetCartByUserID(txCtx, guestID)
+			if errGuest != nil {
+				return errGuest
+			}
+			if guestCart == nil || !guestCart.Guest {
+				return ErrGuestCartNotFound
+			}
+
+			// a request still adding to the guest cart must not slip a line in after it was merged
+			guestItems, errItems := u.repoMySQL.GetItemsForUpdate(txCtx, guestCart.ID)
+			if errItems != nil {
+				return errItems
+			}
+			savedItems, errSaved := u.lockSavedItems(txCtx, guestID, guestCart.ID)
+			if errSaved != nil {
+				return errSaved
+			}
+			guestCart.Items = append(guestItems, savedItems...)
+			if len(guestCart.Items) == 0 {
+				return nil
+			}
+
+			cart, errCart := u.getOrCreateCart(txCtx, userID, cartID, guestCart.Currency)
+			if errCart != nil {
+				return errCart
+			}
+			if cart.Currency != guestCart.Currency {
+				return ErrCurrencyMismatch
+			}
+
+			now := time.Now()
+			lines := len(cart.Items)
+			guestItemIDs := make(uuid.UUIDs, len(guestCart.Items))
+			for i, guestItem := range guestCart.Items {
+				guestItemIDs[i] = guestItem.ID
+
+				existing, errExist := u.repoMySQL.GetItemByLine(txCtx, cart.ID, guestItem, guestItem.List)
+				if errExist != nil {
+					return errExist
+				}
+
+				if existing == nil {
+					if guestItem.List == entity.CartItemListCart {
+						lines++
+						if errCount := u.validateLineCount(lines); errCount != nil {
+							return errCount
+						}
+					}
+					item := *guestItem
+					if errID := item.GenerateCartItemID(); errID != nil {
+						return errID
+					}
+					item.CartID = cart.ID
+					item.UserID = userID
+					item.Version = 1
+					item.UpdatedAt = now
+					if errInsert := u.repoMySQL.Insert(txCtx, &item); errInsert != nil {
+						return errInsert
+					}
+					if errEvent := u.recordEvent(txCtx, entity.CartEventItemMerged, nil, &item); errEvent != nil {
+						return errEvent
+					}
+					continue
+				}
+
+				before := *existing
+
+				// never fail the sign in over a merged quantity, cap it instead
+				existing.ProductQuantity = mergeCartQuantity(u.guestCart.MergeRule, existing.ProductQuantity, guestItem.ProductQuantity)
+				if u.rules.MaxQuantity > 0 {
+					existing.ProductQuantity = min(existing.ProductQuantity, u.rules.MaxQuantity)
+				}
+				if u.guestCart.MergeRule == entity.CartMergeRuleGuest {
+					existing.Note = guestItem.Note
+				}
+				existing.UpdatedAt = now
+				if errUpdate := u.repoMySQL.UpdateQtyAndNote(txCtx, existing); errUpdate != nil {
+					return errUpdate
+				}
+				existing.Version++
+				if errEvent := u.recordEvent(txCtx, entity.CartEventItemMerged, &before, existing); errEvent != nil {
+					return errEvent
+				}
+			}
+
+			if errDelete := u.repoMySQL.DeleteMany(txCtx, guestID, guestItemIDs, entity.CartItemDeletedMerged); errDelete != nil {
+				return errDelete
+			}
+
+			for _, guestItem := range guestCart.Items {
+				if errEvent := u.recordEvent(txCtx, entity.CartEventItemDeleted, guestItem, nil); errEvent != nil {
+					return errEvent
+				}
+			}
+
+			return nil
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if cartID != uuid.Nil {
+		return u.GetUserCart(ctx, userID, cartID)
+	}
+
+	cart, err := u.repoMySQL.GetByUserID(ctx, userID)
+	if err != nil || cart != nil {
+		return cart, err
+	}
+
+	return emptyCart(userID), nil
+}
+
+// lockSavedItems returns the lines saved for later in the cart, locked so they cannot be moved while they are merged
+func (u *CartUseCase) lockSavedItems(ctx context.Context, userID uuid.UUID, cartID uuid.UUID) ([]*entity.CartItem, error) {
+	saved, err := u.repoMySQL.GetItemsByList(ctx, cartID, entity.CartItemListSaved)
+	if err != nil || len(saved) == 0 {
+		return saved, err
+	}
+
+	itemIDs := make(uuid.UUIDs, len(saved))
+	for i, item := range saved {
+		itemIDs[i] = item.ID
+	}
+
+	locked, err := u.repoMySQL.GetItemsByIDs(ctx, userID, itemIDs)
+	if err != nil {
+		return nil, err
+	}
+
+	// skip lines moved out of the saved list before they were locked
+	items := make([]*entity.CartItem, 0, len(locked))
+	for _, item := range locked {
+		if item.List == entity.CartItemListSaved {
+			items = append(items, item)
+		}
+	}
+	return items, nil
+}
+
+func mergeCartQuantity(rule string, userQuantity int64, guestQuantity int64) int64 {
+	switch rule {
+	case entity.CartMergeRuleMax:
+		return max(userQuantity, guestQuantity)
+	case entity.CartMergeRuleGuest:
+		return guestQuantity
+	default:
+		return userQuantity + guestQuantity
+	}
+}
@@ -0,0 +1,238 @@
+package usecase
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/idoyudha/eshop-cart/config"
+	"github.com/idoyudha/eshop-cart/internal/entity"
+)
+
+func TestMergeCartQuantity(t *testing.T) {
+	tests := []struct {
+		name  string
+		rule  string
+		user  int64
+		guest int64
+		want  int64
+	}{
+		{name: "sum", rule: entity.CartMergeRuleSum, user: 2, guest: 3, want: 5},
+		{name: "max keeps the user quantity", rule: entity.CartMergeRuleMax, user: 4, guest: 3, want: 4},
+		{name: "max keeps the guest quantity", rule: entity.CartMergeRuleMax, user: 2, guest: 3, want: 3},
+		{name: "guest replaces", rule: entity.CartMergeRuleGuest, user: 5, guest: 1, want: 1},
+		{name: "unknown rule sums", rule: "", user: 1, guest: 1, want: 2},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := mergeCartQuantity(tt.rule, tt.user, tt.guest); got != tt.want {
+				t.Errorf("mergeCartQuantity(%q, %d, %d) = %d, want %d", tt.rule, tt.user, tt.guest, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseGuestCartToken(t *testing.T) {
+	secret := []byte("secret")
+	guestID := uuid.New()
+	now := time.Now()
+	token := signGuestCartToken(secret, guestID, now.Add(time.Hour))
+	payload, signature, _ := strings.Cut(token, ".")
+
+	// flips one bit of the decoded part, keeping the encoding valid
+	tamper := func(part string) string {
+		decoded, _ := base64.RawURLEncoding.DecodeString(part)
+		decoded[0] ^= 1
+		return base64.RawURLEncoding.EncodeToString(decoded)
+	}
+
+	tests := []struct {
+		name   string
+		secret []byte
+		token  string
+		now    time.Time
+		valid  bool
+	}{
+		{name: "valid", secret: secret, token: token, now: now, valid: true},
+		{name: "expired", secret: secret, token: token, now: now.Add(time.Hour)},
+		{name: "other secret", secret: []byte("other"), token: token, now: now},
+		{name: "tampered guest id", secret: secret, token: tamper(payload) + "." + signature, now: now},
+		{name: "tampered signature", secret: secret, token: payload + "." + tamper(signature), now: now},
+		{name: "extended expiry", secret: secret, token: strings.Split(signGuestCartToken([]byte("other"), guestID, now.Add(time.Hour*24)), ".")[0] + "." + signature, now: now},
+		{name: "no signature", secret: secret, token: payload, now: now},
+		{name: "not base64", secret: secret, token: "!!." + signature, now: now},
+		{name: "short payload", secret: secret, token: base64.RawURLEncoding.EncodeToString(guestID[:]) + "." + signature, now: now},
+		{name: "empty", secret: secret, token: "", now: now},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parseGuestCartToken(tt.secret, tt.token, tt.now)
+			if tt.valid {
+				if err != nil || got != guestID {
+					t.Fatalf("parseGuestCartToken() = %s, %v, want %s", got, err, guestID)
+				}
+				return
+			}
+			if !errors.Is(err, ErrInvalidCartToken) || got != uuid.Nil {
+				t.Errorf("parseGuestCartToken() = %s, %v, want %v", got, err, ErrInvalidCartToken)
+			}
+		})
+	}
+}
+
+func TestMergeGuestCart(t *testing.T) {
+	userID := uuid.New()
+	guestID := uuid.New()
+	mug := uuid.New()
+	plate := uuid.New()
+	bowl := uuid.New()
+
+	type carts struct {
+		repo  *fakeCartRepo
+		guest *entity.Cart
+	}
+	line := func(cart *entity.Cart, productID uuid.UUID, list string, quantity int64) *entity.CartItem {
+		return &entity.CartItem{CartID: cart.ID, UserID: cart.UserID, ProductID: productID, ProductQuantity: quantity, Currency: cart.Currency, List: list, Version: 1}
+	}
+	// the user has 2 mugs in the cart and 4 plates saved for later
+	setup := func(guestCurrency string) carts {
+		user := &entity.Cart{ID: uuid.New(), UserID: userID, Default: true, Currency: "USD"}
+		guest := &entity.Cart{ID: uuid.New(), UserID: guestID, Default: true, Guest: true, Currency: guestCurrency}
+		repo := newFakeCartRepo(user)
+		repo.carts[guest.ID] = guest
+		repo.add(line(user, mug, entity.CartItemListCart, 2))
+		repo.add(line(user, plate, entity.CartItemListSaved, 4))
+		return carts{repo: repo, guest: guest}
+	}
+
+	tests := []struct {
+		name          string
+		guestCurrency string
+		rule          string
+		maxLines      int
+		guestLines    func(c carts)
+		wantErr       func(error) bool
+		// quantity per product of the user lists afterwards
+		wantCart  map[uuid.UUID]int64
+		wantSaved map[uuid.UUID]int64
+	}{
+		{
+			name: "cart and saved lines are summed",
+			guestLines: func(c carts) {
+				c.repo.add(line(c.guest, mug, entity.CartItemListCart, 3))
+				c.repo.add(line(c.guest, plate, entity.CartItemListSaved, 1))
+				c.repo.add(line(c.guest, bowl, entity.CartItemListSaved, 6))
+			},
+			wantCart:  map[uuid.UUID]int64{mug: 5},
+			wantSaved: map[uuid.UUID]int64{plate: 5, bowl: 6},
+		},
+		{
+			name: "saved lines follow the max rule",
+			rule: entity.CartMergeRuleMax,
+			guestLines: func(c carts) {
+				c.repo.add(line(c.guest, plate, entity.CartItemListSaved, 3))
+			},
+			wantCart:  map[uuid.UUID]int64{mug: 2},
+			wantSaved: map[uuid.UUID]int64{plate: 4},
+		},
+		{
+			name: "merged quantity is capped",
+			guestLines: func(c carts) {
+				c.repo.add(line(c.guest, mug, entity.CartItemListCart, 9))
+			},
+			wantCart:  map[uuid.UUID]int64{mug: 10},
+			wantSaved: map[uuid.UUID]int64{plate: 4},
+		},
+		{
+			name:     "saved lines do not count against the line limit",
+			maxLines: 1,
+			guestLines: func(c carts) {
+				c.repo.add(line(c.guest, bowl, entity.CartItemListSaved, 1))
+			},
+			wantCart:  map[uuid.UUID]int64{mug: 2},
+			wantSaved: map[uuid.UUID]int64{plate: 4, bowl: 1},
+		},
+		{
+			name:     "new cart line over the line limit",
+			maxLines: 1,
+			guestLines: func(c carts) {
+				c.repo.add(line(c.guest, bowl, entity.CartItemListCart, 1))
+			},
+			wantErr: func(err error) bool { var validation *ValidationError; return errors.As(err, &validation) },
+		},
+		{
+			name:          "guest cart in another currency",
+			guestCurrency: "EUR",
+			guestLines: func(c carts) {
+				c.repo.add(line(c.guest, bowl, entity.CartItemListSaved, 1))
+			},
+			wantErr: func(err error) bool { return errors.Is(err, ErrCurrencyMismatch) },
+		},
+		{
+			name:       "not a guest cart",
+			guestLines: func(c carts) { c.guest.Guest = false },
+			wantErr:    func(err error) bool { return errors.Is(err, ErrGuestCartNotFound) },
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			currency := tt.guestCurrency
+			if currency == "" {
+				currency = "USD"
+			}
+			c := setup(currency)
+			tt.guestLines(c)
+
+			uc := &CartUseCase{
+				repoMySQL:  c.repo,
+				repoOutbox: &fakeOutboxRepo{},
+				repoEvents: &fakeEventRepo{},
+				relay:      &fakeRelay{},
+				guestCart:  config.GuestCart{MergeRule: tt.rule},
+				rules:      config.CartRules{MinQuantity: 1, MaxQuantity: 10, MaxLines: tt.maxLines},
+			}
+
+			cart, err := uc.MergeGuestCart(context.Background(), userID, uuid.Nil, guestID)
+			if tt.wantErr != nil {
+				if !tt.wantErr(err) {
+					t.Fatalf("MergeGuestCart() = %v, want a matching error", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("MergeGuestCart() = %v", err)
+			}
+			if len(cart.Items) != len(tt.wantCart) {
+				t.Errorf("merged cart has %d lines, want %d", len(cart.Items), len(tt.wantCart))
+			}
+
+			for list, want := range map[string]map[uuid.UUID]int64{entity.CartItemListCart: tt.wantCart, entity.CartItemListSaved: tt.wantSaved} {
+				got := make(map[uuid.UUID]int64)
+				for _, item := range c.repo.list(c.repo.cart.ID, list) {
+					got[item.ProductID] += item.ProductQuantity
+				}
+				if len(got) != len(want) {
+					t.Errorf("%s list = %v, want %v", list, got, want)
+					continue
+				}
+				for productID, quantity := range want {
+					if got[productID] != quantity {
+						t.Errorf("%s list = %v, want %v", list, got, want)
+						break
+					}
+				}
+			}
+
+			if left := len(c.repo.list(c.guest.ID, entity.CartItemListCart)) + len(c.repo.list(c.guest.ID, entity.CartItemListSaved)); left != 0 {
+				t.Errorf("guest cart kept %d lines", left)
+			}
+		})
+	}
+}
@@ -0,0 +1,55 @@
+package usecase
+
+import (
+	"context"
+
+	"github.com/idoyudha/eshop-cart/config"
+	"github.com/idoyudha/eshop-cart/internal/entity"
+)
+
+type IdempotencyUseCase struct {
+	repo IdempotencyRedisRepo
+	cfg  config.Idempotency
+}
+
+func NewIdempotencyUseCase(repo IdempotencyRedisRepo, cfg config.Idempotency) *IdempotencyUseCase {
+	return &IdempotencyUseCase{
+		repo,
+		cfg,
+	}
+}
+
+// Begin reserves key for the request with requestHash. It returns nil when the request must be handled,
+// or the completed record whose response must be replayed instead
+func (u *IdempotencyUseCase) Begin(ctx context.Context, key string, requestHash string) (*entity.IdempotencyRecord, error) {
+	existing, err := u.repo.Reserve(ctx, entity.NewIdempotencyRecord(key, requestHash), u.cfg.LockTimeout)
+	if err != nil {
+		return nil, err
+	}
+
+	if existing == nil {
+		return nil, nil
+	}
+
+	if existing.RequestHash != requestHash {
+		return nil, ErrIdempotencyKeyReused
+	}
+
+	if existing.Status != entity.IdempotencyStatusCompleted {
+		return nil, ErrIdempotencyKeyInProgress
+	}
+
+	return existing, nil
+}
+
+// Complete stores the response of the request reserved by Begin so retries replay it
+func (u *IdempotencyUseCase) Complete(ctx context.Context, record *entity.IdempotencyRecord) error {
+	record.Status = entity.IdempotencyStatusCompleted
+
+	return u.repo.Save(ctx, record, u.cfg.TTL)
+}
+
+// Release frees key so the request can be retried, used when it failed without a response worth replaying
+func (u *IdempotencyUseCase) Release(ctx context.Context, key string) error {
+	return u.repo.Delete(ctx, key)
+}
@@ -2,6 +2,7 @@ package usecase
 
 import (
 	"context"
+	"time"
 
 	"github.com/google/uuid"
 	"github.com/idoyudha/eshop-cart/internal/entity"
@@ -9,33 +10,180 @@ import (
 
 type (
 	CartMySQLRepo interface {
-		Insert(context.Context, *entity.Cart) error
-		GetByUserID(context.Context, uuid.UUID) ([]*entity.Cart, error)
-		UpdateQtyAndNote(context.Context, *entity.Cart) (*uuid.UUID, error)
-		UpdateNameAndPrice(context.Context, *entity.Cart) error
-		DeleteMany(context.Context, uuid.UUIDs) error
-		DeleteOne(context.Context, uuid.UUID) (*uuid.UUID, error)
-		UpdateProductQty(context.Context, *entity.Cart) error
+		WithTx(context.Context, func(context.Context) error) error
+		InsertCart(context.Context, *entity.Cart) error
+		GetCartByUserID(context.Context, uuid.UUID) (*entity.Cart, error)
+		GetCartByID(context.Context, uuid.UUID, uuid.UUID) (*entity.Cart, error)
+		GetCartsByUserID(context.Context, uuid.UUID) ([]*entity.Cart, error)
+		UpdateCartName(context.Context, *entity.Cart) error
+		DeleteCartHeader(context.Context, uuid.UUID, uuid.UUID) error
+		SetDefaultCart(context.Context, uuid.UUID, uuid.UUID) error
+		GetUserIDs(context.Context, uuid.UUID, int) (uuid.UUIDs, error)
+		UpdateCartCurrency(context.Context, uuid.UUID, string) error
+		Insert(context.Context, *entity.CartItem) error
+		GetByUserID(context.Context, uuid.UUID) (*entity.Cart, error)
+		IncrementCacheVersion(context.Context, uuid.UUID) error
+		GetItemsForUpdate(context.Context, uuid.UUID) ([]*entity.CartItem, error)
+		GetByCartID(context.Context, uuid.UUID, uuid.UUID) (*entity.Cart, error)
+		GetItemByLine(context.Context, uuid.UUID, *entity.CartItem, string) (*entity.CartItem, error)
+		GetItemByID(context.Context, uuid.UUID, uuid.UUID) (*entity.CartItem, error)
+		GetItemsByList(context.Context, uuid.UUID, string) ([]*entity.CartItem, error)
+		GetItemsByIDs(context.Context, uuid.UUID, uuid.UUIDs) ([]*entity.CartItem, error)
+		GetItemsByProductID(context.Context, uuid.UUID) ([]*entity.CartItem, error)
+		MoveItem(context.Context, *entity.CartItem) error
+		MoveItemToCart(context.Context, *entity.CartItem) error
+		MoveItemsList(context.Context, uuid.UUID, uuid.UUIDs, string, string) error
+		GetAllActive(context.Context) ([]*entity.CartItem, error)
+		UpdateQtyAndNote(context.Context, *entity.CartItem) error
+		UpdateNameAndPrice(context.Context, *entity.CartItem, uuid.UUIDs) error
+		DeleteMany(context.Context, uuid.UUID, uuid.UUIDs, string) error
+		DeleteOne(context.Context, uuid.UUID, string) error
+		GetRemovedSince(context.Context, uuid.UUID, time.Time) ([]*entity.CartItem, error)
+		GetRemovedItemByID(context.Context, uuid.UUID, uuid.UUID) (*entity.CartItem, error)
+		RestoreItem(context.Context, *entity.CartItem) error
+		UpdateProductQty(context.Context, *entity.CartItem) error
+		PurgeDeletedBefore(context.Context, time.Time, int, bool) (int64, error)
+		PurgeExpiredGuestCarts(context.Context, time.Time, int) (int64, error)
 	}
 
 	CartRedisRepo interface {
-		Save(context.Context, *entity.Cart) error
-		GetUserCart(context.Context, string) ([]*entity.Cart, error)
-		UpdateQtyAndNote(context.Context, *entity.Cart) error
-		UpdateNameAndPrice(context.Context, *entity.Cart) error
-		DeleteCart(context.Context, string, string) error
+		SaveCart(context.Context, *entity.Cart) error
+		ReplaceCart(context.Context, string, *entity.Cart) error
+		GetUserCart(context.Context, string) (*entity.Cart, error)
+		UpdateNameAndPrice(context.Context, *entity.CartItem) error
 		DeleteCarts(context.Context, string) error
-		IsProductExistInUserCart(context.Context, string, string) (bool, error)
-		UpdateProductQtyCart(context.Context, *entity.Cart) error
+		ScanUserIDs(context.Context) ([]string, error)
+		DeleteLegacyCartKeys(context.Context) (int, error)
+		RebuildProductIndex(context.Context, []*entity.CartItem) error
+	}
+
+	CartEventMySQLRepo interface {
+		Insert(context.Context, *entity.CartEvent) error
+		GetByUserID(context.Context, uuid.UUID, uuid.UUID, int) ([]*entity.CartEvent, error)
+	}
+
+	CheckoutMySQLRepo interface {
+		Insert(context.Context, *entity.Checkout) error
+		Transition(context.Context, *entity.Checkout, string) (bool, error)
+		UpdateReservation(context.Context, *entity.Checkout) error
+		GetStuck(context.Context, []string, time.Time, int) ([]*entity.Checkout, error)
+		GetExpiredReservations(context.Context, time.Time, int) ([]*entity.Checkout, error)
+	}
+
+	OutboxMySQLRepo interface {
+		Insert(context.Context, *entity.OutboxEvent) error
+		ClaimPending(context.Context, int, time.Duration) ([]*entity.OutboxEvent, error)
+		MarkProcessed(context.Context, uuid.UUID) error
+		MarkFailed(context.Context, uuid.UUID, string, time.Time) error
+		DeleteProcessedBefore(context.Context, time.Time) (int64, error)
+	}
+
+	AbandonedCartMySQLRepo interface {
+		GetAbandoned(context.Context, time.Time, uuid.UUID, int) ([]entity.AbandonedCart, error)
+		MarkNotified(context.Context, entity.AbandonedCart, time.Time) (bool, error)
+	}
+
+	CartEventPublisher interface {
+		PublishCartAbandoned(context.Context, uuid.UUID, []byte) error
+	}
+
+	CartSnapshotRedisRepo interface {
+		Save(context.Context, *entity.CartSnapshot) error
+		Get(context.Context, string) (*entity.CartSnapshot, error)
+	}
+
+	// OrderClient places orders. the idempotency key of an order places it once however often it is sent,
+	// FindOrder returns the order placed with a key and false when there is none
+	OrderClient interface {
+		CreateOrder(context.Context, string, entity.OrderRequest) (uuid.UUID, error)
+		FindOrder(context.Context, string) (uuid.UUID, bool, error)
+	}
+
+	ProductCatalog interface {
+		GetProducts(context.Context, uuid.UUIDs) (map[uuid.UUID]entity.CatalogProduct, error)
+	}
+
+	InventoryClient interface {
+		Reserve(context.Context, entity.InventoryReservationRequest) (*entity.InventoryReservation, error)
+		Confirm(context.Context, string, string) error
+		Release(context.Context, string) error
+	}
+
+	IdempotencyRedisRepo interface {
+		Reserve(context.Context, *entity.IdempotencyRecord, time.Duration) (*entity.IdempotencyRecord, error)
+		Save(context.Context, *entity.IdempotencyRecord, time.Duration) error
+		Delete(context.Context, string) error
 	}
 
 	Cart interface {
-		CreateCart(context.Context, *entity.Cart) (entity.Cart, error)
-		GetUserCart(context.Context, uuid.UUID) ([]*entity.Cart, error)
-		UpdateProductNameAndPriceCart(context.Context, *entity.Cart) error
-		UpdateQtyAndNoteCart(context.Context, *entity.Cart) error
-		DeleteCart(context.Context, uuid.UUID, uuid.UUID) error
+		CreateCart(context.Context, *entity.CartItem) (entity.CartItem, error)
+		CreateCarts(context.Context, uuid.UUID, uuid.UUID, []*entity.CartItem, bool) ([]CartBatchResult, error)
+		GetUserCart(context.Context, uuid.UUID, uuid.UUID) (*entity.Cart, error)
+		UpdateProductNameAndPriceCart(context.Context, *entity.CartItem) error
+		UpdateQtyAndNoteCart(context.Context, *entity.CartItem) error
+		DeleteCart(context.Context, uuid.UUID, uuid.UUID, int64) error
 		DeleteCarts(context.Context, uuid.UUID, uuid.UUIDs) error
-		CheckOutCarts(context.Context, uuid.UUID, uuid.UUIDs, *entity.CheckoutAddress, string) error
+		CheckOutCarts(context.Context, uuid.UUID, uuid.UUID, uuid.UUIDs, *entity.CheckoutAddress, string) error
+		CreateGuestCart(context.Context) (string, *entity.Cart, error)
+		ParseGuestCartToken(string) (uuid.UUID, error)
+		MergeGuestCart(context.Context, uuid.UUID, uuid.UUID, uuid.UUID) (*entity.Cart, error)
+		GetSavedItems(context.Context, uuid.UUID, uuid.UUID) ([]*entity.CartItem, error)
+		MoveCartItem(context.Context, uuid.UUID, uuid.UUID, int64, string) (entity.CartItem, error)
+		GetHistory(context.Context, uuid.UUID, uuid.UUID, int) ([]*entity.CartEvent, error)
+		GetRemovedItems(context.Context, uuid.UUID, time.Duration) ([]*entity.CartItem, error)
+		RestoreCartItem(context.Context, uuid.UUID, uuid.UUID) (entity.CartItem, error)
+		ListCarts(context.Context, uuid.UUID) ([]*entity.Cart, error)
+		CreateNamedCart(context.Context, uuid.UUID, string, string) (*entity.Cart, error)
+		RenameCart(context.Context, uuid.UUID, uuid.UUID, string) (*entity.Cart, error)
+		DeleteNamedCart(context.Context, uuid.UUID, uuid.UUID) error
+		SetDefaultCart(context.Context, uuid.UUID, uuid.UUID) (*entity.Cart, error)
+		MoveItemToCart(context.Context, uuid.UUID, uuid.UUID, int64, uuid.UUID) (entity.CartItem, error)
+	}
+
+	CartSnapshot interface {
+		CreateSnapshot(context.Context, uuid.UUID, uuid.UUID) (*entity.CartSnapshot, error)
+		GetSnapshot(context.Context, string) (*entity.CartSnapshot, error)
+		ImportSnapshot(context.Context, uuid.UUID, uuid.UUID, string) ([]CartBatchResult, error)
+	}
+
+	Idempotency interface {
+		Begin(context.Context, string, string) (*entity.IdempotencyRecord, error)
+		Complete(context.Context, *entity.IdempotencyRecord) error
+		Release(context.Context, string) error
+	}
+
+	OutboxRelay interface {
+		Dispatch(context.Context, ...*entity.OutboxEvent)
+		Run(context.Context)
+	}
+
+	Reconcile interface {
+		Reconcile(context.Context, bool) (entity.ReconcileReport, error)
+		Run(context.Context)
+	}
+
+	AbandonedCart interface {
+		Detect(context.Context) (int, error)
+		Run(context.Context)
+	}
+
+	CheckoutRecovery interface {
+		Recover(context.Context) (int, error)
+		Run(context.Context)
+	}
+
+	ReservationSweeper interface {
+		Sweep(context.Context) (int, error)
+		Run(context.Context)
+	}
+
+	Retention interface {
+		Purge(context.Context, bool) (int64, error)
+		Run(context.Context)
+	}
+
+	Maintenance interface {
+		MigrateRedisCartKeys(context.Context) error
+		RebuildProductIndex(context.Context) error
 	}
 )
@@ -0,0 +1,80 @@
+package usecase
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/google/uuid"
+	"github.com/idoyudha/eshop-cart/pkg/logger"
+)
+
+type MaintenanceUseCase struct {
+	repoRedis CartRedisRepo
+	repoMySQL CartMySQLRepo
+	l         logger.Interface
+}
+
+func NewMaintenanceUseCase(
+	repoRedis CartRedisRepo,
+	repoMySQL CartMySQLRepo,
+	l logger.Interface,
+) *MaintenanceUseCase {
+	return &MaintenanceUseCase{
+		repoRedis,
+		repoMySQL,
+		l,
+	}
+}
+
+// MigrateRedisCartKeys moves cached carts from the global cart:{productID} hashes
+// to the per user cart:{userID}:{productID} layout.
+// the legacy hashes were shared between users, so their content cannot be trusted,
+// every cached user cart is rebuilt from mysql instead of copied.
+func (u *MaintenanceUseCase) MigrateRedisCartKeys(ctx context.Context) error {
+	userIDs, err := u.repoRedis.ScanUserIDs(ctx)
+	if err != nil {
+		return err
+	}
+
+	for _, userID := range userIDs {
+		parsedUserID, errParse := uuid.Parse(userID)
+		if errParse != nil {
+			u.l.Warn("usecase - MaintenanceUseCase - MigrateRedisCartKeys - invalid user id: %s", userID)
+			continue
+		}
+
+		cart, errGet := u.repoMySQL.GetByUserID(ctx, parsedUserID)
+		if errGet != nil {
+			return fmt.Errorf("failed to get cart of user %s: %w", userID, errGet)
+		}
+
+		if errReplace := u.repoRedis.ReplaceCart(ctx, userID, cart); errReplace != nil {
+			return errReplace
+		}
+	}
+
+	deleted, err := u.repoRedis.DeleteLegacyCartKeys(ctx)
+	if err != nil {
+		return err
+	}
+
+	u.l.Info("migrated redis carts of %d users, deleted %d legacy keys", len(userIDs), deleted)
+
+	return nil
+}
+
+// RebuildProductIndex fills the product:{productID}:carts reverse index from the active lines in mysql
+func (u *MaintenanceUseCase) RebuildProductIndex(ctx context.Context) error {
+	items, err := u.repoMySQL.GetAllActive(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to get active cart items: %w", err)
+	}
+
+	if err := u.repoRedis.RebuildProductIndex(ctx, items); err != nil {
+		return err
+	}
+
+	u.l.Info("rebuilt product index from %d cart lines", len(items))
+
+	return nil
+}
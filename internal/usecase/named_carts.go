@@ -0,0 +1,270 @@
+package usecase
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/idoyudha/eshop-cart/internal/entity"
+)
+
+// ListCarts returns the carts of the user without their lines, oldest first
+func (u *CartUseCase) ListCarts(ctx context.Context, userID uuid.UUID) ([]*entity.Cart, error) {
+	return u.repoMySQL.GetCartsByUserID(ctx, userID)
+}
+
+// CreateNamedCart adds an empty cart to the user, the first cart of a user becomes the default cart
+func (u *CartUseCase) CreateNamedCart(ctx context.Context, userID uuid.UUID, name string, currency string) (*entity.Cart, error) {
+	cart, err := entity.NewNamedCart(userID, name, currency)
+	if err != nil {
+		return nil, err
+	}
+
+	event, err := entity.NewCartChangedEvent(userID)
+	if err != nil {
+		return nil, err
+	}
+
+	err = u.mutate(ctx, event, func(txCtx context.Context) error {
+		carts, errCarts := u.repoMySQL.GetCartsByUserID(txCtx, userID)
+		if errCarts != nil {
+			return errCarts
+		}
+		if cartNameTaken(carts, name, uuid.Nil) {
+			return ErrCartNameTaken
+		}
+
+		// a concurrent request can take the name after the check above
+		if errInsert := u.repoMySQL.InsertCart(txCtx, cart); errInsert != nil {
+			if errors.Is(errInsert, entity.ErrAlreadyExists) {
+				return ErrCartNameTaken
+			}
+			return errInsert
+		}
+
+		if len(carts) > 0 {
+			return nil
+		}
+		cart.Default = true
+		return u.repoMySQL.SetDefaultCart(txCtx, userID, cart.ID)
+	})
+	if err != nil {
+		return nil, err
+	}
+	cart.Items = make([]*entity.CartItem, 0)
+
+	return cart, nil
+}
+
+// RenameCart changes the name of a cart of the user, names are unique per user
+func (u *CartUseCase) RenameCart(ctx context.Context, userID uuid.UUID, cartID uuid.UUID, name string) (*entity.Cart, error) {
+	event, err := entity.NewCartChangedEvent(userID)
+	if err != nil {
+		return nil, err
+	}
+
+	var renamed *entity.Cart
+	err = u.mutate(ctx, event, func(txCtx context.Context) error {
+		carts, errCarts := u.repoMySQL.GetCartsByUserID(txCtx, userID)
+		if errCarts != nil {
+			return errCarts
+		}
+		if cartNameTaken(carts, name, cartID) {
+			return ErrCartNameTaken
+		}
+
+		for _, cart := range carts {
+			if cart.ID == cartID {
+				renamed = cart
+			}
+		}
+		if renamed == nil {
+			return ErrCartNotFound
+		}
+
+		renamed.Name = name
+		renamed.UpdatedAt = time.Now()
+		errUpdate := u.repoMySQL.UpdateCartName(txCtx, renamed)
+		if errors.Is(errUpdate, entity.ErrAlreadyExists) {
+			return ErrCartNameTaken
+		}
+		return errUpdate
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return renamed, nil
+}
+
+// DeleteNamedCart removes a cart of the user with all its lines, the default cart and a cart being checked out cannot be deleted
+func (u *CartUseCase) DeleteNamedCart(ctx context.Context, userID uuid.UUID, cartID uuid.UUID) error {
+	event, err := entity.NewCartChangedEvent(userID)
+	if err != nil {
+		return err
+	}
+
+	return u.mutate(ctx, event, func(txCtx context.Context) error {
+		cart, errCart := u.selectCart(txCtx, userID, cartID)
+		if errCart != nil {
+			return errCart
+		}
+		if cart.Default {
+			return ErrDefaultCartDelete
+		}
+
+		// a failed checkout gives its lines back to the cart, it must still exist then
+		held, errHeld := u.repoMySQL.GetItemsByList(txCtx, cart.ID, entity.CartItemListCheckout)
+		if errHeld != nil {
+			return errHeld
+		}
+		if len(held) > 0 {
+			return ErrCheckoutInProgress
+		}
+
+		items := make([]*entity.CartItem, 0)
+		for _, list := range []string{entity.CartItemListCart, entity.CartItemListSaved} {
+			listItems, errItems := u.repoMySQL.GetItemsByList(txCtx, cart.ID, list)
+			if errItems != nil {
+				return errItems
+			}
+			items = append(items, listItems...)
+		}
+
+		itemIDs := make(uuid.UUIDs, len(items))
+		for i, item := range items {
+			itemIDs[i] = item.ID
+		}
+		if errDelete := u.repoMySQL.DeleteMany(txCtx, userID, itemIDs, entity.CartItemDeletedCart); errDelete != nil {
+			return errDelete
+		}
+		for _, item := range items {
+			if errEvent := u.recordEvent(txCtx, entity.CartEventItemDeleted, item, nil); errEvent != nil {
+				return errEvent
+			}
+		}
+
+		return u.repoMySQL.DeleteCartHeader(txCtx, userID, cart.ID)
+	})
+}
+
+// SetDefaultCart makes a cart of the user the one used when no cart is selected
+func (u *CartUseCase) SetDefaultCart(ctx context.Context, userID uuid.UUID, cartID uuid.UUID) (*entity.Cart, error) {
+	// the cached cart is the default cart, the event replaces it with the new one
+	event, err := entity.NewCartChangedEvent(userID)
+	if err != nil {
+		return nil, err
+	}
+
+	var cart *entity.Cart
+	err = u.mutate(ctx, event, func(txCtx context.Context) error {
+		var errCart error
+		if cart, errCart = u.selectCart(txCtx, userID, cartID); errCart != nil {
+			return errCart
+		}
+		cart.Default = true
+		return u.repoMySQL.SetDefaultCart(txCtx, userID, cart.ID)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return cart, nil
+}
+
+// MoveItemToCart moves a line to another cart of the user, keeping its list.
+// when the target cart already has a line with the same product, variant and options in that list the quantities are added to it instead.
+// a non zero version must match the current version of the line
+func (u *CartUseCase) MoveItemToCart(ctx context.Context, userID uuid.UUID, itemID uuid.UUID, version int64, cartID uuid.UUID) (entity.CartItem, error) {
+	event, err := entity.NewCartChangedEvent(userID)
+	if err != nil {
+		return entity.CartItem{}, err
+	}
+
+	var moved entity.CartItem
+	err = retryDuplicate(func() error {
+		return u.mutate(ctx, event, func(txCtx context.Context) error {
+			current, errCurrent := u.lockCartItem(txCtx, userID, itemID, version)
+			if errCurrent != nil {
+				return errCurrent
+			}
+
+			target, errTarget := u.getOrCreateCart(txCtx, userID, cartID, current.Currency)
+			if errTarget != nil {
+				return errTarget
+			}
+			// compared once resolved, a nil cartID may be the default cart the line is already in
+			if target.ID == current.CartID {
+				moved = *current
+				return nil
+			}
+			if target.Currency != current.Currency {
+				return ErrCurrencyMismatch
+			}
+
+			existing, errExist := u.repoMySQL.GetItemByLine(txCtx, target.ID, current, current.List)
+			if errExist != nil {
+				return errExist
+			}
+
+			before := *current
+			now := time.Now()
+			if existing == nil {
+				if current.List == entity.CartItemListCart {
+					if errCount := u.validateLineCount(len(target.Items) + 1); errCount != nil {
+						return errCount
+					}
+				}
+
+				current.CartID = target.ID
+				current.UpdatedAt = now
+				if errMove := u.repoMySQL.MoveItemToCart(txCtx, current); errMove != nil {
+					return errMove
+				}
+				current.Version++
+				moved = *current
+				return u.recordEvent(txCtx, entity.CartEventItemMoved, &before, current)
+			}
+
+			if errQuantity := newValidationError(u.checkQuantity(existing.ProductQuantity + current.ProductQuantity)); errQuantity != nil {
+				return errQuantity
+			}
+			existingBefore := *existing
+			existing.ProductQuantity += current.ProductQuantity
+			if existing.Note == "" {
+				existing.Note = current.Note
+			}
+			existing.UpdatedAt = now
+			if errUpdate := u.repoMySQL.UpdateQtyAndNote(txCtx, existing); errUpdate != nil {
+				return errUpdate
+			}
+			existing.Version++
+			moved = *existing
+
+			if errDelete := u.repoMySQL.DeleteOne(txCtx, current.ID, entity.CartItemDeletedMerged); errDelete != nil {
+				return errDelete
+			}
+			if errEvent := u.recordEvent(txCtx, entity.CartEventItemMerged, &existingBefore, existing); errEvent != nil {
+				return errEvent
+			}
+
+			return u.recordEvent(txCtx, entity.CartEventItemMoved, &before, nil)
+		})
+	})
+	if err != nil {
+		return entity.CartItem{}, err
+	}
+
+	return moved, nil
+}
+
+// cartNameTaken reports whether another cart than exceptID already uses name
+func cartNameTaken(carts []*entity.Cart, name string, exceptID uuid.UUID) bool {
+	for _, cart := range carts {
+		if cart.Name == name && cart.ID != exceptID {
+			return true
+		}
+	}
+	return false
+}
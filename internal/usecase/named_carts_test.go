@@ -0,0 +1,146 @@
+package usecase
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/idoyudha/eshop-cart/config"
+	"github.com/idoyudha/eshop-cart/internal/entity"
+)
+
+func TestMoveItemToCart(t *testing.T) {
+	userID := uuid.New()
+	productID := uuid.New()
+
+	type carts struct {
+		repo      *fakeCartRepo
+		line      *entity.CartItem
+		warehouse *entity.Cart
+	}
+	// the line is 2 mugs in the default USD cart, the warehouse cart is another USD cart of the user
+	setup := func() carts {
+		defaultCart := &entity.Cart{ID: uuid.New(), UserID: userID, Default: true, Currency: "USD"}
+		warehouse := &entity.Cart{ID: uuid.New(), UserID: userID, Name: "warehouse", Currency: "USD"}
+		line := &entity.CartItem{ID: uuid.New(), CartID: defaultCart.ID, UserID: userID, ProductID: productID, ProductQuantity: 2, Currency: "USD", List: entity.CartItemListCart, Version: 3}
+		repo := newFakeCartRepo(defaultCart, line)
+		repo.carts[warehouse.ID] = warehouse
+		return carts{repo: repo, line: line, warehouse: warehouse}
+	}
+
+	tests := []struct {
+		name         string
+		prepare      func(c carts) (cartID uuid.UUID, version int64)
+		wantErr      func(error) bool
+		wantCart     func(c carts) uuid.UUID
+		wantQuantity int64
+		wantDeleted  string
+		// quantity of the active lines of the warehouse cart afterwards
+		wantWarehouse int64
+	}{
+		{
+			name:         "no cart id is the default cart the line is in",
+			prepare:      func(c carts) (uuid.UUID, int64) { return uuid.Nil, 0 },
+			wantCart:     func(c carts) uuid.UUID { return c.repo.cart.ID },
+			wantQuantity: 2,
+		},
+		{
+			name:         "the cart the line is in",
+			prepare:      func(c carts) (uuid.UUID, int64) { return c.repo.cart.ID, 3 },
+			wantCart:     func(c carts) uuid.UUID { return c.repo.cart.ID },
+			wantQuantity: 2,
+		},
+		{
+			name:          "another cart",
+			prepare:       func(c carts) (uuid.UUID, int64) { return c.warehouse.ID, 3 },
+			wantCart:      func(c carts) uuid.UUID { return c.warehouse.ID },
+			wantQuantity:  2,
+			wantWarehouse: 2,
+		},
+		{
+			name: "another cart with the same line",
+			prepare: func(c carts) (uuid.UUID, int64) {
+				c.repo.add(&entity.CartItem{CartID: c.warehouse.ID, ProductID: productID, ProductQuantity: 5, Currency: "USD", List: entity.CartItemListCart})
+				return c.warehouse.ID, 0
+			},
+			wantCart:      func(c carts) uuid.UUID { return c.repo.cart.ID },
+			wantQuantity:  2,
+			wantDeleted:   entity.CartItemDeletedMerged,
+			wantWarehouse: 7,
+		},
+		{
+			name: "merged quantity above the maximum",
+			prepare: func(c carts) (uuid.UUID, int64) {
+				c.repo.add(&entity.CartItem{CartID: c.warehouse.ID, ProductID: productID, ProductQuantity: 9, Currency: "USD", List: entity.CartItemListCart})
+				return c.warehouse.ID, 0
+			},
+			wantErr: func(err error) bool { var validation *ValidationError; return errors.As(err, &validation) },
+		},
+		{
+			name: "cart in another currency",
+			prepare: func(c carts) (uuid.UUID, int64) {
+				c.warehouse.Currency = "EUR"
+				c.repo.add(&entity.CartItem{CartID: c.warehouse.ID, ProductID: uuid.New(), ProductQuantity: 1, Currency: "EUR", List: entity.CartItemListCart})
+				return c.warehouse.ID, 0
+			},
+			wantErr: func(err error) bool { return errors.Is(err, ErrCurrencyMismatch) },
+		},
+		{
+			name:    "unknown cart",
+			prepare: func(c carts) (uuid.UUID, int64) { return uuid.New(), 0 },
+			wantErr: func(err error) bool { return errors.Is(err, ErrCartNotFound) },
+		},
+		{
+			name:    "stale version",
+			prepare: func(c carts) (uuid.UUID, int64) { return c.warehouse.ID, 2 },
+			wantErr: func(err error) bool { var conflict *VersionConflictError; return errors.As(err, &conflict) },
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := setup()
+			cartID, version := tt.prepare(c)
+			uc := &CartUseCase{
+				repoMySQL:  c.repo,
+				repoOutbox: &fakeOutboxRepo{},
+				repoEvents: &fakeEventRepo{},
+				relay:      &fakeRelay{},
+				rules:      config.CartRules{MinQuantity: 1, MaxQuantity: 10},
+			}
+
+			_, err := uc.MoveItemToCart(context.Background(), userID, c.line.ID, version, cartID)
+			if tt.wantErr != nil {
+				if !tt.wantErr(err) {
+					t.Fatalf("MoveItemToCart() = %v, want a matching error", err)
+				}
+				if c.line.CartID != c.repo.cart.ID || c.repo.deleted[c.line.ID] != "" {
+					t.Error("a failed move changed the line")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("MoveItemToCart() = %v", err)
+			}
+
+			if got := c.repo.deleted[c.line.ID]; got != tt.wantDeleted {
+				t.Errorf("line deleted as %q, want %q", got, tt.wantDeleted)
+			}
+			if c.line.CartID != tt.wantCart(c) {
+				t.Errorf("line cart = %s, want %s", c.line.CartID, tt.wantCart(c))
+			}
+			if c.line.ProductQuantity != tt.wantQuantity {
+				t.Errorf("line quantity = %d, want %d", c.line.ProductQuantity, tt.wantQuantity)
+			}
+
+			var warehouse int64
+			for _, item := range c.repo.list(c.warehouse.ID, entity.CartItemListCart) {
+				warehouse += item.ProductQuantity
+			}
+			if warehouse != tt.wantWarehouse {
+				t.Errorf("warehouse cart quantity = %d, want %d", warehouse, tt.wantWarehouse)
+			}
+		})
+	}
+}
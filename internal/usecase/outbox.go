@@ -0,0 +1,141 @@
+package usecase
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/idoyudha/eshop-cart/config"
+	"github.com/idoyudha/eshop-cart/internal/entity"
+	"github.com/idoyudha/eshop-cart/pkg/logger"
+)
+
+const (
+	_outboxMinBackoff     = time.Second
+	_outboxMaxBackoff     = 5 * time.Minute
+	_outboxProcessTimeout = 10 * time.Second
+)
+
+// OutboxRelayUseCase applies the changes recorded in the outbox to redis and publishes its events,
+// retrying with backoff until redis or kafka accept them
+type OutboxRelayUseCase struct {
+	repoOutbox OutboxMySQLRepo
+	repoMySQL  CartMySQLRepo
+	repoRedis  CartRedisRepo
+	publisher  CartEventPublisher
+	cfg        config.Outbox
+	l          logger.Interface
+}
+
+func NewOutboxRelayUseCase(
+	repoOutbox OutboxMySQLRepo,
+	repoMySQL CartMySQLRepo,
+	repoRedis CartRedisRepo,
+	publisher CartEventPublisher,
+	cfg config.Outbox,
+	l logger.Interface,
+) *OutboxRelayUseCase {
+	return &OutboxRelayUseCase{
+		repoOutbox,
+		repoMySQL,
+		repoRedis,
+		publisher,
+		cfg,
+		l,
+	}
+}
+
+// Dispatch applies freshly committed events, failures are left to Run
+func (u *OutboxRelayUseCase) Dispatch(ctx context.Context, events ...*entity.OutboxEvent) {
+	// the mysql change is committed, finish it even if the caller goes away
+	ctx = context.WithoutCancel(ctx)
+
+	for _, event := range events {
+		u.process(ctx, event)
+	}
+}
+
+// Run relays the pending events until ctx is done
+func (u *OutboxRelayUseCase) Run(ctx context.Context) {
+	ticker := time.NewTicker(u.cfg.RelayInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			u.relayPending(ctx)
+		}
+	}
+}
+
+func (u *OutboxRelayUseCase) relayPending(ctx context.Context) {
+	events, err := u.repoOutbox.ClaimPending(ctx, u.cfg.BatchSize, entity.OutboxLease)
+	if err != nil {
+		u.l.Error(err, "usecase - OutboxRelayUseCase - relayPending - ClaimPending")
+		return
+	}
+
+	for _, event := range events {
+		u.process(ctx, event)
+	}
+
+	if _, err := u.repoOutbox.DeleteProcessedBefore(ctx, time.Now().Add(-u.cfg.Retention)); err != nil {
+		u.l.Error(err, "usecase - OutboxRelayUseCase - relayPending - DeleteProcessedBefore")
+	}
+}
+
+func (u *OutboxRelayUseCase) process(ctx context.Context, event *entity.OutboxEvent) {
+	applyCtx, cancel := context.WithTimeout(ctx, _outboxProcessTimeout)
+	defer cancel()
+
+	if errApply := u.apply(applyCtx, event); errApply != nil {
+		u.l.Warn("usecase - OutboxRelayUseCase - process - event %s attempt %d: %s", event.ID, event.Attempts+1, errApply)
+
+		nextAttemptAt := time.Now().Add(outboxBackoff(event.Attempts))
+		if err := u.repoOutbox.MarkFailed(ctx, event.ID, errApply.Error(), nextAttemptAt); err != nil {
+			u.l.Error(err, "usecase - OutboxRelayUseCase - process - MarkFailed")
+		}
+		return
+	}
+
+	if err := u.repoOutbox.MarkProcessed(ctx, event.ID); err != nil {
+		u.l.Error(err, "usecase - OutboxRelayUseCase - process - MarkProcessed")
+	}
+}
+
+// apply must be idempotent, an event can be applied more than once
+func (u *OutboxRelayUseCase) apply(ctx context.Context, event *entity.OutboxEvent) error {
+	switch event.EventType {
+	case entity.OutboxEventCartChanged:
+		cart, err := u.repoMySQL.GetByUserID(ctx, event.AggregateID)
+		if err != nil {
+			return fmt.Errorf("failed to get cart: %w", err)
+		}
+
+		return u.repoRedis.ReplaceCart(ctx, event.AggregateID.String(), cart)
+	case entity.OutboxEventProductChanged:
+		var payload entity.ProductChangedPayload
+		if err := json.Unmarshal(event.Payload, &payload); err != nil {
+			return fmt.Errorf("failed to unmarshal payload: %w", err)
+		}
+
+		return u.repoRedis.UpdateNameAndPrice(ctx, &entity.CartItem{
+			ProductID:    event.AggregateID,
+			ProductName:  payload.ProductName,
+			ProductPrice: payload.ProductPrice,
+			Currency:     payload.Currency,
+		})
+	case entity.OutboxEventCartAbandoned:
+		return u.publisher.PublishCartAbandoned(ctx, event.AggregateID, event.Payload)
+	default:
+		return fmt.Errorf("unknown outbox event type: %s", event.EventType)
+	}
+}
+
+func outboxBackoff(attempts int) time.Duration {
+	backoff := _outboxMinBackoff << min(attempts, 16)
+	return min(backoff, _outboxMaxBackoff)
+}
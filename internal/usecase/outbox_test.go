@@ -0,0 +1,186 @@
+package usecase
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/idoyudha/eshop-cart/config"
+	"github.com/idoyudha/eshop-cart/internal/entity"
+	"github.com/idoyudha/eshop-cart/pkg/logger"
+)
+
+// relayOutboxRepo hands out pending once and records how every event ended
+type relayOutboxRepo struct {
+	OutboxMySQLRepo
+	pending    []*entity.OutboxEvent
+	claimErr   error
+	processed  []uuid.UUID
+	failed     map[uuid.UUID]time.Time
+	lastErrors map[uuid.UUID]string
+	purged     bool
+}
+
+func (f *relayOutboxRepo) ClaimPending(context.Context, int, time.Duration) ([]*entity.OutboxEvent, error) {
+	events := f.pending
+	f.pending = nil
+	return events, f.claimErr
+}
+
+func (f *relayOutboxRepo) MarkProcessed(_ context.Context, eventID uuid.UUID) error {
+	f.processed = append(f.processed, eventID)
+	return nil
+}
+
+func (f *relayOutboxRepo) MarkFailed(_ context.Context, eventID uuid.UUID, lastError string, nextAttemptAt time.Time) error {
+	f.failed[eventID] = nextAttemptAt
+	f.lastErrors[eventID] = lastError
+	return nil
+}
+
+func (f *relayOutboxRepo) DeleteProcessedBefore(context.Context, time.Time) (int64, error) {
+	f.purged = true
+	return 0, nil
+}
+
+func newTestRelay(cart *entity.Cart, pending ...*entity.OutboxEvent) (*OutboxRelayUseCase, *relayOutboxRepo, *fakeCartRedisRepo) {
+	outbox := &relayOutboxRepo{pending: pending, failed: make(map[uuid.UUID]time.Time), lastErrors: make(map[uuid.UUID]string)}
+	redis := newFakeCartRedisRepo()
+	relay := NewOutboxRelayUseCase(outbox, newFakeCartRepo(cart), redis, nil, config.Outbox{BatchSize: 10, Retention: time.Hour}, logger.New("error"))
+	return relay, outbox, redis
+}
+
+func TestRelayPending(t *testing.T) {
+	userID := uuid.New()
+	cart := &entity.Cart{ID: uuid.New(), UserID: userID, Default: true, Currency: "USD"}
+
+	cartChanged, _ := entity.NewCartChangedEvent(userID)
+	productChanged, _ := entity.NewProductChangedEvent(&entity.CartItem{ProductID: uuid.New(), ProductName: "mug", ProductPrice: 1500, Currency: "USD"})
+	unknown := &entity.OutboxEvent{ID: uuid.New(), AggregateID: userID, EventType: "cart.renamed", Attempts: 2}
+	malformed := &entity.OutboxEvent{ID: uuid.New(), AggregateID: uuid.New(), EventType: entity.OutboxEventProductChanged, Payload: []byte("{"), Attempts: 20}
+
+	relay, outbox, redis := newTestRelay(cart, cartChanged, productChanged, unknown, malformed)
+	before := time.Now()
+	relay.relayPending(context.Background())
+
+	if len(outbox.processed) != 2 || outbox.processed[0] != cartChanged.ID || outbox.processed[1] != productChanged.ID {
+		t.Errorf("processed %v, want the cart and product events", outbox.processed)
+	}
+	if got := redis.replaced[userID.String()]; got == nil || got.ID != cart.ID {
+		t.Errorf("replaced cart = %v, want the mysql cart", got)
+	}
+	if len(redis.products) != 1 || redis.products[0].ProductPrice != 1500 || redis.products[0].Currency != "USD" {
+		t.Errorf("updated products = %v, want the price of the event", redis.products)
+	}
+
+	// failed events are retried after a backoff growing with their attempts, capped at the maximum
+	for _, tt := range []struct {
+		event *entity.OutboxEvent
+		delay time.Duration
+	}{
+		{event: unknown, delay: 4 * time.Second},
+		{event: malformed, delay: _outboxMaxBackoff},
+	} {
+		next, ok := outbox.failed[tt.event.ID]
+		if !ok {
+			t.Errorf("event %s was not marked failed", tt.event.EventType)
+			continue
+		}
+		if next.Before(before.Add(tt.delay)) || next.After(time.Now().Add(tt.delay)) {
+			t.Errorf("event %s retried at %s, want %s from now", tt.event.EventType, next.Sub(before), tt.delay)
+		}
+		if outbox.lastErrors[tt.event.ID] == "" {
+			t.Errorf("event %s failed without its error", tt.event.EventType)
+		}
+	}
+
+	if !outbox.purged {
+		t.Error("processed events were not purged")
+	}
+}
+
+func TestRelayPendingRedisDown(t *testing.T) {
+	userID := uuid.New()
+	event, _ := entity.NewCartChangedEvent(userID)
+
+	relay, outbox, redis := newTestRelay(&entity.Cart{ID: uuid.New(), UserID: userID}, event)
+	redis.err = errors.New("redis down")
+	relay.relayPending(context.Background())
+
+	if len(outbox.processed) != 0 {
+		t.Errorf("processed %v while redis is down", outbox.processed)
+	}
+	if _, ok := outbox.failed[event.ID]; !ok || outbox.lastErrors[event.ID] != "redis down" {
+		t.Errorf("event failed = %v with %q, want it failed with the redis error", ok, outbox.lastErrors[event.ID])
+	}
+}
+
+func TestRelayPendingClaimError(t *testing.T) {
+	event, _ := entity.NewCartChangedEvent(uuid.New())
+
+	relay, outbox, redis := newTestRelay(nil, event)
+	outbox.claimErr = errors.New("lock wait timeout")
+	relay.relayPending(context.Background())
+
+	if len(outbox.processed) != 0 || len(outbox.failed) != 0 || len(redis.replaced) != 0 || outbox.purged {
+		t.Error("a failed claim applied or purged events")
+	}
+}
+
+func TestOutboxBackoff(t *testing.T) {
+	tests := []struct {
+		attempts int
+		want     time.Duration
+	}{
+		{attempts: 0, want: time.Second},
+		{attempts: 1, want: 2 * time.Second},
+		{attempts: 8, want: 256 * time.Second},
+		{attempts: 9, want: _outboxMaxBackoff},
+		{attempts: 64, want: _outboxMaxBackoff},
+	}
+
+	for _, tt := range tests {
+		if got := outboxBackoff(tt.attempts); got != tt.want {
+			t.Errorf("outboxBackoff(%d) = %s, want %s", tt.attempts, got, tt.want)
+		}
+	}
+}
+
+// every cart change moves the cache version of its user, so the relay can tell an older snapshot from a newer one
+func TestMutateCountsCartChanges(t *testing.T) {
+	userEvent, _ := entity.NewCartChangedEvent(uuid.New())
+	guestEvent, _ := entity.NewCartChangedEvent(uuid.New())
+	productEvent, _ := entity.NewProductChangedEvent(&entity.CartItem{ProductID: uuid.New()})
+	payload, _ := json.Marshal(entity.CartAbandonedPayload{})
+	abandonedEvent := &entity.OutboxEvent{ID: uuid.New(), EventType: entity.OutboxEventCartAbandoned, Payload: payload}
+
+	tests := []struct {
+		name   string
+		events []*entity.OutboxEvent
+		fnErr  error
+		want   int64
+	}{
+		{name: "one cart", events: []*entity.OutboxEvent{userEvent}, want: 1},
+		{name: "guest merge", events: []*entity.OutboxEvent{userEvent, guestEvent}, want: 2},
+		{name: "no cart change", events: []*entity.OutboxEvent{productEvent, abandonedEvent}, want: 0},
+		{name: "failed change", events: []*entity.OutboxEvent{userEvent}, fnErr: errors.New("deadlock"), want: 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			repo := newFakeCartRepo(nil)
+			uc := &CartUseCase{repoMySQL: repo, repoOutbox: &fakeOutboxRepo{}, relay: &fakeRelay{}}
+
+			err := uc.mutateMany(context.Background(), tt.events, func(context.Context) error { return tt.fnErr })
+			if !errors.Is(err, tt.fnErr) {
+				t.Fatalf("mutateMany() = %v, want %v", err, tt.fnErr)
+			}
+			if repo.versions != tt.want {
+				t.Errorf("cache versions = %d, want %d", repo.versions, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,193 @@
+package usecase
+
+import (
+	"context"
+	"expvar"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/idoyudha/eshop-cart/config"
+	"github.com/idoyudha/eshop-cart/internal/entity"
+	"github.com/idoyudha/eshop-cart/pkg/logger"
+)
+
+// counters of every reconciliation run of this process, exposed on /debug/vars
+var reconcileMetrics = expvar.NewMap("cart_reconcile")
+
+// ReconcileUseCase compares the carts cached in redis with mysql and optionally repairs redis
+type ReconcileUseCase struct {
+	repoMySQL CartMySQLRepo
+	repoRedis CartRedisRepo
+	cfg       config.Reconcile
+	l         logger.Interface
+}
+
+func NewReconcileUseCase(
+	repoMySQL CartMySQLRepo,
+	repoRedis CartRedisRepo,
+	cfg config.Reconcile,
+	l logger.Interface,
+) *ReconcileUseCase {
+	return &ReconcileUseCase{
+		repoMySQL,
+		repoRedis,
+		cfg,
+		l,
+	}
+}
+
+// Run reconciles every cfg.Interval until ctx is done, a zero interval disables it
+func (u *ReconcileUseCase) Run(ctx context.Context) {
+	if u.cfg.Interval <= 0 {
+		return
+	}
+
+	ticker := time.NewTicker(u.cfg.Interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if _, err := u.Reconcile(ctx, u.cfg.Repair); err != nil {
+				u.l.Error(err, "usecase - ReconcileUseCase - Run - Reconcile")
+			}
+		}
+	}
+}
+
+// Reconcile walks every user cart in mysql and reports how its cached copy differs.
+// carts that are not cached are skipped, with repair the drifted ones are rewritten from mysql.
+func (u *ReconcileUseCase) Reconcile(ctx context.Context, repair bool) (entity.ReconcileReport, error) {
+	var report entity.ReconcileReport
+	reconcileMetrics.Add("runs", 1)
+
+	afterUserID := uuid.Nil
+	for {
+		userIDs, err := u.repoMySQL.GetUserIDs(ctx, afterUserID, u.cfg.BatchSize)
+		if err != nil {
+			return report, fmt.Errorf("failed to get user ids: %w", err)
+		}
+
+		for _, userID := range userIDs {
+			if err := u.reconcileUser(ctx, userID, repair, &report); err != nil {
+				return report, err
+			}
+		}
+
+		if len(userIDs) == 0 || len(userIDs) < u.cfg.BatchSize {
+			break
+		}
+		afterUserID = userIDs[len(userIDs)-1]
+	}
+
+	for kind, count := range report.CountByKind() {
+		reconcileMetrics.Add(kind, int64(count))
+	}
+	reconcileMetrics.Add("users_checked", int64(report.UsersChecked))
+	reconcileMetrics.Add("carts_drifted", int64(report.CartsDrifted))
+	reconcileMetrics.Add("carts_repaired", int64(report.CartsRepaired))
+
+	u.l.Info("reconciled %d carts, %d drifted, %d repaired, drifts: %v",
+		report.UsersChecked, report.CartsDrifted, report.CartsRepaired, report.CountByKind())
+
+	return report, nil
+}
+
+func (u *ReconcileUseCase) reconcileUser(ctx context.Context, userID uuid.UUID, repair bool, report *entity.ReconcileReport) error {
+	cached, err := u.repoRedis.GetUserCart(ctx, userID.String())
+	if err != nil {
+		return err
+	}
+
+	// nothing cached, the next read loads it from mysql
+	if cached == nil {
+		return nil
+	}
+
+	cart, err := u.repoMySQL.GetByUserID(ctx, userID)
+	if err != nil {
+		return fmt.Errorf("failed to get cart of user %s: %w", userID, err)
+	}
+
+	report.UsersChecked++
+
+	drifts := diffCarts(userID, cart, cached)
+	if len(drifts) == 0 {
+		return nil
+	}
+
+	report.CartsDrifted++
+	report.Drifts = append(report.Drifts, drifts...)
+	for _, drift := range drifts {
+		u.l.Warn("usecase - ReconcileUseCase - user %s item %s: %s mysql=%q redis=%q",
+			drift.UserID, drift.ItemID, drift.Kind, drift.MySQL, drift.Redis)
+	}
+
+	if !repair {
+		return nil
+	}
+
+	if err := u.repoRedis.ReplaceCart(ctx, userID.String(), cart); err != nil {
+		return err
+	}
+	report.CartsRepaired++
+
+	return nil
+}
+
+// diffCarts lists the differences between the mysql cart and its cached copy, lines are matched by id
+func diffCarts(userID uuid.UUID, source *entity.Cart, cached *entity.Cart) []entity.CartDrift {
+	var drifts []entity.CartDrift
+
+	cachedItems := make(map[uuid.UUID]*entity.CartItem, len(cached.Items))
+	for _, item := range cached.Items {
+		cachedItems[item.ID] = item
+	}
+
+	var sourceItems []*entity.CartItem
+	if source != nil {
+		sourceItems = source.Items
+	}
+
+	for _, item := range sourceItems {
+		cachedItem, ok := cachedItems[item.ID]
+		if !ok {
+			drifts = append(drifts, newCartDrift(userID, item, entity.DriftMissingLine, item.ID.String(), ""))
+			continue
+		}
+		delete(cachedItems, item.ID)
+
+		if item.ProductQuantity != cachedItem.ProductQuantity {
+			drifts = append(drifts, newCartDrift(userID, item, entity.DriftQuantityMismatch,
+				strconv.FormatInt(item.ProductQuantity, 10), strconv.FormatInt(cachedItem.ProductQuantity, 10)))
+		}
+		if item.ProductPrice != cachedItem.ProductPrice || item.Currency != cachedItem.Currency {
+			drifts = append(drifts, newCartDrift(userID, item, entity.DriftPriceMismatch,
+				fmt.Sprintf("%d %s", item.ProductPrice, item.Currency), fmt.Sprintf("%d %s", cachedItem.ProductPrice, cachedItem.Currency)))
+		}
+		if item.Note != cachedItem.Note {
+			drifts = append(drifts, newCartDrift(userID, item, entity.DriftNoteMismatch, item.Note, cachedItem.Note))
+		}
+	}
+
+	for _, cachedItem := range cachedItems {
+		drifts = append(drifts, newCartDrift(userID, cachedItem, entity.DriftExtraLine, "", cachedItem.ID.String()))
+	}
+
+	return drifts
+}
+
+func newCartDrift(userID uuid.UUID, item *entity.CartItem, kind string, mysqlValue string, redisValue string) entity.CartDrift {
+	return entity.CartDrift{
+		UserID:    userID,
+		ItemID:    item.ID,
+		ProductID: item.ProductID,
+		Kind:      kind,
+		MySQL:     mysqlValue,
+		Redis:     redisValue,
+	}
+}
@@ -0,0 +1,164 @@
+package usecase
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"sort"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/idoyudha/eshop-cart/config"
+	"github.com/idoyudha/eshop-cart/internal/entity"
+	"github.com/idoyudha/eshop-cart/pkg/logger"
+)
+
+// reconcileMySQLRepo holds the default carts of many users
+type reconcileMySQLRepo struct {
+	CartMySQLRepo
+	carts     map[uuid.UUID]*entity.Cart
+	userIDErr error
+}
+
+func (f *reconcileMySQLRepo) GetUserIDs(_ context.Context, after uuid.UUID, limit int) (uuid.UUIDs, error) {
+	if f.userIDErr != nil {
+		return nil, f.userIDErr
+	}
+
+	userIDs := make(uuid.UUIDs, 0, len(f.carts))
+	for userID := range f.carts {
+		if bytes.Compare(userID[:], after[:]) > 0 {
+			userIDs = append(userIDs, userID)
+		}
+	}
+	sort.Slice(userIDs, func(i, j int) bool { return bytes.Compare(userIDs[i][:], userIDs[j][:]) < 0 })
+	return userIDs[:min(limit, len(userIDs))], nil
+}
+
+func (f *reconcileMySQLRepo) GetByUserID(_ context.Context, userID uuid.UUID) (*entity.Cart, error) {
+	return f.carts[userID], nil
+}
+
+func TestDiffCarts(t *testing.T) {
+	userID := uuid.New()
+	line := &entity.CartItem{ID: uuid.New(), ProductID: uuid.New(), ProductQuantity: 2, ProductPrice: 1000, Currency: "USD", Note: "gift"}
+	with := func(change func(item *entity.CartItem)) *entity.Cart {
+		item := *line
+		change(&item)
+		return &entity.Cart{Items: []*entity.CartItem{&item}}
+	}
+	source := &entity.Cart{Items: []*entity.CartItem{line}}
+
+	tests := []struct {
+		name   string
+		source *entity.Cart
+		cached *entity.Cart
+		want   []string
+	}{
+		{name: "in sync", source: source, cached: with(func(*entity.CartItem) {})},
+		{name: "line missing in redis", source: source, cached: &entity.Cart{}, want: []string{entity.DriftMissingLine}},
+		{name: "line only in redis", source: &entity.Cart{}, cached: with(func(*entity.CartItem) {}), want: []string{entity.DriftExtraLine}},
+		{name: "cart gone from mysql", cached: with(func(*entity.CartItem) {}), want: []string{entity.DriftExtraLine}},
+		{name: "quantity", source: source, cached: with(func(item *entity.CartItem) { item.ProductQuantity = 3 }), want: []string{entity.DriftQuantityMismatch}},
+		{name: "price", source: source, cached: with(func(item *entity.CartItem) { item.ProductPrice = 900 }), want: []string{entity.DriftPriceMismatch}},
+		{name: "currency", source: source, cached: with(func(item *entity.CartItem) { item.Currency = "EUR" }), want: []string{entity.DriftPriceMismatch}},
+		{
+			name:   "quantity and note",
+			source: source,
+			cached: with(func(item *entity.CartItem) { item.ProductQuantity = 1; item.Note = "" }),
+			want:   []string{entity.DriftQuantityMismatch, entity.DriftNoteMismatch},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			drifts := diffCarts(userID, tt.source, tt.cached)
+			if len(drifts) != len(tt.want) {
+				t.Fatalf("diffCarts() = %v, want kinds %v", drifts, tt.want)
+			}
+			for i, drift := range drifts {
+				if drift.Kind != tt.want[i] || drift.UserID != userID || drift.ItemID != line.ID {
+					t.Errorf("drift %d = %s of item %s, want %s of item %s", i, drift.Kind, drift.ItemID, tt.want[i], line.ID)
+				}
+			}
+		})
+	}
+}
+
+func TestReconcile(t *testing.T) {
+	newCart := func(quantity int64) *entity.Cart {
+		userID := uuid.New()
+		return &entity.Cart{ID: uuid.New(), UserID: userID, Items: []*entity.CartItem{{ID: uuid.New(), UserID: userID, ProductQuantity: quantity, Currency: "USD"}}}
+	}
+	cachedWith := func(cart *entity.Cart, quantity int64) *entity.Cart {
+		item := *cart.Items[0]
+		item.ProductQuantity = quantity
+		cached := *cart
+		cached.Items = []*entity.CartItem{&item}
+		return &cached
+	}
+
+	for _, repair := range []bool{false, true} {
+		// five users over pages of two: two in sync, one drifted, two not cached
+		inSync, inSyncToo, drifted, notCached, notCachedToo := newCart(1), newCart(2), newCart(3), newCart(4), newCart(5)
+		mysql := &reconcileMySQLRepo{carts: make(map[uuid.UUID]*entity.Cart)}
+		for _, cart := range []*entity.Cart{inSync, inSyncToo, drifted, notCached, notCachedToo} {
+			mysql.carts[cart.UserID] = cart
+		}
+		redis := newFakeCartRedisRepo()
+		redis.carts[inSync.UserID.String()] = cachedWith(inSync, 1)
+		redis.carts[inSyncToo.UserID.String()] = cachedWith(inSyncToo, 2)
+		redis.carts[drifted.UserID.String()] = cachedWith(drifted, 7)
+
+		uc := NewReconcileUseCase(mysql, redis, config.Reconcile{BatchSize: 2}, logger.New("error"))
+		report, err := uc.Reconcile(context.Background(), repair)
+		if err != nil {
+			t.Fatalf("Reconcile(%v) = %v", repair, err)
+		}
+
+		wantRepaired := 0
+		if repair {
+			wantRepaired = 1
+		}
+		if report.UsersChecked != 3 || report.CartsDrifted != 1 || report.CartsRepaired != wantRepaired {
+			t.Errorf("Reconcile(%v) checked %d, drifted %d, repaired %d, want 3, 1, %d", repair, report.UsersChecked, report.CartsDrifted, report.CartsRepaired, wantRepaired)
+		}
+		if counts := report.CountByKind(); len(counts) != 1 || counts[entity.DriftQuantityMismatch] != 1 {
+			t.Errorf("Reconcile(%v) drifts = %v, want one quantity mismatch", repair, counts)
+		}
+
+		if len(redis.replaced) != wantRepaired {
+			t.Errorf("Reconcile(%v) rewrote %d carts, want %d", repair, len(redis.replaced), wantRepaired)
+		}
+		if repair && redis.carts[drifted.UserID.String()].Items[0].ProductQuantity != 3 {
+			t.Error("the drifted cart was not rewritten from mysql")
+		}
+	}
+}
+
+func TestReconcileErrors(t *testing.T) {
+	errDown := errors.New("down")
+
+	tests := []struct {
+		name      string
+		userIDErr error
+		redisErr  error
+	}{
+		{name: "mysql down", userIDErr: errDown},
+		{name: "redis down", redisErr: errDown},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			userID := uuid.New()
+			mysql := &reconcileMySQLRepo{carts: map[uuid.UUID]*entity.Cart{userID: {UserID: userID}}, userIDErr: tt.userIDErr}
+			redis := newFakeCartRedisRepo()
+			redis.err = tt.redisErr
+
+			uc := NewReconcileUseCase(mysql, redis, config.Reconcile{BatchSize: 10}, logger.New("error"))
+			if _, err := uc.Reconcile(context.Background(), true); !errors.Is(err, errDown) {
+				t.Errorf("Reconcile() = %v, want %v", err, errDown)
+			}
+		})
+	}
+}
@@ -0,0 +1,86 @@
+package repo
+
+import (
+	"context"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/idoyudha/eshop-cart/internal/entity"
+	mysqlClient "github.com/idoyudha/eshop-cart/pkg/mysql"
+)
+
+type AbandonedCartMySQLRepo struct {
+	*mysqlClient.MySQL
+}
+
+func NewAbandonedCartMySQLRepo(client *mysqlClient.MySQL) *AbandonedCartMySQLRepo {
+	return &AbandonedCartMySQLRepo{
+		client,
+	}
+}
+
+// carts of signed in users with active lines, idle since before the threshold
+// and not notified yet for their current inactivity
+const getAbandonedCartsQuery = `SELECT c.id, c.user_id, MAX(ci.updated_at) AS last_activity_at
+FROM carts c
+JOIN cart_items ci ON ci.cart_id = c.id AND ci.list_type = 'cart' AND ci.deleted_at IS NULL
+LEFT JOIN cart_abandoned_notifications n ON n.cart_id = c.id
+WHERE c.guest = FALSE AND c.id > ?
+GROUP BY c.id, c.user_id, n.last_activity_at
+HAVING MAX(ci.updated_at) < ? AND (n.last_activity_at IS NULL OR MAX(ci.updated_at) > n.last_activity_at)
+ORDER BY c.id
+LIMIT ?`
+
+// GetAbandoned pages through the abandoned carts ordered by cart id after afterCartID
+func (r *AbandonedCartMySQLRepo) GetAbandoned(ctx context.Context, idleBefore time.Time, afterCartID uuid.UUID, limit int) ([]entity.AbandonedCart, error) {
+	stmt, errStmt := r.Executor(ctx).PrepareContext(ctx, getAbandonedCartsQuery)
+	if errStmt != nil {
+		return nil, errStmt
+	}
+	defer stmt.Close()
+
+	rows, err := stmt.QueryContext(ctx, afterCartID, idleBefore, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	carts := make([]entity.AbandonedCart, 0, limit)
+	for rows.Next() {
+		var cart entity.AbandonedCart
+		if err := rows.Scan(&cart.CartID, &cart.UserID, &cart.LastActivityAt); err != nil {
+			return nil, err
+		}
+		carts = append(carts, cart)
+	}
+
+	return carts, rows.Err()
+}
+
+// notified_at is assigned before last_activity_at, so it compares against the previous activity
+const queryMarkCartNotified = `INSERT INTO cart_abandoned_notifications (cart_id, user_id, last_activity_at, notified_at) VALUES (?, ?, ?, ?)
+ON DUPLICATE KEY UPDATE
+	notified_at = IF(last_activity_at < VALUES(last_activity_at), VALUES(notified_at), notified_at),
+	last_activity_at = GREATEST(last_activity_at, VALUES(last_activity_at))`
+
+// MarkNotified records the notification of the cart for its current inactivity.
+// it returns false when the cart was already notified for it, e.g. by another instance
+func (r *AbandonedCartMySQLRepo) MarkNotified(ctx context.Context, cart entity.AbandonedCart, notifiedAt time.Time) (bool, error) {
+	stmt, errStmt := r.Executor(ctx).PrepareContext(ctx, queryMarkCartNotified)
+	if errStmt != nil {
+		return false, errStmt
+	}
+	defer stmt.Close()
+
+	result, err := stmt.ExecContext(ctx, cart.CartID, cart.UserID, cart.LastActivityAt, notifiedAt)
+	if err != nil {
+		return false, err
+	}
+
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+
+	return affected > 0, nil
+}
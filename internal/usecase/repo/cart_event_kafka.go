@@ -0,0 +1,23 @@
+package repo
+
+import (
+	"context"
+
+	"github.com/google/uuid"
+	"github.com/idoyudha/eshop-cart/pkg/kafka"
+)
+
+type CartEventKafkaRepo struct {
+	*kafka.ProducerServer
+}
+
+func NewCartEventKafkaRepo(producer *kafka.ProducerServer) *CartEventKafkaRepo {
+	return &CartEventKafkaRepo{
+		producer,
+	}
+}
+
+// PublishCartAbandoned sends the cart-abandoned event keyed by user, so events of a user stay in order
+func (r *CartEventKafkaRepo) PublishCartAbandoned(ctx context.Context, userID uuid.UUID, payload []byte) error {
+	return r.Produce(ctx, kafka.CartAbandonedTopic, []byte(userID.String()), payload)
+}
@@ -0,0 +1,114 @@
+package repo
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+
+	"github.com/google/uuid"
+	"github.com/idoyudha/eshop-cart/internal/entity"
+	mysqlClient "github.com/idoyudha/eshop-cart/pkg/mysql"
+)
+
+// CartEventMySQLRepo is append only, events are never updated or deleted
+type CartEventMySQLRepo struct {
+	*mysqlClient.MySQL
+}
+
+func NewCartEventMySQLRepo(client *mysqlClient.MySQL) *CartEventMySQLRepo {
+	return &CartEventMySQLRepo{
+		client,
+	}
+}
+
+const queryInsertCartEvent = `INSERT INTO cart_events (id, cart_id, user_id, item_id, event_type, actor, source, before_snapshot, after_snapshot, created_at) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?);`
+
+func (r *CartEventMySQLRepo) Insert(ctx context.Context, event *entity.CartEvent) error {
+	before, errBefore := marshalSnapshot(event.Before)
+	if errBefore != nil {
+		return errBefore
+	}
+
+	after, errAfter := marshalSnapshot(event.After)
+	if errAfter != nil {
+		return errAfter
+	}
+
+	stmt, errStmt := r.Executor(ctx).PrepareContext(ctx, queryInsertCartEvent)
+	if errStmt != nil {
+		return errStmt
+	}
+	defer stmt.Close()
+
+	_, insertErr := stmt.ExecContext(ctx, event.ID, event.CartID, event.UserID, event.ItemID, event.EventType, event.Actor, event.Source, before, after, event.CreatedAt)
+	if insertErr != nil {
+		return insertErr
+	}
+
+	return nil
+}
+
+const getCartEventsQueryByUserID = `SELECT id, cart_id, user_id, item_id, event_type, actor, source, before_snapshot, after_snapshot, created_at FROM cart_events WHERE user_id = ? AND id < ? ORDER BY id DESC LIMIT ?`
+
+// GetByUserID returns up to limit events of the user older than beforeID, newest first.
+// uuid.Max as beforeID starts from the newest event
+func (r *CartEventMySQLRepo) GetByUserID(ctx context.Context, userID uuid.UUID, beforeID uuid.UUID, limit int) ([]*entity.CartEvent, error) {
+	stmt, errStmt := r.Executor(ctx).PrepareContext(ctx, getCartEventsQueryByUserID)
+	if errStmt != nil {
+		return nil, errStmt
+	}
+	defer stmt.Close()
+
+	rows, err := stmt.QueryContext(ctx, userID, beforeID, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	events := make([]*entity.CartEvent, 0, limit)
+	for rows.Next() {
+		event := &entity.CartEvent{}
+		var before, after sql.NullString
+		err := rows.Scan(&event.ID, &event.CartID, &event.UserID, &event.ItemID, &event.EventType, &event.Actor, &event.Source, &before, &after, &event.CreatedAt)
+		if err != nil {
+			return nil, err
+		}
+
+		if event.Before, err = unmarshalSnapshot(before); err != nil {
+			return nil, err
+		}
+		if event.After, err = unmarshalSnapshot(after); err != nil {
+			return nil, err
+		}
+
+		events = append(events, event)
+	}
+
+	return events, rows.Err()
+}
+
+func marshalSnapshot(snapshot *entity.CartItemSnapshot) (sql.NullString, error) {
+	if snapshot == nil {
+		return sql.NullString{}, nil
+	}
+
+	value, err := json.Marshal(snapshot)
+	if err != nil {
+		return sql.NullString{}, err
+	}
+
+	return sql.NullString{String: string(value), Valid: true}, nil
+}
+
+func unmarshalSnapshot(value sql.NullString) (*entity.CartItemSnapshot, error) {
+	if !value.Valid {
+		return nil, nil
+	}
+
+	var snapshot entity.CartItemSnapshot
+	if err := json.Unmarshal([]byte(value.String), &snapshot); err != nil {
+		return nil, err
+	}
+
+	return &snapshot, nil
+}
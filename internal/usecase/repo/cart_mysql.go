@@ -2,9 +2,14 @@ package repo
 
 import (
 	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
 	"strings"
 	"time"
 
+	mysqlDriver "github.com/go-sql-driver/mysql"
 	"github.com/google/uuid"
 	"github.com/idoyudha/eshop-cart/internal/entity"
 	mysqlClient "github.com/idoyudha/eshop-cart/pkg/mysql"
@@ -20,27 +25,187 @@ func NewCartMySQLRepo(client *mysqlClient.MySQL) *CartMySQLRepo {
 	}
 }
 
-const queryInsertCart = `INSERT INTO carts (id, user_id, product_id, product_name, product_image_url, product_price, product_quantity, note, created_at, updated_at) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?);`
+// mysql error number of an insert or update that violates a unique key
+const mysqlErrDuplicateEntry = 1062
 
-func (r *CartMySQLRepo) Insert(ctx context.Context, cart *entity.Cart) error {
-	stmt, errStmt := r.Conn.PrepareContext(ctx, queryInsertCart)
+// duplicateError reports a unique key violation as entity.ErrAlreadyExists, other errors are returned as is
+func duplicateError(err error) error {
+	var mysqlErr *mysqlDriver.MySQLError
+	if errors.As(err, &mysqlErr) && mysqlErr.Number == mysqlErrDuplicateEntry {
+		return fmt.Errorf("%w: %s", entity.ErrAlreadyExists, mysqlErr.Message)
+	}
+	return err
+}
+
+const queryInsertCartHeader = `INSERT INTO carts (id, user_id, name, currency, status, guest, expires_at, created_at, updated_at) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?);`
+
+func (r *CartMySQLRepo) InsertCart(ctx context.Context, cart *entity.Cart) error {
+	stmt, errStmt := r.Executor(ctx).PrepareContext(ctx, queryInsertCartHeader)
 	if errStmt != nil {
 		return errStmt
 	}
 	defer stmt.Close()
 
-	_, insertErr := stmt.ExecContext(ctx, cart.ID, cart.UserID, cart.ProductID, cart.ProductName, cart.ProductImageURL, cart.ProductPrice, cart.ProductQuantity, cart.Note, cart.CreatedAt, cart.UpdatedAt)
+	var expiresAt sql.NullTime
+	if !cart.ExpiresAt.IsZero() {
+		expiresAt = sql.NullTime{Time: cart.ExpiresAt, Valid: true}
+	}
+
+	_, insertErr := stmt.ExecContext(ctx, cart.ID, cart.UserID, cart.Name, cart.Currency, cart.Status, cart.Guest, expiresAt, cart.CreatedAt, cart.UpdatedAt)
 	if insertErr != nil {
-		return insertErr
+		return duplicateError(insertErr)
+	}
+
+	return nil
+}
+
+const queryUpdateCartCurrency = `UPDATE carts SET currency = ?, updated_at = ? WHERE id = ?`
+
+func (r *CartMySQLRepo) UpdateCartCurrency(ctx context.Context, cartID uuid.UUID, currency string) error {
+	stmt, errStmt := r.Executor(ctx).PrepareContext(ctx, queryUpdateCartCurrency)
+	if errStmt != nil {
+		return errStmt
+	}
+	defer stmt.Close()
+
+	_, updateErr := stmt.ExecContext(ctx, currency, time.Now(), cartID)
+	if updateErr != nil {
+		return updateErr
 	}
 
 	return nil
 }
 
-const getCartsQueryByUserID = `SELECT id, user_id, product_id, product_name, product_image_url, product_price, product_quantity, note, created_at, updated_at FROM carts WHERE user_id = ? AND deleted_at IS NULL`
+const queryUpdateCartName = `UPDATE carts SET name = ?, updated_at = ? WHERE id = ? AND user_id = ?`
 
-func (r *CartMySQLRepo) GetByUserID(ctx context.Context, userID uuid.UUID) ([]*entity.Cart, error) {
-	stmt, errStmt := r.Conn.PrepareContext(ctx, getCartsQueryByUserID)
+func (r *CartMySQLRepo) UpdateCartName(ctx context.Context, cart *entity.Cart) error {
+	stmt, errStmt := r.Executor(ctx).PrepareContext(ctx, queryUpdateCartName)
+	if errStmt != nil {
+		return errStmt
+	}
+	defer stmt.Close()
+
+	_, updateErr := stmt.ExecContext(ctx, cart.Name, cart.UpdatedAt, cart.ID, cart.UserID)
+	if updateErr != nil {
+		return duplicateError(updateErr)
+	}
+
+	return nil
+}
+
+// statements removing a named cart, lines removed by the shopper before can no longer be restored
+// into it and its abandoned cart notification goes with it
+const (
+	queryRetireRemovedCartItems       = `UPDATE cart_items SET delete_reason = ? WHERE cart_id = ? AND user_id = ? AND delete_reason = 'removed'`
+	queryDeleteCartHeaderNotification = `DELETE FROM cart_abandoned_notifications WHERE cart_id = ? AND user_id = ?`
+	queryDeleteCartHeader             = `DELETE FROM carts WHERE id = ? AND user_id = ?`
+)
+
+// DeleteCartHeader removes the header of a named cart with what still points to it, its active lines must be deleted before
+func (r *CartMySQLRepo) DeleteCartHeader(ctx context.Context, userID uuid.UUID, cartID uuid.UUID) error {
+	deletes := []struct {
+		query string
+		args  []interface{}
+	}{
+		{queryRetireRemovedCartItems, []interface{}{entity.CartItemDeletedCart, cartID, userID}},
+		{queryDeleteCartHeaderNotification, []interface{}{cartID, userID}},
+		{queryDeleteCartHeader, []interface{}{cartID, userID}},
+	}
+
+	for _, del := range deletes {
+		stmt, errStmt := r.Executor(ctx).PrepareContext(ctx, del.query)
+		if errStmt != nil {
+			return errStmt
+		}
+		defer stmt.Close()
+
+		if _, err := stmt.ExecContext(ctx, del.args...); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+const querySetDefaultCart = `INSERT INTO user_default_carts (user_id, cart_id, updated_at) VALUES (?, ?, ?) ON DUPLICATE KEY UPDATE cart_id = VALUES(cart_id), updated_at = VALUES(updated_at)`
+
+// SetDefaultCart points the user to the cart used when no cart is selected
+func (r *CartMySQLRepo) SetDefaultCart(ctx context.Context, userID uuid.UUID, cartID uuid.UUID) error {
+	stmt, errStmt := r.Executor(ctx).PrepareContext(ctx, querySetDefaultCart)
+	if errStmt != nil {
+		return errStmt
+	}
+	defer stmt.Close()
+
+	_, upsertErr := stmt.ExecContext(ctx, userID, cartID, time.Now())
+	if upsertErr != nil {
+		return upsertErr
+	}
+
+	return nil
+}
+
+const cartHeaderColumns = `c.id, c.user_id, c.name, c.currency, c.status, c.guest, c.expires_at, c.created_at, c.updated_at, d.cart_id IS NOT NULL`
+
+func scanCartHeader(row rowScanner) (*entity.Cart, error) {
+	cart := &entity.Cart{}
+	var expiresAt sql.NullTime
+	err := row.Scan(&cart.ID, &cart.UserID, &cart.Name, &cart.Currency, &cart.Status, &cart.Guest, &expiresAt, &cart.CreatedAt, &cart.UpdatedAt, &cart.Default)
+	if err != nil {
+		return nil, err
+	}
+	cart.ExpiresAt = expiresAt.Time
+
+	return cart, nil
+}
+
+const getCartHeaderQueryByUserID = `SELECT ` + cartHeaderColumns + ` FROM carts c JOIN user_default_carts d ON d.cart_id = c.id WHERE d.user_id = ?`
+
+// GetCartByUserID returns the header of the default cart without its lines, nil if the user has no cart yet
+func (r *CartMySQLRepo) GetCartByUserID(ctx context.Context, userID uuid.UUID) (*entity.Cart, error) {
+	stmt, errStmt := r.Executor(ctx).PrepareContext(ctx, getCartHeaderQueryByUserID)
+	if errStmt != nil {
+		return nil, errStmt
+	}
+	defer stmt.Close()
+
+	cart, err := scanCartHeader(stmt.QueryRowContext(ctx, userID))
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return cart, nil
+}
+
+const getCartHeaderQueryByID = `SELECT ` + cartHeaderColumns + ` FROM carts c LEFT JOIN user_default_carts d ON d.cart_id = c.id WHERE c.id = ? AND c.user_id = ?`
+
+// GetCartByID returns the header of a cart of the user without its lines, nil if the user has no such cart
+func (r *CartMySQLRepo) GetCartByID(ctx context.Context, userID uuid.UUID, cartID uuid.UUID) (*entity.Cart, error) {
+	stmt, errStmt := r.Executor(ctx).PrepareContext(ctx, getCartHeaderQueryByID)
+	if errStmt != nil {
+		return nil, errStmt
+	}
+	defer stmt.Close()
+
+	cart, err := scanCartHeader(stmt.QueryRowContext(ctx, cartID, userID))
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return cart, nil
+}
+
+const getCartHeadersQueryByUserID = `SELECT ` + cartHeaderColumns + ` FROM carts c LEFT JOIN user_default_carts d ON d.cart_id = c.id WHERE c.user_id = ? ORDER BY c.created_at, c.id`
+
+// GetCartsByUserID returns the headers of every cart of the user, oldest first
+func (r *CartMySQLRepo) GetCartsByUserID(ctx context.Context, userID uuid.UUID) ([]*entity.Cart, error) {
+	stmt, errStmt := r.Executor(ctx).PrepareContext(ctx, getCartHeadersQueryByUserID)
 	if errStmt != nil {
 		return nil, errStmt
 	}
@@ -54,59 +219,494 @@ func (r *CartMySQLRepo) GetByUserID(ctx context.Context, userID uuid.UUID) ([]*e
 
 	carts := make([]*entity.Cart, 0)
 	for rows.Next() {
-		cart := &entity.Cart{}
-		err := rows.Scan(&cart.ID, &cart.UserID, &cart.ProductID, &cart.ProductName, &cart.ProductImageURL, &cart.ProductPrice, &cart.ProductQuantity, &cart.Note, &cart.CreatedAt, &cart.UpdatedAt)
+		cart, err := scanCartHeader(rows)
 		if err != nil {
-			continue
+			return nil, err
 		}
 		carts = append(carts, cart)
 	}
 
-	return carts, nil
+	return carts, rows.Err()
+}
+
+const getCartUserIDsQuery = `SELECT DISTINCT user_id FROM carts WHERE user_id > ? ORDER BY user_id LIMIT ?`
+
+// GetUserIDs pages through the users owning a cart, ordered by user id after afterUserID
+func (r *CartMySQLRepo) GetUserIDs(ctx context.Context, afterUserID uuid.UUID, limit int) (uuid.UUIDs, error) {
+	stmt, errStmt := r.Executor(ctx).PrepareContext(ctx, getCartUserIDsQuery)
+	if errStmt != nil {
+		return nil, errStmt
+	}
+	defer stmt.Close()
+
+	rows, err := stmt.QueryContext(ctx, afterUserID, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	userIDs := make(uuid.UUIDs, 0, limit)
+	for rows.Next() {
+		var userID uuid.UUID
+		if err := rows.Scan(&userID); err != nil {
+			return nil, err
+		}
+		userIDs = append(userIDs, userID)
+	}
+
+	return userIDs, rows.Err()
+}
+
+const cartItemColumns = `id, cart_id, user_id, product_id, variant_id, product_name, product_image_url, product_price, currency, product_quantity, note, options, options_hash, list_type, version, created_at, updated_at`
+
+type rowScanner interface {
+	Scan(dest ...any) error
+}
+
+func scanCartItem(row rowScanner) (*entity.CartItem, error) {
+	item := &entity.CartItem{}
+	var options sql.NullString
+	var optionsHash string
+	err := row.Scan(&item.ID, &item.CartID, &item.UserID, &item.ProductID, &item.VariantID, &item.ProductName, &item.ProductImageURL, &item.ProductPrice, &item.Currency, &item.ProductQuantity, &item.Note, &options, &optionsHash, &item.List, &item.Version, &item.CreatedAt, &item.UpdatedAt)
+	if err != nil {
+		return nil, err
+	}
+
+	item.Options, err = unmarshalOptions(options)
+	if err != nil {
+		return nil, err
+	}
+
+	return item, nil
+}
+
+// variant ids are stored as an empty string for products without variants so they take part in the line index
+func variantIDValue(variantID uuid.UUID) string {
+	if variantID == uuid.Nil {
+		return ""
+	}
+	return variantID.String()
+}
+
+func marshalOptions(options map[string]string) (sql.NullString, error) {
+	if len(options) == 0 {
+		return sql.NullString{}, nil
+	}
+
+	value, err := json.Marshal(options)
+	if err != nil {
+		return sql.NullString{}, err
+	}
+
+	return sql.NullString{String: string(value), Valid: true}, nil
+}
+
+func unmarshalOptions(value sql.NullString) (map[string]string, error) {
+	if !value.Valid || value.String == "" {
+		return nil, nil
+	}
+
+	var options map[string]string
+	if err := json.Unmarshal([]byte(value.String), &options); err != nil {
+		return nil, err
+	}
+
+	return options, nil
 }
 
-const queryUpdateQtyAndNoteCart = `UPDATE carts SET product_quantity = ?, note = ?, updated_at = ? WHERE id = ? AND user_id = ? AND deleted_at IS NULL`
-const querySelectUpdatedCart = `SELECT product_id FROM carts WHERE id = ? AND user_id = ? AND deleted_at IS NULL`
+const queryInsertCartItem = `INSERT INTO cart_items (` + cartItemColumns + `) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?);`
+
+func (r *CartMySQLRepo) Insert(ctx context.Context, item *entity.CartItem) error {
+	options, errOptions := marshalOptions(item.Options)
+	if errOptions != nil {
+		return errOptions
+	}
 
-func (r *CartMySQLRepo) UpdateQtyAndNote(ctx context.Context, cart *entity.Cart) (*uuid.UUID, error) {
-	stmt, errStmt := r.Conn.PrepareContext(ctx, queryUpdateQtyAndNoteCart)
+	stmt, errStmt := r.Executor(ctx).PrepareContext(ctx, queryInsertCartItem)
+	if errStmt != nil {
+		return errStmt
+	}
+	defer stmt.Close()
+
+	_, insertErr := stmt.ExecContext(ctx, item.ID, item.CartID, item.UserID, item.ProductID, variantIDValue(item.VariantID), item.ProductName, item.ProductImageURL, item.ProductPrice, item.Currency, item.ProductQuantity, item.Note, options, item.OptionsHash(), item.List, item.Version, item.CreatedAt, item.UpdatedAt)
+	if insertErr != nil {
+		return duplicateError(insertErr)
+	}
+
+	return nil
+}
+
+const getCartItemsQueryByCartID = `SELECT ` + cartItemColumns + ` FROM cart_items WHERE cart_id = ? AND list_type = 'cart' AND deleted_at IS NULL`
+
+// GetByUserID returns the default cart of the user with its active lines, nil if the user has no cart yet.
+// lines saved for later are not part of it, see GetItemsByList
+func (r *CartMySQLRepo) GetByUserID(ctx context.Context, userID uuid.UUID) (*entity.Cart, error) {
+	// read before the cart, a change committed in between makes the cart newer than its version but never older
+	version, err := r.getCacheVersion(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	cart, err := r.GetCartByUserID(ctx, userID)
+	if err != nil || cart == nil {
+		return nil, err
+	}
+	cart.CacheVersion = version
+
+	return cart, r.getCartItems(ctx, cart)
+}
+
+const queryGetCacheVersion = `SELECT version FROM cart_cache_versions WHERE user_id = ?`
+
+func (r *CartMySQLRepo) getCacheVersion(ctx context.Context, userID uuid.UUID) (int64, error) {
+	stmt, errStmt := r.Executor(ctx).PrepareContext(ctx, queryGetCacheVersion)
+	if errStmt != nil {
+		return 0, errStmt
+	}
+	defer stmt.Close()
+
+	var version int64
+	err := stmt.QueryRowContext(ctx, userID).Scan(&version)
+	if errors.Is(err, sql.ErrNoRows) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+
+	return version, nil
+}
+
+const queryIncrementCacheVersion = `INSERT INTO cart_cache_versions (user_id, version, updated_at) VALUES (?, 1, ?) ON DUPLICATE KEY UPDATE version = version + 1, updated_at = VALUES(updated_at)`
+
+// IncrementCacheVersion counts a change to the carts of the user, call it in the transaction of the change
+func (r *CartMySQLRepo) IncrementCacheVersion(ctx context.Context, userID uuid.UUID) error {
+	stmt, errStmt := r.Executor(ctx).PrepareContext(ctx, queryIncrementCacheVersion)
+	if errStmt != nil {
+		return errStmt
+	}
+	defer stmt.Close()
+
+	_, err := stmt.ExecContext(ctx, userID, time.Now())
+	return err
+}
+
+// GetByCartID is GetByUserID for any cart of the user, nil if the user has no such cart
+func (r *CartMySQLRepo) GetByCartID(ctx context.Context, userID uuid.UUID, cartID uuid.UUID) (*entity.Cart, error) {
+	cart, err := r.GetCartByID(ctx, userID, cartID)
+	if err != nil || cart == nil {
+		return nil, err
+	}
+
+	return cart, r.getCartItems(ctx, cart)
+}
+
+func (r *CartMySQLRepo) getCartItems(ctx context.Context, cart *entity.Cart) error {
+	stmt, errStmt := r.Executor(ctx).PrepareContext(ctx, getCartItemsQueryByCartID)
+	if errStmt != nil {
+		return errStmt
+	}
+	defer stmt.Close()
+
+	rows, err := stmt.QueryContext(ctx, cart.ID)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	cart.Items = make([]*entity.CartItem, 0)
+	for rows.Next() {
+		item, err := scanCartItem(rows)
+		if err != nil {
+			continue
+		}
+		cart.Items = append(cart.Items, item)
+	}
+
+	return nil
+}
+
+// GetItemsForUpdate returns the active lines of the cart locked for the running transaction,
+// the index range is locked as well so no line can be added to the cart until commit
+func (r *CartMySQLRepo) GetItemsForUpdate(ctx context.Context, cartID uuid.UUID) ([]*entity.CartItem, error) {
+	stmt, errStmt := r.Executor(ctx).PrepareContext(ctx, getCartItemsQueryByCartID+" FOR UPDATE")
+	if errStmt != nil {
+		return nil, errStmt
+	}
+	defer stmt.Close()
+
+	rows, err := stmt.QueryContext(ctx, cartID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	items := make([]*entity.CartItem, 0)
+	for rows.Next() {
+		item, err := scanCartItem(rows)
+		if err != nil {
+			return nil, err
+		}
+		items = append(items, item)
+	}
+
+	return items, rows.Err()
+}
+
+const getCartItemQueryByLine = `SELECT ` + cartItemColumns + ` FROM cart_items WHERE cart_id = ? AND product_id = ? AND variant_id = ? AND options_hash = ? AND list_type = ? AND deleted_at IS NULL FOR UPDATE`
+
+// GetItemByLine returns the active line with the same product, variant and options as line
+// in the given list of the cart, nil if there is none. inside a transaction the line stays locked until commit
+func (r *CartMySQLRepo) GetItemByLine(ctx context.Context, cartID uuid.UUID, line *entity.CartItem, list string) (*entity.CartItem, error) {
+	stmt, errStmt := r.Executor(ctx).PrepareContext(ctx, getCartItemQueryByLine)
 	if errStmt != nil {
 		return nil, errStmt
 	}
 	defer stmt.Close()
 
-	_, updateErr := stmt.ExecContext(ctx, cart.ProductQuantity, cart.Note, cart.UpdatedAt, cart.ID, cart.UserID)
+	item, err := scanCartItem(stmt.QueryRowContext(ctx, cartID, line.ProductID, variantIDValue(line.VariantID), line.OptionsHash(), list))
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return item, nil
+}
+
+const getCartItemQueryByID = `SELECT ` + cartItemColumns + ` FROM cart_items WHERE id = ? AND user_id = ? AND deleted_at IS NULL FOR UPDATE`
+
+// GetItemByID returns the active line of the user, nil if there is none.
+// inside a transaction the line stays locked until commit
+func (r *CartMySQLRepo) GetItemByID(ctx context.Context, userID uuid.UUID, itemID uuid.UUID) (*entity.CartItem, error) {
+	stmt, errStmt := r.Executor(ctx).PrepareContext(ctx, getCartItemQueryByID)
+	if errStmt != nil {
+		return nil, errStmt
+	}
+	defer stmt.Close()
+
+	item, err := scanCartItem(stmt.QueryRowContext(ctx, itemID, userID))
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return item, nil
+}
+
+const getCartItemsQueryByList = `SELECT ` + cartItemColumns + ` FROM cart_items WHERE cart_id = ? AND list_type = ? AND deleted_at IS NULL ORDER BY updated_at DESC`
+
+// GetItemsByList returns the active lines of the cart in the given list, most recently changed first
+func (r *CartMySQLRepo) GetItemsByList(ctx context.Context, cartID uuid.UUID, list string) ([]*entity.CartItem, error) {
+	stmt, errStmt := r.Executor(ctx).PrepareContext(ctx, getCartItemsQueryByList)
+	if errStmt != nil {
+		return nil, errStmt
+	}
+	defer stmt.Close()
+
+	rows, err := stmt.QueryContext(ctx, cartID, list)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	items := make([]*entity.CartItem, 0)
+	for rows.Next() {
+		item, err := scanCartItem(rows)
+		if err != nil {
+			return nil, err
+		}
+		items = append(items, item)
+	}
+
+	return items, rows.Err()
+}
+
+const getCartItemsQueryByIDs = `SELECT ` + cartItemColumns + ` FROM cart_items WHERE user_id = ? AND deleted_at IS NULL AND id IN`
+
+// GetItemsByIDs returns the active lines of itemIDs owned by the user, locked for the running transaction
+func (r *CartMySQLRepo) GetItemsByIDs(ctx context.Context, userID uuid.UUID, itemIDs uuid.UUIDs) ([]*entity.CartItem, error) {
+	items := make([]*entity.CartItem, 0, len(itemIDs))
+	if len(itemIDs) == 0 {
+		return items, nil
+	}
+
+	placeholders := "?" + strings.Repeat(",?", len(itemIDs)-1)
+	query := getCartItemsQueryByIDs + " (" + placeholders + ") FOR UPDATE"
+
+	args := make([]interface{}, len(itemIDs)+1)
+	args[0] = userID
+	for i, id := range itemIDs {
+		args[i+1] = id
+	}
+
+	stmt, errStmt := r.Executor(ctx).PrepareContext(ctx, query)
+	if errStmt != nil {
+		return nil, errStmt
+	}
+	defer stmt.Close()
+
+	rows, err := stmt.QueryContext(ctx, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		item, err := scanCartItem(rows)
+		if err != nil {
+			return nil, err
+		}
+		items = append(items, item)
+	}
+
+	return items, rows.Err()
+}
+
+const getCartItemsQueryByProductID = `SELECT ` + cartItemColumns + ` FROM cart_items WHERE product_id = ? AND deleted_at IS NULL`
+
+// GetItemsByProductID returns the active lines of the product in every cart and list, without locking them
+func (r *CartMySQLRepo) GetItemsByProductID(ctx context.Context, productID uuid.UUID) ([]*entity.CartItem, error) {
+	stmt, errStmt := r.Executor(ctx).PrepareContext(ctx, getCartItemsQueryByProductID)
+	if errStmt != nil {
+		return nil, errStmt
+	}
+	defer stmt.Close()
+
+	rows, err := stmt.QueryContext(ctx, productID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	items := make([]*entity.CartItem, 0)
+	for rows.Next() {
+		item, err := scanCartItem(rows)
+		if err != nil {
+			return nil, err
+		}
+		items = append(items, item)
+	}
+
+	return items, rows.Err()
+}
+
+const queryMoveCartItem = `UPDATE cart_items SET list_type = ?, version = version + 1, updated_at = ? WHERE id = ? AND user_id = ? AND deleted_at IS NULL`
+
+// MoveItem moves the line to item.List
+func (r *CartMySQLRepo) MoveItem(ctx context.Context, item *entity.CartItem) error {
+	stmt, errStmt := r.Executor(ctx).PrepareContext(ctx, queryMoveCartItem)
+	if errStmt != nil {
+		return errStmt
+	}
+	defer stmt.Close()
+
+	_, updateErr := stmt.ExecContext(ctx, item.List, item.UpdatedAt, item.ID, item.UserID)
+	if updateErr != nil {
+		return duplicateError(updateErr)
+	}
+
+	return nil
+}
+
+const queryMoveCartItemToCart = `UPDATE cart_items SET cart_id = ?, version = version + 1, updated_at = ? WHERE id = ? AND user_id = ? AND deleted_at IS NULL`
+
+// MoveItemToCart moves the line to item.CartID
+func (r *CartMySQLRepo) MoveItemToCart(ctx context.Context, item *entity.CartItem) error {
+	stmt, errStmt := r.Executor(ctx).PrepareContext(ctx, queryMoveCartItemToCart)
+	if errStmt != nil {
+		return errStmt
+	}
+	defer stmt.Close()
+
+	_, updateErr := stmt.ExecContext(ctx, item.CartID, item.UpdatedAt, item.ID, item.UserID)
+	if updateErr != nil {
+		return duplicateError(updateErr)
+	}
+
+	return nil
+}
+
+const queryMoveCartItemsList = `UPDATE cart_items SET list_type = ?, version = version + 1, updated_at = ? WHERE user_id = ? AND list_type = ? AND deleted_at IS NULL AND id IN`
+
+// MoveItemsList moves the lines of itemIDs owned by the user from list to another list, lines in other lists are left untouched
+func (r *CartMySQLRepo) MoveItemsList(ctx context.Context, userID uuid.UUID, itemIDs uuid.UUIDs, from string, to string) error {
+	if len(itemIDs) == 0 {
+		return nil
+	}
+
+	placeholders := "?" + strings.Repeat(",?", len(itemIDs)-1)
+	query := queryMoveCartItemsList + " (" + placeholders + ")"
+
+	args := make([]interface{}, len(itemIDs)+4)
+	args[0] = to
+	args[1] = time.Now()
+	args[2] = userID
+	args[3] = from
+	for i, id := range itemIDs {
+		args[i+4] = id
+	}
+
+	stmt, errStmt := r.Executor(ctx).PrepareContext(ctx, query)
+	if errStmt != nil {
+		return errStmt
+	}
+	defer stmt.Close()
+
+	_, updateErr := stmt.ExecContext(ctx, args...)
 	if updateErr != nil {
-		return nil, updateErr
+		return duplicateError(updateErr)
 	}
 
-	// get product id for updating in redis
-	stmt, errStmt = r.Conn.PrepareContext(ctx, querySelectUpdatedCart)
+	return nil
+}
+
+const getActiveCartItemsQuery = `SELECT id, cart_id, user_id, product_id, variant_id, options FROM cart_items WHERE list_type = 'cart' AND deleted_at IS NULL`
+
+// GetAllActive returns the identity of every cart line that is not deleted, enough to build its LineKey
+func (r *CartMySQLRepo) GetAllActive(ctx context.Context) ([]*entity.CartItem, error) {
+	stmt, errStmt := r.Executor(ctx).PrepareContext(ctx, getActiveCartItemsQuery)
 	if errStmt != nil {
 		return nil, errStmt
 	}
 	defer stmt.Close()
 
-	row := stmt.QueryRowContext(ctx, cart.ID, cart.UserID)
-	var productID uuid.UUID
-	err := row.Scan(&productID)
+	rows, err := stmt.QueryContext(ctx)
 	if err != nil {
 		return nil, err
 	}
+	defer rows.Close()
+
+	items := make([]*entity.CartItem, 0)
+	for rows.Next() {
+		item := &entity.CartItem{}
+		var options sql.NullString
+		err := rows.Scan(&item.ID, &item.CartID, &item.UserID, &item.ProductID, &item.VariantID, &options)
+		if err != nil {
+			continue
+		}
+		if item.Options, err = unmarshalOptions(options); err != nil {
+			continue
+		}
+		items = append(items, item)
+	}
 
-	return &productID, nil
+	return items, rows.Err()
 }
 
-const queryUpdateNameAndPriceCart = `UPDATE carts SET product_name = ?, product_price = ?, updated_at = ? WHERE product_id = ? AND deleted_at IS NOT NULL`
+const queryUpdateQtyAndNoteCartItem = `UPDATE cart_items SET product_quantity = ?, note = ?, version = version + 1, updated_at = ? WHERE id = ? AND user_id = ? AND deleted_at IS NULL`
 
-func (r *CartMySQLRepo) UpdateNameAndPrice(ctx context.Context, cart *entity.Cart) error {
-	stmt, errStmt := r.Conn.PrepareContext(ctx, queryUpdateNameAndPriceCart)
+func (r *CartMySQLRepo) UpdateQtyAndNote(ctx context.Context, item *entity.CartItem) error {
+	stmt, errStmt := r.Executor(ctx).PrepareContext(ctx, queryUpdateQtyAndNoteCartItem)
 	if errStmt != nil {
 		return errStmt
 	}
 	defer stmt.Close()
 
-	_, updateErr := stmt.ExecContext(ctx, cart.ProductName, cart.ProductPrice, cart.UpdatedAt, cart.ProductID)
+	_, updateErr := stmt.ExecContext(ctx, item.ProductQuantity, item.Note, item.UpdatedAt, item.ID, item.UserID)
 	if updateErr != nil {
 		return updateErr
 	}
@@ -114,19 +714,62 @@ func (r *CartMySQLRepo) UpdateNameAndPrice(ctx context.Context, cart *entity.Car
 	return nil
 }
 
-const querySoftDeleteCart = `UPDATE carts SET deleted_at = ? WHERE id IN`
+// the currency of a line is never rewritten, a price in another currency only renames the line
+const queryUpdateNameAndPriceCartItems = `UPDATE cart_items SET product_name = ?, product_price = IF(currency = ?, ?, product_price), updated_at = ? WHERE product_id = ? AND deleted_at IS NULL AND id IN`
+
+// UpdateNameAndPrice renames and reprices the lines of itemIDs, ids of lines of another product are left untouched
+func (r *CartMySQLRepo) UpdateNameAndPrice(ctx context.Context, item *entity.CartItem, itemIDs uuid.UUIDs) error {
+	if len(itemIDs) == 0 {
+		return nil
+	}
 
-func (r *CartMySQLRepo) DeleteMany(ctx context.Context, cartIDs uuid.UUIDs) error {
-	placeholders := "?" + strings.Repeat(",?", len(cartIDs)-1)
-	query := querySoftDeleteCart + " (" + placeholders + ")"
+	placeholders := "?" + strings.Repeat(",?", len(itemIDs)-1)
+	query := queryUpdateNameAndPriceCartItems + " (" + placeholders + ")"
 
-	args := make([]interface{}, len(cartIDs)+1)
+	args := make([]interface{}, len(itemIDs)+5)
+	args[0] = item.ProductName
+	args[1] = item.Currency
+	args[2] = item.ProductPrice
+	args[3] = item.UpdatedAt
+	args[4] = item.ProductID
+	for i, id := range itemIDs {
+		args[i+5] = id
+	}
+
+	stmt, errStmt := r.Executor(ctx).PrepareContext(ctx, query)
+	if errStmt != nil {
+		return errStmt
+	}
+	defer stmt.Close()
+
+	_, updateErr := stmt.ExecContext(ctx, args...)
+	if updateErr != nil {
+		return updateErr
+	}
+
+	return nil
+}
+
+const querySoftDeleteCartItems = `UPDATE cart_items SET deleted_at = ?, delete_reason = ? WHERE user_id = ? AND deleted_at IS NULL AND id IN`
+
+// DeleteMany soft deletes the lines of itemIDs owned by the user, ids of other users are left untouched
+func (r *CartMySQLRepo) DeleteMany(ctx context.Context, userID uuid.UUID, itemIDs uuid.UUIDs, reason string) error {
+	if len(itemIDs) == 0 {
+		return nil
+	}
+
+	placeholders := "?" + strings.Repeat(",?", len(itemIDs)-1)
+	query := querySoftDeleteCartItems + " (" + placeholders + ")"
+
+	args := make([]interface{}, len(itemIDs)+3)
 	args[0] = time.Now()
-	for i, id := range cartIDs {
-		args[i+1] = id
+	args[1] = reason
+	args[2] = userID
+	for i, id := range itemIDs {
+		args[i+3] = id
 	}
 
-	stmt, errStmt := r.Conn.PrepareContext(ctx, query)
+	stmt, errStmt := r.Executor(ctx).PrepareContext(ctx, query)
 	if errStmt != nil {
 		return errStmt
 	}
@@ -140,51 +783,280 @@ func (r *CartMySQLRepo) DeleteMany(ctx context.Context, cartIDs uuid.UUIDs) erro
 	return nil
 }
 
-const queryDeleteCart = `UPDATE carts SET deleted_at = ? WHERE id = ?`
-const queryGetProductIDDeletedCart = `SELECT product_id FROM carts WHERE id = ? AND deleted_at IS NOT NULL`
+const queryDeleteCartItem = `UPDATE cart_items SET deleted_at = ?, delete_reason = ? WHERE id = ?`
 
-func (r *CartMySQLRepo) DeleteOne(ctx context.Context, cartID uuid.UUID) (*uuid.UUID, error) {
-	stmt, errStmt := r.Conn.PrepareContext(ctx, queryDeleteCart)
+func (r *CartMySQLRepo) DeleteOne(ctx context.Context, itemID uuid.UUID, reason string) error {
+	stmt, errStmt := r.Executor(ctx).PrepareContext(ctx, queryDeleteCartItem)
 	if errStmt != nil {
-		return nil, errStmt
+		return errStmt
 	}
 	defer stmt.Close()
 
-	_, deleteErr := stmt.ExecContext(ctx, time.Now(), cartID)
+	_, deleteErr := stmt.ExecContext(ctx, time.Now(), reason, itemID)
 	if deleteErr != nil {
-		return nil, deleteErr
+		return deleteErr
+	}
+
+	return nil
+}
+
+const getRemovedCartItemsQuery = `SELECT ` + cartItemColumns + `, deleted_at FROM cart_items WHERE user_id = ? AND delete_reason = 'removed' AND deleted_at >= ? ORDER BY deleted_at DESC`
+
+// GetRemovedSince returns the lines the user removed since the given time, most recently removed first
+func (r *CartMySQLRepo) GetRemovedSince(ctx context.Context, userID uuid.UUID, since time.Time) ([]*entity.CartItem, error) {
+	stmt, errStmt := r.Executor(ctx).PrepareContext(ctx, getRemovedCartItemsQuery)
+	if errStmt != nil {
+		return nil, errStmt
+	}
+	defer stmt.Close()
+
+	rows, err := stmt.QueryContext(ctx, userID, since)
+	if err != nil {
+		return nil, err
 	}
+	defer rows.Close()
 
-	// get product id for updating in redis
-	stmt, errStmt = r.Conn.PrepareContext(ctx, queryGetProductIDDeletedCart)
+	items := make([]*entity.CartItem, 0)
+	for rows.Next() {
+		item, err := scanDeletedCartItem(rows)
+		if err != nil {
+			return nil, err
+		}
+		items = append(items, item)
+	}
+
+	return items, rows.Err()
+}
+
+const getRemovedCartItemQueryByID = `SELECT ` + cartItemColumns + `, deleted_at FROM cart_items WHERE id = ? AND user_id = ? AND delete_reason = 'removed' FOR UPDATE`
+
+// GetRemovedItemByID returns the line of the user removed by the shopper, locked for the running transaction
+func (r *CartMySQLRepo) GetRemovedItemByID(ctx context.Context, userID uuid.UUID, itemID uuid.UUID) (*entity.CartItem, error) {
+	stmt, errStmt := r.Executor(ctx).PrepareContext(ctx, getRemovedCartItemQueryByID)
 	if errStmt != nil {
 		return nil, errStmt
 	}
 	defer stmt.Close()
 
-	row := stmt.QueryRowContext(ctx, cartID)
-	var productID uuid.UUID
-	err := row.Scan(&productID)
+	item, err := scanDeletedCartItem(stmt.QueryRowContext(ctx, itemID, userID))
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
 	if err != nil {
 		return nil, err
 	}
 
-	return &productID, nil
+	return item, nil
+}
+
+func scanDeletedCartItem(row rowScanner) (*entity.CartItem, error) {
+	item := &entity.CartItem{}
+	var options sql.NullString
+	var optionsHash string
+	err := row.Scan(&item.ID, &item.CartID, &item.UserID, &item.ProductID, &item.VariantID, &item.ProductName, &item.ProductImageURL, &item.ProductPrice, &item.Currency, &item.ProductQuantity, &item.Note, &options, &optionsHash, &item.List, &item.Version, &item.CreatedAt, &item.UpdatedAt, &item.DeletedAt)
+	if err != nil {
+		return nil, err
+	}
+
+	item.Options, err = unmarshalOptions(options)
+	if err != nil {
+		return nil, err
+	}
+
+	return item, nil
+}
+
+const queryRestoreCartItem = `UPDATE cart_items SET deleted_at = NULL, delete_reason = NULL, version = version + 1, updated_at = ? WHERE id = ? AND user_id = ? AND delete_reason = 'removed'`
+
+// RestoreItem brings back a line removed by the shopper
+func (r *CartMySQLRepo) RestoreItem(ctx context.Context, item *entity.CartItem) error {
+	stmt, errStmt := r.Executor(ctx).PrepareContext(ctx, queryRestoreCartItem)
+	if errStmt != nil {
+		return errStmt
+	}
+	defer stmt.Close()
+
+	_, updateErr := stmt.ExecContext(ctx, item.UpdatedAt, item.ID, item.UserID)
+	if updateErr != nil {
+		return duplicateError(updateErr)
+	}
+
+	return nil
 }
 
-const queryUpdateProductQtyCart = `UPDATE carts SET product_quantity = product_quantity + ?, updated_at = ? WHERE id = ? AND user_id = ? AND deleted_at IS NOT NULL`
+const queryUpdateProductQtyCartItem = `UPDATE cart_items SET product_quantity = product_quantity + ?, version = version + 1, updated_at = ? WHERE id = ? AND deleted_at IS NULL`
 
-func (r *CartMySQLRepo) UpdateProductQty(ctx context.Context, cart *entity.Cart) error {
-	stmt, errStmt := r.Conn.PrepareContext(ctx, queryUpdateProductQtyCart)
+// UpdateProductQty adds item.ProductQuantity to the quantity of the line item.ID
+func (r *CartMySQLRepo) UpdateProductQty(ctx context.Context, item *entity.CartItem) error {
+	stmt, errStmt := r.Executor(ctx).PrepareContext(ctx, queryUpdateProductQtyCartItem)
 	if errStmt != nil {
 		return errStmt
 	}
 	defer stmt.Close()
 
-	_, updateErr := stmt.ExecContext(ctx, cart.ProductQuantity, cart.UpdatedAt, cart.ID, cart.UserID)
+	_, updateErr := stmt.ExecContext(ctx, item.ProductQuantity, item.UpdatedAt, item.ID)
 	if updateErr != nil {
 		return updateErr
 	}
 
 	return nil
 }
+
+const selectDeletedCartItemIDsQuery = `SELECT id FROM cart_items WHERE deleted_at IS NOT NULL AND deleted_at < ? ORDER BY deleted_at LIMIT ? FOR UPDATE SKIP LOCKED`
+const queryArchiveCartItems = `INSERT INTO cart_items_archive (` + cartItemColumns + `, deleted_at, delete_reason, archived_at) SELECT ` + cartItemColumns + `, deleted_at, delete_reason, ? FROM cart_items WHERE id IN`
+const queryHardDeleteCartItems = `DELETE FROM cart_items WHERE id IN`
+
+// PurgeDeletedBefore hard deletes up to limit lines soft deleted before the given time in one short transaction,
+// copying them to cart_items_archive first when archive is set. it returns how many lines were purged
+func (r *CartMySQLRepo) PurgeDeletedBefore(ctx context.Context, before time.Time, limit int, archive bool) (int64, error) {
+	var purged int64
+
+	err := r.WithTx(ctx, func(txCtx context.Context) error {
+		stmt, errStmt := r.Executor(txCtx).PrepareContext(txCtx, selectDeletedCartItemIDsQuery)
+		if errStmt != nil {
+			return errStmt
+		}
+		defer stmt.Close()
+
+		rows, err := stmt.QueryContext(txCtx, before, limit)
+		if err != nil {
+			return err
+		}
+		defer rows.Close()
+
+		args := make([]interface{}, 0, limit)
+		for rows.Next() {
+			var itemID uuid.UUID
+			if err := rows.Scan(&itemID); err != nil {
+				return err
+			}
+			args = append(args, itemID)
+		}
+
+		if err := rows.Err(); err != nil {
+			return err
+		}
+
+		if len(args) == 0 {
+			return nil
+		}
+
+		placeholders := " (?" + strings.Repeat(",?", len(args)-1) + ")"
+
+		if archive {
+			archiveStmt, errArchive := r.Executor(txCtx).PrepareContext(txCtx, queryArchiveCartItems+placeholders)
+			if errArchive != nil {
+				return errArchive
+			}
+			defer archiveStmt.Close()
+
+			if _, err := archiveStmt.ExecContext(txCtx, append([]interface{}{time.Now()}, args...)...); err != nil {
+				return err
+			}
+		}
+
+		deleteStmt, errDelete := r.Executor(txCtx).PrepareContext(txCtx, queryHardDeleteCartItems+placeholders)
+		if errDelete != nil {
+			return errDelete
+		}
+		defer deleteStmt.Close()
+
+		result, err := deleteStmt.ExecContext(txCtx, args...)
+		if err != nil {
+			return err
+		}
+
+		purged, err = result.RowsAffected()
+		return err
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	return purged, nil
+}
+
+const selectExpiredGuestCartsQuery = `SELECT id, user_id FROM carts WHERE guest = TRUE AND expires_at < ? ORDER BY expires_at LIMIT ? FOR UPDATE SKIP LOCKED`
+
+// statements removing a guest cart and everything that points to it
+const (
+	queryDeleteGuestCartItems         = `DELETE FROM cart_items WHERE cart_id IN`
+	queryDeleteGuestCartNotifications = `DELETE FROM cart_abandoned_notifications WHERE cart_id IN`
+	queryDeleteGuestCarts             = `DELETE FROM carts WHERE guest = TRUE AND id IN`
+	queryDeleteGuestDefaultCarts      = `DELETE FROM user_default_carts WHERE user_id IN`
+)
+
+// PurgeExpiredGuestCarts hard deletes up to limit guest carts expired before the given time in one short transaction,
+// with their lines, abandoned cart notification and default cart entry. it returns how many carts were purged
+func (r *CartMySQLRepo) PurgeExpiredGuestCarts(ctx context.Context, before time.Time, limit int) (int64, error) {
+	var purged int64
+
+	err := r.WithTx(ctx, func(txCtx context.Context) error {
+		stmt, errStmt := r.Executor(txCtx).PrepareContext(txCtx, selectExpiredGuestCartsQuery)
+		if errStmt != nil {
+			return errStmt
+		}
+		defer stmt.Close()
+
+		rows, err := stmt.QueryContext(txCtx, before, limit)
+		if err != nil {
+			return err
+		}
+		defer rows.Close()
+
+		cartIDs := make([]interface{}, 0, limit)
+		guestIDs := make([]interface{}, 0, limit)
+		for rows.Next() {
+			var cartID, guestID uuid.UUID
+			if err := rows.Scan(&cartID, &guestID); err != nil {
+				return err
+			}
+			cartIDs = append(cartIDs, cartID)
+			guestIDs = append(guestIDs, guestID)
+		}
+
+		if err := rows.Err(); err != nil {
+			return err
+		}
+
+		if len(cartIDs) == 0 {
+			return nil
+		}
+
+		placeholders := " (?" + strings.Repeat(",?", len(cartIDs)-1) + ")"
+
+		deletes := []struct {
+			query string
+			args  []interface{}
+		}{
+			{queryDeleteGuestCartItems, cartIDs},
+			{queryDeleteGuestCartNotifications, cartIDs},
+			{queryDeleteGuestDefaultCarts, guestIDs},
+			{queryDeleteGuestCarts, cartIDs},
+		}
+		for _, del := range deletes {
+			deleteStmt, errDelete := r.Executor(txCtx).PrepareContext(txCtx, del.query+placeholders)
+			if errDelete != nil {
+				return errDelete
+			}
+			defer deleteStmt.Close()
+
+			result, err := deleteStmt.ExecContext(txCtx, del.args...)
+			if err != nil {
+				return err
+			}
+			if del.query == queryDeleteGuestCarts {
+				if purged, err = result.RowsAffected(); err != nil {
+					return err
+				}
+			}
+		}
+
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	return purged, nil
+}
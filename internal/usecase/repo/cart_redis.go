@@ -2,8 +2,12 @@ package repo
 
 import (
 	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"strconv"
+	"strings"
+	"time"
 
 	"github.com/google/uuid"
 	"github.com/idoyudha/eshop-cart/internal/entity"
@@ -12,73 +16,312 @@ import (
 )
 
 const (
-	cartKey = "cart"
+	cartKey      = "cart"
+	userKey      = "user"
+	productKey   = "product"
+	scanPageSize = 100
+	// watched replaces of a cart that keeps changing give up after this many tries
+	replaceAttempts = 3
 )
 
+// updates the hash only if it is still cached, otherwise drops it from the product index,
+// the price is only applied to a line priced in the same currency
+// KEYS[1] -> cart:{userID}:{lineKey}, KEYS[2] -> product:{productID}:carts
+// ARGV[1] -> product name, ARGV[2] -> price in minor units, ARGV[3] -> currency of the price
+var updateIndexedCartScript = redis.NewScript(`
+if redis.call("EXISTS", KEYS[1]) == 0 then
+	redis.call("SREM", KEYS[2], KEYS[1])
+	return 0
+end
+redis.call("HSET", KEYS[1], "product_name", ARGV[1])
+if redis.call("HGET", KEYS[1], "currency") == ARGV[3] then
+	redis.call("HSET", KEYS[1], "product_price", ARGV[2])
+end
+return 1
+`)
+
 type CartRedisRepo struct {
 	*rClient.RedisClient
+	// header, line set and lines of a cart always share the same expiry, zero disables it
+	ttl time.Duration
 }
 
-func NewCartRedisRepo(client *rClient.RedisClient) *CartRedisRepo {
+func NewCartRedisRepo(client *rClient.RedisClient, ttl time.Duration) *CartRedisRepo {
 	return &CartRedisRepo{
 		client,
+		ttl,
 	}
 }
 
-func getCartKey(cartID string) string {
-	return fmt.Sprintf("cart:%s", cartID)
+// lineKey is entity.CartItem.LineKey, it starts with the product id
+func getCartKey(userID string, lineKey string) string {
+	return fmt.Sprintf("%s:%s:%s", cartKey, userID, lineKey)
+}
+
+func getUserCartKey(userID string) string {
+	return fmt.Sprintf("%s:%s:cart", userKey, userID)
 }
 
 func getUserCartsKey(userID string) string {
-	return fmt.Sprintf("user:%s:carts", userID)
+	return fmt.Sprintf("%s:%s:carts", userKey, userID)
 }
 
-// store cart data as hash -> cart:{cartID}
-// add cartID to set -> user:{userID}:carts
-func (r *CartRedisRepo) Save(ctx context.Context, cart *entity.Cart) error {
-	cartKey := getCartKey(cart.ProductID.String())
-	userCartsKey := getUserCartsKey(cart.UserID.String())
+func getProductCartsKey(productID string) string {
+	return fmt.Sprintf("%s:%s:carts", productKey, productID)
+}
 
-	// perform multiple operations
-	pipe := r.Client.Pipeline()
+// a product index is built here by RebuildProductIndex and renamed over the live key once complete
+func getProductCartsRebuildKey(productID string) string {
+	return fmt.Sprintf("%s:%s:carts:rebuild", productKey, productID)
+}
+
+func productIDOfLineKey(lineKey string) string {
+	productID, _, _ := strings.Cut(lineKey, ":")
+	return productID
+}
 
-	cartMap := map[string]interface{}{
-		"id":                cart.ID.String(),
-		"user_id":           cart.UserID.String(),
-		"product_id":        cart.ProductID.String(),
-		"product_name":      cart.ProductName,
-		"product_image_url": cart.ProductImageURL,
-		"product_price":     cart.ProductPrice,
-		"product_quantity":  cart.ProductQuantity,
-		"note":              cart.Note,
+// store cart header as hash -> user:{userID}:cart
+// and every line of the cart, see saveItem. only the default cart of a user is cached.
+// like ReplaceCart it leaves a cart cached at a newer version in place
+func (r *CartRedisRepo) SaveCart(ctx context.Context, cart *entity.Cart) error {
+	if err := r.ReplaceCart(ctx, cart.UserID.String(), cart); err != nil {
+		return fmt.Errorf("failed to save cart to redis: %w", err)
 	}
 
-	pipe.HSet(ctx, cartKey, cartMap)
-	pipe.SAdd(ctx, userCartsKey, cart.ProductID.String())
+	return nil
+}
 
-	_, err := pipe.Exec(ctx)
+// ReplaceCart drops everything cached for the user and stores cart instead in one transaction,
+// a nil cart only drops the cache. a cart read from mysql before the cached one has a lower
+// CacheVersion and is skipped, so a late writer never brings back an older cart
+func (r *CartRedisRepo) ReplaceCart(ctx context.Context, userID string, cart *entity.Cart) error {
+	headerKey := getUserCartKey(userID)
+	cartsKey := getUserCartsKey(userID)
+
+	replace := func(tx *redis.Tx) error {
+		if cart != nil {
+			cached, err := tx.HGet(ctx, headerKey, "version").Int64()
+			if err != nil && !errors.Is(err, redis.Nil) {
+				return fmt.Errorf("failed to get cart version from redis: %w", err)
+			}
+			if cached > cart.CacheVersion {
+				return nil
+			}
+		}
+
+		lineKeys, err := tx.SMembers(ctx, cartsKey).Result()
+		if err != nil {
+			return fmt.Errorf("failed to get line key members from redis: %w", err)
+		}
+
+		_, err = tx.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+			deleteUserCart(ctx, pipe, userID, lineKeys)
+			if cart != nil {
+				r.saveCart(ctx, pipe, cart)
+			}
+			return nil
+		})
+		return err
+	}
+
+	// another writer changed the cart between the version check and the write, check again
+	var err error
+	for attempt := 0; attempt < replaceAttempts; attempt++ {
+		err = r.Client.Watch(ctx, replace, headerKey, cartsKey)
+		if !errors.Is(err, redis.TxFailedErr) {
+			break
+		}
+	}
 	if err != nil {
-		return fmt.Errorf("failed to save cart to redis: %w", err)
+		return fmt.Errorf("failed to replace cart in redis: %w", err)
 	}
 
 	return nil
 }
 
-func (r *CartRedisRepo) GetUserCart(ctx context.Context, userID string) ([]*entity.Cart, error) {
-	userCartKey := getUserCartsKey(userID)
-	cartIDs, err := r.Client.SMembers(ctx, userCartKey).Result()
+func (r *CartRedisRepo) saveCart(ctx context.Context, pipe redis.Pipeliner, cart *entity.Cart) {
+	userID := cart.UserID.String()
+
+	var expiresAt int64
+	if !cart.ExpiresAt.IsZero() {
+		expiresAt = cart.ExpiresAt.Unix()
+	}
+
+	// the line count lets a read tell a complete cart from one whose line set was evicted
+	pipe.HSet(ctx, getUserCartKey(userID), map[string]interface{}{
+		"id":         cart.ID.String(),
+		"user_id":    cart.UserID.String(),
+		"name":       cart.Name,
+		"currency":   cart.Currency,
+		"status":     cart.Status,
+		"guest":      cart.Guest,
+		"expires_at": expiresAt,
+		"created_at": cart.CreatedAt.Unix(),
+		"updated_at": cart.UpdatedAt.Unix(),
+		"version":    cart.CacheVersion,
+		"lines":      len(cart.Items),
+	})
+
+	lineKeys := make([]string, len(cart.Items))
+	for i, item := range cart.Items {
+		saveItem(ctx, pipe, item)
+		lineKeys[i] = item.LineKey()
+	}
+
+	r.expireCart(ctx, pipe, cart, lineKeys)
+}
+
+// expireCart (re)sets the same ttl on header, line set and every line of the cart,
+// call it inside a transaction pipeline so the keys can only expire together.
+// guest carts expire at their fixed ExpiresAt instead of the sliding ttl
+func (r *CartRedisRepo) expireCart(ctx context.Context, pipe redis.Pipeliner, cart *entity.Cart, lineKeys []string) {
+	r.expireProductIndex(ctx, pipe, cart, lineKeys)
+
+	expire := func(key string) {
+		pipe.Expire(ctx, key, r.ttl)
+	}
+
+	switch {
+	case cart.Guest && !cart.ExpiresAt.IsZero():
+		expire = func(key string) {
+			pipe.ExpireAt(ctx, key, cart.ExpiresAt)
+		}
+	case r.ttl <= 0:
+		return
+	}
+
+	userID := cart.UserID.String()
+	expire(getUserCartKey(userID))
+	if len(lineKeys) == 0 {
+		return
+	}
+
+	expire(getUserCartsKey(userID))
+	for _, lineKey := range lineKeys {
+		expire(getCartKey(userID, lineKey))
+	}
+}
+
+// expireProductIndex keeps the product index of the lines alive at least as long as the cart, the index is
+// shared by every cart of the product so the product of a cart that is never saved again expires with it.
+// entries of carts expired earlier are dropped by UpdateNameAndPrice
+func (r *CartRedisRepo) expireProductIndex(ctx context.Context, pipe redis.Pipeliner, cart *entity.Cart, lineKeys []string) {
+	ttl := r.ttl
+	if cart.Guest && !cart.ExpiresAt.IsZero() {
+		ttl = max(ttl, time.Until(cart.ExpiresAt))
+	}
+	if ttl <= 0 {
+		return
+	}
+
+	for _, lineKey := range lineKeys {
+		pipe.Expire(ctx, getProductCartsKey(productIDOfLineKey(lineKey)), ttl)
+	}
+}
+
+// store cart item data as hash -> cart:{userID}:{lineKey}
+// add lineKey to set -> user:{userID}:carts
+// add cart key to reverse index -> product:{productID}:carts
+func saveItem(ctx context.Context, pipe redis.Pipeliner, item *entity.CartItem) {
+	lineKey := item.LineKey()
+	cartKey := getCartKey(item.UserID.String(), lineKey)
+
+	var variantID string
+	if item.VariantID != uuid.Nil {
+		variantID = item.VariantID.String()
+	}
+
+	var options string
+	if len(item.Options) > 0 {
+		value, _ := json.Marshal(item.Options)
+		options = string(value)
+	}
+
+	itemMap := map[string]interface{}{
+		"id":                item.ID.String(),
+		"cart_id":           item.CartID.String(),
+		"user_id":           item.UserID.String(),
+		"product_id":        item.ProductID.String(),
+		"variant_id":        variantID,
+		"product_name":      item.ProductName,
+		"product_image_url": item.ProductImageURL,
+		"product_price":     item.ProductPrice,
+		"currency":          item.Currency,
+		"product_quantity":  item.ProductQuantity,
+		"note":              item.Note,
+		"options":           options,
+		"version":           item.Version,
+	}
+
+	pipe.HSet(ctx, cartKey, itemMap)
+	pipe.SAdd(ctx, getUserCartsKey(item.UserID.String()), lineKey)
+	pipe.SAdd(ctx, getProductCartsKey(item.ProductID.String()), cartKey)
+}
+
+// GetUserCart returns nil when the cart is not cached or only partially cached
+func (r *CartRedisRepo) GetUserCart(ctx context.Context, userID string) (*entity.Cart, error) {
+	pipe := r.Client.Pipeline()
+	headerCmd := pipe.HGetAll(ctx, getUserCartKey(userID))
+	membersCmd := pipe.SMembers(ctx, getUserCartsKey(userID))
+
+	_, err := pipe.Exec(ctx)
 	if err != nil {
 		return nil, fmt.Errorf("failed to get user cart from redis: %w", err)
 	}
 
-	if len(cartIDs) == 0 {
+	header := headerCmd.Val()
+	// headers without name were written before named carts, reload them
+	if _, ok := header["name"]; len(header) == 0 || !ok {
 		return nil, nil
 	}
 
-	pipe := r.Client.Pipeline()
-	commands := make([]*redis.MapStringStringCmd, len(cartIDs))
-	for i, cartID := range cartIDs {
-		commands[i] = pipe.HGetAll(ctx, getCartKey(cartID))
+	// a header left without its line set, or with only part of it, would serve a cart missing lines.
+	// headers without a line count were written before it was stored, reload them too
+	lineCount, errCount := strconv.Atoi(header["lines"])
+	if errCount != nil || lineCount != len(membersCmd.Val()) {
+		return nil, nil
+	}
+
+	cartID, _ := uuid.Parse(header["id"])
+	cartUserID, _ := uuid.Parse(header["user_id"])
+	guest, _ := strconv.ParseBool(header["guest"])
+	expiresAt, _ := strconv.ParseInt(header["expires_at"], 10, 64)
+	createdAt, _ := strconv.ParseInt(header["created_at"], 10, 64)
+	updatedAt, _ := strconv.ParseInt(header["updated_at"], 10, 64)
+	version, _ := strconv.ParseInt(header["version"], 10, 64)
+
+	lineKeys := membersCmd.Val()
+	cart := &entity.Cart{
+		ID:        cartID,
+		UserID:    cartUserID,
+		Name:      header["name"],
+		Default:   true,
+		Currency:  header["currency"],
+		Status:    header["status"],
+		Guest:     guest,
+		Items:     make([]*entity.CartItem, 0, len(lineKeys)),
+		CreatedAt: time.Unix(createdAt, 0),
+		UpdatedAt: time.Unix(updatedAt, 0),
+
+		CacheVersion: version,
+	}
+	if expiresAt > 0 {
+		cart.ExpiresAt = time.Unix(expiresAt, 0)
+	}
+
+	// read the lines and refresh the expiry of the whole cart at once
+	pipe = r.Client.TxPipeline()
+	commands := make([]*redis.MapStringStringCmd, len(lineKeys))
+	for i, lineKey := range lineKeys {
+		commands[i] = pipe.HGetAll(ctx, getCartKey(userID, lineKey))
+	}
+	r.expireCart(ctx, pipe, cart, lineKeys)
+
+	if len(lineKeys) == 0 {
+		if _, err = pipe.Exec(ctx); err != nil {
+			return nil, fmt.Errorf("failed to refresh user cart expiry in redis: %w", err)
+		}
+		return cart, nil
 	}
 
 	_, err = pipe.Exec(ctx)
@@ -86,168 +329,212 @@ func (r *CartRedisRepo) GetUserCart(ctx context.Context, userID string) ([]*enti
 		return nil, fmt.Errorf("failed to get user cart from redis: %w", err)
 	}
 
-	carts := make([]*entity.Cart, 0, len(cartIDs))
 	for _, cmd := range commands {
-		cartData := cmd.Val()
-		if len(cartData) == 0 {
-			continue
+		itemData := cmd.Val()
+		// a line in the set without its hash means the cached cart is incomplete,
+		// report it as a miss so the caller reloads the whole cart from mysql.
+		// hashes without variant_id were written by an older layout, reload them too
+		if _, ok := itemData["variant_id"]; len(itemData) == 0 || !ok {
+			return nil, nil
 		}
 
-		cartID, _ := uuid.Parse(cartData["id"])
-		userID, _ := uuid.Parse(cartData["user_id"])
-		productID, _ := uuid.Parse(cartData["product_id"])
-		productQuantity, _ := strconv.ParseInt(cartData["product_quantity"], 10, 64)
-		productPrice, _ := strconv.ParseFloat(cartData["product_price"], 64)
-
-		cart := &entity.Cart{
-			ID:              cartID,
-			UserID:          userID,
+		itemID, _ := uuid.Parse(itemData["id"])
+		itemCartID, _ := uuid.Parse(itemData["cart_id"])
+		itemUserID, _ := uuid.Parse(itemData["user_id"])
+		productID, _ := uuid.Parse(itemData["product_id"])
+		variantID, _ := uuid.Parse(itemData["variant_id"])
+		productQuantity, _ := strconv.ParseInt(itemData["product_quantity"], 10, 64)
+		version, _ := strconv.ParseInt(itemData["version"], 10, 64)
+		productPrice, _ := strconv.ParseInt(itemData["product_price"], 10, 64)
+
+		item := &entity.CartItem{
+			ID:              itemID,
+			CartID:          itemCartID,
+			UserID:          itemUserID,
 			ProductID:       productID,
-			ProductName:     cartData["product_name"],
-			ProductImageURL: cartData["product_image_url"],
+			VariantID:       variantID,
+			ProductName:     itemData["product_name"],
+			ProductImageURL: itemData["product_image_url"],
 			ProductPrice:    productPrice,
+			Currency:        itemData["currency"],
 			ProductQuantity: productQuantity,
-			Note:            cartData["note"],
+			Note:            itemData["note"],
+			List:            entity.CartItemListCart,
+			Version:         version,
+		}
+		if options := itemData["options"]; options != "" {
+			_ = json.Unmarshal([]byte(options), &item.Options)
 		}
 
-		carts = append(carts, cart)
+		cart.Items = append(cart.Items, item)
 	}
 
-	return carts, nil
+	return cart, nil
 }
 
-func (r *CartRedisRepo) UpdateQtyAndNote(ctx context.Context, cart *entity.Cart) error {
-	cartKey := getCartKey(cart.ProductID.String())
-	exists, err := r.Client.Exists(ctx, cartKey).Result()
+// only the carts listed in the product reverse index are touched, in a single pipeline
+func (r *CartRedisRepo) UpdateNameAndPrice(ctx context.Context, item *entity.CartItem) error {
+	productCartsKey := getProductCartsKey(item.ProductID.String())
+	cartKeys, err := r.Client.SMembers(ctx, productCartsKey).Result()
 	if err != nil {
-		return fmt.Errorf("cart is not exist: %w", err)
+		return fmt.Errorf("failed to get product carts from redis: %w", err)
 	}
-	if exists == 0 {
-		return fmt.Errorf("cart not found for updating quantity and note")
+
+	if len(cartKeys) == 0 {
+		return nil
 	}
 
 	pipe := r.Client.Pipeline()
-	pipe.HSet(ctx, cartKey, map[string]interface{}{
-		"product_quantity": cart.ProductQuantity,
-		"note":             cart.Note,
-	})
+	for _, cartKey := range cartKeys {
+		updateIndexedCartScript.Eval(ctx, pipe, []string{cartKey, productCartsKey},
+			item.ProductName, item.ProductPrice, item.Currency,
+		)
+	}
 
 	_, err = pipe.Exec(ctx)
 	if err != nil {
-		return fmt.Errorf("failed to update cart: %w", err)
+		return fmt.Errorf("failed to update carts: %w", err)
 	}
 
 	return nil
 }
 
-// TODO: REFACTOR -> bcs already refactor the product_id as a key in redis
-func (r *CartRedisRepo) UpdateNameAndPrice(ctx context.Context, cart *entity.Cart) error {
-	// get all cart keys from Redis that contain this product
-	pattern := fmt.Sprintf("cart:*")
-	iter := r.Client.Scan(ctx, 0, pattern, 0).Iterator()
+func (r *CartRedisRepo) DeleteCarts(ctx context.Context, userID string) error {
+	lineKeys, err := r.Client.SMembers(ctx, getUserCartsKey(userID)).Result()
+	if err != nil {
+		return fmt.Errorf("failed to get line key members from redis: %w", err)
+	}
 
 	pipe := r.Client.Pipeline()
-	cartUpdated := false
-
-	for iter.Next(ctx) {
-		cartKey := iter.Val()
 
-		// get the product ID from this cart
-		cartProductID, err := r.Client.HGet(ctx, cartKey, "product_id").Result()
-		if err != nil {
-			continue
-		}
+	deleteUserCart(ctx, pipe, userID, lineKeys)
 
-		// if this cart contains our target product, update it
-		if cartProductID == cart.ProductID.String() {
-			pipe.HSet(ctx, cartKey, map[string]interface{}{
-				"product_name":  cart.ProductName,
-				"product_price": cart.ProductPrice,
-			})
-			cartUpdated = true
-		}
+	_, err = pipe.Exec(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to delete cart from redis: %w", err)
 	}
 
-	if err := iter.Err(); err != nil {
-		return fmt.Errorf("error scanning carts: %w", err)
+	return nil
+}
+
+// remove header, lines, line set and product index entries of the user
+func deleteUserCart(ctx context.Context, pipe redis.Pipeliner, userID string, lineKeys []string) {
+	pipe.Del(ctx, getUserCartKey(userID))
+
+	if len(lineKeys) == 0 {
+		return
 	}
 
-	// execute pipeline if we found carts to update
-	if cartUpdated {
-		_, err := pipe.Exec(ctx)
-		if err != nil {
-			return fmt.Errorf("failed to update carts: %w", err)
-		}
+	cartKeys := make([]string, len(lineKeys))
+	for i, lineKey := range lineKeys {
+		cartKeys[i] = getCartKey(userID, lineKey)
+		pipe.SRem(ctx, getProductCartsKey(productIDOfLineKey(lineKey)), cartKeys[i])
 	}
 
-	return nil
+	pipe.Del(ctx, cartKeys...)
+	pipe.Del(ctx, getUserCartsKey(userID))
 }
 
-func (r *CartRedisRepo) DeleteCart(ctx context.Context, userID string, cartID string) error {
-	pipe := r.Client.Pipeline()
-	pipe.Del(ctx, getCartKey(cartID))
-	pipe.SRem(ctx, getUserCartsKey(userID), cartID)
+// ScanUserIDs returns every user that has a cart set -> user:{userID}:carts
+func (r *CartRedisRepo) ScanUserIDs(ctx context.Context) ([]string, error) {
+	pattern := getUserCartsKey("*")
+	iter := r.Client.Scan(ctx, 0, pattern, scanPageSize).Iterator()
 
-	_, err := pipe.Exec(ctx)
-	if err != nil {
-		return fmt.Errorf("failed to delete cart from redis: %w", err)
+	var userIDs []string
+	for iter.Next(ctx) {
+		userID := strings.TrimSuffix(strings.TrimPrefix(iter.Val(), userKey+":"), ":carts")
+		userIDs = append(userIDs, userID)
 	}
 
-	return nil
+	if err := iter.Err(); err != nil {
+		return nil, fmt.Errorf("error scanning user carts: %w", err)
+	}
+
+	return userIDs, nil
 }
 
-func (r *CartRedisRepo) DeleteCarts(ctx context.Context, userID string) error {
-	cartIDs, err := r.Client.SMembers(ctx, getUserCartsKey(userID)).Result()
-	if err != nil {
-		return fmt.Errorf("failed to get cartid members from redis: %w", err)
-	}
+// DeleteLegacyCartKeys removes the cart:{productID} hashes written before carts were scoped per user
+func (r *CartRedisRepo) DeleteLegacyCartKeys(ctx context.Context) (int, error) {
+	pattern := fmt.Sprintf("%s:*", cartKey)
+	iter := r.Client.Scan(ctx, 0, pattern, scanPageSize).Iterator()
 
-	cartKeys := make([]string, len(cartIDs))
-	for i, cartID := range cartIDs {
-		cartKeys[i] = getCartKey(cartID)
+	var legacyKeys []string
+	for iter.Next(ctx) {
+		key := iter.Val()
+		// new keys are cart:{userID}:{lineKey}, legacy keys hold a single product id
+		if _, err := uuid.Parse(strings.TrimPrefix(key, cartKey+":")); err == nil {
+			legacyKeys = append(legacyKeys, key)
+		}
 	}
 
-	pipe := r.Client.Pipeline()
-
-	pipe.Del(ctx, cartKeys...)
-	pipe.SRem(ctx, getUserCartsKey(userID), cartIDs)
+	if err := iter.Err(); err != nil {
+		return 0, fmt.Errorf("error scanning legacy carts: %w", err)
+	}
 
-	_, err = pipe.Exec(ctx)
-	if err != nil {
-		return fmt.Errorf("failed to delete cart from redis: %w", err)
+	for start := 0; start < len(legacyKeys); start += scanPageSize {
+		end := min(start+scanPageSize, len(legacyKeys))
+		if err := r.Client.Del(ctx, legacyKeys[start:end]...).Err(); err != nil {
+			return start, fmt.Errorf("failed to delete legacy carts from redis: %w", err)
+		}
 	}
 
-	return nil
+	return len(legacyKeys), nil
 }
 
-func (r *CartRedisRepo) IsProductExistInUserCart(ctx context.Context, userID string, productID string) (bool, error) {
-	cartKey := getUserCartsKey(userID)
-
-	exists, err := r.Client.SIsMember(ctx, cartKey, productID).Result()
-	if err != nil {
-		return false, fmt.Errorf("failed to check if cart exists: %w", err)
+// RebuildProductIndex replaces every product:{productID}:carts set with the given cart lines. each set is built
+// under a temporary key and renamed over the live one, so updates keep finding the carts while it runs
+func (r *CartRedisRepo) RebuildProductIndex(ctx context.Context, items []*entity.CartItem) error {
+	cartKeysByProduct := make(map[string][]interface{})
+	for _, item := range items {
+		productID := item.ProductID.String()
+		cartKeysByProduct[productID] = append(cartKeysByProduct[productID], getCartKey(item.UserID.String(), item.LineKey()))
 	}
 
-	return exists, nil
-}
+	productIDs := make([]string, 0, len(cartKeysByProduct))
+	for productID := range cartKeysByProduct {
+		productIDs = append(productIDs, productID)
+	}
 
-func (r *CartRedisRepo) UpdateProductQtyCart(ctx context.Context, cart *entity.Cart) error {
-	cartKey := getCartKey(cart.ProductID.String())
+	for start := 0; start < len(productIDs); start += scanPageSize {
+		end := min(start+scanPageSize, len(productIDs))
+
+		pipe := r.Client.Pipeline()
+		for _, productID := range productIDs[start:end] {
+			rebuildKey := getProductCartsRebuildKey(productID)
+			pipe.Del(ctx, rebuildKey)
+			pipe.SAdd(ctx, rebuildKey, cartKeysByProduct[productID]...)
+			if r.ttl > 0 {
+				pipe.Expire(ctx, rebuildKey, r.ttl)
+			}
+			pipe.Rename(ctx, rebuildKey, getProductCartsKey(productID))
+		}
 
-	exists, err := r.Client.Exists(ctx, cartKey).Result()
-	if err != nil {
-		return fmt.Errorf("cart is not exist: %w", err)
+		if _, err := pipe.Exec(ctx); err != nil {
+			return fmt.Errorf("failed to rebuild product index: %w", err)
+		}
 	}
-	if exists == 0 {
-		return fmt.Errorf("cart not found for updating quantity")
+
+	// products without any active line left
+	iter := r.Client.Scan(ctx, 0, getProductCartsKey("*"), scanPageSize).Iterator()
+
+	var staleKeys []string
+	for iter.Next(ctx) {
+		key := iter.Val()
+		productID := strings.TrimSuffix(strings.TrimPrefix(key, productKey+":"), ":carts")
+		if _, ok := cartKeysByProduct[productID]; !ok {
+			staleKeys = append(staleKeys, key)
+		}
 	}
 
-	pipe := r.Client.Pipeline()
-	pipe.HIncrBy(ctx, cartKey, "product_quantity", cart.ProductQuantity)
+	if err := iter.Err(); err != nil {
+		return fmt.Errorf("error scanning product index: %w", err)
+	}
 
-	_, err = pipe.Exec(ctx)
-	if err != nil {
-		return fmt.Errorf("failed to update cart: %w", err)
+	for start := 0; start < len(staleKeys); start += scanPageSize {
+		end := min(start+scanPageSize, len(staleKeys))
+		if err := r.Client.Del(ctx, staleKeys[start:end]...).Err(); err != nil {
+			return fmt.Errorf("failed to delete product index from redis: %w", err)
+		}
 	}
 
 	return nil
@@ -0,0 +1,493 @@
+package repo
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/google/uuid"
+	"github.com/idoyudha/eshop-cart/internal/entity"
+	rClient "github.com/idoyudha/eshop-cart/pkg/redis"
+	"github.com/redis/go-redis/v9"
+)
+
+func newTestCartRedisRepo(t *testing.T) (*CartRedisRepo, *miniredis.Miniredis) {
+	t.Helper()
+
+	server := miniredis.RunT(t)
+	client := redis.NewClient(&redis.Options{Addr: server.Addr()})
+	t.Cleanup(func() { client.Close() })
+
+	return NewCartRedisRepo(&rClient.RedisClient{Client: client}, time.Hour), server
+}
+
+// newTestCart is a default cart of userID at version with one line per quantity
+func newTestCart(userID uuid.UUID, version int64, quantities ...int64) *entity.Cart {
+	cart := &entity.Cart{
+		ID:           uuid.New(),
+		UserID:       userID,
+		Name:         entity.DefaultCartName,
+		Default:      true,
+		Currency:     "USD",
+		Status:       entity.CartStatusActive,
+		CreatedAt:    time.Unix(1700000000, 0),
+		UpdatedAt:    time.Unix(1700000000, 0),
+		CacheVersion: version,
+	}
+	for _, quantity := range quantities {
+		cart.Items = append(cart.Items, &entity.CartItem{
+			ID:              uuid.New(),
+			CartID:          cart.ID,
+			UserID:          userID,
+			ProductID:       uuid.New(),
+			ProductName:     "mug",
+			ProductPrice:    1999,
+			Currency:        "USD",
+			ProductQuantity: quantity,
+			List:            entity.CartItemListCart,
+			Version:         1,
+		})
+	}
+	return cart
+}
+
+func cachedQuantities(t *testing.T, repo *CartRedisRepo, userID uuid.UUID) []int64 {
+	t.Helper()
+
+	cart, err := repo.GetUserCart(context.Background(), userID.String())
+	if err != nil {
+		t.Fatalf("GetUserCart() = %v", err)
+	}
+	if cart == nil {
+		return nil
+	}
+
+	quantities := make([]int64, 0, len(cart.Items))
+	for _, item := range cart.Items {
+		quantities = append(quantities, item.ProductQuantity)
+	}
+	return quantities
+}
+
+func TestReplaceCartVersion(t *testing.T) {
+	userID := uuid.New()
+
+	tests := []struct {
+		name    string
+		cached  *entity.Cart
+		replace *entity.Cart
+		want    []int64
+	}{
+		{name: "nothing cached", replace: newTestCart(userID, 3, 2), want: []int64{2}},
+		{name: "newer cart", cached: newTestCart(userID, 3, 2), replace: newTestCart(userID, 4, 5), want: []int64{5}},
+		{name: "same version is applied again", cached: newTestCart(userID, 3, 2), replace: newTestCart(userID, 3, 5), want: []int64{5}},
+		{name: "older cart applied late", cached: newTestCart(userID, 4, 5), replace: newTestCart(userID, 3, 2), want: []int64{5}},
+		{name: "nil cart drops the cache", cached: newTestCart(userID, 4, 5), want: nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			repo, _ := newTestCartRedisRepo(t)
+			ctx := context.Background()
+
+			if tt.cached != nil {
+				if err := repo.SaveCart(ctx, tt.cached); err != nil {
+					t.Fatalf("SaveCart() = %v", err)
+				}
+			}
+			if err := repo.ReplaceCart(ctx, userID.String(), tt.replace); err != nil {
+				t.Fatalf("ReplaceCart() = %v", err)
+			}
+
+			got := cachedQuantities(t, repo, userID)
+			if len(got) != len(tt.want) || (len(got) == 1 && got[0] != tt.want[0]) {
+				t.Errorf("cached quantities = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+// a cache fill that read mysql before the relay applied a change must not bring the older cart back
+func TestSaveCartKeepsNewerCart(t *testing.T) {
+	repo, _ := newTestCartRedisRepo(t)
+	ctx := context.Background()
+	userID := uuid.New()
+
+	if err := repo.ReplaceCart(ctx, userID.String(), newTestCart(userID, 7, 1, 1)); err != nil {
+		t.Fatalf("ReplaceCart() = %v", err)
+	}
+	if err := repo.SaveCart(ctx, newTestCart(userID, 6, 9)); err != nil {
+		t.Fatalf("SaveCart() = %v", err)
+	}
+
+	cart, err := repo.GetUserCart(ctx, userID.String())
+	if err != nil || cart == nil {
+		t.Fatalf("GetUserCart() = %v, %v", cart, err)
+	}
+	if cart.CacheVersion != 7 || len(cart.Items) != 2 {
+		t.Errorf("cached version %d with %d lines, want version 7 with 2 lines", cart.CacheVersion, len(cart.Items))
+	}
+}
+
+func TestReplaceCartRedisDown(t *testing.T) {
+	repo, server := newTestCartRedisRepo(t)
+	server.Close()
+
+	userID := uuid.New()
+	if err := repo.ReplaceCart(context.Background(), userID.String(), newTestCart(userID, 1, 1)); err == nil {
+		t.Fatal("ReplaceCart() = nil, want an error while redis is down")
+	}
+}
+
+func TestGetUserCartIncomplete(t *testing.T) {
+	userID := uuid.New()
+	headerKey := getUserCartKey(userID.String())
+	cartsKey := getUserCartsKey(userID.String())
+
+	tests := []struct {
+		name  string
+		cart  *entity.Cart
+		evict func(server *miniredis.Miniredis, cart *entity.Cart)
+		// number of lines served, -1 for a miss
+		want int
+	}{
+		{name: "complete cart", cart: newTestCart(userID, 1, 1, 2), evict: func(*miniredis.Miniredis, *entity.Cart) {}, want: 2},
+		{name: "empty cart", cart: newTestCart(userID, 1), evict: func(*miniredis.Miniredis, *entity.Cart) {}, want: 0},
+		{
+			name:  "line set evicted",
+			cart:  newTestCart(userID, 1, 1, 2),
+			evict: func(server *miniredis.Miniredis, _ *entity.Cart) { server.Del(cartsKey) },
+			want:  -1,
+		},
+		{
+			name: "line set lost a member",
+			cart: newTestCart(userID, 1, 1, 2),
+			evict: func(server *miniredis.Miniredis, cart *entity.Cart) {
+				_, _ = server.SRem(cartsKey, cart.Items[0].LineKey())
+			},
+			want: -1,
+		},
+		{
+			name: "line hash evicted",
+			cart: newTestCart(userID, 1, 1, 2),
+			evict: func(server *miniredis.Miniredis, cart *entity.Cart) {
+				server.Del(getCartKey(userID.String(), cart.Items[1].LineKey()))
+			},
+			want: -1,
+		},
+		{
+			name:  "header written before the line count",
+			cart:  newTestCart(userID, 1, 1),
+			evict: func(server *miniredis.Miniredis, _ *entity.Cart) { server.HDel(headerKey, "lines") },
+			want:  -1,
+		},
+		{
+			name:  "header evicted",
+			cart:  newTestCart(userID, 1, 1),
+			evict: func(server *miniredis.Miniredis, _ *entity.Cart) { server.Del(headerKey) },
+			want:  -1,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			repo, server := newTestCartRedisRepo(t)
+			if err := repo.SaveCart(context.Background(), tt.cart); err != nil {
+				t.Fatalf("SaveCart() = %v", err)
+			}
+			tt.evict(server, tt.cart)
+
+			cart, err := repo.GetUserCart(context.Background(), userID.String())
+			if err != nil {
+				t.Fatalf("GetUserCart() = %v", err)
+			}
+
+			got := -1
+			if cart != nil {
+				got = len(cart.Items)
+			}
+			if got != tt.want {
+				t.Errorf("GetUserCart() served %d lines, want %d", got, tt.want)
+			}
+		})
+	}
+}
+
+// a read slides the expiry of header, line set and lines together
+func TestGetUserCartRefreshesExpiry(t *testing.T) {
+	repo, server := newTestCartRedisRepo(t)
+	userID := uuid.New()
+	cart := newTestCart(userID, 1, 1, 2)
+
+	if err := repo.SaveCart(context.Background(), cart); err != nil {
+		t.Fatalf("SaveCart() = %v", err)
+	}
+	server.FastForward(30 * time.Minute)
+	if _, err := repo.GetUserCart(context.Background(), userID.String()); err != nil {
+		t.Fatalf("GetUserCart() = %v", err)
+	}
+
+	keys := []string{getUserCartKey(userID.String()), getUserCartsKey(userID.String())}
+	for _, item := range cart.Items {
+		keys = append(keys, getCartKey(userID.String(), item.LineKey()))
+	}
+	for _, key := range keys {
+		if ttl := server.TTL(key); ttl != time.Hour {
+			t.Errorf("ttl of %s = %s, want %s", key, ttl, time.Hour)
+		}
+	}
+}
+
+// the same product in the carts of two users are two lines, one user never sees or deletes the line of the other
+func TestCartKeysPerUser(t *testing.T) {
+	repo, server := newTestCartRedisRepo(t)
+	ctx := context.Background()
+
+	alice := newTestCart(uuid.New(), 1, 2)
+	bob := newTestCart(uuid.New(), 1, 5)
+	bob.Items[0].ProductID = alice.Items[0].ProductID
+
+	for _, cart := range []*entity.Cart{alice, bob} {
+		if err := repo.SaveCart(ctx, cart); err != nil {
+			t.Fatalf("SaveCart() = %v", err)
+		}
+	}
+
+	if got := cachedQuantities(t, repo, alice.UserID); len(got) != 1 || got[0] != 2 {
+		t.Errorf("alice cart = %v, want [2]", got)
+	}
+	if got := cachedQuantities(t, repo, bob.UserID); len(got) != 1 || got[0] != 5 {
+		t.Errorf("bob cart = %v, want [5]", got)
+	}
+
+	if err := repo.DeleteCarts(ctx, alice.UserID.String()); err != nil {
+		t.Fatalf("DeleteCarts() = %v", err)
+	}
+	if got := cachedQuantities(t, repo, alice.UserID); got != nil {
+		t.Errorf("alice cart after delete = %v, want a miss", got)
+	}
+	if got := cachedQuantities(t, repo, bob.UserID); len(got) != 1 || got[0] != 5 {
+		t.Errorf("bob cart after deleting alice = %v, want [5]", got)
+	}
+
+	// the product index keeps only the line of bob
+	members, err := server.SMembers(getProductCartsKey(bob.Items[0].ProductID.String()))
+	if err != nil || len(members) != 1 || members[0] != getCartKey(bob.UserID.String(), bob.Items[0].LineKey()) {
+		t.Errorf("product index = %v, %v, want only the line of bob", members, err)
+	}
+}
+
+func TestScanUserIDs(t *testing.T) {
+	repo, server := newTestCartRedisRepo(t)
+	ctx := context.Background()
+
+	want := map[string]bool{}
+	for i := 0; i < scanPageSize+5; i++ {
+		cart := newTestCart(uuid.New(), 1, 1)
+		if err := repo.SaveCart(ctx, cart); err != nil {
+			t.Fatalf("SaveCart() = %v", err)
+		}
+		want[cart.UserID.String()] = true
+	}
+	// a user whose cart has no line has no line set to find
+	if err := repo.SaveCart(ctx, newTestCart(uuid.New(), 1)); err != nil {
+		t.Fatalf("SaveCart() = %v", err)
+	}
+
+	userIDs, err := repo.ScanUserIDs(ctx)
+	if err != nil {
+		t.Fatalf("ScanUserIDs() = %v", err)
+	}
+	if len(userIDs) != len(want) {
+		t.Fatalf("ScanUserIDs() found %d users, want %d", len(userIDs), len(want))
+	}
+	for _, userID := range userIDs {
+		if !want[userID] {
+			t.Errorf("ScanUserIDs() found unknown user %q", userID)
+		}
+	}
+
+	server.Close()
+	if _, err := repo.ScanUserIDs(ctx); err == nil {
+		t.Error("ScanUserIDs() = nil, want an error while redis is down")
+	}
+}
+
+func TestDeleteLegacyCartKeys(t *testing.T) {
+	repo, server := newTestCartRedisRepo(t)
+	ctx := context.Background()
+
+	cart := newTestCart(uuid.New(), 1, 1)
+	if err := repo.SaveCart(ctx, cart); err != nil {
+		t.Fatalf("SaveCart() = %v", err)
+	}
+	legacyKeys := []string{"cart:" + uuid.NewString(), "cart:" + uuid.NewString()}
+	for _, key := range legacyKeys {
+		server.HSet(key, "product_quantity", "1")
+	}
+	// not a product id, left alone
+	server.HSet("cart:report", "lines", "1")
+
+	deleted, err := repo.DeleteLegacyCartKeys(ctx)
+	if err != nil || deleted != len(legacyKeys) {
+		t.Fatalf("DeleteLegacyCartKeys() = %d, %v, want %d", deleted, err, len(legacyKeys))
+	}
+	for _, key := range legacyKeys {
+		if server.Exists(key) {
+			t.Errorf("legacy key %s was kept", key)
+		}
+	}
+	if !server.Exists("cart:report") {
+		t.Error("a key that is not a legacy cart was deleted")
+	}
+	if got := cachedQuantities(t, repo, cart.UserID); len(got) != 1 {
+		t.Errorf("cart of the user = %v, want its line kept", got)
+	}
+}
+
+func TestCartLinesOfOneProduct(t *testing.T) {
+	repo, server := newTestCartRedisRepo(t)
+	ctx := context.Background()
+
+	cart := newTestCart(uuid.New(), 1, 1, 2, 3)
+	productID := cart.Items[0].ProductID
+	variantID := uuid.New()
+	cart.Items[0].Options = map[string]string{"color": "red"}
+	cart.Items[1].ProductID = productID
+	cart.Items[1].Options = map[string]string{"color": "blue"}
+	cart.Items[2].ProductID = productID
+	cart.Items[2].VariantID = variantID
+
+	if err := repo.SaveCart(ctx, cart); err != nil {
+		t.Fatalf("SaveCart() = %v", err)
+	}
+
+	cached, err := repo.GetUserCart(ctx, cart.UserID.String())
+	if err != nil || cached == nil || len(cached.Items) != 3 {
+		t.Fatalf("GetUserCart() = %v, %v, want the three lines", cached, err)
+	}
+	byID := make(map[uuid.UUID]*entity.CartItem, len(cached.Items))
+	for _, item := range cached.Items {
+		byID[item.ID] = item
+	}
+	for _, want := range cart.Items {
+		got := byID[want.ID]
+		if got == nil {
+			t.Fatalf("line %s is not cached", want.ID)
+		}
+		if got.LineKey() != want.LineKey() || got.VariantID != want.VariantID || got.ProductQuantity != want.ProductQuantity {
+			t.Errorf("cached line %s = key %q quantity %d, want key %q quantity %d", want.ID, got.LineKey(), got.ProductQuantity, want.LineKey(), want.ProductQuantity)
+		}
+	}
+
+	// the product index holds every line of the product and a catalog update reaches each one
+	members, _ := server.SMembers(getProductCartsKey(productID.String()))
+	if len(members) != 3 {
+		t.Errorf("product index = %v, want the three lines", members)
+	}
+	if err := repo.UpdateNameAndPrice(ctx, &entity.CartItem{ProductID: productID, ProductName: "big mug", ProductPrice: 2499, Currency: "USD"}); err != nil {
+		t.Fatalf("UpdateNameAndPrice() = %v", err)
+	}
+	cached, _ = repo.GetUserCart(ctx, cart.UserID.String())
+	for _, item := range cached.Items {
+		if item.ProductName != "big mug" || item.ProductPrice != 2499 {
+			t.Errorf("line %s = %q at %d after the update", item.LineKey(), item.ProductName, item.ProductPrice)
+		}
+	}
+}
+
+func TestUpdateNameAndPrice(t *testing.T) {
+	repo, server := newTestCartRedisRepo(t)
+	ctx := context.Background()
+
+	usd := newTestCart(uuid.New(), 1, 1)
+	eur := newTestCart(uuid.New(), 1, 1)
+	eur.Currency = "EUR"
+	eur.Items[0].Currency = "EUR"
+	expired := newTestCart(uuid.New(), 1, 1)
+	productID := usd.Items[0].ProductID
+	eur.Items[0].ProductID = productID
+	expired.Items[0].ProductID = productID
+
+	for _, cart := range []*entity.Cart{usd, eur, expired} {
+		if err := repo.SaveCart(ctx, cart); err != nil {
+			t.Fatalf("SaveCart() = %v", err)
+		}
+	}
+	expiredKey := getCartKey(expired.UserID.String(), expired.Items[0].LineKey())
+	server.Del(expiredKey)
+
+	err := repo.UpdateNameAndPrice(ctx, &entity.CartItem{ProductID: productID, ProductName: "big mug", ProductPrice: 2499, Currency: "USD"})
+	if err != nil {
+		t.Fatalf("UpdateNameAndPrice() = %v", err)
+	}
+
+	tests := []struct {
+		cart      *entity.Cart
+		wantPrice int64
+	}{
+		{cart: usd, wantPrice: 2499},
+		// priced in another currency, only renamed
+		{cart: eur, wantPrice: 1999},
+	}
+	for _, tt := range tests {
+		cached, errGet := repo.GetUserCart(ctx, tt.cart.UserID.String())
+		if errGet != nil || cached == nil {
+			t.Fatalf("GetUserCart(%s) = %v, %v", tt.cart.Currency, cached, errGet)
+		}
+		if item := cached.Items[0]; item.ProductName != "big mug" || item.ProductPrice != tt.wantPrice {
+			t.Errorf("%s line = %q at %d, want %q at %d", tt.cart.Currency, item.ProductName, item.ProductPrice, "big mug", tt.wantPrice)
+		}
+	}
+
+	// the update dropped the expired line from the index instead of recreating it
+	if server.Exists(expiredKey) {
+		t.Error("the update recreated an expired line")
+	}
+	members, _ := server.SMembers(getProductCartsKey(productID.String()))
+	if len(members) != 2 {
+		t.Errorf("product index = %v, want the two cached lines", members)
+	}
+}
+
+func TestUpdateNameAndPriceRedisDown(t *testing.T) {
+	repo, server := newTestCartRedisRepo(t)
+	server.Close()
+
+	if err := repo.UpdateNameAndPrice(context.Background(), &entity.CartItem{ProductID: uuid.New()}); err == nil {
+		t.Fatal("UpdateNameAndPrice() = nil, want an error while redis is down")
+	}
+}
+
+func TestRebuildProductIndex(t *testing.T) {
+	repo, server := newTestCartRedisRepo(t)
+	ctx := context.Background()
+
+	cart := newTestCart(uuid.New(), 1, 1, 1)
+	line := cart.Items[0]
+	lineKey := getCartKey(line.UserID.String(), line.LineKey())
+
+	// a stale entry of the product and the index of a product no cart holds anymore
+	server.SAdd(getProductCartsKey(line.ProductID.String()), "cart:gone:line")
+	gone := getProductCartsKey(uuid.NewString())
+	server.SAdd(gone, "cart:gone:line")
+
+	if err := repo.RebuildProductIndex(ctx, cart.Items); err != nil {
+		t.Fatalf("RebuildProductIndex() = %v", err)
+	}
+
+	members, _ := server.SMembers(getProductCartsKey(line.ProductID.String()))
+	if len(members) != 1 || members[0] != lineKey {
+		t.Errorf("product index = %v, want [%s]", members, lineKey)
+	}
+	if server.Exists(gone) {
+		t.Error("index of a product without lines was kept")
+	}
+	if server.Exists(getProductCartsRebuildKey(line.ProductID.String())) {
+		t.Error("rebuild key was left behind")
+	}
+	if ttl := server.TTL(getProductCartsKey(line.ProductID.String())); ttl != time.Hour {
+		t.Errorf("product index ttl = %s, want %s", ttl, time.Hour)
+	}
+}
@@ -0,0 +1,67 @@
+package repo
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/idoyudha/eshop-cart/internal/entity"
+	rClient "github.com/idoyudha/eshop-cart/pkg/redis"
+	"github.com/redis/go-redis/v9"
+)
+
+const cartSnapshotKey = "cart_snapshot"
+
+// CartSnapshotRedisRepo keeps shared cart snapshots until they expire
+type CartSnapshotRedisRepo struct {
+	*rClient.RedisClient
+}
+
+func NewCartSnapshotRedisRepo(client *rClient.RedisClient) *CartSnapshotRedisRepo {
+	return &CartSnapshotRedisRepo{client}
+}
+
+func getCartSnapshotKey(id string) string {
+	return fmt.Sprintf("%s:%s", cartSnapshotKey, id)
+}
+
+// Save stores the snapshot until its ExpiresAt, a snapshot already expired is rejected
+// since redis would otherwise keep it forever or keep the ttl of a previous value
+func (r *CartSnapshotRedisRepo) Save(ctx context.Context, snapshot *entity.CartSnapshot) error {
+	ttl := time.Until(snapshot.ExpiresAt)
+	if ttl <= 0 {
+		return fmt.Errorf("cart snapshot %s expired at %s", snapshot.ID, snapshot.ExpiresAt.Format(time.RFC3339))
+	}
+
+	value, err := json.Marshal(snapshot)
+	if err != nil {
+		return fmt.Errorf("failed to marshal cart snapshot: %w", err)
+	}
+
+	err = r.Client.Set(ctx, getCartSnapshotKey(snapshot.ID), value, ttl).Err()
+	if err != nil {
+		return fmt.Errorf("failed to save cart snapshot to redis: %w", err)
+	}
+
+	return nil
+}
+
+// Get returns nil when the snapshot does not exist or expired
+func (r *CartSnapshotRedisRepo) Get(ctx context.Context, id string) (*entity.CartSnapshot, error) {
+	stored, err := r.Client.Get(ctx, getCartSnapshotKey(id)).Bytes()
+	if errors.Is(err, redis.Nil) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get cart snapshot from redis: %w", err)
+	}
+
+	var snapshot entity.CartSnapshot
+	if err := json.Unmarshal(stored, &snapshot); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal cart snapshot: %w", err)
+	}
+
+	return &snapshot, nil
+}
@@ -0,0 +1,184 @@
+package repo
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/idoyudha/eshop-cart/internal/entity"
+	mysqlClient "github.com/idoyudha/eshop-cart/pkg/mysql"
+)
+
+type CheckoutMySQLRepo struct {
+	*mysqlClient.MySQL
+}
+
+func NewCheckoutMySQLRepo(client *mysqlClient.MySQL) *CheckoutMySQLRepo {
+	return &CheckoutMySQLRepo{
+		client,
+	}
+}
+
+const queryInsertCheckout = `INSERT INTO checkouts (id, user_id, cart_id, item_ids, address, state, created_at, updated_at) VALUES (?, ?, ?, ?, ?, ?, ?, ?);`
+
+func (r *CheckoutMySQLRepo) Insert(ctx context.Context, checkout *entity.Checkout) error {
+	itemIDs, errItems := json.Marshal(checkout.ItemIDs)
+	if errItems != nil {
+		return errItems
+	}
+	address, errAddress := json.Marshal(checkout.Address)
+	if errAddress != nil {
+		return errAddress
+	}
+
+	stmt, errStmt := r.Executor(ctx).PrepareContext(ctx, queryInsertCheckout)
+	if errStmt != nil {
+		return errStmt
+	}
+	defer stmt.Close()
+
+	_, insertErr := stmt.ExecContext(ctx, checkout.ID, checkout.UserID, checkout.CartID, itemIDs, address, checkout.State, checkout.CreatedAt, checkout.UpdatedAt)
+	if insertErr != nil {
+		return insertErr
+	}
+
+	return nil
+}
+
+const queryTransitionCheckout = `UPDATE checkouts SET state = ?, order_id = ?, last_error = ?, updated_at = ? WHERE id = ? AND state = ?`
+
+// Transition stores the state, order and error of the checkout if it is still in state from.
+// it returns false when another process moved the checkout first
+func (r *CheckoutMySQLRepo) Transition(ctx context.Context, checkout *entity.Checkout, from string) (bool, error) {
+	stmt, errStmt := r.Executor(ctx).PrepareContext(ctx, queryTransitionCheckout)
+	if errStmt != nil {
+		return false, errStmt
+	}
+	defer stmt.Close()
+
+	orderID := uuid.NullUUID{UUID: checkout.OrderID, Valid: checkout.OrderID != uuid.Nil}
+	lastError := sql.NullString{String: checkout.LastError, Valid: checkout.LastError != ""}
+
+	result, err := stmt.ExecContext(ctx, checkout.State, orderID, lastError, checkout.UpdatedAt, checkout.ID, from)
+	if err != nil {
+		return false, err
+	}
+
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+
+	return affected > 0, nil
+}
+
+const queryUpdateCheckoutReservation = `UPDATE checkouts SET reservation_id = ?, reservation_state = ?, reservation_expires_at = ?, last_error = ? WHERE id = ?`
+
+// UpdateReservation stores the reservation and the last error of the checkout, it leaves its state alone
+func (r *CheckoutMySQLRepo) UpdateReservation(ctx context.Context, checkout *entity.Checkout) error {
+	stmt, errStmt := r.Executor(ctx).PrepareContext(ctx, queryUpdateCheckoutReservation)
+	if errStmt != nil {
+		return errStmt
+	}
+	defer stmt.Close()
+
+	reservationID := sql.NullString{String: checkout.ReservationID, Valid: checkout.ReservationID != ""}
+	reservationState := sql.NullString{String: checkout.ReservationState, Valid: checkout.ReservationState != ""}
+	expiresAt := sql.NullTime{Time: checkout.ReservationExpiresAt, Valid: !checkout.ReservationExpiresAt.IsZero()}
+	lastError := sql.NullString{String: checkout.LastError, Valid: checkout.LastError != ""}
+
+	_, updateErr := stmt.ExecContext(ctx, reservationID, reservationState, expiresAt, lastError, checkout.ID)
+	if updateErr != nil {
+		return updateErr
+	}
+
+	return nil
+}
+
+const checkoutColumns = `id, user_id, cart_id, item_ids, address, state, order_id, reservation_id, reservation_state, reservation_expires_at, last_error, created_at, updated_at`
+
+func scanCheckout(row rowScanner) (*entity.Checkout, error) {
+	checkout := &entity.Checkout{}
+	var itemIDs, address []byte
+	var orderID uuid.NullUUID
+	var reservationID, reservationState, lastError sql.NullString
+	var expiresAt sql.NullTime
+	err := row.Scan(&checkout.ID, &checkout.UserID, &checkout.CartID, &itemIDs, &address, &checkout.State, &orderID,
+		&reservationID, &reservationState, &expiresAt, &lastError, &checkout.CreatedAt, &checkout.UpdatedAt)
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(itemIDs, &checkout.ItemIDs); err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(address, &checkout.Address); err != nil {
+		return nil, err
+	}
+	checkout.OrderID = orderID.UUID
+	checkout.ReservationID = reservationID.String
+	checkout.ReservationState = reservationState.String
+	checkout.ReservationExpiresAt = expiresAt.Time
+	checkout.LastError = lastError.String
+
+	return checkout, nil
+}
+
+func (r *CheckoutMySQLRepo) getCheckouts(ctx context.Context, query string, args ...interface{}) ([]*entity.Checkout, error) {
+	stmt, errStmt := r.Executor(ctx).PrepareContext(ctx, query)
+	if errStmt != nil {
+		return nil, errStmt
+	}
+	defer stmt.Close()
+
+	rows, err := stmt.QueryContext(ctx, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	checkouts := make([]*entity.Checkout, 0)
+	for rows.Next() {
+		checkout, err := scanCheckout(rows)
+		if err != nil {
+			return nil, err
+		}
+		checkouts = append(checkouts, checkout)
+	}
+
+	return checkouts, rows.Err()
+}
+
+const getStuckCheckoutsQuery = `SELECT ` + checkoutColumns + ` FROM checkouts WHERE state IN`
+
+// GetStuck returns up to limit checkouts in one of states that did not move since before updatedBefore, oldest first
+func (r *CheckoutMySQLRepo) GetStuck(ctx context.Context, states []string, updatedBefore time.Time, limit int) ([]*entity.Checkout, error) {
+	if len(states) == 0 {
+		return make([]*entity.Checkout, 0), nil
+	}
+
+	placeholders := "?" + strings.Repeat(",?", len(states)-1)
+	query := getStuckCheckoutsQuery + " (" + placeholders + ") AND updated_at < ? ORDER BY updated_at LIMIT ?"
+
+	args := make([]interface{}, 0, len(states)+2)
+	for _, state := range states {
+		args = append(args, state)
+	}
+	args = append(args, updatedBefore, limit)
+
+	return r.getCheckouts(ctx, query, args...)
+}
+
+// a checkout with an order keeps its reservation, the recovery confirms it
+const getExpiredReservationsQuery = `SELECT ` + checkoutColumns + ` FROM checkouts
+WHERE reservation_state = 'reserved' AND reservation_expires_at < ? AND state = 'failed'
+ORDER BY reservation_expires_at
+LIMIT ?`
+
+// GetExpiredReservations returns up to limit failed checkouts whose reservation expired before expiredBefore
+// and was not released yet, oldest first
+func (r *CheckoutMySQLRepo) GetExpiredReservations(ctx context.Context, expiredBefore time.Time, limit int) ([]*entity.Checkout, error) {
+	return r.getCheckouts(ctx, getExpiredReservationsQuery, expiredBefore, limit)
+}
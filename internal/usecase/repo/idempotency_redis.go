@@ -0,0 +1,90 @@
+package repo
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/idoyudha/eshop-cart/internal/entity"
+	rClient "github.com/idoyudha/eshop-cart/pkg/redis"
+	"github.com/redis/go-redis/v9"
+)
+
+const idempotencyKey = "idempotency"
+
+// stores the record only if the key is free, otherwise returns the record already stored
+// KEYS[1] -> idempotency:{key}, ARGV[1] -> record, ARGV[2] -> ttl in milliseconds
+var reserveIdempotencyKeyScript = redis.NewScript(`
+if redis.call("SET", KEYS[1], ARGV[1], "NX", "PX", ARGV[2]) then
+	return false
+end
+return redis.call("GET", KEYS[1])
+`)
+
+type IdempotencyRedisRepo struct {
+	*rClient.RedisClient
+}
+
+func NewIdempotencyRedisRepo(client *rClient.RedisClient) *IdempotencyRedisRepo {
+	return &IdempotencyRedisRepo{client}
+}
+
+func getIdempotencyKey(key string) string {
+	return fmt.Sprintf("%s:%s", idempotencyKey, key)
+}
+
+// Reserve stores record under its key for ttl and returns nil,
+// or returns the record stored before when the key is already taken
+func (r *IdempotencyRedisRepo) Reserve(ctx context.Context, record *entity.IdempotencyRecord, ttl time.Duration) (*entity.IdempotencyRecord, error) {
+	value, err := json.Marshal(record)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal idempotency record: %w", err)
+	}
+
+	stored, err := reserveIdempotencyKeyScript.Run(
+		ctx,
+		r.Client,
+		[]string{getIdempotencyKey(record.Key)},
+		value,
+		ttl.Milliseconds(),
+	).Text()
+	if errors.Is(err, redis.Nil) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to reserve idempotency key in redis: %w", err)
+	}
+
+	var existing entity.IdempotencyRecord
+	if err := json.Unmarshal([]byte(stored), &existing); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal idempotency record: %w", err)
+	}
+
+	return &existing, nil
+}
+
+// Save overwrites the record stored under its key and resets the expiry to ttl
+func (r *IdempotencyRedisRepo) Save(ctx context.Context, record *entity.IdempotencyRecord, ttl time.Duration) error {
+	value, err := json.Marshal(record)
+	if err != nil {
+		return fmt.Errorf("failed to marshal idempotency record: %w", err)
+	}
+
+	err = r.Client.Set(ctx, getIdempotencyKey(record.Key), value, ttl).Err()
+	if err != nil {
+		return fmt.Errorf("failed to save idempotency record to redis: %w", err)
+	}
+
+	return nil
+}
+
+func (r *IdempotencyRedisRepo) Delete(ctx context.Context, key string) error {
+	err := r.Client.Del(ctx, getIdempotencyKey(key)).Err()
+	if err != nil {
+		return fmt.Errorf("failed to delete idempotency record from redis: %w", err)
+	}
+
+	return nil
+}
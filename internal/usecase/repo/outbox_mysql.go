@@ -0,0 +1,156 @@
+package repo
+
+import (
+	"context"
+	"database/sql"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/idoyudha/eshop-cart/internal/entity"
+	mysqlClient "github.com/idoyudha/eshop-cart/pkg/mysql"
+)
+
+type OutboxMySQLRepo struct {
+	*mysqlClient.MySQL
+}
+
+func NewOutboxMySQLRepo(client *mysqlClient.MySQL) *OutboxMySQLRepo {
+	return &OutboxMySQLRepo{
+		client,
+	}
+}
+
+const queryInsertOutboxEvent = `INSERT INTO cart_outbox (id, aggregate_id, event_type, payload, attempts, created_at, next_attempt_at) VALUES (?, ?, ?, ?, ?, ?, ?);`
+
+func (r *OutboxMySQLRepo) Insert(ctx context.Context, event *entity.OutboxEvent) error {
+	stmt, errStmt := r.Executor(ctx).PrepareContext(ctx, queryInsertOutboxEvent)
+	if errStmt != nil {
+		return errStmt
+	}
+	defer stmt.Close()
+
+	_, insertErr := stmt.ExecContext(ctx, event.ID, event.AggregateID, event.EventType, event.Payload, event.Attempts, event.CreatedAt, event.NextAttemptAt)
+	if insertErr != nil {
+		return insertErr
+	}
+
+	return nil
+}
+
+const querySelectPendingOutboxEvents = `SELECT id, aggregate_id, event_type, payload, attempts, last_error, created_at, next_attempt_at FROM cart_outbox WHERE processed_at IS NULL AND next_attempt_at <= ? ORDER BY created_at LIMIT ? FOR UPDATE SKIP LOCKED`
+const queryLeaseOutboxEvents = `UPDATE cart_outbox SET next_attempt_at = ? WHERE id IN`
+
+// ClaimPending returns up to limit events that are due and pushes their next attempt
+// by lease, so other relay instances skip them while they are being applied
+func (r *OutboxMySQLRepo) ClaimPending(ctx context.Context, limit int, lease time.Duration) ([]*entity.OutboxEvent, error) {
+	events := make([]*entity.OutboxEvent, 0)
+
+	err := r.WithTx(ctx, func(txCtx context.Context) error {
+		now := time.Now()
+
+		stmt, errStmt := r.Executor(txCtx).PrepareContext(txCtx, querySelectPendingOutboxEvents)
+		if errStmt != nil {
+			return errStmt
+		}
+		defer stmt.Close()
+
+		rows, err := stmt.QueryContext(txCtx, now, limit)
+		if err != nil {
+			return err
+		}
+		defer rows.Close()
+
+		for rows.Next() {
+			event := &entity.OutboxEvent{}
+			var lastError sql.NullString
+			err := rows.Scan(&event.ID, &event.AggregateID, &event.EventType, &event.Payload, &event.Attempts, &lastError, &event.CreatedAt, &event.NextAttemptAt)
+			if err != nil {
+				return err
+			}
+			event.LastError = lastError.String
+			events = append(events, event)
+		}
+
+		if err := rows.Err(); err != nil {
+			return err
+		}
+
+		if len(events) == 0 {
+			return nil
+		}
+
+		placeholders := "?" + strings.Repeat(",?", len(events)-1)
+		query := queryLeaseOutboxEvents + " (" + placeholders + ")"
+
+		args := make([]interface{}, len(events)+1)
+		args[0] = now.Add(lease)
+		for i, event := range events {
+			args[i+1] = event.ID
+		}
+
+		_, err = r.Executor(txCtx).ExecContext(txCtx, query, args...)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return events, nil
+}
+
+const queryMarkOutboxEventProcessed = `UPDATE cart_outbox SET processed_at = ?, attempts = attempts + 1, last_error = NULL WHERE id = ?`
+
+func (r *OutboxMySQLRepo) MarkProcessed(ctx context.Context, eventID uuid.UUID) error {
+	stmt, errStmt := r.Executor(ctx).PrepareContext(ctx, queryMarkOutboxEventProcessed)
+	if errStmt != nil {
+		return errStmt
+	}
+	defer stmt.Close()
+
+	_, updateErr := stmt.ExecContext(ctx, time.Now(), eventID)
+	if updateErr != nil {
+		return updateErr
+	}
+
+	return nil
+}
+
+const queryMarkOutboxEventFailed = `UPDATE cart_outbox SET attempts = attempts + 1, last_error = ?, next_attempt_at = ? WHERE id = ? AND processed_at IS NULL`
+
+func (r *OutboxMySQLRepo) MarkFailed(ctx context.Context, eventID uuid.UUID, lastError string, nextAttemptAt time.Time) error {
+	stmt, errStmt := r.Executor(ctx).PrepareContext(ctx, queryMarkOutboxEventFailed)
+	if errStmt != nil {
+		return errStmt
+	}
+	defer stmt.Close()
+
+	// last_error column is VARCHAR(255)
+	if len(lastError) > 255 {
+		lastError = lastError[:255]
+	}
+
+	_, updateErr := stmt.ExecContext(ctx, lastError, nextAttemptAt, eventID)
+	if updateErr != nil {
+		return updateErr
+	}
+
+	return nil
+}
+
+const queryDeleteProcessedOutboxEvents = `DELETE FROM cart_outbox WHERE processed_at IS NOT NULL AND processed_at < ?`
+
+func (r *OutboxMySQLRepo) DeleteProcessedBefore(ctx context.Context, before time.Time) (int64, error) {
+	stmt, errStmt := r.Executor(ctx).PrepareContext(ctx, queryDeleteProcessedOutboxEvents)
+	if errStmt != nil {
+		return 0, errStmt
+	}
+	defer stmt.Close()
+
+	result, deleteErr := stmt.ExecContext(ctx, before)
+	if deleteErr != nil {
+		return 0, deleteErr
+	}
+
+	return result.RowsAffected()
+}
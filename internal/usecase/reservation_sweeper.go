@@ -0,0 +1,79 @@
+package usecase
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/idoyudha/eshop-cart/config"
+	"github.com/idoyudha/eshop-cart/internal/entity"
+	"github.com/idoyudha/eshop-cart/pkg/logger"
+)
+
+// ReservationSweeperUseCase releases the expired stock reservations of failed checkouts whose release failed.
+// a pending checkout may still get its order, it is left to the checkout recovery
+type ReservationSweeperUseCase struct {
+	repoCheckout CheckoutMySQLRepo
+	cart         *CartUseCase
+	cfg          config.InventoryService
+	l            logger.Interface
+}
+
+func NewReservationSweeperUseCase(
+	repoCheckout CheckoutMySQLRepo,
+	cart *CartUseCase,
+	cfg config.InventoryService,
+	l logger.Interface,
+) *ReservationSweeperUseCase {
+	return &ReservationSweeperUseCase{
+		repoCheckout,
+		cart,
+		cfg,
+		l,
+	}
+}
+
+// Run sweeps every cfg.SweepInterval until ctx is done, a zero interval disables it
+func (u *ReservationSweeperUseCase) Run(ctx context.Context) {
+	if u.cfg.SweepInterval <= 0 {
+		return
+	}
+
+	ticker := time.NewTicker(u.cfg.SweepInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if _, err := u.Sweep(ctx); err != nil {
+				u.l.Error(err, "usecase - ReservationSweeperUseCase - Run - Sweep")
+			}
+		}
+	}
+}
+
+// Sweep releases one batch of expired reservations and returns how many it released
+func (u *ReservationSweeperUseCase) Sweep(ctx context.Context) (int, error) {
+	checkoutMetrics.Add("sweeper_runs", 1)
+	ctx = ContextWithActor(ctx, entity.CartActor{ID: "reservation-sweeper", Source: entity.CartEventSourceSystem})
+
+	expired, err := u.repoCheckout.GetExpiredReservations(ctx, time.Now(), u.cfg.SweepBatchSize)
+	if err != nil {
+		return 0, fmt.Errorf("failed to get expired reservations: %w", err)
+	}
+
+	var released int
+	for _, checkout := range expired {
+		if errStep := u.cart.releaseStock(ctx, checkout); errStep != nil {
+			// the next run retries it
+			u.l.Warn("usecase - ReservationSweeperUseCase - Sweep - checkout %s reservation %s: %s", checkout.ID, checkout.ReservationID, errStep)
+			continue
+		}
+		released++
+	}
+
+	checkoutMetrics.Add("reservations_released", int64(released))
+	return released, nil
+}
@@ -0,0 +1,109 @@
+package usecase
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/idoyudha/eshop-cart/config"
+	"github.com/idoyudha/eshop-cart/internal/entity"
+	"github.com/idoyudha/eshop-cart/pkg/logger"
+)
+
+// sweeperCheckoutRepo returns the expired reservations it holds and records their new state
+type sweeperCheckoutRepo struct {
+	CheckoutMySQLRepo
+	expired []*entity.Checkout
+	err     error
+	limit   int
+	states  map[uuid.UUID]string
+}
+
+func (f *sweeperCheckoutRepo) GetExpiredReservations(_ context.Context, _ time.Time, limit int) ([]*entity.Checkout, error) {
+	f.limit = limit
+	return f.expired[:min(limit, len(f.expired))], f.err
+}
+
+func (f *sweeperCheckoutRepo) UpdateReservation(_ context.Context, checkout *entity.Checkout) error {
+	f.states[checkout.ID] = checkout.ReservationState
+	return nil
+}
+
+func TestSweepReservations(t *testing.T) {
+	reserved := func(reservationID string) *entity.Checkout {
+		return &entity.Checkout{ID: uuid.New(), ReservationID: reservationID, ReservationState: entity.ReservationStateReserved, ReservationExpiresAt: time.Now().Add(-time.Minute)}
+	}
+
+	tests := []struct {
+		name        string
+		expired     []*entity.Checkout
+		releaseErrs map[string]error
+		wantCount   int
+		wantRelease []string
+	}{
+		{name: "nothing expired"},
+		{name: "every reservation released", expired: []*entity.Checkout{reserved("r1"), reserved("r2")}, wantCount: 2, wantRelease: []string{"r1", "r2"}},
+		{
+			name:        "a failed release is left for the next run",
+			expired:     []*entity.Checkout{reserved("r1"), reserved("r2"), reserved("r3")},
+			releaseErrs: map[string]error{"r2": entity.ErrInventoryServiceUnavailable},
+			wantCount:   2,
+			wantRelease: []string{"r1", "r3"},
+		},
+		{
+			name:        "one batch per run",
+			expired:     []*entity.Checkout{reserved("r1"), reserved("r2"), reserved("r3"), reserved("r4")},
+			wantCount:   3,
+			wantRelease: []string{"r1", "r2", "r3"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			checkouts := &sweeperCheckoutRepo{expired: tt.expired, states: make(map[uuid.UUID]string)}
+			inventory := &fakeInventory{releaseErrs: tt.releaseErrs}
+			cart := &CartUseCase{repoCheckout: checkouts, inventory: inventory}
+			uc := NewReservationSweeperUseCase(checkouts, cart, config.InventoryService{SweepBatchSize: 3}, logger.New("error"))
+
+			released, err := uc.Sweep(context.Background())
+			if err != nil {
+				t.Fatalf("Sweep() = %v", err)
+			}
+			if released != tt.wantCount || checkouts.limit != 3 {
+				t.Errorf("Sweep() = %d with a batch of %d, want %d with a batch of 3", released, checkouts.limit, tt.wantCount)
+			}
+			if len(inventory.released) != len(tt.wantRelease) {
+				t.Fatalf("released %v, want %v", inventory.released, tt.wantRelease)
+			}
+			for i, reservationID := range tt.wantRelease {
+				if inventory.released[i] != reservationID {
+					t.Errorf("released %v, want %v", inventory.released, tt.wantRelease)
+				}
+			}
+
+			for _, checkout := range tt.expired[:min(3, len(tt.expired))] {
+				want := entity.ReservationStateReleased
+				if tt.releaseErrs[checkout.ReservationID] != nil {
+					// still reserved in mysql, so the next run picks it up again
+					want = ""
+				}
+				if checkouts.states[checkout.ID] != want {
+					t.Errorf("checkout %s stored as %q, want %q", checkout.ReservationID, checkouts.states[checkout.ID], want)
+				}
+			}
+		})
+	}
+}
+
+func TestSweepReservationsReadError(t *testing.T) {
+	errDB := errors.New("db down")
+	checkouts := &sweeperCheckoutRepo{err: errDB, states: make(map[uuid.UUID]string)}
+	inventory := &fakeInventory{}
+	uc := NewReservationSweeperUseCase(checkouts, &CartUseCase{repoCheckout: checkouts, inventory: inventory}, config.InventoryService{SweepBatchSize: 3}, logger.New("error"))
+
+	if released, err := uc.Sweep(context.Background()); !errors.Is(err, errDB) || released != 0 || len(inventory.released) != 0 {
+		t.Errorf("Sweep() = %d, %v after releasing %v, want %v before any release", released, err, inventory.released, errDB)
+	}
+}
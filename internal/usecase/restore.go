@@ -0,0 +1,91 @@
+package usecase
+
+import (
+	"context"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/idoyudha/eshop-cart/internal/entity"
+)
+
+// GetRemovedItems returns the lines the user removed within the given period, most recently removed first.
+// lines ordered at checkout or folded into another line are not listed
+func (u *CartUseCase) GetRemovedItems(ctx context.Context, userID uuid.UUID, within time.Duration) ([]*entity.CartItem, error) {
+	return u.repoMySQL.GetRemovedSince(ctx, userID, time.Now().Add(-within))
+}
+
+// RestoreCartItem brings back a line the user removed into its list.
+// when the same product, variant and options were added again since, the quantity is added to that line instead
+// and the removed line can no longer be restored
+func (u *CartUseCase) RestoreCartItem(ctx context.Context, userID uuid.UUID, itemID uuid.UUID) (entity.CartItem, error) {
+	event, err := entity.NewCartChangedEvent(userID)
+	if err != nil {
+		return entity.CartItem{}, err
+	}
+
+	var restored entity.CartItem
+	err = retryDuplicate(func() error {
+		return u.mutate(ctx, event, func(txCtx context.Context) error {
+			removed, errRemoved := u.repoMySQL.GetRemovedItemByID(txCtx, userID, itemID)
+			if errRemoved != nil {
+				return errRemoved
+			}
+			if removed == nil {
+				return ErrCartItemNotFound
+			}
+
+			existing, errExist := u.repoMySQL.GetItemByLine(txCtx, removed.CartID, removed, removed.List)
+			if errExist != nil {
+				return errExist
+			}
+
+			now := time.Now()
+			if existing == nil {
+				if removed.List == entity.CartItemListCart {
+					cart, errCart := u.getOrCreateCart(txCtx, userID, removed.CartID, removed.Currency)
+					if errCart != nil {
+						return errCart
+					}
+					if cart.Currency != removed.Currency {
+						return ErrCurrencyMismatch
+					}
+					if errCount := u.validateLineCount(len(cart.Items) + 1); errCount != nil {
+						return errCount
+					}
+				}
+
+				removed.UpdatedAt = now
+				if errRestore := u.repoMySQL.RestoreItem(txCtx, removed); errRestore != nil {
+					return errRestore
+				}
+				removed.Version++
+				removed.DeletedAt = time.Time{}
+				restored = *removed
+				return u.recordEvent(txCtx, entity.CartEventItemRestored, nil, removed)
+			}
+
+			if errQuantity := newValidationError(u.checkQuantity(existing.ProductQuantity + removed.ProductQuantity)); errQuantity != nil {
+				return errQuantity
+			}
+			before := *existing
+			existing.ProductQuantity += removed.ProductQuantity
+			existing.UpdatedAt = now
+			if errUpdate := u.repoMySQL.UpdateQtyAndNote(txCtx, existing); errUpdate != nil {
+				return errUpdate
+			}
+			existing.Version++
+			restored = *existing
+
+			if errDelete := u.repoMySQL.DeleteOne(txCtx, removed.ID, entity.CartItemDeletedMerged); errDelete != nil {
+				return errDelete
+			}
+
+			return u.recordEvent(txCtx, entity.CartEventItemRestored, &before, existing)
+		})
+	})
+	if err != nil {
+		return entity.CartItem{}, err
+	}
+
+	return restored, nil
+}
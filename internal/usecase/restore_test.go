@@ -0,0 +1,124 @@
+package usecase
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/idoyudha/eshop-cart/config"
+	"github.com/idoyudha/eshop-cart/internal/entity"
+)
+
+func TestRestoreCartItem(t *testing.T) {
+	userID := uuid.New()
+	mug := uuid.New()
+	line := func(productID uuid.UUID, quantity int64, list string) *entity.CartItem {
+		return &entity.CartItem{UserID: userID, ProductID: productID, ProductQuantity: quantity, Currency: "USD", List: list, Version: 2}
+	}
+
+	tests := []struct {
+		name     string
+		currency string
+		// removed is the line to restore, deleted for reason, next to the active lines
+		removed entity.CartItem
+		reason  string
+		active  []*entity.CartItem
+		wantErr func(error) bool
+		// quantity of the line the removed one ended in, merged when that is an active line
+		wantQuantity int64
+		wantMerged   bool
+	}{
+		{name: "back into the cart", removed: *line(mug, 2, entity.CartItemListCart), wantQuantity: 2},
+		{name: "back into the saved list of a full cart", removed: *line(mug, 2, entity.CartItemListSaved), active: []*entity.CartItem{line(uuid.New(), 1, entity.CartItemListCart)}, wantQuantity: 2},
+		{name: "product added again", removed: *line(mug, 2, entity.CartItemListCart), active: []*entity.CartItem{line(mug, 3, entity.CartItemListCart)}, wantQuantity: 5, wantMerged: true},
+		{
+			name:    "merged quantity over the maximum",
+			removed: *line(mug, 6, entity.CartItemListCart), active: []*entity.CartItem{line(mug, 5, entity.CartItemListCart)},
+			wantErr: isValidationError,
+		},
+		{
+			name:    "cart full",
+			removed: *line(mug, 1, entity.CartItemListCart), active: []*entity.CartItem{line(uuid.New(), 1, entity.CartItemListCart)},
+			wantErr: isValidationError,
+		},
+		{
+			name:     "cart switched currency",
+			currency: "EUR",
+			removed:  *line(mug, 1, entity.CartItemListCart), active: []*entity.CartItem{{UserID: userID, ProductID: uuid.New(), ProductQuantity: 1, Currency: "EUR", List: entity.CartItemListCart}},
+			wantErr: func(err error) bool { return errors.Is(err, ErrCurrencyMismatch) },
+		},
+		{
+			name:    "ordered at checkout",
+			removed: *line(mug, 1, entity.CartItemListCart), reason: entity.CartItemDeletedCheckedOut,
+			wantErr: func(err error) bool { return errors.Is(err, ErrCartItemNotFound) },
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			currency := "USD"
+			if tt.currency != "" {
+				currency = tt.currency
+			}
+			cart := &entity.Cart{ID: uuid.New(), UserID: userID, Default: true, Currency: currency}
+			repo := newFakeCartRepo(cart)
+			for _, active := range tt.active {
+				active.CartID = cart.ID
+				repo.add(active)
+			}
+			removed := tt.removed
+			removed.CartID = cart.ID
+			removedID := repo.add(&removed)
+			repo.deleted[removedID] = entity.CartItemDeletedRemoved
+			if tt.reason != "" {
+				repo.deleted[removedID] = tt.reason
+			}
+
+			events := &fakeEventRepo{}
+			uc := &CartUseCase{
+				repoMySQL:  repo,
+				repoOutbox: &fakeOutboxRepo{},
+				repoEvents: events,
+				relay:      &fakeRelay{},
+				rules:      config.CartRules{MinQuantity: 1, MaxQuantity: 10, MaxLines: 1},
+			}
+
+			restored, err := uc.RestoreCartItem(context.Background(), userID, removedID)
+			if tt.wantErr != nil {
+				if !tt.wantErr(err) {
+					t.Fatalf("RestoreCartItem() = %v, want a matching error", err)
+				}
+				if len(events.types) != 0 || repo.deleted[removedID] == "" {
+					t.Error("a rejected restore changed the lines")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("RestoreCartItem() = %v", err)
+			}
+
+			if restored.ProductQuantity != tt.wantQuantity || restored.Version != 3 || !restored.DeletedAt.IsZero() {
+				t.Errorf("RestoreCartItem() = quantity %d version %d deleted at %v, want %d at version 3", restored.ProductQuantity, restored.Version, restored.DeletedAt, tt.wantQuantity)
+			}
+			if merged := restored.ID != removedID; merged != tt.wantMerged {
+				t.Errorf("restored into another line = %v, want %v", merged, tt.wantMerged)
+			}
+			wantReason := ""
+			if tt.wantMerged {
+				wantReason = entity.CartItemDeletedMerged
+			}
+			if repo.deleted[removedID] != wantReason {
+				t.Errorf("removed line deleted as %q, want %q", repo.deleted[removedID], wantReason)
+			}
+			if len(events.events) != 1 || events.types[0] != entity.CartEventItemRestored || (events.events[0].Before != nil) != tt.wantMerged {
+				t.Errorf("recorded %v, want one restore", events.types)
+			}
+
+			// a line is restored once
+			if _, err := uc.RestoreCartItem(context.Background(), userID, removedID); !errors.Is(err, ErrCartItemNotFound) {
+				t.Errorf("second RestoreCartItem() = %v, want %v", err, ErrCartItemNotFound)
+			}
+		})
+	}
+}
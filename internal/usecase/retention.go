@@ -0,0 +1,125 @@
+package usecase
+
+import (
+	"context"
+	"expvar"
+	"fmt"
+	"time"
+
+	"github.com/idoyudha/eshop-cart/config"
+	"github.com/idoyudha/eshop-cart/pkg/logger"
+)
+
+// counters of every purge of this process, exposed on /debug/vars
+var retentionMetrics = expvar.NewMap("cart_retention")
+
+// RetentionUseCase purges cart lines that were soft deleted longer than the retention period ago,
+// and guest carts past their expiry
+type RetentionUseCase struct {
+	repoMySQL CartMySQLRepo
+	cfg       config.Retention
+	l         logger.Interface
+}
+
+func NewRetentionUseCase(
+	repoMySQL CartMySQLRepo,
+	cfg config.Retention,
+	l logger.Interface,
+) *RetentionUseCase {
+	return &RetentionUseCase{
+		repoMySQL,
+		cfg,
+		l,
+	}
+}
+
+// Run purges every cfg.Interval until ctx is done, a zero interval, period or batch size disables it
+func (u *RetentionUseCase) Run(ctx context.Context) {
+	if u.cfg.Interval <= 0 || u.cfg.Period <= 0 || u.cfg.BatchSize <= 0 {
+		return
+	}
+
+	ticker := time.NewTicker(u.cfg.Interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if _, err := u.Purge(ctx, u.cfg.Archive); err != nil {
+				u.l.Error(err, "usecase - RetentionUseCase - Run - Purge")
+			}
+		}
+	}
+}
+
+// Purge removes the expired lines batch by batch, each batch in its own transaction so locks stay short.
+// with archive the lines are copied to the archive table before they are deleted
+func (u *RetentionUseCase) Purge(ctx context.Context, archive bool) (int64, error) {
+	if u.cfg.Period <= 0 {
+		return 0, fmt.Errorf("retention period must be positive, got %s", u.cfg.Period)
+	}
+	// a batch of zero would never purge anything and loop forever
+	if u.cfg.BatchSize <= 0 {
+		return 0, fmt.Errorf("retention batch size must be positive, got %d", u.cfg.BatchSize)
+	}
+
+	before := time.Now().Add(-u.cfg.Period)
+	retentionMetrics.Add("runs", 1)
+
+	var total int64
+	for {
+		select {
+		case <-ctx.Done():
+			return total, ctx.Err()
+		default:
+		}
+
+		purged, err := u.repoMySQL.PurgeDeletedBefore(ctx, before, u.cfg.BatchSize, archive)
+		if err != nil {
+			return total, fmt.Errorf("failed to purge deleted cart items: %w", err)
+		}
+		total += purged
+		retentionMetrics.Add("items_purged", purged)
+
+		if purged < int64(u.cfg.BatchSize) {
+			break
+		}
+	}
+
+	u.l.Info("purged %d cart items deleted before %s, archived: %t", total, before.Format(time.RFC3339), archive)
+
+	guests, err := u.purgeGuestCarts(ctx)
+	if err != nil {
+		return total, err
+	}
+	u.l.Info("purged %d expired guest carts", guests)
+
+	return total, nil
+}
+
+// purgeGuestCarts removes the guest carts that expired, their redis keys expire on their own
+func (u *RetentionUseCase) purgeGuestCarts(ctx context.Context) (int64, error) {
+	now := time.Now()
+
+	var total int64
+	for {
+		select {
+		case <-ctx.Done():
+			return total, ctx.Err()
+		default:
+		}
+
+		purged, err := u.repoMySQL.PurgeExpiredGuestCarts(ctx, now, u.cfg.BatchSize)
+		if err != nil {
+			return total, fmt.Errorf("failed to purge expired guest carts: %w", err)
+		}
+		total += purged
+		retentionMetrics.Add("guest_carts_purged", purged)
+
+		if purged < int64(u.cfg.BatchSize) {
+			return total, nil
+		}
+	}
+}
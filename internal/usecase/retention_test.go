@@ -0,0 +1,122 @@
+package usecase
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/idoyudha/eshop-cart/config"
+	"github.com/idoyudha/eshop-cart/pkg/logger"
+)
+
+// purgeRepo holds deleted lines and expired guest carts waiting to be purged,
+// purging fails once failAfter batches of lines were taken when it is set
+type purgeRepo struct {
+	CartMySQLRepo
+	lines     int64
+	guests    int64
+	failAfter int
+	err       error
+	batches   int
+	archived  int64
+	before    time.Time
+}
+
+func (f *purgeRepo) PurgeDeletedBefore(_ context.Context, before time.Time, limit int, archive bool) (int64, error) {
+	if f.err != nil && f.batches == f.failAfter {
+		return 0, f.err
+	}
+	f.batches++
+	f.before = before
+
+	purged := min(f.lines, int64(limit))
+	f.lines -= purged
+	if archive {
+		f.archived += purged
+	}
+	return purged, nil
+}
+
+func (f *purgeRepo) PurgeExpiredGuestCarts(_ context.Context, _ time.Time, limit int) (int64, error) {
+	purged := min(f.guests, int64(limit))
+	f.guests -= purged
+	return purged, nil
+}
+
+func TestRetentionPurge(t *testing.T) {
+	tests := []struct {
+		name        string
+		lines       int64
+		archive     bool
+		wantBatches int
+	}{
+		{name: "nothing to purge", lines: 0, wantBatches: 1},
+		{name: "last batch partial", lines: 5, wantBatches: 3},
+		// a full last batch needs one more query to see the end
+		{name: "last batch full", lines: 4, wantBatches: 3},
+		{name: "archived", lines: 3, archive: true, wantBatches: 2},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			repo := &purgeRepo{lines: tt.lines, guests: 3}
+			uc := NewRetentionUseCase(repo, config.Retention{Period: 24 * time.Hour, BatchSize: 2}, logger.New("error"))
+
+			start := time.Now()
+			purged, err := uc.Purge(context.Background(), tt.archive)
+			end := time.Now()
+			if err != nil {
+				t.Fatalf("Purge() = %v", err)
+			}
+
+			if purged != tt.lines || repo.lines != 0 || repo.batches != tt.wantBatches {
+				t.Errorf("Purge() = %d in %d batches, want %d in %d", purged, repo.batches, tt.lines, tt.wantBatches)
+			}
+			var wantArchived int64
+			if tt.archive {
+				wantArchived = tt.lines
+			}
+			if repo.archived != wantArchived {
+				t.Errorf("archived %d lines, want %d", repo.archived, wantArchived)
+			}
+			if repo.guests != 0 {
+				t.Errorf("%d expired guest carts left", repo.guests)
+			}
+			if repo.before.Before(start.Add(-24*time.Hour)) || repo.before.After(end.Add(-24*time.Hour)) {
+				t.Errorf("purged lines deleted before %s, want a day before the purge", repo.before)
+			}
+		})
+	}
+}
+
+func TestRetentionPurgeErrors(t *testing.T) {
+	errDB := errors.New("db down")
+	ctx := context.Background()
+
+	for _, cfg := range []config.Retention{{BatchSize: 2}, {Period: time.Hour}} {
+		repo := &purgeRepo{lines: 1}
+		if _, err := NewRetentionUseCase(repo, cfg, logger.New("error")).Purge(ctx, false); err == nil || repo.batches != 0 {
+			t.Errorf("Purge() with %+v = %v after %d batches, want a config error before any batch", cfg, err, repo.batches)
+		}
+	}
+
+	// the lines of the batches before the failure stay purged and are reported
+	repo := &purgeRepo{lines: 5, failAfter: 1, err: errDB, guests: 1}
+	uc := NewRetentionUseCase(repo, config.Retention{Period: time.Hour, BatchSize: 2}, logger.New("error"))
+	purged, err := uc.Purge(ctx, false)
+	if !errors.Is(err, errDB) || purged != 2 {
+		t.Errorf("Purge() = %d, %v, want 2 and %v", purged, err, errDB)
+	}
+	if repo.guests != 1 {
+		t.Error("guest carts were purged after the lines failed")
+	}
+
+	cancelled, cancel := context.WithCancel(ctx)
+	cancel()
+	repo = &purgeRepo{lines: 5}
+	uc = NewRetentionUseCase(repo, config.Retention{Period: time.Hour, BatchSize: 2}, logger.New("error"))
+	if _, err := uc.Purge(cancelled, false); !errors.Is(err, context.Canceled) || repo.batches != 0 {
+		t.Errorf("Purge() with a cancelled context = %v after %d batches, want %v", err, repo.batches, context.Canceled)
+	}
+}
@@ -0,0 +1,38 @@
+package usecase
+
+import (
+	"fmt"
+	"unicode/utf8"
+)
+
+// the checks below enforce config.CartRules, a zero maximum is not enforced
+
+func (u *CartUseCase) checkQuantity(quantity int64) []FieldViolation {
+	switch {
+	case quantity < u.rules.MinQuantity:
+		return []FieldViolation{{Field: "product_quantity", Message: fmt.Sprintf("must be at least %d", u.rules.MinQuantity)}}
+	case u.rules.MaxQuantity > 0 && quantity > u.rules.MaxQuantity:
+		return []FieldViolation{{Field: "product_quantity", Message: fmt.Sprintf("must be at most %d", u.rules.MaxQuantity)}}
+	}
+	return nil
+}
+
+func (u *CartUseCase) checkNote(note string) []FieldViolation {
+	if u.rules.MaxNoteLength > 0 && utf8.RuneCountInString(note) > u.rules.MaxNoteLength {
+		return []FieldViolation{{Field: "note", Message: fmt.Sprintf("must be at most %d characters", u.rules.MaxNoteLength)}}
+	}
+	return nil
+}
+
+// validateLine checks the quantity and note a line would have after the change
+func (u *CartUseCase) validateLine(quantity int64, note string) error {
+	return newValidationError(append(u.checkQuantity(quantity), u.checkNote(note)...))
+}
+
+// validateLineCount checks the number of lines a cart would have after the change
+func (u *CartUseCase) validateLineCount(lines int) error {
+	if u.rules.MaxLines > 0 && lines > u.rules.MaxLines {
+		return newValidationError([]FieldViolation{{Field: "items", Message: fmt.Sprintf("a cart holds at most %d lines", u.rules.MaxLines)}})
+	}
+	return nil
+}
@@ -0,0 +1,81 @@
+package usecase
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/idoyudha/eshop-cart/config"
+)
+
+func TestValidateLine(t *testing.T) {
+	u := &CartUseCase{rules: config.CartRules{MinQuantity: 1, MaxQuantity: 10, MaxNoteLength: 5}}
+
+	tests := []struct {
+		name     string
+		quantity int64
+		note     string
+		fields   []string
+	}{
+		{name: "valid", quantity: 1, note: "gift"},
+		{name: "at the maximum", quantity: 10, note: "héllo"},
+		{name: "below the minimum", quantity: 0, fields: []string{"product_quantity"}},
+		{name: "above the maximum", quantity: 11, fields: []string{"product_quantity"}},
+		{name: "note too long", quantity: 1, note: "gift wrap", fields: []string{"note"}},
+		{name: "both broken", quantity: -1, note: "gift wrap", fields: []string{"product_quantity", "note"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := u.validateLine(tt.quantity, tt.note)
+			if got := violationFields(err); strings.Join(got, ",") != strings.Join(tt.fields, ",") {
+				t.Errorf("validateLine(%d, %q) fields = %v, want %v", tt.quantity, tt.note, got, tt.fields)
+			}
+		})
+	}
+}
+
+func TestValidateLineNoMaximum(t *testing.T) {
+	u := &CartUseCase{rules: config.CartRules{MinQuantity: 1}}
+
+	if err := u.validateLine(1_000_000, strings.Repeat("a", 1000)); err != nil {
+		t.Errorf("validateLine without maximums = %v, want nil", err)
+	}
+}
+
+func TestValidateLineCount(t *testing.T) {
+	tests := []struct {
+		name     string
+		maxLines int
+		lines    int
+		wantErr  bool
+	}{
+		{name: "below the maximum", maxLines: 3, lines: 2},
+		{name: "at the maximum", maxLines: 3, lines: 3},
+		{name: "above the maximum", maxLines: 3, lines: 4, wantErr: true},
+		{name: "no maximum", maxLines: 0, lines: 1000},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			u := &CartUseCase{rules: config.CartRules{MaxLines: tt.maxLines}}
+			if err := u.validateLineCount(tt.lines); (err != nil) != tt.wantErr {
+				t.Errorf("validateLineCount(%d) = %v, want error %v", tt.lines, err, tt.wantErr)
+			}
+		})
+	}
+}
+
+// violationFields returns the fields of a *ValidationError in order, nil for any other error
+func violationFields(err error) []string {
+	var validation *ValidationError
+	if !errors.As(err, &validation) {
+		return nil
+	}
+
+	fields := make([]string, len(validation.Violations))
+	for i, violation := range validation.Violations {
+		fields[i] = violation.Field
+	}
+	return fields
+}
@@ -0,0 +1,104 @@
+package usecase
+
+import (
+	"context"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/idoyudha/eshop-cart/internal/entity"
+)
+
+// GetSavedItems returns the lines the user saved for later in the selected cart, read from mysql as they are not cached
+func (u *CartUseCase) GetSavedItems(ctx context.Context, userID uuid.UUID, cartID uuid.UUID) ([]*entity.CartItem, error) {
+	cart, err := u.selectCart(ctx, userID, cartID)
+	if err != nil {
+		return nil, err
+	}
+	if cart == nil {
+		return make([]*entity.CartItem, 0), nil
+	}
+
+	return u.repoMySQL.GetItemsByList(ctx, cart.ID, entity.CartItemListSaved)
+}
+
+// MoveCartItem moves a line between the active cart and the saved for later list, keeping its product data.
+// when the same product, variant and options already have a line in the target list the quantities are added to that line instead.
+// a non zero version must match the current version of the line
+func (u *CartUseCase) MoveCartItem(ctx context.Context, userID uuid.UUID, itemID uuid.UUID, version int64, list string) (entity.CartItem, error) {
+	event, err := entity.NewCartChangedEvent(userID)
+	if err != nil {
+		return entity.CartItem{}, err
+	}
+
+	var moved entity.CartItem
+	err = retryDuplicate(func() error {
+		return u.mutate(ctx, event, func(txCtx context.Context) error {
+			current, errCurrent := u.lockCartItem(txCtx, userID, itemID, version)
+			if errCurrent != nil {
+				return errCurrent
+			}
+
+			if current.List == list {
+				moved = *current
+				return nil
+			}
+
+			target, errTarget := u.repoMySQL.GetItemByLine(txCtx, current.CartID, current, list)
+			if errTarget != nil {
+				return errTarget
+			}
+
+			before := *current
+			now := time.Now()
+			if target == nil {
+				if list == entity.CartItemListCart {
+					cart, errCart := u.repoMySQL.GetByCartID(txCtx, userID, current.CartID)
+					if errCart != nil {
+						return errCart
+					}
+					if errCount := u.validateLineCount(len(cart.Items) + 1); errCount != nil {
+						return errCount
+					}
+				}
+
+				current.List = list
+				current.UpdatedAt = now
+				if errMove := u.repoMySQL.MoveItem(txCtx, current); errMove != nil {
+					return errMove
+				}
+				current.Version++
+				moved = *current
+				return u.recordEvent(txCtx, entity.CartEventItemMoved, &before, current)
+			}
+
+			if errQuantity := newValidationError(u.checkQuantity(target.ProductQuantity + current.ProductQuantity)); errQuantity != nil {
+				return errQuantity
+			}
+			targetBefore := *target
+			target.ProductQuantity += current.ProductQuantity
+			if target.Note == "" {
+				target.Note = current.Note
+			}
+			target.UpdatedAt = now
+			if errUpdate := u.repoMySQL.UpdateQtyAndNote(txCtx, target); errUpdate != nil {
+				return errUpdate
+			}
+			target.Version++
+			moved = *target
+
+			if errDelete := u.repoMySQL.DeleteOne(txCtx, current.ID, entity.CartItemDeletedMerged); errDelete != nil {
+				return errDelete
+			}
+			if errEvent := u.recordEvent(txCtx, entity.CartEventItemMerged, &targetBefore, target); errEvent != nil {
+				return errEvent
+			}
+
+			return u.recordEvent(txCtx, entity.CartEventItemMoved, &before, nil)
+		})
+	})
+	if err != nil {
+		return entity.CartItem{}, err
+	}
+
+	return moved, nil
+}
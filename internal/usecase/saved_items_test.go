@@ -0,0 +1,161 @@
+package usecase
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/idoyudha/eshop-cart/config"
+	"github.com/idoyudha/eshop-cart/internal/entity"
+)
+
+func TestGetSavedItems(t *testing.T) {
+	userID := uuid.New()
+	cart := &entity.Cart{ID: uuid.New(), UserID: userID, Default: true}
+	repo := newFakeCartRepo(cart)
+	saved := repo.add(&entity.CartItem{CartID: cart.ID, UserID: userID, List: entity.CartItemListSaved})
+	repo.add(&entity.CartItem{CartID: cart.ID, UserID: userID, List: entity.CartItemListCart})
+	uc := &CartUseCase{repoMySQL: repo}
+
+	items, err := uc.GetSavedItems(context.Background(), userID, uuid.Nil)
+	if err != nil {
+		t.Fatalf("GetSavedItems() = %v", err)
+	}
+	if len(items) != 1 || items[0].ID != saved {
+		t.Errorf("GetSavedItems() = %v, want only the saved line %s", items, saved)
+	}
+
+	if _, err := uc.GetSavedItems(context.Background(), userID, uuid.New()); !errors.Is(err, ErrCartNotFound) {
+		t.Errorf("GetSavedItems() of another cart = %v, want %v", err, ErrCartNotFound)
+	}
+
+	uc = &CartUseCase{repoMySQL: newFakeCartRepo(nil)}
+	items, err = uc.GetSavedItems(context.Background(), userID, uuid.Nil)
+	if err != nil || items == nil || len(items) != 0 {
+		t.Errorf("GetSavedItems() of a user without a cart = %v, %v, want an empty list", items, err)
+	}
+}
+
+// savedItemsFixture is a cart holding a mug line in the cart and a saved line per test
+type savedItemsFixture struct {
+	userID uuid.UUID
+	cart   *entity.Cart
+	repo   *fakeCartRepo
+	events *fakeEventRepo
+	uc     *CartUseCase
+	mug    uuid.UUID
+}
+
+func newSavedItemsFixture(maxLines int) *savedItemsFixture {
+	f := &savedItemsFixture{userID: uuid.New(), events: &fakeEventRepo{}}
+	f.cart = &entity.Cart{ID: uuid.New(), UserID: f.userID, Default: true, Currency: "USD"}
+	f.repo = newFakeCartRepo(f.cart)
+	f.mug = f.repo.add(&entity.CartItem{CartID: f.cart.ID, UserID: f.userID, ProductID: uuid.New(), ProductQuantity: 3, List: entity.CartItemListCart, Version: 1})
+	f.uc = &CartUseCase{
+		repoMySQL:  f.repo,
+		repoOutbox: &fakeOutboxRepo{},
+		repoEvents: f.events,
+		relay:      &fakeRelay{},
+		rules:      config.CartRules{MinQuantity: 1, MaxQuantity: 10, MaxLines: maxLines},
+	}
+	return f
+}
+
+// save adds a saved line, of the mug product when sameProduct is set
+func (f *savedItemsFixture) save(sameProduct bool, quantity int64, note string) uuid.UUID {
+	productID := uuid.New()
+	if sameProduct {
+		productID = f.repo.items[f.mug].ProductID
+	}
+	return f.repo.add(&entity.CartItem{CartID: f.cart.ID, UserID: f.userID, ProductID: productID, ProductQuantity: quantity, Note: note, List: entity.CartItemListSaved, Version: 1})
+}
+
+func TestMoveCartItemSaveForLater(t *testing.T) {
+	f := newSavedItemsFixture(2)
+
+	moved, err := f.uc.MoveCartItem(context.Background(), f.userID, f.mug, 1, entity.CartItemListSaved)
+	if err != nil {
+		t.Fatalf("MoveCartItem() = %v", err)
+	}
+
+	if moved.ID != f.mug || moved.List != entity.CartItemListSaved || moved.Version != 2 {
+		t.Errorf("MoveCartItem() = line %s in %q at version %d, want the mug saved at version 2", moved.ID, moved.List, moved.Version)
+	}
+	if f.repo.items[f.mug].List != entity.CartItemListSaved {
+		t.Error("the stored line was not saved for later")
+	}
+	if len(f.events.types) != 1 || f.events.types[0] != entity.CartEventItemMoved {
+		t.Errorf("recorded %v, want one move", f.events.types)
+	}
+
+	// moving it again to the same list changes nothing
+	again, err := f.uc.MoveCartItem(context.Background(), f.userID, f.mug, 0, entity.CartItemListSaved)
+	if err != nil || again.Version != 2 || len(f.events.types) != 1 {
+		t.Errorf("second MoveCartItem() = version %d, %v with events %v, want a no-op", again.Version, err, f.events.types)
+	}
+}
+
+func TestMoveCartItemMergesIntoMatchingLine(t *testing.T) {
+	f := newSavedItemsFixture(2)
+	saved := f.save(true, 2, "gift wrap")
+
+	moved, err := f.uc.MoveCartItem(context.Background(), f.userID, saved, 0, entity.CartItemListCart)
+	if err != nil {
+		t.Fatalf("MoveCartItem() = %v", err)
+	}
+
+	if moved.ID != f.mug || moved.ProductQuantity != 5 || moved.Note != "gift wrap" {
+		t.Errorf("MoveCartItem() = line %s with %d %q, want the cart line at 5 with the saved note", moved.ID, moved.ProductQuantity, moved.Note)
+	}
+	if f.repo.deleted[saved] != entity.CartItemDeletedMerged {
+		t.Errorf("saved line deleted as %q, want %q", f.repo.deleted[saved], entity.CartItemDeletedMerged)
+	}
+	want := []string{entity.CartEventItemMerged, entity.CartEventItemMoved}
+	if len(f.events.types) != 2 || f.events.types[0] != want[0] || f.events.types[1] != want[1] {
+		t.Errorf("recorded %v, want %v", f.events.types, want)
+	}
+}
+
+func TestMoveCartItemRejected(t *testing.T) {
+	tests := []struct {
+		name     string
+		maxLines int
+		// the saved line to move back to the cart
+		sameProduct bool
+		quantity    int64
+		version     int64
+		wantErr     func(error) bool
+	}{
+		{name: "cart full", maxLines: 1, quantity: 1, wantErr: isValidationError},
+		{name: "merged quantity over the limit", maxLines: 2, sameProduct: true, quantity: 8, wantErr: isValidationError},
+		{
+			name: "stale version", maxLines: 2, quantity: 1, version: 4,
+			wantErr: func(err error) bool { var conflict *VersionConflictError; return errors.As(err, &conflict) },
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f := newSavedItemsFixture(tt.maxLines)
+			saved := f.save(tt.sameProduct, tt.quantity, "")
+
+			if _, err := f.uc.MoveCartItem(context.Background(), f.userID, saved, tt.version, entity.CartItemListCart); !tt.wantErr(err) {
+				t.Fatalf("MoveCartItem() = %v, want a matching error", err)
+			}
+			if f.repo.items[saved].List != entity.CartItemListSaved || f.repo.deleted[saved] != "" || f.repo.items[f.mug].ProductQuantity != 3 {
+				t.Error("a rejected move changed the lines")
+			}
+			if len(f.events.types) != 0 {
+				t.Errorf("recorded %v for a rejected move", f.events.types)
+			}
+		})
+	}
+}
+
+func TestMoveCartItemUnknownLine(t *testing.T) {
+	f := newSavedItemsFixture(2)
+	if _, err := f.uc.MoveCartItem(context.Background(), f.userID, uuid.New(), 0, entity.CartItemListSaved); !errors.Is(err, ErrCartItemNotFound) {
+		t.Errorf("MoveCartItem() = %v, want %v", err, ErrCartItemNotFound)
+	}
+}
@@ -0,0 +1,67 @@
+package webapi
+
+import (
+	"sync"
+	"time"
+)
+
+// circuitBreaker opens after threshold failures in a row and rejects calls for cooldown,
+// then lets a single trial call through: a success closes it, a failure opens it again.
+// a zero threshold never opens
+type circuitBreaker struct {
+	mu        sync.Mutex
+	threshold int
+	cooldown  time.Duration
+	failures  int
+	openedAt  time.Time
+	trial     bool
+}
+
+func newCircuitBreaker(threshold int, cooldown time.Duration) *circuitBreaker {
+	return &circuitBreaker{
+		threshold: threshold,
+		cooldown:  cooldown,
+	}
+}
+
+// allow reports whether a call may be made now
+func (b *circuitBreaker) allow() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.threshold <= 0 || b.failures < b.threshold {
+		return true
+	}
+	if b.trial || time.Since(b.openedAt) < b.cooldown {
+		return false
+	}
+
+	b.trial = true
+	return true
+}
+
+// cancel gives back a call allowed by allow whose outcome says nothing about the service,
+// e.g. the caller gave up. it is not counted but frees the trial call
+func (b *circuitBreaker) cancel() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.trial = false
+}
+
+// record counts the outcome of a call allowed by allow
+func (b *circuitBreaker) record(ok bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.trial = false
+	if ok {
+		b.failures = 0
+		return
+	}
+
+	b.failures++
+	if b.threshold > 0 && b.failures >= b.threshold {
+		b.openedAt = time.Now()
+	}
+}
@@ -0,0 +1,93 @@
+package webapi
+
+import (
+	"testing"
+	"time"
+)
+
+func TestCircuitBreaker(t *testing.T) {
+	// a step is one call: allowed is what allow must answer, then the call ends with outcome
+	type step struct {
+		allowed bool
+		outcome string // "ok", "fail", "cancel", or "" when the call was not allowed
+	}
+
+	tests := []struct {
+		name      string
+		threshold int
+		cooldown  time.Duration
+		steps     []step
+	}{
+		{
+			name:      "stays closed below the threshold",
+			threshold: 2,
+			cooldown:  time.Hour,
+			steps:     []step{{true, "fail"}, {true, "ok"}, {true, "fail"}, {true, "ok"}},
+		},
+		{
+			name:      "opens at the threshold",
+			threshold: 2,
+			cooldown:  time.Hour,
+			steps:     []step{{true, "fail"}, {true, "fail"}, {false, ""}},
+		},
+		{
+			name:      "zero threshold never opens",
+			threshold: 0,
+			cooldown:  time.Hour,
+			steps:     []step{{true, "fail"}, {true, "fail"}, {true, "fail"}},
+		},
+		{
+			name:      "successful trial closes it",
+			threshold: 1,
+			steps:     []step{{true, "fail"}, {true, "ok"}, {true, "ok"}},
+		},
+		{
+			name:      "failed trial opens it again",
+			threshold: 1,
+			steps:     []step{{true, "fail"}, {true, "fail"}, {true, "fail"}},
+		},
+		{
+			name:      "cancelled trial frees the trial",
+			threshold: 1,
+			steps:     []step{{true, "fail"}, {true, "cancel"}, {true, "ok"}, {true, "ok"}},
+		},
+		{
+			name:      "cancel does not count a failure",
+			threshold: 2,
+			cooldown:  time.Hour,
+			steps:     []step{{true, "fail"}, {true, "cancel"}, {true, "cancel"}, {true, "ok"}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			breaker := newCircuitBreaker(tt.threshold, tt.cooldown)
+			for i, s := range tt.steps {
+				if got := breaker.allow(); got != s.allowed {
+					t.Fatalf("step %d: allow() = %v, want %v", i, got, s.allowed)
+				}
+				switch s.outcome {
+				case "ok":
+					breaker.record(true)
+				case "fail":
+					breaker.record(false)
+				case "cancel":
+					breaker.cancel()
+				}
+			}
+		})
+	}
+}
+
+func TestCircuitBreakerSingleTrial(t *testing.T) {
+	breaker := newCircuitBreaker(1, 0)
+	breaker.allow()
+	breaker.record(false)
+
+	if !breaker.allow() {
+		t.Fatal("first call after the cooldown was not allowed")
+	}
+	if breaker.allow() {
+		t.Error("second call was allowed while the trial is running")
+	}
+}
@@ -0,0 +1,148 @@
+package webapi
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/idoyudha/eshop-cart/config"
+	"github.com/idoyudha/eshop-cart/internal/entity"
+)
+
+// InventoryWebAPI reserves stock on the inventory service, every request is bounded by cfg.Timeout.
+// a reservation is held for cfg.ReservationTTL unless it is confirmed or released before
+type InventoryWebAPI struct {
+	client *http.Client
+	cfg    config.InventoryService
+}
+
+func NewInventoryWebAPI(cfg config.InventoryService) *InventoryWebAPI {
+	return &InventoryWebAPI{
+		client: &http.Client{Timeout: cfg.Timeout},
+		cfg:    cfg,
+	}
+}
+
+type createReservationRequest struct {
+	Items      []reservationItemRequest `json:"items"`
+	TTLSeconds int64                    `json:"ttl_seconds"`
+}
+
+type reservationItemRequest struct {
+	ProductID uuid.UUID `json:"product_id"`
+	VariantID string    `json:"variant_id,omitempty"`
+	Quantity  int64     `json:"quantity"`
+}
+
+type restSuccessCreateReservation struct {
+	Code    int                 `json:"code"`
+	Data    reservationResponse `json:"data"`
+	Message string              `json:"message"`
+}
+
+type reservationResponse struct {
+	ID        string    `json:"id"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+// Reserve holds the stock of the lines, the key is sent as Idempotency-Key so a retry holds it once.
+// missing stock is returned as *entity.InventoryServiceError
+func (w *InventoryWebAPI) Reserve(ctx context.Context, reservation entity.InventoryReservationRequest) (*entity.InventoryReservation, error) {
+	requestBody, err := json.Marshal(reservationRequestToCreateReservationRequest(reservation, w.cfg.ReservationTTL))
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal request body: %w", err)
+	}
+
+	reserveURL := fmt.Sprintf("%s/v1/reservations", w.cfg.BaseURL)
+	body, err := w.post(ctx, reserveURL, reservation.Key, requestBody, http.StatusCreated)
+	if err != nil {
+		return nil, err
+	}
+
+	var successCreateReservation restSuccessCreateReservation
+	if err := json.Unmarshal(body, &successCreateReservation); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal response body: %w", err)
+	}
+
+	expiresAt := successCreateReservation.Data.ExpiresAt
+	if expiresAt.IsZero() {
+		expiresAt = time.Now().Add(w.cfg.ReservationTTL)
+	}
+
+	return &entity.InventoryReservation{
+		ID:        successCreateReservation.Data.ID,
+		ExpiresAt: expiresAt,
+	}, nil
+}
+
+// Confirm turns the reservation into a stock decrease, the key is sent as Idempotency-Key so a retry
+// decreases it once. a reservation the service no longer knows is returned as *entity.InventoryServiceError
+func (w *InventoryWebAPI) Confirm(ctx context.Context, reservationID string, idempotencyKey string) error {
+	confirmURL := fmt.Sprintf("%s/v1/reservations/%s/confirm", w.cfg.BaseURL, reservationID)
+	_, err := w.post(ctx, confirmURL, idempotencyKey, nil, http.StatusOK)
+	return err
+}
+
+// Release makes the reserved stock available again, a reservation the service no longer knows counts as released
+func (w *InventoryWebAPI) Release(ctx context.Context, reservationID string) error {
+	releaseURL := fmt.Sprintf("%s/v1/reservations/%s/release", w.cfg.BaseURL, reservationID)
+	_, err := w.post(ctx, releaseURL, "", nil, http.StatusOK, http.StatusNotFound)
+	return err
+}
+
+// post sends the request and returns the response body when its status is one of expected
+func (w *InventoryWebAPI) post(ctx context.Context, url string, idempotencyKey string, requestBody []byte, expected ...int) ([]byte, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(requestBody))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if idempotencyKey != "" {
+		req.Header.Set("Idempotency-Key", idempotencyKey)
+	}
+
+	resp, err := w.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", entity.ErrInventoryServiceUnavailable, err)
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read response body: %w", err)
+	}
+
+	for _, status := range expected {
+		if resp.StatusCode == status {
+			return body, nil
+		}
+	}
+
+	if resp.StatusCode >= http.StatusInternalServerError {
+		return nil, fmt.Errorf("%w: responded %d", entity.ErrInventoryServiceUnavailable, resp.StatusCode)
+	}
+	return nil, &entity.InventoryServiceError{StatusCode: resp.StatusCode, Message: restErrorMessage(resp.StatusCode, body)}
+}
+
+func reservationRequestToCreateReservationRequest(reservation entity.InventoryReservationRequest, ttl time.Duration) createReservationRequest {
+	items := make([]reservationItemRequest, 0, len(reservation.Items))
+	for _, item := range reservation.Items {
+		reservationItem := reservationItemRequest{
+			ProductID: item.ProductID,
+			Quantity:  item.ProductQuantity,
+		}
+		if item.VariantID != uuid.Nil {
+			reservationItem.VariantID = item.VariantID.String()
+		}
+		items = append(items, reservationItem)
+	}
+	return createReservationRequest{
+		Items:      items,
+		TTLSeconds: int64(ttl / time.Second),
+	}
+}
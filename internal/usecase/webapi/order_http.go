@@ -0,0 +1,264 @@
+package webapi
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/idoyudha/eshop-cart/config"
+	"github.com/idoyudha/eshop-cart/internal/entity"
+)
+
+// OrderWebAPI places orders on the order service. every attempt is bounded by cfg.Timeout,
+// an unreachable or overloaded service is retried with exponential backoff
+// and a circuit breaker stops calling it after cfg.BreakerThreshold failures in a row
+type OrderWebAPI struct {
+	client  *http.Client
+	cfg     config.OrderService
+	breaker *circuitBreaker
+}
+
+func NewOrderWebAPI(cfg config.OrderService) *OrderWebAPI {
+	return &OrderWebAPI{
+		client:  &http.Client{Timeout: cfg.Timeout},
+		cfg:     cfg,
+		breaker: newCircuitBreaker(cfg.BreakerThreshold, cfg.BreakerCooldown),
+	}
+}
+
+// CreateOrder places the order and returns its id. every attempt sends order.IdempotencyKey as the
+// Idempotency-Key header, the order service places one order per key and answers a repeated key with
+// that order, so retries and a later FindOrder with the same key are safe. a 4xx response is returned
+// as *entity.OrderServiceError. giving up returns entity.ErrOrderServiceUnavailable when no attempt
+// could have reached the service and entity.ErrOrderOutcomeUnknown when the order may be placed
+func (w *OrderWebAPI) CreateOrder(ctx context.Context, token string, order entity.OrderRequest) (uuid.UUID, error) {
+	requestBody, err := json.Marshal(orderRequestToCreateOrderRequest(order))
+	if err != nil {
+		return uuid.Nil, fmt.Errorf("failed to marshal request body: %w", err)
+	}
+
+	backoff := w.cfg.RetryBackoff
+	// set once an attempt may have reached the service and placed the order
+	var sent bool
+	for attempt := 0; ; attempt++ {
+		if !w.breaker.allow() {
+			return uuid.Nil, giveUpOrder(sent, errors.New("circuit open"))
+		}
+
+		orderID, err := w.createOrder(ctx, token, order.IdempotencyKey, requestBody)
+		if ctx.Err() != nil {
+			// the caller gave up, it says nothing about the order service
+			w.breaker.cancel()
+			return uuid.Nil, fmt.Errorf("%w: %v", entity.ErrOrderOutcomeUnknown, err)
+		}
+
+		retryable := isRetryable(err)
+		w.breaker.record(!retryable)
+		if !retryable {
+			return orderID, err
+		}
+		sent = sent || !isOverloaded(err)
+		if attempt >= w.cfg.MaxRetries {
+			return uuid.Nil, giveUpOrder(sent, err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return uuid.Nil, giveUpOrder(sent, ctx.Err())
+		case <-time.After(backoff):
+		}
+		backoff *= 2
+	}
+}
+
+// giveUpOrder is the error of CreateOrder giving up, sent tells whether an attempt may have placed the order
+func giveUpOrder(sent bool, err error) error {
+	if sent {
+		return fmt.Errorf("%w: %v", entity.ErrOrderOutcomeUnknown, err)
+	}
+	return fmt.Errorf("%w: %v", entity.ErrOrderServiceUnavailable, err)
+}
+
+// createOrder is one attempt of CreateOrder
+func (w *OrderWebAPI) createOrder(ctx context.Context, token string, idempotencyKey string, requestBody []byte) (uuid.UUID, error) {
+	createOrderURL := fmt.Sprintf("%s/v1/orders", w.cfg.BaseURL)
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, createOrderURL, bytes.NewReader(requestBody))
+	if err != nil {
+		return uuid.Nil, fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", token))
+	req.Header.Set("Idempotency-Key", idempotencyKey)
+
+	resp, err := w.client.Do(req)
+	if err != nil {
+		return uuid.Nil, fmt.Errorf("failed to send request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return uuid.Nil, fmt.Errorf("failed to read response body: %w", err)
+	}
+
+	if resp.StatusCode != http.StatusCreated {
+		return uuid.Nil, newOrderServiceError(resp.StatusCode, body)
+	}
+
+	// the order is placed even if its id cannot be read, never report it as failed
+	var successOrder restSuccessOrder
+	if err := json.Unmarshal(body, &successOrder); err != nil {
+		return uuid.Nil, nil
+	}
+
+	return successOrder.Data.Address.OrderID, nil
+}
+
+// FindOrder returns the order placed with idempotencyKey, found is false when the order service has none.
+// it authenticates with the service token, the token of the shopper may have expired since the checkout
+func (w *OrderWebAPI) FindOrder(ctx context.Context, idempotencyKey string) (uuid.UUID, bool, error) {
+	findOrderURL := fmt.Sprintf("%s/v1/orders?idempotency_key=%s", w.cfg.BaseURL, url.QueryEscape(idempotencyKey))
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, findOrderURL, nil)
+	if err != nil {
+		return uuid.Nil, false, fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", w.cfg.ServiceToken))
+
+	resp, err := w.client.Do(req)
+	if err != nil {
+		return uuid.Nil, false, fmt.Errorf("%w: %v", entity.ErrOrderServiceUnavailable, err)
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return uuid.Nil, false, fmt.Errorf("failed to read response body: %w", err)
+	}
+
+	if resp.StatusCode == http.StatusNotFound {
+		return uuid.Nil, false, nil
+	}
+	if resp.StatusCode != http.StatusOK {
+		return uuid.Nil, false, newOrderServiceError(resp.StatusCode, body)
+	}
+
+	var successOrder restSuccessOrder
+	if err := json.Unmarshal(body, &successOrder); err != nil {
+		return uuid.Nil, false, fmt.Errorf("failed to unmarshal response body: %w", err)
+	}
+
+	return successOrder.Data.Address.OrderID, true, nil
+}
+
+// isRetryable is true for errors a later attempt may not get: the request did not get through,
+// timed out, or the service answered it is overloaded or failing
+func isRetryable(err error) bool {
+	if err == nil {
+		return false
+	}
+
+	var serviceErr *entity.OrderServiceError
+	if errors.As(err, &serviceErr) {
+		return serviceErr.StatusCode == http.StatusTooManyRequests || serviceErr.StatusCode >= http.StatusInternalServerError
+	}
+
+	return true
+}
+
+// isOverloaded is true when the service answered it did not take the request
+func isOverloaded(err error) bool {
+	var serviceErr *entity.OrderServiceError
+	return errors.As(err, &serviceErr) && serviceErr.StatusCode == http.StatusTooManyRequests
+}
+
+type createOrderRequest struct {
+	Items   []createItemsOrderRequest `json:"items"`
+	Address createAddressOrderRequest `json:"address"`
+}
+
+type createItemsOrderRequest struct {
+	ProductID   uuid.UUID         `json:"product_id"`
+	VariantID   string            `json:"variant_id,omitempty"`
+	Options     map[string]string `json:"options,omitempty"`
+	Quantity    int64             `json:"quantity"`
+	PriceAmount int64             `json:"price_amount"`
+	Currency    string            `json:"currency"`
+}
+
+type createAddressOrderRequest struct {
+	Street  string `json:"street"`
+	City    string `json:"city"`
+	State   string `json:"state"`
+	ZipCode string `json:"zipcode"`
+	Note    string `json:"note"`
+}
+
+type restSuccessOrder struct {
+	Code    int           `json:"code"`
+	Data    orderResponse `json:"data"`
+	Message string        `json:"message"`
+}
+
+type orderResponse struct {
+	Status           string               `json:"status"`
+	TotalPriceAmount int64                `json:"total_price_amount"`
+	Currency         string               `json:"currency"`
+	Items            []itemsOrderResponse `json:"items"`
+	Address          addressOrderResponse `json:"address"`
+}
+
+type itemsOrderResponse struct {
+	OrderID     uuid.UUID `json:"order_id"`
+	ProductID   uuid.UUID `json:"product_id"`
+	PriceAmount int64     `json:"price_amount"`
+	Currency    string    `json:"currency"`
+	Quantity    int64     `json:"quantity"`
+	Note        string    `json:"note"`
+}
+
+type addressOrderResponse struct {
+	OrderID uuid.UUID `json:"order_id"`
+	Street  string    `json:"street"`
+	City    string    `json:"city"`
+	State   string    `json:"state"`
+	ZipCode string    `json:"zipcode"`
+	Note    string    `json:"note"`
+}
+
+func orderRequestToCreateOrderRequest(order entity.OrderRequest) createOrderRequest {
+	items := make([]createItemsOrderRequest, 0, len(order.Items))
+	for _, item := range order.Items {
+		orderItem := createItemsOrderRequest{
+			ProductID:   item.ProductID,
+			Options:     item.Options,
+			Quantity:    item.ProductQuantity,
+			PriceAmount: item.ProductPrice,
+			Currency:    item.Currency,
+		}
+		if item.VariantID != uuid.Nil {
+			orderItem.VariantID = item.VariantID.String()
+		}
+		items = append(items, orderItem)
+	}
+	return createOrderRequest{
+		Items: items,
+		Address: createAddressOrderRequest{
+			Street:  order.Address.Street,
+			City:    order.Address.City,
+			State:   order.Address.State,
+			ZipCode: order.Address.ZipCode,
+		},
+	}
+}
+
+// newOrderServiceError reads the reason of an error response of the order service
+func newOrderServiceError(statusCode int, body []byte) *entity.OrderServiceError {
+	return &entity.OrderServiceError{StatusCode: statusCode, Message: restErrorMessage(statusCode, body)}
+}
@@ -0,0 +1,101 @@
+package webapi
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/idoyudha/eshop-cart/config"
+	"github.com/idoyudha/eshop-cart/internal/entity"
+)
+
+func TestOrderWebAPICreateOrderErrors(t *testing.T) {
+	tests := []struct {
+		name         string
+		statuses     []int // answered in turn, the last one repeats
+		wantErr      error
+		wantRejected int
+		wantAttempts int32
+	}{
+		{
+			name:         "overloaded on every attempt",
+			statuses:     []int{http.StatusTooManyRequests},
+			wantErr:      entity.ErrOrderServiceUnavailable,
+			wantAttempts: 3,
+		},
+		{
+			name:         "failing on every attempt",
+			statuses:     []int{http.StatusBadGateway},
+			wantErr:      entity.ErrOrderOutcomeUnknown,
+			wantAttempts: 3,
+		},
+		{
+			name:         "failing then overloaded",
+			statuses:     []int{http.StatusInternalServerError, http.StatusTooManyRequests},
+			wantErr:      entity.ErrOrderOutcomeUnknown,
+			wantAttempts: 3,
+		},
+		{
+			name:         "rejected",
+			statuses:     []int{http.StatusUnprocessableEntity},
+			wantRejected: http.StatusUnprocessableEntity,
+			wantAttempts: 1,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var attempts atomic.Int32
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+				attempt := int(attempts.Add(1)) - 1
+				w.WriteHeader(tt.statuses[min(attempt, len(tt.statuses)-1)])
+			}))
+			defer server.Close()
+
+			client := NewOrderWebAPI(config.OrderService{
+				BaseURL:      server.URL,
+				Timeout:      time.Second,
+				MaxRetries:   2,
+				RetryBackoff: time.Millisecond,
+			})
+
+			_, err := client.CreateOrder(context.Background(), "token", entity.OrderRequest{IdempotencyKey: "checkout"})
+
+			var serviceErr *entity.OrderServiceError
+			switch {
+			case tt.wantErr != nil && !errors.Is(err, tt.wantErr):
+				t.Errorf("CreateOrder() = %v, want %v", err, tt.wantErr)
+			case tt.wantRejected != 0 && (!errors.As(err, &serviceErr) || serviceErr.StatusCode != tt.wantRejected):
+				t.Errorf("CreateOrder() = %v, want a %d response", err, tt.wantRejected)
+			}
+			if got := attempts.Load(); got != tt.wantAttempts {
+				t.Errorf("attempts = %d, want %d", got, tt.wantAttempts)
+			}
+		})
+	}
+}
+
+func TestOrderWebAPICreateOrderCircuitOpen(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer server.Close()
+
+	client := NewOrderWebAPI(config.OrderService{
+		BaseURL:          server.URL,
+		Timeout:          time.Second,
+		BreakerThreshold: 1,
+		BreakerCooldown:  time.Hour,
+	})
+
+	if _, err := client.CreateOrder(context.Background(), "token", entity.OrderRequest{}); !errors.Is(err, entity.ErrOrderOutcomeUnknown) {
+		t.Fatalf("first CreateOrder() = %v, want %v", err, entity.ErrOrderOutcomeUnknown)
+	}
+	if _, err := client.CreateOrder(context.Background(), "token", entity.OrderRequest{}); !errors.Is(err, entity.ErrOrderServiceUnavailable) {
+		t.Errorf("CreateOrder() with the circuit open = %v, want %v", err, entity.ErrOrderServiceUnavailable)
+	}
+}
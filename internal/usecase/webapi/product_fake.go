@@ -0,0 +1,67 @@
+package webapi
+
+import (
+	"context"
+	"sync"
+
+	"github.com/google/uuid"
+	"github.com/idoyudha/eshop-cart/internal/entity"
+)
+
+// FakeProductCatalog is an in memory product catalog for tests and local runs
+type FakeProductCatalog struct {
+	mu       sync.Mutex
+	products map[uuid.UUID]entity.CatalogProduct
+	err      error
+}
+
+func NewFakeProductCatalog(products ...entity.CatalogProduct) *FakeProductCatalog {
+	fake := &FakeProductCatalog{
+		products: make(map[uuid.UUID]entity.CatalogProduct, len(products)),
+	}
+	for _, product := range products {
+		fake.products[product.ID] = product
+	}
+	return fake
+}
+
+// Set adds the product or replaces the one with the same id
+func (f *FakeProductCatalog) Set(product entity.CatalogProduct) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.products[product.ID] = product
+}
+
+// Remove makes the product unknown to the catalog
+func (f *FakeProductCatalog) Remove(productID uuid.UUID) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	delete(f.products, productID)
+}
+
+// SetErr makes every call fail with err until it is set back to nil
+func (f *FakeProductCatalog) SetErr(err error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.err = err
+}
+
+func (f *FakeProductCatalog) GetProducts(_ context.Context, productIDs uuid.UUIDs) (map[uuid.UUID]entity.CatalogProduct, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if f.err != nil {
+		return nil, f.err
+	}
+
+	products := make(map[uuid.UUID]entity.CatalogProduct, len(productIDs))
+	for _, productID := range productIDs {
+		if product, ok := f.products[productID]; ok {
+			products[productID] = product
+		}
+	}
+	return products, nil
+}
@@ -0,0 +1,108 @@
+package webapi
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+
+	"github.com/google/uuid"
+	"github.com/idoyudha/eshop-cart/config"
+	"github.com/idoyudha/eshop-cart/internal/entity"
+)
+
+// ProductWebAPI reads products from the product service, every request is bounded by cfg.Timeout
+type ProductWebAPI struct {
+	client *http.Client
+	cfg    config.ProductService
+}
+
+func NewProductWebAPI(cfg config.ProductService) *ProductWebAPI {
+	return &ProductWebAPI{
+		client: &http.Client{Timeout: cfg.Timeout},
+		cfg:    cfg,
+	}
+}
+
+type restSuccessGetProduct struct {
+	Code    int             `json:"code"`
+	Data    productResponse `json:"data"`
+	Message string          `json:"message"`
+}
+
+type productResponse struct {
+	ID          uuid.UUID `json:"id"`
+	Name        string    `json:"name"`
+	PriceAmount int64     `json:"price_amount"`
+	Currency    string    `json:"currency"`
+	Quantity    int64     `json:"quantity"`
+}
+
+// GetProducts returns the products of productIDs known to the catalog, an unknown product is left out
+func (w *ProductWebAPI) GetProducts(ctx context.Context, productIDs uuid.UUIDs) (map[uuid.UUID]entity.CatalogProduct, error) {
+	products := make(map[uuid.UUID]entity.CatalogProduct, len(productIDs))
+	for _, productID := range productIDs {
+		if _, ok := products[productID]; ok {
+			continue
+		}
+
+		product, found, err := w.getProduct(ctx, productID)
+		if err != nil {
+			return nil, err
+		}
+		if found {
+			products[productID] = product
+		}
+	}
+
+	return products, nil
+}
+
+func (w *ProductWebAPI) getProduct(ctx context.Context, productID uuid.UUID) (entity.CatalogProduct, bool, error) {
+	getProductURL := fmt.Sprintf("%s/v1/products/%s", w.cfg.BaseURL, productID)
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, getProductURL, nil)
+	if err != nil {
+		return entity.CatalogProduct{}, false, fmt.Errorf("failed to create request: %w", err)
+	}
+
+	resp, err := w.client.Do(req)
+	if err != nil {
+		return entity.CatalogProduct{}, false, fmt.Errorf("%w: %v", entity.ErrProductCatalogUnavailable, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusNotFound {
+		return entity.CatalogProduct{}, false, nil
+	}
+	if resp.StatusCode != http.StatusOK {
+		return entity.CatalogProduct{}, false, fmt.Errorf("%w: product %s responded %d", entity.ErrProductCatalogUnavailable, productID, resp.StatusCode)
+	}
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return entity.CatalogProduct{}, false, fmt.Errorf("failed to read response body: %w", err)
+	}
+
+	var successGetProduct restSuccessGetProduct
+	if err := json.Unmarshal(body, &successGetProduct); err != nil {
+		return entity.CatalogProduct{}, false, fmt.Errorf("failed to unmarshal response body: %w", err)
+	}
+
+	return productResponseToCatalogProduct(productID, successGetProduct.Data), true, nil
+}
+
+func productResponseToCatalogProduct(productID uuid.UUID, product productResponse) entity.CatalogProduct {
+	currency := product.Currency
+	if currency == "" {
+		currency = entity.DefaultCartCurrency
+	}
+
+	return entity.CatalogProduct{
+		ID:          productID,
+		Name:        product.Name,
+		PriceAmount: product.PriceAmount,
+		Currency:    currency,
+		Available:   product.Quantity > 0,
+	}
+}
@@ -0,0 +1,29 @@
+package webapi
+
+import (
+	"encoding/json"
+	"net/http"
+)
+
+// restErrorResponse is the error body of the other eshop services
+type restErrorResponse struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+	Error   struct {
+		Message string `json:"message"`
+	} `json:"error"`
+}
+
+// restErrorMessage reads the reason of an error response, falling back to the status text
+func restErrorMessage(statusCode int, body []byte) string {
+	message := http.StatusText(statusCode)
+	var restError restErrorResponse
+	if err := json.Unmarshal(body, &restError); err == nil {
+		if restError.Error.Message != "" {
+			message = restError.Error.Message
+		} else if restError.Message != "" {
+			message = restError.Message
+		}
+	}
+	return message
+}
@@ -0,0 +1,28 @@
+-- the former carts rows are cart lines, keep them as items of a new cart header
+RENAME TABLE `carts` TO `cart_items`;
+
+CREATE TABLE IF NOT EXISTS `carts` (
+    `id` VARCHAR(36) PRIMARY KEY,
+    `user_id` VARCHAR(36) NOT NULL,
+    `currency` VARCHAR(3) NOT NULL,
+    `status` VARCHAR(20) NOT NULL,
+    `updated_at` TIMESTAMP NOT NULL,
+    `created_at` TIMESTAMP NOT NULL,
+    UNIQUE KEY `uq_carts_user_id` (`user_id`)
+);
+
+ALTER TABLE `cart_items` ADD COLUMN `cart_id` VARCHAR(36) AFTER `id`;
+
+INSERT INTO `carts` (`id`, `user_id`, `currency`, `status`, `updated_at`, `created_at`)
+SELECT UUID(), `user_id`, 'USD', 'active', MAX(`updated_at`), MIN(`created_at`)
+FROM `cart_items`
+GROUP BY `user_id`;
+
+UPDATE `cart_items` ci
+JOIN `carts` c ON c.`user_id` = ci.`user_id`
+SET ci.`cart_id` = c.`id`;
+
+ALTER TABLE `cart_items`
+    MODIFY `cart_id` VARCHAR(36) NOT NULL,
+    ADD INDEX `idx_cart_items_cart_id` (`cart_id`),
+    ADD INDEX `idx_cart_items_product_id` (`product_id`);
@@ -0,0 +1,16 @@
+ALTER TABLE `cart_items`
+    ADD COLUMN `product_price_minor` BIGINT NOT NULL DEFAULT 0 AFTER `product_price`,
+    ADD COLUMN `currency` VARCHAR(3) NOT NULL DEFAULT 'USD' AFTER `product_price_minor`;
+
+-- existing prices are decimal amounts in the currency of their cart
+UPDATE `cart_items` ci
+JOIN `carts` c ON c.`id` = ci.`cart_id`
+SET ci.`currency` = c.`currency`,
+    ci.`product_price_minor` = ROUND(ci.`product_price` * CASE c.`currency`
+        WHEN 'JPY' THEN 1 WHEN 'KRW' THEN 1 WHEN 'VND' THEN 1
+        WHEN 'BHD' THEN 1000 WHEN 'KWD' THEN 1000 WHEN 'OMR' THEN 1000 WHEN 'JOD' THEN 1000 WHEN 'TND' THEN 1000
+        ELSE 100 END);
+
+ALTER TABLE `cart_items` DROP COLUMN `product_price`;
+
+ALTER TABLE `cart_items` RENAME COLUMN `product_price_minor` TO `product_price`;
@@ -0,0 +1,12 @@
+CREATE TABLE IF NOT EXISTS `cart_outbox` (
+    `id` VARCHAR(36) PRIMARY KEY,
+    `aggregate_id` VARCHAR(36) NOT NULL,
+    `event_type` VARCHAR(50) NOT NULL,
+    `payload` JSON NOT NULL,
+    `attempts` INT NOT NULL DEFAULT 0,
+    `last_error` VARCHAR(255),
+    `created_at` TIMESTAMP NOT NULL,
+    `next_attempt_at` TIMESTAMP NOT NULL,
+    `processed_at` TIMESTAMP NULL,
+    INDEX `idx_cart_outbox_pending` (`processed_at`, `next_attempt_at`)
+);
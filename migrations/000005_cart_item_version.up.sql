@@ -0,0 +1 @@
+ALTER TABLE `cart_items` ADD COLUMN `version` BIGINT NOT NULL DEFAULT 1 AFTER `note`;
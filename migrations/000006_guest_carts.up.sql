@@ -0,0 +1,5 @@
+-- guest carts are owned by an id issued with a signed cart token instead of a user
+ALTER TABLE `carts`
+    ADD COLUMN `guest` BOOLEAN NOT NULL DEFAULT FALSE AFTER `status`,
+    ADD COLUMN `expires_at` TIMESTAMP NULL AFTER `guest`,
+    ADD INDEX `idx_carts_guest_expires_at` (`guest`, `expires_at`);
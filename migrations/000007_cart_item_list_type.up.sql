@@ -0,0 +1,4 @@
+-- lines are either in the active cart or in the saved for later list of the same cart
+ALTER TABLE `cart_items`
+    ADD COLUMN `list_type` VARCHAR(20) NOT NULL DEFAULT 'cart' AFTER `note`,
+    ADD INDEX `idx_cart_items_user_id_list_type` (`user_id`, `list_type`);
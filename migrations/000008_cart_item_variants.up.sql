@@ -0,0 +1,6 @@
+-- a line is identified by product, variant and options within its cart and list
+ALTER TABLE `cart_items`
+    ADD COLUMN `variant_id` VARCHAR(36) NOT NULL DEFAULT '' AFTER `product_id`,
+    ADD COLUMN `options` JSON NULL AFTER `note`,
+    ADD COLUMN `options_hash` CHAR(64) NOT NULL DEFAULT '' AFTER `options`,
+    ADD INDEX `idx_cart_items_line` (`cart_id`, `product_id`, `variant_id`, `options_hash`);
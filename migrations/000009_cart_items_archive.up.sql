@@ -0,0 +1,6 @@
+-- soft deleted lines past the retention period, moved here by the purger when archiving is enabled
+CREATE TABLE IF NOT EXISTS `cart_items_archive` LIKE `cart_items`;
+
+ALTER TABLE `cart_items_archive` ADD COLUMN `archived_at` TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP;
+
+ALTER TABLE `cart_items` ADD INDEX `idx_cart_items_deleted_at` (`deleted_at`);
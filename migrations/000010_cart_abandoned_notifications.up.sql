@@ -0,0 +1,9 @@
+-- the last inactivity a cart-abandoned event was sent for, a cart is notified again only after new activity
+CREATE TABLE IF NOT EXISTS `cart_abandoned_notifications` (
+    `cart_id` VARCHAR(36) PRIMARY KEY,
+    `user_id` VARCHAR(36) NOT NULL,
+    `last_activity_at` TIMESTAMP NOT NULL,
+    `notified_at` TIMESTAMP NOT NULL
+);
+
+ALTER TABLE `cart_items` ADD INDEX `idx_cart_items_cart_id_updated_at` (`cart_id`, `updated_at`);
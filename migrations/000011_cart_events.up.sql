@@ -0,0 +1,14 @@
+-- append only history of every change made to a cart line, ids are time ordered uuid v7
+CREATE TABLE IF NOT EXISTS `cart_events` (
+    `id` VARCHAR(36) PRIMARY KEY,
+    `cart_id` VARCHAR(36) NOT NULL,
+    `user_id` VARCHAR(36) NOT NULL,
+    `item_id` VARCHAR(36) NOT NULL,
+    `event_type` VARCHAR(32) NOT NULL,
+    `actor` VARCHAR(64) NOT NULL,
+    `source` VARCHAR(16) NOT NULL,
+    `before_snapshot` JSON NULL,
+    `after_snapshot` JSON NULL,
+    `created_at` TIMESTAMP NOT NULL,
+    INDEX `idx_cart_events_user_id_id` (`user_id`, `id`)
+);
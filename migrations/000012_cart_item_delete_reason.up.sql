@@ -0,0 +1,8 @@
+-- why a line was soft deleted, only lines removed by the shopper can be restored.
+-- lines deleted before this migration keep a null reason and are not restorable
+ALTER TABLE `cart_items` ADD COLUMN `delete_reason` VARCHAR(16) NULL AFTER `deleted_at`;
+
+-- archived lines keep the reason they were deleted for
+ALTER TABLE `cart_items_archive` ADD COLUMN `delete_reason` VARCHAR(16) NULL AFTER `deleted_at`;
+
+ALTER TABLE `cart_items` ADD INDEX `idx_cart_items_user_id_deleted_at` (`user_id`, `deleted_at`);
@@ -0,0 +1,15 @@
+-- a user can keep several named carts, one of them is the default cart used when no cart is selected
+ALTER TABLE `carts`
+    ADD COLUMN `name` VARCHAR(64) NOT NULL DEFAULT 'default' AFTER `user_id`,
+    ADD UNIQUE KEY `uq_carts_user_id_name` (`user_id`, `name`),
+    DROP INDEX `uq_carts_user_id`;
+
+CREATE TABLE IF NOT EXISTS `user_default_carts` (
+    `user_id` VARCHAR(36) PRIMARY KEY,
+    `cart_id` VARCHAR(36) NOT NULL,
+    `updated_at` TIMESTAMP NOT NULL
+);
+
+-- every existing user has exactly one cart, it becomes the default
+INSERT INTO `user_default_carts` (`user_id`, `cart_id`, `updated_at`)
+SELECT `user_id`, `id`, `updated_at` FROM `carts`;
@@ -0,0 +1,15 @@
+-- every checkout attempt and the step it reached, so an attempt interrupted by a restart can be resumed
+CREATE TABLE IF NOT EXISTS `checkouts` (
+    `id` VARCHAR(36) PRIMARY KEY,
+    `user_id` VARCHAR(36) NOT NULL,
+    `cart_id` VARCHAR(36) NOT NULL,
+    `item_ids` JSON NOT NULL,
+    `address` JSON NOT NULL,
+    `state` VARCHAR(20) NOT NULL,
+    `order_id` VARCHAR(36) NULL,
+    `last_error` TEXT NULL,
+    `created_at` TIMESTAMP NOT NULL,
+    `updated_at` TIMESTAMP NOT NULL,
+    INDEX `idx_checkouts_state_updated_at` (`state`, `updated_at`),
+    INDEX `idx_checkouts_user_id` (`user_id`)
+);
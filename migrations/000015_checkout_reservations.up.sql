@@ -0,0 +1,6 @@
+-- the stock reserved in the inventory service for a checkout, released by the sweeper once expired
+ALTER TABLE `checkouts`
+    ADD COLUMN `reservation_id` VARCHAR(64) NULL AFTER `order_id`,
+    ADD COLUMN `reservation_state` VARCHAR(16) NULL AFTER `reservation_id`,
+    ADD COLUMN `reservation_expires_at` TIMESTAMP NULL AFTER `reservation_state`,
+    ADD INDEX `idx_checkouts_reservation_state_expires_at` (`reservation_state`, `reservation_expires_at`);
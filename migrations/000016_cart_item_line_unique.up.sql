@@ -0,0 +1,26 @@
+-- at most one active line per product, variant and options in a cart list. deleted lines and lines held by
+-- a checkout get a null key so they never conflict
+ALTER TABLE `cart_items`
+    ADD COLUMN `active_line` TINYINT GENERATED ALWAYS AS (IF(`deleted_at` IS NULL AND `list_type` <> 'checkout', 1, NULL)) STORED;
+
+-- concurrent adds could insert the same line twice, fold the duplicates into the oldest line first
+CREATE TEMPORARY TABLE `cart_items_duplicate_lines` AS
+SELECT `cart_id`, `list_type`, `product_id`, `variant_id`, `options_hash`, MIN(`id`) AS `keep_id`, SUM(`product_quantity`) AS `product_quantity`
+FROM `cart_items`
+WHERE `active_line` = 1
+GROUP BY `cart_id`, `list_type`, `product_id`, `variant_id`, `options_hash`
+HAVING COUNT(*) > 1;
+
+UPDATE `cart_items` c
+JOIN `cart_items_duplicate_lines` d ON c.`id` = d.`keep_id`
+SET c.`product_quantity` = d.`product_quantity`, c.`version` = c.`version` + 1;
+
+UPDATE `cart_items` c
+JOIN `cart_items_duplicate_lines` d ON c.`cart_id` = d.`cart_id` AND c.`list_type` = d.`list_type` AND c.`product_id` = d.`product_id`
+    AND c.`variant_id` = d.`variant_id` AND c.`options_hash` = d.`options_hash`
+SET c.`deleted_at` = CURRENT_TIMESTAMP, c.`delete_reason` = 'merged'
+WHERE c.`active_line` = 1 AND c.`id` <> d.`keep_id`;
+
+DROP TEMPORARY TABLE `cart_items_duplicate_lines`;
+
+ALTER TABLE `cart_items` ADD UNIQUE KEY `uq_cart_items_active_line` (`cart_id`, `list_type`, `product_id`, `variant_id`, `options_hash`, `active_line`);
@@ -0,0 +1,7 @@
+-- counts the cart changes of a user, the relay stores it with the cached cart so an older snapshot
+-- applied late never overwrites a newer one
+CREATE TABLE IF NOT EXISTS `cart_cache_versions` (
+    `user_id` VARCHAR(36) PRIMARY KEY,
+    `version` BIGINT NOT NULL,
+    `updated_at` TIMESTAMP NOT NULL
+);
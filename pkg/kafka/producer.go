@@ -0,0 +1,71 @@
+package kafka
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/confluentinc/confluent-kafka-go/kafka"
+	"github.com/idoyudha/eshop-cart/config"
+)
+
+const (
+	CartAbandonedTopic = "cart-abandoned"
+	flushTimeoutMs     = 5000
+)
+
+type ProducerServer struct {
+	Producer *kafka.Producer
+}
+
+func NewKafkaProducer(kafkaCfg config.Kafka) (*ProducerServer, error) {
+	p, err := kafka.NewProducer(&kafka.ConfigMap{
+		"bootstrap.servers":  kafkaCfg.Broker,
+		"acks":               "all",
+		"enable.idempotence": true,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to create producer: %v", err)
+	}
+
+	return &ProducerServer{
+		Producer: p,
+	}, nil
+}
+
+// Produce sends the message and waits for its delivery report until ctx is done. a message given up on
+// may still be delivered later, consumers must tolerate duplicates
+func (p *ProducerServer) Produce(ctx context.Context, topic string, key []byte, value []byte) error {
+	deliveryChan := make(chan kafka.Event, 1)
+
+	err := p.Producer.Produce(&kafka.Message{
+		TopicPartition: kafka.TopicPartition{Topic: &topic, Partition: kafka.PartitionAny},
+		Key:            key,
+		Value:          value,
+	}, deliveryChan)
+	if err != nil {
+		return fmt.Errorf("failed to produce message: %v", err)
+	}
+
+	// the channel is buffered so a late delivery report never blocks the producer
+	var event kafka.Event
+	select {
+	case <-ctx.Done():
+		return fmt.Errorf("failed to wait for delivery report: %w", ctx.Err())
+	case event = <-deliveryChan:
+	}
+
+	message, ok := event.(*kafka.Message)
+	if !ok {
+		return fmt.Errorf("unexpected delivery event: %v", event)
+	}
+	if message.TopicPartition.Error != nil {
+		return fmt.Errorf("failed to deliver message: %v", message.TopicPartition.Error)
+	}
+
+	return nil
+}
+
+func (p *ProducerServer) Close() {
+	p.Producer.Flush(flushTimeoutMs)
+	p.Producer.Close()
+}